@@ -0,0 +1,40 @@
+package app
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ericchiang/got/imports"
+)
+
+func addCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "add <package>[@version]",
+		Short: "Vendor a package's repo and pin it in the manifest.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("add takes exactly one argument")
+			}
+			pkg, version := args[0], ""
+			if i := strings.LastIndex(pkg, "@"); i >= 0 {
+				pkg, version = pkg[:i], pkg[i+1:]
+				if version == "" {
+					return errors.Errorf("no version after '@' in %s", args[0])
+				}
+			}
+
+			cacheDir, err := defaultCacheDir()
+			if err != nil {
+				return err
+			}
+			pin, err := imports.Add(".", cacheDir, pkg, version, resolverOpts, logger)
+			if err != nil {
+				return err
+			}
+			return writePins(os.Stdout, []imports.Pin{pin})
+		},
+	}
+}
@@ -3,16 +3,41 @@ package app
 
 import (
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+
+	"github.com/ericchiang/got/imports"
+	"github.com/ericchiang/got/log"
 )
 
 var errHelp = errors.New("help message printed")
 
+// logger is passed to the imports operations. It's set from the --verbose
+// and --quiet flags before any command runs.
+var logger = log.New(log.Info)
+
+// logOutput, if non-nil, is the --log-file logger writes to. It's closed once
+// the command is done.
+var logOutput io.Closer
+
+// resolverOpts configure how the imports operations resolve import paths.
+// They're set by the persistent flags of the root command.
+var resolverOpts imports.ResolverOptions
+
+// cacheDirFlag is the --cache-dir repos are cloned into, see defaultCacheDir.
+var cacheDirFlag string
+
 func Run() int {
-	if err := rootCmd().Execute(); err != nil {
+	err := rootCmd().Execute()
+	if logOutput != nil {
+		if cerr := logOutput.Close(); cerr != nil && err == nil {
+			err = errors.Wrap(cerr, "closing log file")
+		}
+	}
+	if err != nil {
 		if err != errHelp {
 			fmt.Fprintf(os.Stderr, "error: "+err.Error())
 		}
@@ -22,13 +47,93 @@ func Run() int {
 }
 
 func rootCmd() *cobra.Command {
+	var (
+		verbose, quiet bool
+		logFile        string
+		logMaxSize     int64
+		logKeep        int
+	)
 	cmd := &cobra.Command{
 		Use:   "got",
 		Short: "Got is a vendor directory manager.",
+		Long: `Got is a vendor directory manager.
+
+Flags of the root command can also be set through environment variables named
+after them, such as GOT_CACHE_DIR for --cache-dir, or in a YAML config file,
+got/config.yaml in the user config directory such as ~/.config, or .got.yaml
+in the project, the latter taking precedence. Flags take precedence over environment variables, which take
+precedence over config files.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			sources, err := applyConfig(cmd.Root().PersistentFlags(), configFiles(), os.Getenv)
+			if err != nil {
+				return err
+			}
+			flagSources = sources
+			level := log.Info
+			switch {
+			case verbose && quiet:
+				return errors.New("--verbose and --quiet can't be used together")
+			case verbose:
+				level = log.Debug
+			case quiet:
+				level = log.Silent
+			}
+			logger = log.New(level)
+			if logFile != "" {
+				f, err := log.NewRotatingFile(logFile, logMaxSize<<20, logKeep)
+				if err != nil {
+					return err
+				}
+				logger = log.NewWriter(level, f)
+				logOutput = f
+			}
+			if resolverOpts.Retries < 0 {
+				return errors.New("--retries can't be negative")
+			}
+			if resolverOpts.Timeout < 0 {
+				return errors.New("--http-timeout can't be negative")
+			}
+			return nil
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cmd.Help()
 			return nil
 		},
 	}
+	cmd.PersistentFlags().StringVar(&cacheDirFlag, "cache-dir", "", "Directory repos are cloned into. Defaults to \"got\" in the user cache directory.")
+	cmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Log debug messages, such as the requests made and the files copied.")
+	cmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Don't log anything, not even errors.")
+	cmd.PersistentFlags().StringVar(&logFile, "log-file", "", "Append log messages to this file rather than writing them to stderr.")
+	cmd.PersistentFlags().Int64Var(&logMaxSize, "log-max-size", 10, "Rotate --log-file once it grows past this many MiB. Zero means never rotate.")
+	cmd.PersistentFlags().IntVar(&logKeep, "log-keep", 3, "Number of rotated log files to keep.")
+	cmd.PersistentFlags().DurationVar(&resolverOpts.Timeout, "http-timeout", 0, "Fail HTTP requests that take longer than this, independently of the operation as a whole. Zero means no limit.")
+	cmd.PersistentFlags().BoolVar(&resolverOpts.GuessRoots, "guess-roots", false, "For hosts without a go-get endpoint, assume the first two path elements after the host are a git repo, github style, if it exists.")
+	cmd.PersistentFlags().StringSliceVar(&resolverOpts.MetaNames, "meta-name", nil, "Also accept meta tags with this name in place of 'go-import', for legacy servers. Can be repeated.")
+	cmd.PersistentFlags().StringVar(&resolverOpts.ResponsesDir, "responses-dir", "", "Directory of stored go-get responses, one \"<root>.html\" file per repo root, to use before making any requests.")
+	cmd.PersistentFlags().StringArrayVar(&resolverOpts.Overrides, "repo-override", nil, "Force the repo of packages below a root, given as \"<root> <vcs> <remote>\", e.g. \"example.com/foo git https://mirror.example.com/foo\". Can be repeated.")
+	cmd.PersistentFlags().StringSliceVar(&resolverOpts.InsecureHosts, "insecure-host", nil, "Allow go-get responses from this host to point at remotes that don't use a secure transport, such as plain HTTP. Can be repeated.")
+	cmd.PersistentFlags().StringSliceVar(&resolverOpts.HTTPFirstHosts, "http-first-host", nil, "Resolve packages of this host using its go-get endpoint, rather than matching them against the patterns of known hosts first. Can be repeated.")
+	cmd.PersistentFlags().IntVar(&resolverOpts.Retries, "retries", imports.DefaultRetries, "Retry network operations that fail with a network or server error this many times.")
+	cmd.AddCommand(
+		addCmd(),
+		cacheCmd(),
+		configCmd(),
+		explainCmd(),
+		forksCmd(),
+		gomodCmd(),
+		importsCmd(),
+		initCmd(),
+		listCmd(),
+		migrateCmd(),
+		overlayCmd(),
+		pruneCmd(),
+		requirementsCmd(),
+		resolveCmd(),
+		selftestCmd(),
+		statusCmd(),
+		updateCmd(),
+		vendorCmd(),
+		verifyCmd(),
+	)
 	return cmd
 }
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ericchiang/got/imports"
+)
+
+func cacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Inspect the cache of cloned repos.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.Help()
+			return nil
+		},
+	}
+	cmd.AddCommand(cacheListCmd())
+	return cmd
+}
+
+func cacheListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List cached repos with their size and when they were last used, largest first.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return errors.New("list takes no arguments")
+			}
+			cacheDir, err := defaultCacheDir()
+			if err != nil {
+				return err
+			}
+			entries, err := imports.ListCache(cacheDir)
+			if err != nil {
+				return err
+			}
+			return writeCacheEntries(os.Stdout, entries)
+		},
+	}
+}
+
+func writeCacheEntries(w io.Writer, entries []imports.CacheEntry) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPO\tSIZE\tLAST ACCESS")
+	for _, e := range entries {
+		name := e.Remote
+		if name == "" {
+			name = e.Key
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", name, formatSize(e.Size), e.LastAccess.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+// formatSize formats a number of bytes using binary units, e.g. "1.5MiB".
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
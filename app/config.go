@@ -0,0 +1,223 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+func configCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "config",
+		Short: "Print the value of each flag of the root command after applying the environment and config files, and where it came from.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return errors.New("config takes no arguments")
+			}
+			cacheDir, err := defaultCacheDir()
+			if err != nil {
+				return err
+			}
+			settings := effectiveConfig(cmd.Root().PersistentFlags(), flagSources)
+			for i := range settings {
+				if settings[i].Name == "cache-dir" {
+					settings[i].Value = cacheDir
+				}
+			}
+			return writeConfig(os.Stdout, settings)
+		},
+	}
+}
+
+// setting is the effective value of a flag.
+type setting struct {
+	Name   string
+	Value  string
+	Source flagSource
+}
+
+// effectiveConfig returns the value of every flag, sorted by name, along with
+// where it came from, see applyConfig.
+func effectiveConfig(flags *pflag.FlagSet, sources map[string]flagSource) []setting {
+	var settings []setting
+	flags.VisitAll(func(f *pflag.Flag) {
+		source, ok := sources[f.Name]
+		if !ok {
+			source = flagSource{Kind: sourceDefault}
+		}
+		settings = append(settings, setting{f.Name, f.Value.String(), source})
+	})
+	return settings
+}
+
+func writeConfig(w io.Writer, settings []setting) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tVALUE\tSOURCE")
+	for _, s := range settings {
+		source := s.Source.Kind
+		if s.Source.Name != "" {
+			source += " (" + s.Source.Name + ")"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Name, s.Value, source)
+	}
+	return tw.Flush()
+}
+
+// config is the contents of a config file. Each key is the name of a flag of
+// the root command, whose default the value replaces. Lists replace the
+// default list rather than extending it, e.g.
+//
+//	cache-dir: /var/cache/got
+//	retries: 5
+//	insecure-host:
+//	- git.internal.example.com
+//	repo-override:
+//	- example.com/foo git https://mirror.example.com/foo
+type config struct {
+	CacheDir       *string  `yaml:"cache-dir"`
+	GuessRoots     *bool    `yaml:"guess-roots"`
+	HTTPFirstHosts []string `yaml:"http-first-host"`
+	HTTPTimeout    *string  `yaml:"http-timeout"`
+	InsecureHosts  []string `yaml:"insecure-host"`
+	LogFile        *string  `yaml:"log-file"`
+	LogKeep        *int     `yaml:"log-keep"`
+	LogMaxSize     *int64   `yaml:"log-max-size"`
+	MetaNames      []string `yaml:"meta-name"`
+	RepoOverrides  []string `yaml:"repo-override"`
+	ResponsesDir   *string  `yaml:"responses-dir"`
+	Retries        *int     `yaml:"retries"`
+}
+
+// values returns the values of the flags set by the config, keyed by flag
+// name, in the form they're passed on the command line.
+func (c *config) values() map[string][]string {
+	values := map[string][]string{}
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Tag.Get("yaml")
+		switch f := v.Field(i); f.Kind() {
+		case reflect.Ptr:
+			if !f.IsNil() {
+				values[name] = []string{fmt.Sprint(f.Elem().Interface())}
+			}
+		case reflect.Slice:
+			if !f.IsNil() {
+				values[name] = []string{}
+			}
+			for j := 0; j < f.Len(); j++ {
+				values[name] = append(values[name], f.Index(j).String())
+			}
+		}
+	}
+	return values
+}
+
+// configFiles returns the config files got reads, lowest precedence first:
+// the user's config, "got/config.yaml" in the user config directory such as
+// ~/.config, followed by ".got.yaml" in the project.
+func configFiles() []string {
+	var files []string
+	if dir, err := os.UserConfigDir(); err == nil {
+		files = append(files, filepath.Join(dir, "got", "config.yaml"))
+	}
+	return append(files, ".got.yaml")
+}
+
+// Sources of flag values, see applyConfig.
+const (
+	sourceDefault = "default"
+	sourceFlag    = "flag"
+	sourceEnv     = "env"
+	sourceConfig  = "config"
+)
+
+// flagSources records where the value of each flag of the root command came
+// from, keyed by flag name, see applyConfig.
+var flagSources map[string]flagSource
+
+// flagSource is where the value of a flag came from.
+type flagSource struct {
+	// Kind is one of sourceDefault, sourceFlag, sourceEnv or sourceConfig.
+	Kind string
+	// Name is the environment variable or config file the value was read
+	// from, if any.
+	Name string
+}
+
+// envVar returns the environment variable that sets a flag, such as
+// GOT_CACHE_DIR for --cache-dir.
+func envVar(flag string) string {
+	return "GOT_" + strings.ToUpper(strings.Replace(flag, "-", "_", -1))
+}
+
+// applyConfig sets the flags that weren't given on the command line from the
+// environment, or from the config files, later files taking precedence. The
+// precedence is flag > env > config > default. Environment variables are
+// named after their flag, see envVar, and list flags accept comma separated
+// values in them like they do on the command line. Where each flag's value
+// came from is returned.
+func applyConfig(flags *pflag.FlagSet, files []string, getenv func(string) string) (map[string]flagSource, error) {
+	values := map[string][]string{}
+	from := map[string]string{}
+	for _, filename := range files {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, errors.Wrap(err, "reading config")
+		}
+		var c config
+		if err := yaml.UnmarshalStrict(data, &c); err != nil {
+			return nil, errors.Wrapf(err, "parsing config %s", filename)
+		}
+		for name, v := range c.values() {
+			values[name] = v
+			from[name] = filename
+		}
+	}
+
+	sources := map[string]flagSource{}
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if err != nil {
+			return
+		}
+		switch env := envVar(f.Name); {
+		case f.Changed:
+			sources[f.Name] = flagSource{Kind: sourceFlag}
+		case getenv(env) != "":
+			sources[f.Name] = flagSource{Kind: sourceEnv, Name: env}
+			if serr := f.Value.Set(getenv(env)); serr != nil {
+				err = errors.Wrapf(serr, "invalid value for %s", env)
+			}
+		case from[f.Name] != "":
+			sources[f.Name] = flagSource{Kind: sourceConfig, Name: from[f.Name]}
+			var serr error
+			if s, ok := f.Value.(pflag.SliceValue); ok {
+				serr = s.Replace(values[f.Name])
+			} else {
+				serr = f.Value.Set(values[f.Name][0])
+			}
+			if serr != nil {
+				err = errors.Wrapf(serr, "invalid %s in config %s", f.Name, from[f.Name])
+			}
+		default:
+			sources[f.Name] = flagSource{Kind: sourceDefault}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sources, nil
+}
@@ -0,0 +1,193 @@
+package app
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+func TestApplyConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	user, project := filepath.Join(dir, "config.yaml"), filepath.Join(dir, ".got.yaml")
+	files := map[string]string{
+		user: `cache-dir: /user/cache
+retries: 5
+http-timeout: 30s
+insecure-host:
+- user.example.com
+guess-roots: true
+`,
+		project: `retries: 7
+meta-name: [go-source]
+`,
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		cacheDir, responsesDir    string
+		retries                   int
+		timeout                   time.Duration
+		guessRoots                bool
+		insecureHosts, metaNames  []string
+		httpFirstHosts, overrides []string
+	)
+	flags := pflag.NewFlagSet("got", pflag.ContinueOnError)
+	flags.StringVar(&cacheDir, "cache-dir", "", "")
+	flags.StringVar(&responsesDir, "responses-dir", "", "")
+	flags.IntVar(&retries, "retries", 3, "")
+	flags.DurationVar(&timeout, "http-timeout", 0, "")
+	flags.BoolVar(&guessRoots, "guess-roots", false, "")
+	flags.StringSliceVar(&insecureHosts, "insecure-host", nil, "")
+	flags.StringSliceVar(&metaNames, "meta-name", []string{"go-import"}, "")
+	flags.StringSliceVar(&httpFirstHosts, "http-first-host", nil, "")
+	flags.StringArrayVar(&overrides, "repo-override", nil, "")
+	if err := flags.Parse([]string{"--http-timeout=1m"}); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{
+		"GOT_CACHE_DIR":       "/env/cache",
+		"GOT_HTTP_FIRST_HOST": "a.example.com,b.example.com",
+		"GOT_HTTP_TIMEOUT":    "10s",
+	}
+	sources, err := applyConfig(flags, []string{filepath.Join(dir, "missing.yaml"), user, project}, func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The flag beats the environment, which beats the config files, of which
+	// the project's beats the user's.
+	if timeout != time.Minute {
+		t.Errorf("expected --http-timeout from the flag, got %s", timeout)
+	}
+	if cacheDir != "/env/cache" {
+		t.Errorf("expected --cache-dir from the environment, got %q", cacheDir)
+	}
+	if want := []string{"a.example.com", "b.example.com"}; !reflect.DeepEqual(httpFirstHosts, want) {
+		t.Errorf("expected --http-first-host %q, got %q", want, httpFirstHosts)
+	}
+	if retries != 7 {
+		t.Errorf("expected --retries from the project config, got %d", retries)
+	}
+	if !guessRoots {
+		t.Errorf("expected --guess-roots from the user config")
+	}
+	if want := []string{"user.example.com"}; !reflect.DeepEqual(insecureHosts, want) {
+		t.Errorf("expected --insecure-host %q, got %q", want, insecureHosts)
+	}
+	// Lists from a config replace the default.
+	if want := []string{"go-source"}; !reflect.DeepEqual(metaNames, want) {
+		t.Errorf("expected --meta-name %q, got %q", want, metaNames)
+	}
+	if responsesDir != "" || overrides != nil {
+		t.Errorf("expected unset flags to keep their defaults, got %q and %q", responsesDir, overrides)
+	}
+
+	wantSources := map[string]flagSource{
+		"cache-dir":       {Kind: sourceEnv, Name: "GOT_CACHE_DIR"},
+		"guess-roots":     {Kind: sourceConfig, Name: user},
+		"http-first-host": {Kind: sourceEnv, Name: "GOT_HTTP_FIRST_HOST"},
+		"http-timeout":    {Kind: sourceFlag},
+		"insecure-host":   {Kind: sourceConfig, Name: user},
+		"meta-name":       {Kind: sourceConfig, Name: project},
+		"repo-override":   {Kind: sourceDefault},
+		"responses-dir":   {Kind: sourceDefault},
+		"retries":         {Kind: sourceConfig, Name: project},
+	}
+	if !reflect.DeepEqual(sources, wantSources) {
+		t.Errorf("expected sources %v, got %v", wantSources, sources)
+	}
+}
+
+func TestApplyConfigErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name   string
+		config string
+		env    map[string]string
+		want   string
+	}{
+		{"unknown key", "cache-directory: /tmp\n", nil, "parsing config"},
+		{"bad type", "retries: lots\n", nil, "parsing config"},
+		{"bad value", "http-timeout: soon\n", nil, "invalid http-timeout in config"},
+		{"bad env", "", map[string]string{"GOT_RETRIES": "lots"}, "invalid value for GOT_RETRIES"},
+	}
+	for _, test := range tests {
+		filename := filepath.Join(dir, "config.yaml")
+		if err := ioutil.WriteFile(filename, []byte(test.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		flags := pflag.NewFlagSet("got", pflag.ContinueOnError)
+		flags.Int("retries", 3, "")
+		flags.Duration("http-timeout", 0, "")
+		_, err := applyConfig(flags, []string{filename}, func(k string) string { return test.env[k] })
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: expected error containing %q, got %v", test.name, test.want, err)
+		}
+	}
+}
+
+func TestWriteConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(filename, []byte("insecure-host: [a.example.com, b.example.com]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	flags := pflag.NewFlagSet("got", pflag.ContinueOnError)
+	flags.StringSlice("insecure-host", nil, "")
+	flags.String("log-file", "", "")
+	flags.Int("retries", 3, "")
+	flags.Bool("verbose", false, "")
+	if err := flags.Parse([]string{"--verbose"}); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{"GOT_LOG_FILE": "/tmp/got.log"}
+	sources, err := applyConfig(flags, []string{filename}, func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeConfig(&buf, effectiveConfig(flags, sources)); err != nil {
+		t.Fatal(err)
+	}
+	var got [][]string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		got = append(got, strings.Fields(line))
+	}
+	want := [][]string{
+		{"NAME", "VALUE", "SOURCE"},
+		{"insecure-host", "[a.example.com,b.example.com]", "config", "(" + filename + ")"},
+		{"log-file", "/tmp/got.log", "env", "(GOT_LOG_FILE)"},
+		{"retries", "3", "default"},
+		{"verbose", "true", "flag"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected config %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,23 @@
+package app
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ericchiang/got/imports"
+)
+
+func explainCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "explain <importpath>",
+		Short: "Print each step taken to resolve the repo of an import path.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("explain takes exactly one argument")
+			}
+			return imports.Explain(os.Stdout, args[0], resolverOpts)
+		},
+	}
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ericchiang/got/imports"
+)
+
+func forksCmd() *cobra.Command {
+	var compare, check bool
+	cmd := &cobra.Command{
+		Use:   "forks",
+		Short: "List pinned repos fetched from a fork or mirror rather than the remote their import path resolves to.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return errors.New("forks takes no arguments")
+			}
+			cacheDir, err := defaultCacheDir()
+			if err != nil {
+				return err
+			}
+			if check && !compare {
+				return errors.New("--check requires --compare")
+			}
+			forks, err := imports.Forks(".", cacheDir, compare, resolverOpts, logger)
+			if err != nil {
+				return err
+			}
+			if err := writeForks(os.Stdout, forks); err != nil {
+				return err
+			}
+			if check {
+				for _, f := range forks {
+					if f.Diverged() {
+						return errors.New("forks differ from their upstream repos")
+					}
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&compare, "compare", false, "Fetch each fork and its upstream repo, and compare their files at the pinned version.")
+	cmd.Flags().BoolVar(&check, "check", false, "Exit with a non-zero status if any fork differs from its upstream repo. Requires --compare.")
+	return cmd
+}
+
+func writeForks(w io.Writer, forks []imports.Fork) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROOT\tREMOTE\tUPSTREAM\tVERSION\tUPSTREAM CONTENTS")
+	for _, f := range forks {
+		contents := "not compared"
+		switch {
+		case f.Diverged() && f.UpstreamHash == "":
+			contents = "version missing"
+		case f.Diverged():
+			contents = "differ"
+		case f.Compared:
+			contents = "identical"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", f.Root, f.Remote, f.Upstream, f.Version, contents)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,27 @@
+package app
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ericchiang/got/imports"
+)
+
+func gomodCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "gomod",
+		Short: "Print a go.mod fragment requiring the pinned revisions, to help migrate to modules.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return errors.New("gomod takes no arguments")
+			}
+			cacheDir, err := defaultCacheDir()
+			if err != nil {
+				return err
+			}
+			return imports.ExportGoMod(os.Stdout, ".", cacheDir, resolverOpts, logger)
+		},
+	}
+}
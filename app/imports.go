@@ -0,0 +1,65 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ericchiang/got/imports"
+)
+
+func importsCmd() *cobra.Command {
+	var jsonOutput bool
+	cmd := &cobra.Command{
+		Use:   "imports [dir]",
+		Short: "List a project's imports split into standard library, vendored and missing packages.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			switch len(args) {
+			case 0:
+			case 1:
+				dir = args[0]
+			default:
+				return errors.New("imports takes at most one argument")
+			}
+
+			r, err := imports.Imports(dir)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				e := json.NewEncoder(os.Stdout)
+				e.SetIndent("", "  ")
+				return e.Encode(r)
+			}
+			writeImportReport(os.Stdout, r)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print results as JSON.")
+	return cmd
+}
+
+func writeImportReport(w io.Writer, r *imports.ImportReport) {
+	sections := []struct {
+		name     string
+		packages []string
+	}{
+		{"standard library", r.Std},
+		{"vendored", r.Vendored},
+		{"missing", r.Missing},
+	}
+	for i, s := range sections {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s (%d):\n", s.name, len(s.packages))
+		for _, pkg := range s.packages {
+			fmt.Fprintf(w, "  %s\n", pkg)
+		}
+	}
+}
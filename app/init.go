@@ -0,0 +1,65 @@
+package app
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ericchiang/got/imports"
+)
+
+func initCmd() *cobra.Command {
+	var (
+		force    bool
+		progress bool
+		pkg      string
+	)
+	cmd := &cobra.Command{
+		Use:   "init [dir]",
+		Short: "Write a manifest pinning each imported repo to the latest revision of its default branch.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			switch len(args) {
+			case 0:
+			case 1:
+				dir = args[0]
+			default:
+				return errors.New("init takes at most one argument")
+			}
+
+			cacheDir, err := defaultCacheDir()
+			if err != nil {
+				return err
+			}
+			var w io.Writer
+			if progress {
+				w = os.Stderr
+			}
+			pins, err := imports.Init(dir, cacheDir, pkg, force, w, resolverOpts, logger)
+			if err != nil {
+				return err
+			}
+			return writePins(os.Stdout, pins)
+		},
+	}
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite an existing manifest.")
+	cmd.Flags().StringVar(&pkg, "package", "", "Only pin the repos needed by the package in this directory of the project, such as cmd/server, and the project's packages it imports.")
+	cmd.Flags().BoolVar(&progress, "progress", false, "Print a single line summarizing the progress of all clones to stderr.")
+	return cmd
+}
+
+// defaultCacheDir returns the directory repos are cloned into, --cache-dir if
+// it's set.
+func defaultCacheDir() (string, error) {
+	if cacheDirFlag != "" {
+		return cacheDirFlag, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.Wrap(err, "determining cache directory")
+	}
+	return filepath.Join(dir, "got"), nil
+}
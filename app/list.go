@@ -0,0 +1,71 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ericchiang/got/imports"
+)
+
+func listCmd() *cobra.Command {
+	var (
+		jsonOutput bool
+		outdated   bool
+	)
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "Print the repos pinned by the manifest and the revisions they're pinned to.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return errors.New("list takes no arguments")
+			}
+			if !outdated {
+				pins, err := imports.List(".")
+				if err != nil {
+					return err
+				}
+				if jsonOutput {
+					return writePinsJSON(os.Stdout, pins)
+				}
+				return writePins(os.Stdout, pins)
+			}
+
+			cacheDir, err := defaultCacheDir()
+			if err != nil {
+				return err
+			}
+			statuses, err := imports.Outdated(".", cacheDir, resolverOpts)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				e := json.NewEncoder(os.Stdout)
+				e.SetIndent("", "  ")
+				return e.Encode(statuses)
+			}
+			return writePinStatuses(os.Stdout, statuses)
+		},
+	}
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print results as JSON.")
+	cmd.Flags().BoolVar(&outdated, "outdated", false, "Fetch each repo and flag pins behind the latest revision of its default branch.")
+	return cmd
+}
+
+func writePinStatuses(w io.Writer, statuses []imports.PinStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROOT\tREMOTE\tVCS\tVERSION\tLATEST\tSTATUS")
+	for _, s := range statuses {
+		status := "current"
+		if s.Outdated {
+			status = "outdated"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", s.Root, s.Remote, s.VCS, s.Version, s.Latest, status)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ericchiang/got/imports"
+)
+
+func migrateCmd() *cobra.Command {
+	var opts imports.MigrateOptions
+	cmd := &cobra.Command{
+		Use:   "migrate [manifest]",
+		Short: "Convert a manifest into another format, by default a Godeps, glide, dep or govendor manifest into got.json, detecting it if none is given.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch len(args) {
+			case 0:
+			case 1:
+				opts.Manifest = args[0]
+			default:
+				return errors.New("migrate takes at most one argument")
+			}
+
+			cacheDir, err := defaultCacheDir()
+			if err != nil {
+				return err
+			}
+			pins, err := imports.Migrate(".", cacheDir, opts, resolverOpts, logger)
+			if err != nil {
+				return err
+			}
+			return writePins(os.Stdout, pins)
+		},
+	}
+	cmd.Flags().StringVar(&opts.To, "to", "native", "Format to convert to, one of: "+strings.Join(imports.MigrateFormats, ", ")+". Anything the format can't represent is reported.")
+	cmd.Flags().BoolVar(&opts.Force, "force", false, "Overwrite an existing manifest of the target format.")
+	return cmd
+}
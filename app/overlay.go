@@ -0,0 +1,43 @@
+package app
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ericchiang/got/imports"
+)
+
+func overlayCmd() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "overlay",
+		Short: "Write a go build -overlay file mapping the repos pinned by the manifest to cached copies, instead of vendoring them.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return errors.New("overlay takes no arguments")
+			}
+			cacheDir, err := defaultCacheDir()
+			if err != nil {
+				return err
+			}
+
+			// Progress is logged to stderr, so stdout only holds the overlay.
+			if output == "" {
+				return imports.Overlay(os.Stdout, ".", cacheDir, resolverOpts, logger)
+			}
+			f, err := os.Create(output)
+			if err != nil {
+				return errors.Wrap(err, "creating overlay file")
+			}
+			if err := imports.Overlay(f, ".", cacheDir, resolverOpts, logger); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "", "File to write the overlay to. Defaults to stdout.")
+	return cmd
+}
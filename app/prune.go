@@ -0,0 +1,22 @@
+package app
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ericchiang/got/imports"
+)
+
+func pruneCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "prune",
+		Short: "Remove vendored packages the project no longer imports, directly or indirectly.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return errors.New("prune takes no arguments")
+			}
+			_, err := imports.Prune(".", logger)
+			return err
+		},
+	}
+}
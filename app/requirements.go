@@ -0,0 +1,23 @@
+package app
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ericchiang/got/imports"
+)
+
+func requirementsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "requirements",
+		Short: "Print a tab separated line with the revision and tree hash of each vendored repo, sorted by import path.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return errors.New("requirements takes no arguments")
+			}
+			return imports.ExportRequirements(os.Stdout, ".")
+		},
+	}
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ericchiang/got/imports"
+)
+
+func resolveCmd() *cobra.Command {
+	var (
+		jsonOutput    bool
+		replaceLayout string
+	)
+	cmd := &cobra.Command{
+		Use:   "resolve [manifest]",
+		Short: "Print the repo of each package pinned by a manifest without downloading any code.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filename := "Godeps/Godeps.json"
+			switch len(args) {
+			case 0:
+			case 1:
+				filename = args[0]
+			default:
+				return errors.New("resolve takes at most one argument")
+			}
+
+			pins, err := imports.Resolve(filename, replaceLayout, resolverOpts, logger)
+			if rerr, ok := errors.Cause(err).(*imports.ResolveError); ok && jsonOutput {
+				if err := writeFailuresJSON(os.Stdout, rerr.Failures); err != nil {
+					return err
+				}
+				return errors.Errorf("failed to resolve %d packages", len(rerr.Failures))
+			}
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return writePinsJSON(os.Stdout, pins)
+			}
+			return writePins(os.Stdout, pins)
+		},
+	}
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print results as JSON. If packages fail to resolve, each is listed with the category of its error instead: network, not-found, no-go-import, auth or other.")
+	cmd.Flags().StringVar(&replaceLayout, "gomod-replace-layout", "target", "Where go.mod replacements with a newer major version of the same module are vendored: \"target\", at the replacement's module path, or \"original\", at the replaced module's path.")
+	return cmd
+}
+
+func writePins(w io.Writer, pins []imports.Pin) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROOT\tREMOTE\tVCS\tVERSION")
+	for _, p := range pins {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", p.Root, p.Remote, p.VCS, p.Version)
+	}
+	return tw.Flush()
+}
+
+func writePinsJSON(w io.Writer, pins []imports.Pin) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(pins)
+}
+
+// writeFailuresJSON prints packages that failed to resolve as a JSON object,
+// for tools annotating CI runs.
+func writeFailuresJSON(w io.Writer, failures []imports.ResolveFailure) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(struct {
+		Failures []imports.ResolveFailure `json:"failures"`
+	}{failures})
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ericchiang/got/imports"
+)
+
+func selftestCmd() *cobra.Command {
+	var (
+		network   bool
+		responses string
+	)
+	cmd := &cobra.Command{
+		Use:   "selftest [package]",
+		Short: "Check that got works by vendoring a small package into a temporary directory.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pkg := "github.com/pkg/errors"
+			switch len(args) {
+			case 0:
+			case 1:
+				pkg = args[0]
+			default:
+				return errors.New("selftest takes at most one argument")
+			}
+			if !network {
+				return errors.Errorf("selftest fetches %s over the network, pass --network to run it", pkg)
+			}
+
+			cacheDir, err := defaultCacheDir()
+			if err != nil {
+				return err
+			}
+			if err := imports.SelfTest(cacheDir, pkg, responses); err != nil {
+				return errors.Wrap(err, "selftest failed")
+			}
+			fmt.Printf("selftest passed: vendored %s\n", pkg)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&network, "network", false, "Allow network access.")
+	cmd.Flags().StringVar(&responses, "responses", "", "Directory of stored go-get responses to use before making requests, for example to point at a local server.")
+	return cmd
+}
@@ -0,0 +1,68 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ericchiang/got/imports"
+)
+
+func statusCmd() *cobra.Command {
+	var check bool
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Compare the vendor directory to the repos pinned by the manifest, reporting added, modified and removed files, and repos that don't vendor reproducibly.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return errors.New("status takes no arguments")
+			}
+			cacheDir, err := defaultCacheDir()
+			if err != nil {
+				return err
+			}
+			drifts, err := imports.Status(".", cacheDir, resolverOpts, logger)
+			if err != nil {
+				return err
+			}
+			if !writeDrifts(os.Stdout, drifts) && check {
+				return errors.New("vendor directory doesn't match the manifest")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&check, "check", false, "Exit with a non-zero status if any repo drifted or couldn't be reproduced.")
+	return cmd
+}
+
+// writeDrifts prints the files of every drifted repo, and the hashes of repos
+// that couldn't be reproduced, reporting whether all repos were clean.
+func writeDrifts(w io.Writer, drifts []imports.Drift) bool {
+	clean := true
+	for _, d := range drifts {
+		if d.Clean() && d.Reproducible() {
+			continue
+		}
+		clean = false
+		fmt.Fprintf(w, "%s:\n", d.Root)
+		if !d.Reproducible() {
+			fmt.Fprintf(w, "\tnot reproducible: vendored again as %s, manifest records %s\n", d.Hash, d.RecordedHash)
+		}
+		for _, f := range d.Added {
+			fmt.Fprintf(w, "\tadded:    %s\n", f)
+		}
+		for _, f := range d.Modified {
+			fmt.Fprintf(w, "\tmodified: %s\n", f)
+		}
+		for _, f := range d.Removed {
+			fmt.Fprintf(w, "\tremoved:  %s\n", f)
+		}
+	}
+	if clean {
+		fmt.Fprintln(w, "vendor directory matches the manifest")
+	}
+	return clean
+}
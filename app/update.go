@@ -0,0 +1,46 @@
+package app
+
+import (
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ericchiang/got/imports"
+)
+
+func updateCmd() *cobra.Command {
+	var (
+		progress bool
+		gopath   string
+	)
+	cmd := &cobra.Command{
+		Use:   "update [root]",
+		Short: "Re-pin repos in the manifest to the latest revision of their default branch, pinned branch, or highest tag within their version constraint, and re-vendor them.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root := ""
+			switch len(args) {
+			case 0:
+			case 1:
+				root = args[0]
+			default:
+				return errors.New("update takes at most one argument")
+			}
+
+			cacheDir, err := defaultCacheDir()
+			if err != nil {
+				return err
+			}
+			var w io.Writer
+			if progress {
+				w = os.Stderr
+			}
+			_, err = imports.Update(".", cacheDir, root, gopath, w, resolverOpts, logger)
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&gopath, "gopath", "", "Copy repos from checkouts in this GOPATH that are already at the new revision, rather than cloning them.")
+	cmd.Flags().BoolVar(&progress, "progress", false, "Print a single line summarizing the progress of all clones to stderr.")
+	return cmd
+}
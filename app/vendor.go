@@ -0,0 +1,40 @@
+package app
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ericchiang/got/imports"
+)
+
+func vendorCmd() *cobra.Command {
+	var (
+		opts    imports.VendorOptions
+		maxSize int64
+	)
+	cmd := &cobra.Command{
+		Use:   "vendor",
+		Short: "Copy the repos pinned by the manifest into the vendor directory, completing missing or partial copies.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return errors.New("vendor takes no arguments")
+			}
+			cacheDir, err := defaultCacheDir()
+			if err != nil {
+				return err
+			}
+			opts.Limits.MaxSize = maxSize << 20
+			_, err = imports.Vendor(".", cacheDir, opts, resolverOpts, logger)
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&opts.GOPATH, "gopath", "", "Copy repos from checkouts in this GOPATH that are already at the pinned revision, rather than cloning them.")
+	cmd.Flags().BoolVar(&opts.Preflight, "preflight", false, "Check that every repo to fetch is reachable before fetching any, reporting all unreachable repos at once.")
+	cmd.Flags().StringVar(&opts.Manifest, "manifest", "", "Re-pin repos from this manifest, such as Godeps/Godeps.json, before vendoring. Repos already pinned in got.json aren't looked up again, and are only vendored again if their version changed.")
+	cmd.Flags().BoolVar(&opts.Frozen, "frozen", false, "Vendor repos at the revisions recorded in the manifest from the cache only, failing rather than fetching anything.")
+	cmd.Flags().BoolVar(&opts.SkipExisting, "skip-existing", false, "Leave vendored repos alone if they have the files recorded in the manifest, without checking their contents.")
+	cmd.Flags().DurationVar(&opts.Limits.Timeout, "max-clone-time", 0, "Skip repos that take longer than this to clone, reporting them at the end. Zero means no limit.")
+	cmd.Flags().Int64Var(&maxSize, "max-repo-size", 0, "Skip repos larger than this many MiB, reporting them at the end. Zero means no limit.")
+	cmd.Flags().BoolVar(&opts.Limits.Strict, "strict", false, "Fail when a repo exceeds --max-clone-time or --max-repo-size, rather than skipping it.")
+	return cmd
+}
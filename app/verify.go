@@ -0,0 +1,34 @@
+package app
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ericchiang/got/imports"
+)
+
+func verifyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify",
+		Short: "Check the vendor directory against the files and tree hashes recorded in the manifest, without fetching anything.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return errors.New("verify takes no arguments")
+			}
+			mismatched, err := imports.Verify(".")
+			if err != nil {
+				return err
+			}
+			for _, root := range mismatched {
+				fmt.Fprintf(os.Stdout, "%s: vendored copy doesn't match the manifest\n", root)
+			}
+			if len(mismatched) > 0 {
+				return errors.Errorf("%d vendored repos don't match the manifest, vendor them again", len(mismatched))
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,212 @@
+package imports
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/ericchiang/got/log"
+)
+
+// Add vendors the repo of pkg at version into the project in dir and pins it
+// in the project's manifest. If version is empty, the latest revision of the
+// repo's default branch is used. Adding a package from a repo that's already
+// pinned, such as a subpackage, replaces the existing pin rather than adding
+// another one. It fails, leaving the project as it was, if the repo has no
+// directory for pkg.
+func Add(dir, cacheDir, pkg, version string, resolverOpts ResolverOptions, logger log.Logger) (Pin, error) {
+	c, err := newCache(cacheDir)
+	if err != nil {
+		return Pin{}, err
+	}
+	r, err := loggingResolver(resolverOpts, logger)
+	if err != nil {
+		return Pin{}, err
+	}
+	opts := getOptions{logger: logger, retry: resolverOpts.retryPolicy(), proxy: proxyFromEnv(), resolver: r}
+	return addPackage(context.Background(), r, c, dir, pkg, version, opts)
+}
+
+func addPackage(ctx context.Context, r pkgResolver, c *cache, dir, pkg, version string, opts getOptions) (Pin, error) {
+	filename := filepath.Join(dir, ManifestFile)
+	m, err := readManifestFile(filename)
+	if err != nil {
+		return Pin{}, err
+	}
+	pins := m.Packages
+	m.configure(&opts)
+
+	meta, err := r.resolve(ctx, pkg)
+	if err != nil {
+		return Pin{}, errors.Wrapf(err, "lookup metatags for package %s", pkg)
+	}
+	subdir, ok := repoSubdir(meta, pkg)
+	if !ok {
+		return Pin{}, errors.Errorf("package %s isn't below the root %s of its repo", pkg, meta.Root)
+	}
+	if version == "" {
+		if version, err = headVersion(ctx, c, meta, opts.retry); err != nil {
+			return Pin{}, errors.Wrapf(err, "determining latest revision of %s", meta.Root)
+		}
+	}
+
+	roots := pinRoots(filepath.Join(dir, "vendor"), pins)
+	roots[vendorPath(filepath.Join(dir, "vendor"), meta)] = true
+	vendored, err := revendor(ctx, c, dir, meta, version, roots, opts)
+	if err != nil {
+		return Pin{}, err
+	}
+	if subdir != "" {
+		// The whole repo is vendored at its root, so the package ends up in
+		// the matching directory below it.
+		to := filepath.Join(vendorPath(filepath.Join(dir, "vendor"), meta), filepath.FromSlash(subdir))
+		if _, err := os.Stat(to); err != nil {
+			if err := restoreVendored(ctx, c, dir, meta, pins, roots, opts); err != nil {
+				return Pin{}, errors.Wrapf(err, "restoring vendored copy of %s", meta.Root)
+			}
+			if err := revendorNested(ctx, c, dir, meta.Root, pins, roots, opts); err != nil {
+				return Pin{}, err
+			}
+			return Pin{}, errors.Errorf("%s: repo %s has no directory %s", pkg, meta.Root, subdir)
+		}
+	}
+	if err := revendorNested(ctx, c, dir, meta.Root, pins, roots, opts); err != nil {
+		return Pin{}, err
+	}
+
+	pin := pinnedPackage{meta: meta, version: version}.pin()
+	pin.setVendored(version, vendored)
+	replaced := false
+	for i, p := range pins {
+		if p.Root == pin.Root {
+			pins[i] = pin
+			replaced = true
+		}
+	}
+	if !replaced {
+		pins = append(pins, pin)
+	}
+	if err := writeManifest(filename, pins); err != nil {
+		return Pin{}, err
+	}
+	return pin, nil
+}
+
+// restoreVendored undoes vendoring the repo described by meta, since the
+// manifest isn't updated: the repo is vendored again at its pinned version, or
+// removed if it wasn't pinned.
+func restoreVendored(ctx context.Context, c *cache, dir string, meta *pkgMeta, pins []Pin, roots map[string]bool, opts getOptions) error {
+	for _, p := range pins {
+		if p.Root == meta.Root {
+			_, err := revendor(ctx, c, dir, p.meta(), p.Version, roots, opts)
+			return err
+		}
+	}
+	return os.RemoveAll(vendorPath(filepath.Join(dir, "vendor"), meta))
+}
+
+// revendorNested vendors the pinned repos nested below root again at their
+// pinned versions, parents first, since vendoring root removed their copies.
+// The recorded files and revisions of those pins are updated.
+func revendorNested(ctx context.Context, c *cache, dir, root string, pins []Pin, roots map[string]bool, opts getOptions) error {
+	var nested []int
+	for i, p := range pins {
+		if p.Root != root && hasPathPrefix(p.Root, root) {
+			nested = append(nested, i)
+		}
+	}
+	sort.Slice(nested, func(i, j int) bool { return pins[nested[i]].Root < pins[nested[j]].Root })
+	for _, i := range nested {
+		p := &pins[i]
+		vendored, err := revendor(ctx, c, dir, p.meta(), p.Version, roots, opts)
+		if err != nil {
+			return err
+		}
+		p.setVendored(p.Version, vendored)
+	}
+	return nil
+}
+
+// vendorCopy describes a fresh vendored copy of a repo.
+type vendorCopy struct {
+	// files and hash are recorded as the Files and Hash of its pin.
+	files []string
+	hash  string
+	// revision is the revision the pinned version resolved to.
+	revision string
+}
+
+// setVendored pins the repo to version, recording the vendored copy v.
+func (p *Pin) setVendored(version string, v vendorCopy) {
+	p.Version = version
+	p.Revision = resolvedRevision(version, v.revision)
+	p.Files = v.files
+	p.Hash = v.hash
+}
+
+// revendor replaces the vendored copy of a repo in the project in dir with
+// the repo at version, returning the files of the new copy and the revision
+// the version resolved to. The previous copy is removed first so files
+// deleted upstream don't linger. The files of other repos, given by the
+// vendor paths in roots, aren't listed, see pinRoots.
+func revendor(ctx context.Context, c *cache, dir string, meta *pkgMeta, version string, roots map[string]bool, opts getOptions) (vendorCopy, error) {
+	to := vendorPath(filepath.Join(dir, "vendor"), meta)
+	if err := os.RemoveAll(to); err != nil {
+		return vendorCopy{}, errors.Wrap(err, "removing vendored repo")
+	}
+	opts.roots = roots
+	revision, err := goGet(ctx, c, meta, to, version, opts)
+	if err != nil {
+		return vendorCopy{}, errors.Wrapf(err, "vendoring %s", meta.Root)
+	}
+	files, err := listFiles(to, otherRoots(roots, to))
+	if err != nil {
+		return vendorCopy{}, errors.Wrapf(err, "listing vendored files of %s", meta.Root)
+	}
+	hash, err := treeHash(to, files)
+	if err != nil {
+		return vendorCopy{}, errors.Wrapf(err, "hashing vendored files of %s", meta.Root)
+	}
+	return vendorCopy{files: files, hash: hash, revision: revision}, nil
+}
+
+// resolvedRevision returns the revision to record for a pin of version that
+// resolved to revision. It's only recorded if the version has a ref type,
+// since otherwise it's a revision itself or names a moving ref.
+func resolvedRevision(version, revision string) string {
+	if refType, _ := parseVersion(version); refType == "" {
+		return ""
+	}
+	return revision
+}
+
+// listFiles returns the sorted, slash separated paths of all files below dir,
+// relative to dir. Directories in skip aren't descended into.
+func listFiles(dir string, skip map[string]bool) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if skip[path] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
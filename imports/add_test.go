@@ -0,0 +1,268 @@
+package imports
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestAddPackage(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		remote := "file://" + filepath.ToSlash(filepath.Join(dir, "remote"))
+		files := []file{{"foo.go", "package foo"}, {"bar", ""}, {"bar/bar.go", "package bar"}}
+		rev := gitRepo(t, filepath.Join(dir, "remote"), files)
+
+		project := filepath.Join(dir, "project")
+		if err := os.Mkdir(project, 0755); err != nil {
+			t.Fatal(err)
+		}
+		other := Pin{Root: "example.com/other", Remote: "https://example.com/other", VCS: "git", Version: "v1.0.0"}
+		if err := writeManifest(filepath.Join(project, ManifestFile), []Pin{other}); err != nil {
+			t.Fatal(err)
+		}
+
+		r := resolverFunc(func(ctx context.Context, pkg string) (*pkgMeta, error) {
+			return &pkgMeta{Root: "example.com/foo", VCS: "git", Remote: remote}, nil
+		})
+		opts := getOptions{retry: backoff{}}
+
+		want := Pin{Root: "example.com/foo", Remote: remote, VCS: "git", Version: rev, Files: []string{"bar/bar.go", "foo.go"}}
+		pin, err := addPackage(context.Background(), r, c, project, "example.com/foo", "", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want.Hash = vendoredHash(t, project, "example.com/foo", want.Files)
+		if !reflect.DeepEqual(pin, want) {
+			t.Errorf("expected pin %#v, got %#v", want, pin)
+		}
+		vendored := filepath.Join(project, "vendor", "example.com", "foo")
+		compareFiles(t, vendored, files)
+
+		// A subpackage of the same repo updates the existing pin.
+		if _, err := addPackage(context.Background(), r, c, project, "example.com/foo/bar", rev, opts); err != nil {
+			t.Fatal(err)
+		}
+		pins, err := readManifest(filepath.Join(project, ManifestFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wantPins := []Pin{want, other}; !reflect.DeepEqual(pins, wantPins) {
+			t.Errorf("expected manifest to contain %#v, got %#v", wantPins, pins)
+		}
+
+		// A package the repo doesn't have fails, leaving the pinned copy.
+		if _, err := addPackage(context.Background(), r, c, project, "example.com/foo/nope", rev, opts); err == nil {
+			t.Errorf("expected adding a missing package to fail")
+		}
+		compareFiles(t, vendored, files)
+	})
+}
+
+func TestAddPackageParentOfPin(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		parentFiles := []file{{"a.go", "package a"}}
+		nestedFiles := []file{{"b.go", "package b"}}
+		parentRemote := filepath.Join(dir, "a")
+		nestedRemote := filepath.Join(dir, "b")
+		gitRepo(t, parentRemote, parentFiles)
+		nestedRev := gitRepo(t, nestedRemote, nestedFiles)
+
+		project := filepath.Join(dir, "project")
+		if err := os.Mkdir(project, 0755); err != nil {
+			t.Fatal(err)
+		}
+		nested := Pin{
+			Root:    "example.com/a/b",
+			Remote:  "file://" + filepath.ToSlash(nestedRemote),
+			VCS:     "git",
+			Version: nestedRev,
+			Files:   []string{"b.go"},
+		}
+		if err := writeManifest(filepath.Join(project, ManifestFile), []Pin{nested}); err != nil {
+			t.Fatal(err)
+		}
+		writeFiles(t, project, []file{
+			{"vendor", ""},
+			{"vendor/example.com", ""},
+			{"vendor/example.com/a", ""},
+			{"vendor/example.com/a/b", ""},
+			{"vendor/example.com/a/b/b.go", "package b"},
+		})
+
+		r := resolverFunc(func(ctx context.Context, pkg string) (*pkgMeta, error) {
+			return &pkgMeta{Root: "example.com/a", VCS: "git", Remote: "file://" + filepath.ToSlash(parentRemote)}, nil
+		})
+		pin, err := addPackage(context.Background(), r, c, project, "example.com/a", "", getOptions{retry: backoff{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"a.go"}; !reflect.DeepEqual(pin.Files, want) {
+			t.Errorf("expected files %q to be recorded, got %q", want, pin.Files)
+		}
+
+		// The nested repo's copy survives vendoring its parent.
+		compareFiles(t, filepath.Join(project, "vendor", "example.com", "a", "b"), nestedFiles)
+		compareFiles(t, filepath.Join(project, "vendor", "example.com", "a"), []file{
+			{"a.go", "package a"},
+			{"b", ""},
+			{"b/b.go", "package b"},
+		})
+		pins, err := readManifest(filepath.Join(project, ManifestFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Vendoring it again records its hash.
+		nested.Hash = vendoredHash(t, project, nested.Root, nested.Files)
+		if len(pins) != 2 || !reflect.DeepEqual(pins[1], nested) {
+			t.Errorf("expected nested pin %#v to be kept, got %#v", nested, pins)
+		}
+	})
+}
+
+func TestAddPackageMirror(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		mirror := "file://" + filepath.ToSlash(filepath.Join(dir, "mirror"))
+		files := []file{{"foo.go", "package foo"}, {"bar", ""}, {"bar/bar.go", "package bar"}}
+		rev := gitRepo(t, filepath.Join(dir, "mirror"), files)
+
+		project := filepath.Join(dir, "project")
+		if err := os.Mkdir(project, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		// The override substitutes a mirror for the repo's actual remote.
+		r := &resolver{overrides: []*pkgMeta{{Root: "example.com/foo", VCS: "git", Remote: mirror}}}
+		if _, err := addPackage(context.Background(), r, c, project, "example.com/foo/bar", rev, getOptions{retry: backoff{}}); err != nil {
+			t.Fatal(err)
+		}
+
+		// The vendor layout follows the import path, not the mirror.
+		compareFiles(t, filepath.Join(project, "vendor", "example.com", "foo"), files)
+
+		// Resolving the lock needs no lookups and yields the mirror.
+		noLookups := resolverFunc(func(ctx context.Context, pkg string) (*pkgMeta, error) {
+			t.Errorf("unexpected lookup of %s", pkg)
+			return nil, errors.New("no lookups expected")
+		})
+		pins, err := resolveManifest(noLookups, filepath.Join(project, ManifestFile), replaceTarget)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []Pin{{Root: "example.com/foo", Remote: mirror, VCS: "git", Version: rev}}
+		if !reflect.DeepEqual(pins, want) {
+			t.Errorf("expected lock to contain %#v, got %#v", want, pins)
+		}
+	})
+}
+
+func TestAddPackageSubdirectory(t *testing.T) {
+	tests := []struct {
+		name string
+		meta pkgMeta
+		pkg  string
+		// vendored is the directory of the repo below vendor.
+		vendored string
+		// wantErr is a substring of the expected error, in which case
+		// nothing should be vendored.
+		wantErr string
+	}{
+		{
+			name:     "import path below a vanity root",
+			meta:     pkgMeta{Root: "go4.org", VCS: "git"},
+			pkg:      "go4.org/lock",
+			vendored: "go4.org",
+		},
+		{
+			name:     "import path is the root",
+			meta:     pkgMeta{Root: "github.com/camlistore/go4", VCS: "git"},
+			pkg:      "github.com/camlistore/go4",
+			vendored: "github.com/camlistore/go4",
+		},
+		{
+			name:     "import path differs in case from the root",
+			meta:     pkgMeta{Root: "github.com/camlistore/go4", VCS: "git"},
+			pkg:      "github.com/Camlistore/go4/lock",
+			vendored: "github.com/camlistore/go4",
+		},
+		{
+			name:     "missing directory",
+			meta:     pkgMeta{Root: "go4.org", VCS: "git"},
+			pkg:      "go4.org/nope",
+			vendored: "go4.org",
+			wantErr:  "go4.org/nope: repo go4.org has no directory nope",
+		},
+	}
+	for _, test := range tests {
+		withCache(t, func(t *testing.T, c *cache) {
+			dir, err := ioutil.TempDir("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			// The repo is hosted somewhere other than its import path.
+			remote := filepath.Join(dir, "camlistore", "go4")
+			files := []file{
+				{"lock", ""},
+				{"lock/lock.go", "package lock"},
+				{"LICENSE", "license"},
+			}
+			rev := gitRepo(t, remote, files)
+
+			project := filepath.Join(dir, "project")
+			if err := os.Mkdir(project, 0755); err != nil {
+				t.Fatal(err)
+			}
+			meta := test.meta
+			meta.Remote = "file://" + filepath.ToSlash(remote)
+			r := resolverFunc(func(ctx context.Context, pkg string) (*pkgMeta, error) {
+				return &meta, nil
+			})
+			_, err = addPackage(context.Background(), r, c, project, test.pkg, rev, getOptions{retry: backoff{}})
+			vendored := filepath.Join(project, "vendor", filepath.FromSlash(test.vendored))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("%s: expected error containing %q, got %v", test.name, test.wantErr, err)
+				}
+				if _, err := os.Stat(vendored); !os.IsNotExist(err) {
+					t.Errorf("%s: expected the vendored copy to be removed", test.name)
+				}
+				if _, err := os.Stat(filepath.Join(project, ManifestFile)); !os.IsNotExist(err) {
+					t.Errorf("%s: expected no manifest to be written", test.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+
+			// The repo's root is vendored at the import root, so its
+			// subdirectories line up with the import paths below it.
+			compareFiles(t, vendored, files)
+		})
+	}
+}
@@ -0,0 +1,348 @@
+package imports
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Masterminds/vcs"
+	"github.com/pkg/errors"
+)
+
+// Environment variables configuring credentials for private repos.
+const (
+	// tokenEnv holds an access token, such as a GitHub or GitLab personal
+	// access token.
+	tokenEnv = "GOT_GIT_TOKEN"
+	// tokenHostsEnv lists the comma separated hosts the token is sent to.
+	// Defaults to defaultTokenHosts, so the token isn't handed to arbitrary
+	// servers.
+	tokenHostsEnv = "GOT_GIT_TOKEN_HOSTS"
+)
+
+var defaultTokenHosts = []string{"github.com", "gitlab.com"}
+
+// tokenUser is the user name sent along with a token.
+const tokenUser = "x-access-token"
+
+// credentials authenticate requests to private repos and their go-get
+// endpoints.
+type credentials struct {
+	token      string
+	tokenHosts []string
+	// netrc holds entries of a .netrc file, which take precedence over the
+	// token.
+	netrc []netrcEntry
+}
+
+type netrcEntry struct {
+	machine  string
+	login    string
+	password string
+}
+
+// defaultCredentials are used by the default resolver and for all clones.
+var defaultCredentials = credentialsFromEnv(os.Environ())
+
+// credentialsFromEnv loads credentials from environment variables of the form
+// returned by os.Environ, and the .netrc file named by NETRC or found in the
+// home directory. An unreadable .netrc file is ignored.
+func credentialsFromEnv(environ []string) *credentials {
+	env := map[string]string{}
+	for _, kv := range environ {
+		if i := strings.IndexByte(kv, '='); i > 0 {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+	c := &credentials{token: env[tokenEnv], tokenHosts: defaultTokenHosts}
+	if hosts := env[tokenHostsEnv]; hosts != "" {
+		c.tokenHosts = nil
+		for _, host := range strings.Split(hosts, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				c.tokenHosts = append(c.tokenHosts, host)
+			}
+		}
+	}
+
+	netrc := env["NETRC"]
+	if netrc == "" && env["HOME"] != "" {
+		netrc = filepath.Join(env["HOME"], ".netrc")
+	}
+	if netrc != "" {
+		if data, err := ioutil.ReadFile(netrc); err == nil {
+			c.netrc = parseNetrc(data)
+		}
+	}
+	return c
+}
+
+// parseNetrc parses the machine entries of a .netrc file. Macros are skipped.
+func parseNetrc(data []byte) []netrcEntry {
+	var (
+		entries []netrcEntry
+		entry   *netrcEntry
+	)
+	s := bufio.NewScanner(bytes.NewReader(data))
+	inMacro := false
+	for s.Scan() {
+		line := s.Text()
+		if inMacro {
+			// Macros end at an empty line.
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			if strings.HasPrefix(fields[i], "#") {
+				break
+			}
+			var value string
+			if i+1 < len(fields) {
+				value = fields[i+1]
+			}
+			switch fields[i] {
+			case "machine":
+				entries = append(entries, netrcEntry{machine: value})
+				entry = &entries[len(entries)-1]
+				i++
+			case "default":
+				// The default entry must come last and matches any host,
+				// which is too broad to send credentials to.
+				entry = nil
+			case "login":
+				if entry != nil {
+					entry.login = value
+				}
+				i++
+			case "password":
+				if entry != nil {
+					entry.password = value
+				}
+				i++
+			case "account":
+				i++
+			case "macdef":
+				inMacro = true
+				i = len(fields)
+			}
+		}
+	}
+	return entries
+}
+
+// forHost returns the user and password to authenticate to host with.
+func (c *credentials) forHost(host string) (user, password string, ok bool) {
+	if c == nil {
+		return "", "", false
+	}
+	for _, e := range c.netrc {
+		if e.machine == host && e.login != "" {
+			return e.login, e.password, true
+		}
+	}
+	if c.token == "" {
+		return "", "", false
+	}
+	for _, h := range c.tokenHosts {
+		if h == host {
+			return tokenUser, c.token, true
+		}
+	}
+	return "", "", false
+}
+
+// authorize adds credentials for the request's host, if any.
+func (c *credentials) authorize(req *http.Request) {
+	if req.URL.Scheme != "https" || req.Header.Get("Authorization") != "" {
+		return
+	}
+	if user, password, ok := c.forHost(req.URL.Hostname()); ok {
+		req.SetBasicAuth(user, password)
+	}
+}
+
+// gitHeader returns the git configuration key and value of an HTTP header
+// sending the credentials for remote's host, e.g.
+// "http.https://github.com/.extraHeader" and "Authorization: Basic ...". The
+// key is scoped to the remote's scheme, host and port. Only https remotes
+// without credentials of their own are authenticated.
+func (c *credentials) gitHeader(remote string) (key, value string, ok bool) {
+	u, err := url.Parse(remote)
+	if err != nil || u.Scheme != "https" || u.User != nil {
+		return "", "", false
+	}
+	user, password, ok := c.forHost(u.Hostname())
+	if !ok {
+		return "", "", false
+	}
+	origin := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}
+	auth := base64.StdEncoding.EncodeToString([]byte(user + ":" + password))
+	return "http." + origin.String() + ".extraHeader", "Authorization: Basic " + auth, true
+}
+
+// gitEnv returns the environment variables that make a git command send the
+// credentials for remote's host, if any, as an HTTP header. They're added to
+// each command that talks to the remote, through the GIT_CONFIG_COUNT,
+// GIT_CONFIG_KEY_n and GIT_CONFIG_VALUE_n variables, rather than put in the
+// remote URL, so they're neither stored in the configuration of a clone nor
+// visible in the process list. Those variables need git 2.31 or later, so an
+// older git is an error rather than a silently unauthenticated fetch.
+func (c *credentials) gitEnv(remote string) ([]string, error) {
+	key, value, ok := c.gitHeader(remote)
+	if !ok {
+		return nil, nil
+	}
+	if err := checkGitConfigEnv(); err != nil {
+		return nil, err
+	}
+	// Keep any configuration the user passes the same way.
+	n, _ := strconv.Atoi(os.Getenv("GIT_CONFIG_COUNT"))
+	return []string{
+		fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", n, key),
+		fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", n, value),
+		fmt.Sprintf("GIT_CONFIG_COUNT=%d", n+1),
+	}, nil
+}
+
+var (
+	gitVersionOnce sync.Once
+	gitVersionErr  error
+)
+
+// checkGitConfigEnv returns an error if the installed git doesn't read
+// configuration from the environment.
+func checkGitConfigEnv() error {
+	gitVersionOnce.Do(func() {
+		out, err := exec.Command("git", "version").Output()
+		if err != nil {
+			gitVersionErr = errors.Wrap(err, "determining git version")
+			return
+		}
+		// "git version 2.39.5", possibly followed by a platform.
+		fields := strings.Fields(string(out))
+		if len(fields) < 3 {
+			gitVersionErr = errors.Errorf("unexpected git version %q", bytes.TrimSpace(out))
+			return
+		}
+		v, ok := parseGoVersion(fields[2])
+		if !ok {
+			gitVersionErr = errors.Errorf("unexpected git version %q", fields[2])
+			return
+		}
+		if v[0] < 2 || (v[0] == 2 && v[1] < 31) {
+			gitVersionErr = errors.Errorf("git %s can't authenticate to private repos, 2.31 or later is required", fields[2])
+		}
+	})
+	return gitVersionErr
+}
+
+// authGitRepo is a git repo whose commands that talk to its remote carry the
+// environment returned by gitEnv.
+type authGitRepo struct {
+	*vcs.GitRepo
+	env []string
+}
+
+// remoteCmd returns a git command run in the repo's directory, or dir if
+// non-empty, that talks to the remote.
+func (r *authGitRepo) remoteCmd(dir string, args ...string) *exec.Cmd {
+	cmd := r.CmdFromDir("git", args...)
+	if dir != "" {
+		cmd.Dir = dir
+	}
+	// Don't prompt for credentials, treat the remote as unavailable.
+	cmd.Env = append(cmd.Env, "GIT_TERMINAL_PROMPT=0")
+	cmd.Env = append(cmd.Env, r.env...)
+	return cmd
+}
+
+// Get clones the repo, like vcs.GitRepo.Get.
+func (r *authGitRepo) Get() error {
+	if err := os.MkdirAll(filepath.Dir(r.LocalPath()), 0755); err != nil {
+		return vcs.NewLocalError("Unable to create directory", err, "")
+	}
+	cmd := r.remoteCmd(filepath.Dir(r.LocalPath()), "clone", "--recursive", "--", r.Remote(), r.LocalPath())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return vcs.NewRemoteError("Unable to get repository", err, string(out))
+	}
+	return nil
+}
+
+// Update fetches the latest changes of the repo, like vcs.GitRepo.Update.
+func (r *authGitRepo) Update() error {
+	if out, err := r.remoteCmd("", "fetch", "--tags", "--", r.RemoteLocation).CombinedOutput(); err != nil {
+		return vcs.NewRemoteError("Unable to update repository", err, string(out))
+	}
+	head, err := ioutil.ReadFile(filepath.Join(r.LocalPath(), ".git", "HEAD"))
+	if err != nil {
+		return vcs.NewLocalError("Unable to update repository", err, "")
+	}
+	// Pulling in a detached head state, such as when a revision is checked
+	// out, fails.
+	if bytes.HasPrefix(head, []byte("ref: ")) {
+		if out, err := r.remoteCmd("", "pull").CombinedOutput(); err != nil {
+			return vcs.NewRemoteError("Unable to update repository", err, string(out))
+		}
+	}
+	if out, err := r.remoteCmd("", "submodule", "update", "--init", "--recursive").CombinedOutput(); err != nil {
+		return vcs.NewRemoteError("Unable to update submodules", err, string(out))
+	}
+	// Remove the directories of submodules that went away.
+	for _, args := range [][]string{
+		{"clean", "-x", "-d", "-f", "-f"},
+		{"submodule", "foreach", "--recursive", "git clean -x -d -f -f"},
+	} {
+		if out, err := r.RunFromDir("git", args...); err != nil {
+			return vcs.NewLocalError("Unable to clean up submodules", err, string(out))
+		}
+	}
+	return nil
+}
+
+// Ping reports whether the remote is reachable, like vcs.GitRepo.Ping.
+func (r *authGitRepo) Ping() bool {
+	cmd := r.remoteCmd(os.TempDir(), "ls-remote", "--", r.Remote())
+	return cmd.Run() == nil
+}
+
+// redact replaces all secrets in s.
+func (c *credentials) redact(s string) string {
+	if c == nil {
+		return s
+	}
+	var secrets []string
+	if c.token != "" {
+		secrets = append(secrets, c.token, url.QueryEscape(c.token))
+	}
+	for _, e := range c.netrc {
+		if e.password != "" {
+			secrets = append(secrets, e.password, url.QueryEscape(e.password))
+		}
+	}
+	for _, secret := range secrets {
+		s = strings.Replace(s, secret, "****", -1)
+	}
+	return s
+}
+
+// redactError returns err with all secrets removed from its message, so it
+// can be logged or printed.
+func (c *credentials) redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if msg := err.Error(); c.redact(msg) != msg {
+		return errors.New(c.redact(msg))
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package imports
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// circuitBreaker tracks transient failures across requests so a failing
+// server isn't hammered by every package of a run retrying independently.
+// Once open, a circuit stays open for the rest of the run.
+type circuitBreaker struct {
+	// hostFailures is the number of consecutive transient failures after
+	// which requests to a host fail fast. Zero means unlimited.
+	hostFailures int
+	// budget is the total number of transient failures tolerated across
+	// all hosts before every request fails fast. Zero means unlimited.
+	budget int
+
+	mu       sync.Mutex
+	failures map[string]int // host -> consecutive transient failures
+	total    int
+}
+
+// circuitOpenError is returned for requests refused by a circuitBreaker. It
+// isn't transient, so it's never retried.
+type circuitOpenError struct {
+	host string
+	// global is set if the run's failure budget was exhausted, rather than
+	// the host's.
+	global bool
+}
+
+func (e *circuitOpenError) Error() string {
+	if e.global {
+		return "too many failed requests, not requesting " + e.host
+	}
+	return "too many failed requests to " + e.host + ", not retrying"
+}
+
+// allow returns an error if requests to host should fail fast.
+func (b *circuitBreaker) allow(host string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.budget > 0 && b.total >= b.budget {
+		return errors.WithStack(&circuitOpenError{host: host, global: true})
+	}
+	if b.hostFailures > 0 && b.failures[host] >= b.hostFailures {
+		return errors.WithStack(&circuitOpenError{host: host})
+	}
+	return nil
+}
+
+// record records the result of a request to host. Only transient errors
+// count as failures, and a success resets the host's consecutive failures.
+func (b *circuitBreaker) record(host string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		// Don't close an open circuit, it stays open for the whole run.
+		if b.hostFailures == 0 || b.failures[host] < b.hostFailures {
+			delete(b.failures, host)
+		}
+		return
+	}
+	if !isTransient(err) {
+		return
+	}
+	if b.failures == nil {
+		b.failures = map[string]int{}
+	}
+	b.failures[host]++
+	b.total++
+}
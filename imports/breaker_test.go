@@ -0,0 +1,75 @@
+package imports
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestResolverCircuitBreaker(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests int
+	)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+
+	withTestServer(t, h, func(t *testing.T, host string) {
+		r := &resolver{
+			retry:   backoff{retries: 5, retryable: isTransient},
+			breaker: &circuitBreaker{hostFailures: 3},
+		}
+
+		// Retries stop once the circuit opens, rather than after 5.
+		_, err := r.fetchImportMeta(context.Background(), host+"/foo")
+		if _, ok := errors.Cause(err).(*circuitOpenError); !ok {
+			t.Errorf("expected circuit to open, got %v", err)
+		}
+		if got := count(); got != 3 {
+			t.Errorf("expected 3 requests before the circuit opened, got %d", got)
+		}
+
+		// Other packages from the host fail without any requests.
+		for _, pkg := range []string{host + "/bar", host + "/baz/qux"} {
+			if _, err := r.fetchImportMeta(context.Background(), pkg); err == nil {
+				t.Errorf("expected %s to fail fast", pkg)
+			}
+		}
+		if got := count(); got != 3 {
+			t.Errorf("expected no further requests once the circuit opened, got %d", got)
+		}
+	})
+}
+
+func TestCircuitBreakerBudget(t *testing.T) {
+	b := &circuitBreaker{budget: 3}
+	transient := &httpStatusError{code: http.StatusBadGateway, status: "502 Bad Gateway"}
+	notFound := &httpStatusError{code: http.StatusNotFound, status: "404 Not Found"}
+
+	b.record("a.example.com", transient)
+	b.record("a.example.com", notFound) // not transient, doesn't count
+	b.record("b.example.com", transient)
+	b.record("b.example.com", nil)
+	if err := b.allow("c.example.com"); err != nil {
+		t.Fatalf("expected requests to be allowed within budget: %v", err)
+	}
+
+	b.record("c.example.com", transient)
+	err := b.allow("d.example.com")
+	if err == nil || !strings.Contains(err.Error(), "too many failed requests") {
+		t.Errorf("expected exhausted budget to refuse requests to any host, got %v", err)
+	}
+}
@@ -1,22 +1,116 @@
 package imports
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
 
+	"github.com/Masterminds/vcs"
 	"github.com/pkg/errors"
 	"go4.org/lock"
+	"golang.org/x/sync/errgroup"
 )
 
 type cache struct {
 	dirname string
+
+	// lockTimeout bounds how long acquiring the lock of an entry waits for
+	// another process, or goroutine, holding it. Zero means not waiting.
+	lockTimeout time.Duration
 }
 
+// defaultLockTimeout is how long a cache created by newCache waits for locks.
+const defaultLockTimeout = 5 * time.Minute
+
+// lockPollInterval is how often a held lock is retried.
+const lockPollInterval = 50 * time.Millisecond
+
 func newCache(dirname string) (*cache, error) {
 	if err := os.MkdirAll(dirname, 0755); err != nil {
 		return nil, errors.Wrap(err, "creating cache directory")
 	}
-	return &cache{dirname}, nil
+	return &cache{dirname: dirname, lockTimeout: defaultLockTimeout}, nil
+}
+
+// lockOwner is recorded next to a held lock, so processes waiting on the lock
+// can report who holds it. The lock itself must stay empty.
+type lockOwner struct {
+	PID      int       `json:"pid"`
+	Hostname string    `json:"hostname,omitempty"`
+	Since    time.Time `json:"since"`
+}
+
+// lockOwnerFile returns the file recording the owner of a lock.
+func lockOwnerFile(lockfile string) string {
+	return lockfile + ".owner"
+}
+
+// lock acquires the lock of a cache entry, waiting up to c.lockTimeout for it
+// to be released. If it's still held after that, the error names the lock and,
+// if recorded, its owner.
+func (c *cache) lock(target string) (io.Closer, error) {
+	lockfile := target + ".lock"
+	deadline := time.Now().Add(c.lockTimeout)
+	for {
+		closer, err := lock.Lock(lockfile)
+		if err == nil {
+			return newOwnedLock(lockfile, closer), nil
+		}
+		if time.Now().After(deadline) {
+			msg := fmt.Sprintf("timed out after %s waiting for lock %s", c.lockTimeout, lockfile)
+			if owner, ok := readLockOwner(lockfile); ok {
+				msg += fmt.Sprintf(", held by pid %d", owner.PID)
+				if owner.Hostname != "" {
+					msg += " on " + owner.Hostname
+				}
+				msg += " since " + owner.Since.Format(time.RFC3339)
+			}
+			return nil, errors.Wrap(err, msg)
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// ownedLock removes the owner record of a lock when releasing it.
+type ownedLock struct {
+	owner  string
+	closer io.Closer
+}
+
+// newOwnedLock records the current process as the owner of a lock it just
+// acquired. Owners are only used for diagnostics, so failing to record one
+// isn't an error.
+func newOwnedLock(lockfile string, closer io.Closer) *ownedLock {
+	hostname, _ := os.Hostname()
+	owner := lockOwner{PID: os.Getpid(), Hostname: hostname, Since: time.Now()}
+	if data, err := json.Marshal(owner); err == nil {
+		ioutil.WriteFile(lockOwnerFile(lockfile), data, 0644)
+	}
+	return &ownedLock{lockOwnerFile(lockfile), closer}
+}
+
+func (l *ownedLock) Close() error {
+	os.Remove(l.owner)
+	return l.closer.Close()
+}
+
+// readLockOwner returns the recorded owner of a lock, if any.
+func readLockOwner(lockfile string) (lockOwner, bool) {
+	var owner lockOwner
+	data, err := ioutil.ReadFile(lockOwnerFile(lockfile))
+	if err != nil {
+		return owner, false
+	}
+	if err := json.Unmarshal(data, &owner); err != nil || owner.PID == 0 {
+		return owner, false
+	}
+	return owner, true
 }
 
 func (c *cache) dir(name string, f func(filepath string) error) error {
@@ -32,18 +126,25 @@ func (c *cache) dir(name string, f func(filepath string) error) error {
 		}
 	}
 
-	closer, err := lock.Lock(target + ".lock")
+	closer, err := c.lock(target)
 	if err != nil {
 		return errors.Wrap(err, "cache acquiring directory lock")
 	}
 	defer closer.Close()
+
+	// Record the access, so entries can be listed by when they were last
+	// used.
+	now := time.Now()
+	if err := os.Chtimes(target, now, now); err != nil {
+		return errors.Wrap(err, "cache recording directory access")
+	}
 	return f(target)
 }
 
 func (c *cache) file(name string, f func(filepath string) error) error {
 	target := filepath.Join(c.dirname, name)
 
-	closer, err := lock.Lock(target + ".lock")
+	closer, err := c.lock(target)
 	if err != nil {
 		return errors.Wrap(err, "cache acquiring file lock")
 	}
@@ -51,3 +152,87 @@ func (c *cache) file(name string, f func(filepath string) error) error {
 
 	return f(target)
 }
+
+// CacheEntry describes a repo in the cache.
+type CacheEntry struct {
+	// Key is the name of the entry's directory. See cacheKey.
+	Key string
+	// Remote is the remote the repo was cloned from, if it can be
+	// determined.
+	Remote string
+	// Size is the disk usage of the entry in bytes.
+	Size int64
+	// LastAccess is when the entry was last used.
+	LastAccess time.Time
+}
+
+// ListCache lists the repos in a cache directory, largest first.
+func ListCache(dirname string) ([]CacheEntry, error) {
+	return (&cache{dirname: dirname}).list()
+}
+
+func (c *cache) list() ([]CacheEntry, error) {
+	infos, err := ioutil.ReadDir(c.dirname)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "reading cache directory")
+	}
+	var entries []CacheEntry
+	for _, info := range infos {
+		if info.IsDir() {
+			entries = append(entries, CacheEntry{Key: info.Name(), LastAccess: info.ModTime()})
+		}
+	}
+
+	// Sizing entries means walking every file in the cache, so entries are
+	// scanned concurrently.
+	sem := make(chan struct{}, runtime.NumCPU())
+	var group errgroup.Group
+	for i := range entries {
+		e := &entries[i]
+		group.Go(func() error {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			dir := filepath.Join(c.dirname, e.Key)
+			size, err := dirSize(dir)
+			if err != nil {
+				return errors.Wrapf(err, "sizing cache entry %s", e.Key)
+			}
+			e.Size = size
+			// The cache key can't be decoded, so ask the repo instead.
+			if repo, err := vcs.NewRepo("", dir); err == nil {
+				e.Remote = repo.Remote()
+			}
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Size != entries[j].Size {
+			return entries[i].Size > entries[j].Size
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	return entries, nil
+}
+
+// dirSize returns the total size of the files below dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -2,10 +2,14 @@ package imports
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -54,3 +58,114 @@ func testFileCache(t *testing.T, c *cache) {
 		t.Fatal(err)
 	}
 }
+
+func TestCacheList(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		remote, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(remote)
+		gitRepo(t, remote, []file{{"foo.go", "package foo"}})
+
+		meta := &pkgMeta{Root: "example.com/foo", VCS: "git", Remote: "file://" + filepath.ToSlash(remote)}
+		if err := c.dir(cacheKey(meta.Remote), func(path string) error {
+			_, _, err := cloneRepo(context.Background(), meta, path, backoff{})
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		// A synthetic entry that isn't a repo.
+		if err := c.dir("raw", func(path string) error {
+			return ioutil.WriteFile(filepath.Join(path, "data"), make([]byte, 1<<20), 0644)
+		}); err != nil {
+			t.Fatal(err)
+		}
+		// Files in the cache aren't entries.
+		if err := c.file("resolved.json", func(path string) error {
+			return ioutil.WriteFile(path, []byte("[]"), 0644)
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		entries, err := c.list()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 {
+			t.Fatalf("expected 2 entries, got %#v", entries)
+		}
+
+		raw, repo := entries[0], entries[1]
+		if raw.Key != "raw" || raw.Size != 1<<20 || raw.Remote != "" {
+			t.Errorf("expected largest entry to be the raw entry of 1MiB, got %#v", raw)
+		}
+		if repo.Key != cacheKey(meta.Remote) || repo.Remote != meta.Remote {
+			t.Errorf("expected repo entry for %s, got %#v", meta.Remote, repo)
+		}
+		if repo.Size == 0 || repo.Size >= raw.Size {
+			t.Errorf("unexpected size of repo entry %d", repo.Size)
+		}
+		for _, e := range entries {
+			if time.Since(e.LastAccess) > time.Minute {
+				t.Errorf("expected %s to have been accessed recently, got %s", e.Key, e.LastAccess)
+			}
+		}
+	})
+}
+
+func TestCacheLockTimeout(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		c.lockTimeout = 100 * time.Millisecond
+
+		held := make(chan struct{})
+		release := make(chan struct{})
+		done := make(chan error)
+		go func() {
+			done <- c.dir("foo", func(string) error {
+				close(held)
+				<-release
+				return nil
+			})
+		}()
+		<-held
+
+		err := c.dir("foo", func(string) error { return nil })
+		if err == nil {
+			t.Fatal("expected acquiring a held lock to time out")
+		}
+		hostname, _ := os.Hostname()
+		for _, want := range []string{
+			filepath.Join(c.dirname, "foo.lock"),
+			fmt.Sprintf("pid %d", os.Getpid()),
+			hostname,
+		} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("expected error to contain %q, got %v", want, err)
+			}
+		}
+
+		// Without an owner record, the lock is still named.
+		if err := os.Remove(lockOwnerFile(filepath.Join(c.dirname, "foo.lock"))); err != nil {
+			t.Fatal(err)
+		}
+		err = c.dir("foo", func(string) error { return nil })
+		if err == nil || !strings.Contains(err.Error(), "foo.lock") || strings.Contains(err.Error(), "pid") {
+			t.Errorf("expected error naming only the lock, got %v", err)
+		}
+
+		// Locks released within the timeout are acquired.
+		c.lockTimeout = 5 * time.Second
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			close(release)
+		}()
+		if err := c.dir("foo", func(string) error { return nil }); err != nil {
+			t.Errorf("expected lock to be acquired once released: %v", err)
+		}
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,206 @@
+package imports
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/semver"
+)
+
+// versionConstraint is a semantic version range that updates of a repo must
+// stay within, such as "^1.2.0". Alternatives are separated by "||", and are
+// lists of bounds a version must all satisfy, separated by spaces or commas,
+// e.g. ">=1.2.0, <1.4.0 || ^2.1.0". A bound is a version, optionally preceded
+// by one of "=", ">", ">=", "<", "<=", "^" or "~", with "^" allowing changes
+// that don't modify the left-most non-zero number, and "~" allowing patch
+// releases. Versions may omit the "v" prefix and trailing numbers.
+type versionConstraint [][]versionBound
+
+// versionBound compares versions to a canonical semantic version.
+type versionBound struct {
+	op      string
+	version string
+}
+
+// constraintOps are the operators of bounds, longest first so ">=" isn't
+// read as ">".
+var constraintOps = []string{">=", "<=", ">", "<", "=", "^", "~"}
+
+// isConstraint reports whether s looks like a version constraint rather than
+// a plain version, e.g. a Godeps comment holding "^1.2.0" rather than a tag.
+func isConstraint(s string) bool {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "||") {
+		return true
+	}
+	for _, op := range constraintOps {
+		if strings.HasPrefix(s, op) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseConstraint parses a versionConstraint.
+func parseConstraint(s string) (versionConstraint, error) {
+	var c versionConstraint
+	for _, alt := range strings.Split(s, "||") {
+		var bounds []versionBound
+		for _, field := range strings.FieldsFunc(alt, func(r rune) bool { return r == ' ' || r == ',' || r == '\t' }) {
+			op := ""
+			for _, o := range constraintOps {
+				if strings.HasPrefix(field, o) {
+					op = o
+					break
+				}
+			}
+			version := strings.TrimPrefix(field, op)
+			if !strings.HasPrefix(version, "v") {
+				version = "v" + version
+			}
+			if !semver.IsValid(version) {
+				return nil, errors.Errorf("invalid version %q in constraint %q", field, s)
+			}
+			bounds = append(bounds, expandBound(op, semver.Canonical(version))...)
+		}
+		if len(bounds) == 0 {
+			return nil, errors.Errorf("empty version range in constraint %q", s)
+		}
+		c = append(c, bounds)
+	}
+	return c, nil
+}
+
+// expandBound converts "^" and "~" bounds into a pair of comparisons.
+func expandBound(op, version string) []versionBound {
+	major, minor, _ := versionNumbers(version)
+	switch op {
+	case "^":
+		upper := "v" + strconv.Itoa(major+1) + ".0.0"
+		if major == 0 {
+			upper = "v0." + strconv.Itoa(minor+1) + ".0"
+		}
+		return []versionBound{{">=", version}, {"<", upper}}
+	case "~":
+		upper := "v" + strconv.Itoa(major) + "." + strconv.Itoa(minor+1) + ".0"
+		return []versionBound{{">=", version}, {"<", upper}}
+	case "":
+		op = "="
+	}
+	return []versionBound{{op, version}}
+}
+
+// versionNumbers returns the major, minor and patch numbers of a canonical
+// semantic version.
+func versionNumbers(version string) (major, minor, patch int) {
+	v := strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	nums := strings.SplitN(v, ".", 3)
+	for i, p := range []*int{&major, &minor, &patch} {
+		if i < len(nums) {
+			*p, _ = strconv.Atoi(nums[i])
+		}
+	}
+	return major, minor, patch
+}
+
+// allows reports whether a semantic version satisfies the constraint.
+// Prereleases are only allowed if a bound names them exactly.
+func (c versionConstraint) allows(version string) bool {
+	if !semver.IsValid(version) {
+		return false
+	}
+	version = semver.Canonical(version)
+	for _, bounds := range c {
+		ok := true
+		for _, b := range bounds {
+			if semver.Prerelease(version) != "" && !(b.op == "=" && b.version == version) {
+				ok = false
+				break
+			}
+			cmp := semver.Compare(version, b.version)
+			switch b.op {
+			case "=":
+				ok = cmp == 0
+			case ">":
+				ok = cmp > 0
+			case ">=":
+				ok = cmp >= 0
+			case "<":
+				ok = cmp < 0
+			case "<=":
+				ok = cmp <= 0
+			}
+			if !ok {
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// highestTag returns the tag with the highest semantic version allowed by the
+// constraint, or false if none is. Tags of a module in a directory of its
+// repo are prefixed by the directory, e.g. "api/v1.2.0", and only those are
+// considered.
+func (c versionConstraint) highestTag(tags []string, subdir string) (string, bool) {
+	prefix := ""
+	if subdir != "" {
+		prefix = subdir + "/"
+	}
+	best, bestVersion := "", ""
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, prefix) {
+			continue
+		}
+		version := strings.TrimPrefix(tag, prefix)
+		if !strings.HasPrefix(version, "v") {
+			version = "v" + version
+		}
+		if !c.allows(version) {
+			continue
+		}
+		if best == "" || semver.Compare(version, bestVersion) > 0 {
+			best, bestVersion = tag, version
+		}
+	}
+	return best, best != ""
+}
+
+// constrainedTag fetches a repo and returns its highest tag allowed by the
+// constraint.
+func constrainedTag(ctx context.Context, c *cache, meta *pkgMeta, constraint string, p retryPolicy) (string, error) {
+	vc, err := parseConstraint(constraint)
+	if err != nil {
+		return "", err
+	}
+	var tags []string
+	err = c.dir(cacheKey(meta.Remote), func(path string) error {
+		repo, cloned, err := cloneRepo(ctx, meta, path, p)
+		if err != nil {
+			return err
+		}
+		if !cloned {
+			if err := retry(ctx, p, repo.Update); err != nil {
+				return errors.Wrap(defaultCredentials.redactError(err), "updating repo")
+			}
+		}
+		tags, err = repo.Tags()
+		return errors.Wrap(err, "listing tags")
+	})
+	if err != nil {
+		return "", err
+	}
+	tag, ok := vc.highestTag(tags, meta.Subdir)
+	if !ok {
+		return "", errors.Errorf("no tag matches constraint %s", constraint)
+	}
+	return tag, nil
+}
@@ -0,0 +1,84 @@
+package imports
+
+import "testing"
+
+func TestVersionConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		allowed    []string
+		denied     []string
+	}{
+		{
+			constraint: "^1.2.0",
+			allowed:    []string{"v1.2.0", "v1.2.5", "v1.9.0"},
+			denied:     []string{"v1.1.9", "v2.0.0", "v1.3.0-rc.1", "master"},
+		},
+		{
+			constraint: "^0.2.1",
+			allowed:    []string{"v0.2.1", "v0.2.9"},
+			denied:     []string{"v0.3.0", "v1.0.0"},
+		},
+		{
+			constraint: "~1.2",
+			allowed:    []string{"v1.2.0", "v1.2.7"},
+			denied:     []string{"v1.3.0", "v1.1.0"},
+		},
+		{
+			constraint: ">=1.2.0, <1.4.0 || ^3.0.0",
+			allowed:    []string{"v1.2.0", "v1.3.9", "v3.1.0"},
+			denied:     []string{"v1.4.0", "v2.0.0", "v4.0.0"},
+		},
+		{
+			constraint: "1.2.0-rc.1",
+			allowed:    []string{"v1.2.0-rc.1"},
+			denied:     []string{"v1.2.0"},
+		},
+	}
+	for _, test := range tests {
+		c, err := parseConstraint(test.constraint)
+		if err != nil {
+			t.Errorf("parsing %q: %v", test.constraint, err)
+			continue
+		}
+		for _, v := range test.allowed {
+			if !c.allows(v) {
+				t.Errorf("expected %q to allow %s", test.constraint, v)
+			}
+		}
+		for _, v := range test.denied {
+			if c.allows(v) {
+				t.Errorf("expected %q not to allow %s", test.constraint, v)
+			}
+		}
+	}
+
+	for _, bad := range []string{"", "^", ">=1.x", "^1.2.0 ||"} {
+		if _, err := parseConstraint(bad); err == nil {
+			t.Errorf("expected parsing %q to fail", bad)
+		}
+	}
+}
+
+func TestHighestTag(t *testing.T) {
+	tags := []string{"v1.2.0", "1.3.0", "v1.10.0-beta", "v2.0.0", "api/v1.4.0", "release"}
+	tests := []struct {
+		constraint string
+		subdir     string
+		want       string
+	}{
+		{"^1.2.0", "", "1.3.0"},
+		{">=1.0.0", "", "v2.0.0"},
+		{"^1.2.0", "api", "api/v1.4.0"},
+		{"^3.0.0", "", ""},
+	}
+	for _, test := range tests {
+		c, err := parseConstraint(test.constraint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := c.highestTag(tags, test.subdir)
+		if got != test.want || ok != (test.want != "") {
+			t.Errorf("highest tag of %q in %q: expected %q, got %q", test.constraint, test.subdir, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package imports
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// linkBlob copies the file at path into a content-addressed store, keyed by
+// the SHA-256 of its contents, and hard links target to the stored copy.
+// Identical files therefore share a single blob. Blobs are read-only so a
+// write through one link can't change the contents seen through the others.
+func linkBlob(store, target, path string, mode os.FileMode) error {
+	blob, err := storeBlob(store, path, mode)
+	if err != nil {
+		return err
+	}
+	if err := os.Link(blob, target); err != nil {
+		return errors.Wrapf(err, "linking %s", target)
+	}
+	return nil
+}
+
+// storeBlob copies the file at path into a content-addressed store, unless
+// the store already holds its contents, and returns the path of the blob.
+func storeBlob(store, path string, mode os.FileMode) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "opening file for reading %s", path)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errors.Wrapf(err, "hashing %s", path)
+	}
+	blob := filepath.Join(store, hex.EncodeToString(h.Sum(nil)))
+
+	if _, err := os.Stat(blob); err != nil {
+		if !os.IsNotExist(err) {
+			return "", errors.Wrap(err, "checking blob store")
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return "", errors.Wrapf(err, "rewinding %s", path)
+		}
+		if err := writeBlob(store, blob, f, mode&0555); err != nil {
+			return "", err
+		}
+	}
+	return blob, nil
+}
+
+// writeBlob writes a blob to a temporary file and renames it into place, so
+// concurrent writers of the same blob never observe a partial file.
+func writeBlob(store, blob string, r io.Reader, mode os.FileMode) error {
+	tmp, err := ioutil.TempFile(store, ".blob")
+	if err != nil {
+		return errors.Wrap(err, "creating blob")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "writing blob")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "writing blob")
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return errors.Wrap(err, "setting blob permissions")
+	}
+	if err := os.Rename(tmp.Name(), blob); err != nil {
+		return errors.Wrap(err, "storing blob")
+	}
+	return nil
+}
+
+// unlinkBlobs reverses linkBlob for every file below dir, replacing links
+// into a blob store with independent, writable copies.
+func unlinkBlobs(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+
+		from, err := os.Open(path)
+		if err != nil {
+			return errors.Wrapf(err, "opening file for reading %s", path)
+		}
+		defer from.Close()
+
+		tmp, err := ioutil.TempFile(filepath.Dir(path), ".got")
+		if err != nil {
+			return errors.Wrap(err, "creating copy")
+		}
+		defer os.Remove(tmp.Name())
+		if _, err := io.Copy(tmp, from); err != nil {
+			tmp.Close()
+			return errors.Wrapf(err, "copying %s", path)
+		}
+		if err := tmp.Close(); err != nil {
+			return errors.Wrapf(err, "copying %s", path)
+		}
+		if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0200); err != nil {
+			return errors.Wrapf(err, "setting permissions of %s", path)
+		}
+		return os.Rename(tmp.Name(), path)
+	})
+}
@@ -0,0 +1,74 @@
+package imports
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyDirDedup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := filepath.Join(dir, "store")
+	if err := os.Mkdir(store, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	pkgs := map[string][]file{
+		"foo": {{"LICENSE", "license text"}, {"foo.go", "package foo"}},
+		"bar": {{"LICENSE", "license text"}, {"bar.go", "package bar"}},
+	}
+	for name, files := range pkgs {
+		src, dest := filepath.Join(dir, "src", name), filepath.Join(dir, "vendor", name)
+		for _, d := range []string{src, dest} {
+			if err := os.MkdirAll(d, 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		writeFiles(t, src, files)
+		if err := copyDir(dest, src, copyOptions{dedupDir: store}); err != nil {
+			t.Fatal(err)
+		}
+		compareFiles(t, dest, files)
+	}
+
+	blobs, err := ioutil.ReadDir(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs) != 3 {
+		t.Errorf("expected 3 blobs for 4 files with one duplicate, got %d", len(blobs))
+	}
+
+	license := func(pkg string) os.FileInfo {
+		info, err := os.Stat(filepath.Join(dir, "vendor", pkg, "LICENSE"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+	if !os.SameFile(license("foo"), license("bar")) {
+		t.Errorf("expected identical files to share a blob")
+	}
+	if perm := license("foo").Mode().Perm(); perm&0222 != 0 {
+		t.Errorf("expected blob to be read-only, got mode %s", perm)
+	}
+
+	if err := unlinkBlobs(filepath.Join(dir, "vendor")); err != nil {
+		t.Fatal(err)
+	}
+	if os.SameFile(license("foo"), license("bar")) {
+		t.Errorf("expected files to be independent after unlinking")
+	}
+	if perm := license("foo").Mode().Perm(); perm&0200 == 0 {
+		t.Errorf("expected unlinked file to be writable, got mode %s", perm)
+	}
+	for name, files := range pkgs {
+		compareFiles(t, filepath.Join(dir, "vendor", name), files)
+	}
+}
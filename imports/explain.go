@@ -0,0 +1,134 @@
+package imports
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Explain resolves the repo of a package, writing each step taken to w, such
+// as the go-get URL fetched and the 'go-import' meta tags it returned.
+func Explain(w io.Writer, pkg string, resolverOpts ResolverOptions) error {
+	r, err := newResolver(resolverOpts, nil)
+	if err != nil {
+		return err
+	}
+	_, err = r.explain(context.Background(), w, pkg)
+	return err
+}
+
+// explain mirrors resolve and fetchImportMeta, describing each step. Failed
+// requests aren't retried, and results aren't cached.
+func (r *resolver) explain(ctx context.Context, w io.Writer, pkg string) (*pkgMeta, error) {
+	fmt.Fprintf(w, "package: %s\n", pkg)
+
+	meta, err := r.explainSource(ctx, w, pkg)
+	if err != nil {
+		fmt.Fprintf(w, "error: %v\n", err)
+		return nil, err
+	}
+	fmt.Fprintf(w, "root: %s\n", meta.Root)
+	fmt.Fprintf(w, "remote: %s\n", meta.Remote)
+	fmt.Fprintf(w, "vcs: %s\n", meta.VCS)
+	return meta, nil
+}
+
+func (r *resolver) explainSource(ctx context.Context, w io.Writer, pkg string) (*pkgMeta, error) {
+	if meta, ok := matchOverride(r.overrides, pkg); ok {
+		fmt.Fprintf(w, "override: %s %s %s\n", meta.Root, meta.VCS, meta.Remote)
+		return meta, nil
+	}
+
+	switch v, _, ok := matchVCS(pkg); {
+	case r.httpFirst(pkg):
+		fmt.Fprintln(w, "static match: skipped, host is resolved over HTTP first")
+	case ok:
+		host := v.host
+		if host == "" {
+			host = "(any)"
+		}
+		fmt.Fprintf(w, "static match: host %s, pattern %s\n", host, v.pattern)
+		meta, _ := importMeta(pkg)
+		return meta, nil
+	default:
+		fmt.Fprintln(w, "static match: none")
+	}
+
+	if r.responsesDir != "" {
+		meta, ok, err := loadResponse(r.responsesDir, pkg)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			fmt.Fprintf(w, "stored response: %s\n", r.responsesDir)
+			return meta, nil
+		}
+		fmt.Fprintf(w, "stored response: none in %s\n", r.responsesDir)
+	}
+
+	r.mu.Lock()
+	for _, result := range r.results {
+		if strings.HasPrefix(pkg, result.Root) {
+			r.mu.Unlock()
+			fmt.Fprintln(w, "cache: hit")
+			return result, nil
+		}
+	}
+	r.mu.Unlock()
+	fmt.Fprintln(w, "cache: miss")
+
+	resp, u, err := r.request(ctx, pkg)
+	fmt.Fprintf(w, "fetch: %s\n", u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading response from %s", u)
+	}
+
+	for _, content := range importMetaContents(bytes.NewReader(body), r.metaNames) {
+		fmt.Fprintf(w, "meta: %s\n", content)
+	}
+	meta, err := parseImportMeta(bytes.NewReader(body), pkg, r.metaNames)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing response from %s", u)
+	}
+	fmt.Fprintf(w, "selected: %s %s %s\n", meta.Root, meta.VCS, meta.Remote)
+	return meta, nil
+}
+
+// importMetaContents returns the content of every 'go-import' meta tag in the
+// head of a go-get response, including malformed ones parseImportMeta skips.
+func importMetaContents(r io.Reader, extraNames []string) []string {
+	d := xml.NewDecoder(r)
+	d.CharsetReader = charsetReader
+	d.Strict = false
+	var contents []string
+	for {
+		t, err := d.RawToken()
+		if err != nil {
+			return contents
+		}
+		switch e := t.(type) {
+		case xml.StartElement:
+			if strings.EqualFold(e.Name.Local, "body") {
+				return contents
+			}
+			if strings.EqualFold(e.Name.Local, "meta") && isImportMetaName(attrValue(e.Attr, "name"), extraNames) {
+				contents = append(contents, attrValue(e.Attr, "content"))
+			}
+		case xml.EndElement:
+			if strings.EqualFold(e.Name.Local, "head") {
+				return contents
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package imports
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExplainStatic(t *testing.T) {
+	var buf bytes.Buffer
+	r := &resolver{}
+	if _, err := r.explain(context.Background(), &buf, "github.com/pkg/errors/internal"); err != nil {
+		t.Fatal(err)
+	}
+	want := "package: github.com/pkg/errors/internal\n" +
+		"static match: host github.com, pattern " + vcsList[0].pattern + "\n" +
+		"root: github.com/pkg/errors\n" +
+		"remote: https://github.com/pkg/errors\n" +
+		"vcs: git\n"
+	if got := buf.String(); got != want {
+		t.Errorf("expected output:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestExplainFetch(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><head>
+<meta name="go-import" content="invalid">
+<meta name="go-import" content="%s/foo git https://git.example.com/foo">
+</head></html>`, r.Host)
+	})
+
+	withTestServer(t, h, func(t *testing.T, host string) {
+		r := &resolver{retry: backoff{}}
+
+		var buf bytes.Buffer
+		if _, err := r.explain(context.Background(), &buf, host+"/foo/bar"); err != nil {
+			t.Fatal(err)
+		}
+		want := strings.Replace(`package: HOST/foo/bar
+static match: none
+cache: miss
+fetch: https://HOST/foo/bar?go-get=1
+meta: invalid
+meta: HOST/foo git https://git.example.com/foo
+selected: HOST/foo git https://git.example.com/foo
+root: HOST/foo
+remote: https://git.example.com/foo
+vcs: git
+`, "HOST", host, -1)
+		if got := buf.String(); got != want {
+			t.Errorf("expected output:\n%s\ngot:\n%s", want, got)
+		}
+
+		// Once resolved, later lookups are served from the cache.
+		if _, err := r.fetchImportMeta(context.Background(), host+"/foo"); err != nil {
+			t.Fatal(err)
+		}
+		buf.Reset()
+		if _, err := r.explain(context.Background(), &buf, host+"/foo/bar"); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), "cache: hit\n") {
+			t.Errorf("expected cache hit, got:\n%s", buf.String())
+		}
+	})
+}
@@ -0,0 +1,232 @@
+package imports
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// failuresFile is the file in a resolver's failureCache holding packages that
+// failed to resolve.
+const failuresFile = "resolve-failures.json"
+
+type resolveFailure struct {
+	Err     string    `json:"error"`
+	Expires time.Time `json:"expires"`
+	// Category is the category of the error, see failureCategory.
+	// Failures recorded before categories existed don't have one.
+	Category string `json:"category,omitempty"`
+}
+
+// cachedFailureError is returned for packages that failed to resolve
+// previously, see cachedFailure.
+type cachedFailureError struct {
+	pkg     string
+	failure resolveFailure
+}
+
+func (e *cachedFailureError) Error() string {
+	return fmt.Sprintf("resolving %s failed previously (cached until %s): %s",
+		e.pkg, e.failure.Expires.Format(time.RFC3339), e.failure.Err)
+}
+
+// isNotFound reports whether resolving a package failed because it doesn't
+// exist or has no 'go-import' meta tag, rather than due to a transient error.
+func isNotFound(err error) bool {
+	switch e := errors.Cause(err).(type) {
+	case *httpStatusError:
+		return e.code == http.StatusNotFound || e.code == http.StatusGone
+	}
+	return errors.Cause(err) == errNoGoImport
+}
+
+func (r *resolver) timeNow() time.Time {
+	if r.now != nil {
+		return r.now()
+	}
+	return time.Now()
+}
+
+// cachedFailure returns the recorded failure to resolve a package, or nil if
+// there's none that hasn't expired.
+func (r *resolver) cachedFailure(pkg string) error {
+	var (
+		failure resolveFailure
+		ok      bool
+	)
+	err := r.failureCache.file(failuresFile, func(filename string) error {
+		failures, err := readFailures(filename)
+		if err != nil {
+			return err
+		}
+		failure, ok = failures[pkg]
+		return nil
+	})
+	if err != nil {
+		if r.logger != nil {
+			r.logger.Errorf("reading cached resolution failures: %v", err)
+		}
+		return nil
+	}
+	if !ok || !r.timeNow().Before(failure.Expires) {
+		return nil
+	}
+	return errors.WithStack(&cachedFailureError{pkg, failure})
+}
+
+// recordFailure records that a package failed to resolve, dropping expired
+// records.
+func (r *resolver) recordFailure(pkg string, ferr error) error {
+	now := r.timeNow()
+	return r.failureCache.file(failuresFile, func(filename string) error {
+		failures, err := readFailures(filename)
+		if err != nil {
+			return err
+		}
+		for p, f := range failures {
+			if !now.Before(f.Expires) {
+				delete(failures, p)
+			}
+		}
+		failures[pkg] = resolveFailure{
+			Err:      ferr.Error(),
+			Expires:  now.Add(r.failureTTL),
+			Category: failureCategory(ferr),
+		}
+
+		data, err := json.Marshal(failures)
+		if err != nil {
+			return errors.Wrap(err, "encoding resolution failures")
+		}
+		return ioutil.WriteFile(filename, data, 0644)
+	})
+}
+
+func readFailures(filename string) (map[string]resolveFailure, error) {
+	failures := map[string]resolveFailure{}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return failures, nil
+		}
+		return nil, errors.Wrap(err, "reading resolution failures")
+	}
+	if err := json.Unmarshal(data, &failures); err != nil {
+		return nil, errors.Wrap(err, "parsing resolution failures")
+	}
+	return failures, nil
+}
+
+// Categories of errors resolving a package. See failureCategory.
+const (
+	// FailureNetwork is an error reaching a go-get endpoint, including
+	// server errors.
+	FailureNetwork = "network"
+	// FailureNotFound is a go-get endpoint reporting that the package
+	// doesn't exist.
+	FailureNotFound = "not-found"
+	// FailureNoGoImport is a go-get response without a 'go-import' meta
+	// tag for the package.
+	FailureNoGoImport = "no-go-import"
+	// FailureAuth is a go-get endpoint rejecting the request's
+	// credentials, or requiring some.
+	FailureAuth = "auth"
+	// FailureOther is any other error, such as an invalid import path.
+	FailureOther = "other"
+)
+
+// failureCategory returns the category of an error resolving a package.
+func failureCategory(err error) string {
+	code := 0
+	switch e := errors.Cause(err).(type) {
+	case *httpStatusError:
+		code = e.code
+	case *proxyStatusError:
+		code = e.code
+	case *cachedFailureError:
+		if e.failure.Category != "" {
+			return e.failure.Category
+		}
+		// Only packages that weren't found are cached.
+		return FailureNotFound
+	case *circuitOpenError, net.Error:
+		return FailureNetwork
+	}
+	switch {
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return FailureAuth
+	case code == http.StatusNotFound || code == http.StatusGone:
+		return FailureNotFound
+	case code != 0:
+		return FailureNetwork
+	case errors.Cause(err) == errNoGoImport:
+		return FailureNoGoImport
+	}
+	return FailureOther
+}
+
+// ResolveFailure is a package that couldn't be resolved.
+type ResolveFailure struct {
+	Package string `json:"package"`
+	// Category is one of FailureNetwork, FailureNotFound,
+	// FailureNoGoImport, FailureAuth or FailureOther.
+	Category string `json:"category"`
+	Message  string `json:"message"`
+}
+
+// ResolveError lists every package of a manifest that couldn't be resolved,
+// sorted by package.
+type ResolveError struct {
+	Failures []ResolveFailure
+}
+
+func (e *ResolveError) Error() string {
+	lines := []string{"failed to resolve packages:"}
+	for _, f := range e.Failures {
+		lines = append(lines, "  "+f.Package+" ("+f.Category+"): "+f.Message)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isolatingResolver records packages that fail to resolve rather than failing,
+// so every failure of a manifest is reported at once. Failed packages resolve
+// to a placeholder repo rooted at the package, which is never fetched.
+type isolatingResolver struct {
+	next pkgResolver
+
+	mu       sync.Mutex
+	failures []ResolveFailure
+}
+
+func (r *isolatingResolver) resolve(ctx context.Context, pkg string) (*pkgMeta, error) {
+	meta, err := r.next.resolve(ctx, pkg)
+	if err == nil {
+		return meta, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures = append(r.failures, ResolveFailure{pkg, failureCategory(err), err.Error()})
+	return &pkgMeta{Root: pkg}, nil
+}
+
+// err returns a *ResolveError listing the failures, or nil if there were none.
+func (r *isolatingResolver) err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.failures) == 0 {
+		return nil
+	}
+	failures := append([]ResolveFailure(nil), r.failures...)
+	sort.Slice(failures, func(i, j int) bool { return failures[i].Package < failures[j].Package })
+	return errors.WithStack(&ResolveError{failures})
+}
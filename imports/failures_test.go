@@ -0,0 +1,186 @@
+package imports
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestResolverFailureCache(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests = map[string]int{}
+	)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/nometa":
+			w.Write([]byte("<html><head></head></html>"))
+		case "/slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(10 * time.Second):
+			}
+		default:
+			goImportHandler(w, r)
+		}
+	})
+
+	withCache(t, func(t *testing.T, c *cache) {
+		withTestServer(t, h, func(t *testing.T, host string) {
+			now := time.Now()
+			r := &resolver{
+				retry:        backoff{},
+				timeout:      100 * time.Millisecond,
+				failureCache: c,
+				failureTTL:   time.Hour,
+				now:          func() time.Time { return now },
+			}
+
+			tests := []struct {
+				path string
+				// Number of requests expected after two attempts.
+				want int
+			}{
+				{"/missing", 1},
+				{"/nometa", 1},
+				// Timeouts are transient and never cached.
+				{"/slow", 2},
+			}
+			for _, test := range tests {
+				for i := 0; i < 2; i++ {
+					if _, err := r.fetchImportMeta(context.Background(), host+test.path); err == nil {
+						t.Fatalf("%s: expected resolution to fail", test.path)
+					}
+				}
+				mu.Lock()
+				got := requests[test.path]
+				mu.Unlock()
+				if got != test.want {
+					t.Errorf("%s: expected %d requests, got %d", test.path, test.want, got)
+				}
+			}
+
+			// Once the failure expires the package is requested again.
+			now = now.Add(2 * time.Hour)
+			if _, err := r.fetchImportMeta(context.Background(), host+"/missing"); err == nil {
+				t.Fatal("expected resolution to fail")
+			}
+			mu.Lock()
+			got := requests["/missing"]
+			mu.Unlock()
+			if got != 2 {
+				t.Errorf("expected expired failure to be requested again, got %d requests", got)
+			}
+		})
+	})
+}
+
+func TestResolveManifestFailures(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/nometa":
+			w.Write([]byte("<html><head></head></html>"))
+		case "/private":
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		case "/down":
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		default:
+			goImportHandler(w, r)
+		}
+	})
+
+	withTestServer(t, h, func(t *testing.T, host string) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		var deps []string
+		for _, path := range []string{"/ok", "/missing", "/nometa", "/private", "/down"} {
+			deps = append(deps, `{"ImportPath": "`+host+path+`", "Rev": "a4973d9a4225417aecf5d450a9522f00c1f7130f"}`)
+		}
+		filename := filepath.Join(dir, "Godeps.json")
+		data := `{"Deps": [` + strings.Join(deps, ",") + `]}`
+		if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		r := &resolver{retry: backoff{}}
+		_, err = resolveManifest(r, filename, replaceTarget)
+		rerr, ok := errors.Cause(err).(*ResolveError)
+		if !ok {
+			t.Fatalf("expected a *ResolveError, got %v", err)
+		}
+		got := map[string]string{}
+		for _, f := range rerr.Failures {
+			got[f.Package] = f.Category
+			if f.Message == "" {
+				t.Errorf("%s: expected an error message", f.Package)
+			}
+		}
+		want := map[string]string{
+			host + "/missing": FailureNotFound,
+			host + "/nometa":  FailureNoGoImport,
+			host + "/private": FailureAuth,
+			host + "/down":    FailureNetwork,
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("wanted categories %q, got %q", want, got)
+		}
+
+		// The JSON report uses the documented field names.
+		b, err := json.Marshal(rerr.Failures[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fields map[string]string
+		if err := json.Unmarshal(b, &fields); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"package", "category", "message"} {
+			if fields[name] == "" {
+				t.Errorf("expected field %q in %s", name, b)
+			}
+		}
+	})
+}
+
+func TestFailureCategory(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&httpStatusError{code: http.StatusForbidden}, FailureAuth},
+		{&proxyStatusError{code: http.StatusGone}, FailureNotFound},
+		{&httpStatusError{code: http.StatusBadGateway}, FailureNetwork},
+		{errors.Wrap(errNoGoImport, "resolving"), FailureNoGoImport},
+		{&cachedFailureError{failure: resolveFailure{Category: FailureNoGoImport}}, FailureNoGoImport},
+		{&cachedFailureError{}, FailureNotFound},
+		{&circuitOpenError{host: "example.com"}, FailureNetwork},
+		{errors.New("invalid import path"), FailureOther},
+	}
+	for _, test := range tests {
+		if got := failureCategory(test.err); got != test.want {
+			t.Errorf("%v: wanted %s, got %s", test.err, test.want, got)
+		}
+	}
+}
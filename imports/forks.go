@@ -0,0 +1,178 @@
+package imports
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ericchiang/got/log"
+)
+
+// Fork is a pinned repo fetched from another remote than the one its root
+// resolves to, such as a fork substituted by a go.mod replace directive, or a
+// mirror recorded through a resolver override. Substitutions like these can
+// hide modified code, so they're worth a reviewer's attention.
+type Fork struct {
+	Root string `json:"root"`
+	// Remote is where the repo is fetched from.
+	Remote string `json:"remote"`
+	// Upstream is the remote the repo's root resolves to.
+	Upstream string `json:"upstream"`
+	// Version is the version the repo is vendored at, see
+	// Pin.lockedVersion.
+	Version string `json:"version"`
+
+	// Compared is set if the fork was compared to its upstream.
+	Compared bool `json:"compared,omitempty"`
+	// Hash is the tree hash of the fork at Version.
+	Hash string `json:"hash,omitempty"`
+	// UpstreamHash is the tree hash of the upstream repo at Version, or
+	// empty if upstream doesn't have it.
+	UpstreamHash string `json:"upstream_hash,omitempty"`
+}
+
+// Diverged reports whether the fork was compared to upstream and vendors
+// different files at the same version.
+func (f Fork) Diverged() bool {
+	return f.Compared && f.Hash != f.UpstreamHash
+}
+
+// Forks returns every repo pinned by the manifest of the project in dir that's
+// fetched from another remote than the one its root resolves to, logging a
+// warning for each. Roots are resolved ignoring resolverOpts.Overrides, so
+// mirrors substituted by overrides are reported too. If compare is set, the
+// fork and its upstream are fetched into cacheDir and the tree hashes of both
+// at the pinned version are compared, see Fork.Diverged.
+func Forks(dir, cacheDir string, compare bool, resolverOpts ResolverOptions, logger log.Logger) ([]Fork, error) {
+	c, err := newCache(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	upstreamOpts := resolverOpts
+	upstreamOpts.Overrides = nil
+	r, err := loggingResolver(upstreamOpts, logger)
+	if err != nil {
+		return nil, err
+	}
+	opts := getOptions{logger: logger, retry: resolverOpts.retryPolicy(), proxy: proxyFromEnv(), resolver: r}
+	return findForks(context.Background(), c, r, dir, compare, opts)
+}
+
+func findForks(ctx context.Context, c *cache, r pkgResolver, dir string, compare bool, opts getOptions) ([]Fork, error) {
+	filename := filepath.Join(dir, ManifestFile)
+	m, err := readManifestFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	pins := m.Packages
+	if pins == nil {
+		return nil, errors.Errorf("no manifest found at %s", filename)
+	}
+	m.configure(&opts)
+
+	upstreams := make([]*pkgMeta, len(pins))
+	group, gctx := errgroup.WithContext(ctx)
+	for i, p := range pins {
+		i, p := i, p
+		group.Go(func() error {
+			meta, err := r.resolve(gctx, p.Root)
+			if err != nil {
+				return errors.Wrapf(err, "resolving %s", p.Root)
+			}
+			if meta.Remote != p.Remote || meta.VCS != p.VCS {
+				// Modules in a directory of their repo are kept in the
+				// same directory upstream.
+				upstreams[i] = &pkgMeta{Root: p.Root, VCS: meta.VCS, Remote: meta.Remote, Subdir: moduleSubdir(p.Root, meta.Root)}
+			}
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	var (
+		forks []Fork
+		metas []*pkgMeta
+	)
+	for i, p := range pins {
+		if upstreams[i] == nil {
+			continue
+		}
+		forks = append(forks, Fork{Root: p.Root, Remote: p.Remote, Upstream: upstreams[i].Remote, Version: p.lockedVersion()})
+		metas = append(metas, upstreams[i])
+	}
+	if compare && len(forks) > 0 {
+		if err := compareForks(ctx, c, pins, forks, metas, opts); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range forks {
+		switch {
+		case f.Diverged() && f.UpstreamHash == "":
+			opts.logger.Errorf("%s: fetched from %s instead of %s, whose upstream doesn't have version %s", f.Root, f.Remote, f.Upstream, f.Version)
+		case f.Diverged():
+			opts.logger.Errorf("%s: fetched from %s instead of %s, which differs from upstream at version %s", f.Root, f.Remote, f.Upstream, f.Version)
+		default:
+			opts.logger.Errorf("%s: fetched from %s instead of %s", f.Root, f.Remote, f.Upstream)
+		}
+	}
+	return forks, nil
+}
+
+// compareForks fetches every fork and its upstream at the fork's version and
+// records the tree hashes of both copies. A version upstream doesn't have
+// leaves its hash empty.
+func compareForks(ctx context.Context, c *cache, pins []Pin, forks []Fork, upstreams []*pkgMeta, opts getOptions) error {
+	byRoot := map[string]Pin{}
+	for _, p := range pins {
+		byRoot[p.Root] = p
+	}
+	tmp, err := ioutil.TempDir("", "got-forks")
+	if err != nil {
+		return errors.Wrap(err, "creating temporary directory")
+	}
+	defer os.RemoveAll(tmp)
+
+	group, gctx := errgroup.WithContext(ctx)
+	for i := range forks {
+		i := i
+		f := &forks[i]
+		group.Go(func() error {
+			dir := filepath.Join(tmp, strconv.Itoa(i))
+			hash, err := fetchTreeHash(gctx, c, byRoot[f.Root].meta(), filepath.Join(dir, "fork"), f.Version, opts)
+			if err != nil {
+				return errors.Wrapf(err, "fetching %s", f.Root)
+			}
+			f.Hash = hash
+			f.Compared = true
+			// Fetching upstream is expected to fail if the fork
+			// introduced the version.
+			if hash, err := fetchTreeHash(gctx, c, upstreams[i], filepath.Join(dir, "upstream"), f.Version, opts); err != nil {
+				opts.logger.Debugf("%s: fetching upstream %s at %s: %v", f.Root, f.Upstream, f.Version, err)
+			} else {
+				f.UpstreamHash = hash
+			}
+			return nil
+		})
+	}
+	return group.Wait()
+}
+
+// fetchTreeHash vendors a repo at version into the directory to and returns
+// the tree hash of its files.
+func fetchTreeHash(ctx context.Context, c *cache, meta *pkgMeta, to, version string, opts getOptions) (string, error) {
+	if _, err := goGet(ctx, c, meta, to, version, opts); err != nil {
+		return "", err
+	}
+	files, err := listFiles(to, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "listing files")
+	}
+	return treeHash(to, files)
+}
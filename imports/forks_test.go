@@ -0,0 +1,124 @@
+package imports
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/module"
+)
+
+func TestFindForks(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		git := func(dir string, args ...string) string {
+			cmd := exec.Command("git", append([]string{"-c", "user.name=got", "-c", "user.email=got@example.com"}, args...)...)
+			cmd.Dir = dir
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("git %v: %v: %s", args, err, out)
+			}
+			return strings.TrimSpace(string(out))
+		}
+
+		// foo is replaced by a fork that moved its v1.0.0 tag to a
+		// modified commit, bar by an unmodified mirror.
+		fooDir, forkDir := filepath.Join(dir, "foo"), filepath.Join(dir, "fork")
+		gitRepo(t, fooDir, []file{{"foo.go", "package foo"}})
+		git(fooDir, "tag", "v1.0.0")
+		git(dir, "clone", "-q", fooDir, forkDir)
+		writeFiles(t, forkDir, []file{{"foo.go", "package foo // modified"}})
+		git(forkDir, "commit", "-q", "-a", "-m", "modify")
+		git(forkDir, "tag", "-f", "v1.0.0")
+
+		barDir, mirrorDir := filepath.Join(dir, "bar"), filepath.Join(dir, "mirror")
+		bar := gitRepo(t, barDir, []file{{"bar.go", "package bar"}})
+		git(dir, "clone", "-q", barDir, mirrorDir)
+		barVersion := module.PseudoVersion("", "", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), bar[:12])
+
+		remotes := map[string]string{
+			"example.com/foo":    "file://" + filepath.ToSlash(fooDir),
+			"example.com/fork":   "file://" + filepath.ToSlash(forkDir),
+			"example.com/bar":    "file://" + filepath.ToSlash(barDir),
+			"example.com/mirror": "file://" + filepath.ToSlash(mirrorDir),
+			"example.com/plain":  "https://example.com/plain",
+		}
+		r := resolverFunc(func(ctx context.Context, pkg string) (*pkgMeta, error) {
+			remote, ok := remotes[pkg]
+			if !ok {
+				return nil, errors.Errorf("unknown package %s", pkg)
+			}
+			return &pkgMeta{Root: pkg, VCS: "git", Remote: remote}, nil
+		})
+
+		project := filepath.Join(dir, "project")
+		writeFiles(t, dir, []file{{"project", ""}, {"project/go.mod", `module example.com/project
+
+require (
+	example.com/bar ` + barVersion + `
+	example.com/foo v1.0.0
+	example.com/plain v1.2.0
+)
+
+replace example.com/foo => example.com/fork v1.0.0
+
+replace example.com/bar => example.com/mirror ` + barVersion + `
+`}})
+		if err := relock(r, project, filepath.Join(project, "go.mod")); err != nil {
+			t.Fatal(err)
+		}
+
+		// Without comparing, forks are only reported.
+		l := new(testLogger)
+		opts := getOptions{retry: backoff{}, logger: l}
+		forks, err := findForks(context.Background(), c, r, project, false, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(forks) != 2 || forks[0].Root != "example.com/bar" || forks[1].Root != "example.com/foo" {
+			t.Fatalf("expected bar and foo to be reported, got %#v", forks)
+		}
+		for _, f := range forks {
+			if f.Compared || f.Diverged() {
+				t.Errorf("expected %s not to be compared, got %#v", f.Root, f)
+			}
+			if f.Upstream != remotes[f.Root] {
+				t.Errorf("expected upstream of %s to be %s, got %s", f.Root, remotes[f.Root], f.Upstream)
+			}
+		}
+		if msgs := l.messages("error"); len(msgs) != 2 {
+			t.Errorf("expected an advisory for each fork, got %q", msgs)
+		}
+
+		l = new(testLogger)
+		opts.logger = l
+		forks, err = findForks(context.Background(), c, r, project, true, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(forks) != 2 {
+			t.Fatalf("expected two forks, got %#v", forks)
+		}
+		if f := forks[0]; !f.Compared || f.Diverged() || f.Hash == "" {
+			t.Errorf("expected the mirror of bar to match upstream, got %#v", f)
+		}
+		if f := forks[1]; !f.Diverged() || f.UpstreamHash == "" || f.Hash == f.UpstreamHash {
+			t.Errorf("expected the fork of foo to differ from upstream, got %#v", f)
+		}
+		msgs := l.messages("error")
+		if len(msgs) != 2 || !strings.HasPrefix(msgs[1], "example.com/foo: ") || !strings.Contains(msgs[1], "differs from upstream at version v1.0.0") {
+			t.Errorf("expected a divergence warning for foo, got %q", msgs)
+		}
+	})
+}
@@ -1,13 +1,26 @@
 package imports
 
 import (
+	"context"
+	"encoding/json"
+	"go/build"
 	"io"
+	"io/fs"
+	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 
 	"github.com/Masterminds/vcs"
 	"github.com/pkg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ericchiang/got/log"
 )
 
 // cacheKey replaces any non-filepath frendly characters with '-'. This could
@@ -33,48 +46,535 @@ type repoDir struct {
 	Imports []string
 }
 
-func goGet(c *cache, meta *pkgMeta, to, version string) error {
+// getOptions holds optional behavior for goGet.
+type getOptions struct {
+	// writeInfo records the provenance of the repo in a pkgInfoFile written
+	// to the target directory and the directory of every package below it.
+	writeInfo bool
+	// roots, if non-nil, are the vendor paths of the pinned repos, see
+	// pinRoots. The copies of other repos nested below the target directory
+	// are left alone when writing package info.
+	roots map[string]bool
+
+	// logger, if non-nil, receives warnings about the fetched package.
+	logger log.Logger
+
+	// retry determines how failed clones and updates are retried. Defaults
+	// to defaultRetryPolicy.
+	retry retryPolicy
+
+	// gopath, if non-empty, is searched for existing checkouts of the repo
+	// at the requested version before falling back to cloning.
+	gopath string
+
+	// preflight checks that every remote is reachable before fetching any
+	// of them. See preflight.
+	preflight bool
+
+	// skipExisting only checks the recorded files of existing vendored
+	// copies, not their tree hash. See VendorOptions.
+	skipExisting bool
+
+	// frozen only copies repos from the cache, without fetching them or
+	// using GOPATH checkouts and module proxies. See VendorOptions.
+	frozen bool
+
+	// proxy, if non-empty, is a GOPROXY list of module proxies that repos
+	// are downloaded from, using their roots as module paths, before
+	// falling back to cloning. See proxyGet.
+	proxy string
+
+	// resolver makes the requests to module proxies, using its client,
+	// timeout, headers and credentials. Defaults to a resolver with only
+	// the default credentials.
+	resolver *resolver
+
+	// limits bound the clones of a vendor run. See vendorManifest.
+	limits CloneLimits
+
+	copy copyOptions
+}
+
+// goGet copies a repo at version to the target directory, fetching it into
+// the cache first, and returns the revision the version resolved to.
+func goGet(ctx context.Context, c *cache, meta *pkgMeta, to, version string, opts getOptions) (string, error) {
 	if version == "" {
-		return errors.New("no version specified to checkout")
+		return "", errors.New("no version specified to checkout")
 	}
 
-	return c.dir(cacheKey(meta.Remote), func(path string) error {
+	if opts.frozen {
+		return frozenGet(c, meta, to, version, opts)
+	}
+
+	if opts.gopath != "" {
+		// Only exact revisions are matched in a GOPATH.
+		if local, ok := gopathRepo(opts.gopath, meta, version); ok {
+			if opts.logger != nil {
+				opts.logger.Debugf("%s: using GOPATH checkout %s", meta.Root, local)
+			}
+			return version, vendorRepo(meta, to, local, version, opts)
+		}
+	}
+
+	if opts.proxy != "" {
+		revision, err := proxyGet(ctx, c, meta, to, version, opts)
+		if err != errUseVCS {
+			return revision, err
+		}
+	}
+
+	var revision string
+	err := c.dir(cacheKey(meta.Remote), func(path string) error {
+		repo, cloned, err := cloneRepo(ctx, meta, path, opts.retry)
+		if err != nil {
+			return err
+		}
+		if cloned && opts.logger != nil {
+			opts.logger.Debugf("%s: cloned %s into %s", meta.Root, meta.Remote, path)
+		}
+		if revision, err = checkoutVersion(ctx, repo, version, opts.retry); err != nil {
+			return err
+		}
+		if opts.logger != nil {
+			opts.logger.Debugf("%s: checked out %s at %s", meta.Root, version, revision)
+		}
+		return vendorRepo(meta, to, moduleDir(meta, path), version, opts)
+	})
+	return revision, err
+}
+
+// frozenGet copies a repo at version to the target directory from the cache
+// only, failing if the repo or version isn't cached, and returns the revision
+// the version resolved to.
+func frozenGet(c *cache, meta *pkgMeta, to, version string, opts getOptions) (string, error) {
+	var revision string
+	err := c.dir(cacheKey(meta.Remote), func(path string) error {
 		repo, err := newRepo(meta, path)
 		if err != nil {
 			return errors.Wrap(err, "creating repo")
 		}
-
 		if !repo.CheckLocal() {
-			if err := repo.Get(); err != nil {
-				if e, ok := err.(*vcs.RemoteError); ok {
-					return errors.Errorf("%s: %s %v", e.Error(), e.Out(), e.Original())
-				}
-				return errors.Wrap(err, "cloning repo")
-			}
+			return errors.Errorf("%s isn't cached", meta.Remote)
+		}
+		if err := repo.UpdateVersion(vcsRef(repo.Vcs(), version)); err != nil {
+			return errors.Wrapf(err, "%s isn't cached", version)
+		}
+		if revision, err = repo.Version(); err != nil {
+			return errors.Wrap(err, "determining revision")
+		}
+		return vendorRepo(meta, to, moduleDir(meta, path), version, opts)
+	})
+	return revision, err
+}
+
+// Ref types a version can be prefixed with, for example "tag:v1.0.0", to
+// say what kind of ref it names. Without one, the version is passed to the
+// VCS as is, which picks one of the refs if a name is ambiguous, such as a
+// tag and a branch sharing a name.
+const (
+	refCommit = "commit"
+	refTag    = "tag"
+	refBranch = "branch"
+	// refTrack names a branch like refBranch, but every vendor run moves
+	// it to the branch's latest revision, rather than only updates.
+	refTrack = "track"
+)
+
+// parseVersion splits a version into its ref type, if any, and name.
+func parseVersion(version string) (refType, name string) {
+	if i := strings.Index(version, ":"); i > 0 {
+		switch t := version[:i]; t {
+		case refCommit, refTag, refBranch, refTrack:
+			return t, version[i+1:]
 		}
+	}
+	return "", version
+}
 
-		if err := repo.UpdateVersion(version); err != nil {
-			// Revision might just not exist locally.
-			if err := repo.Update(); err != nil {
-				return errors.Wrap(err, "updating repo")
-			}
-			if err := repo.UpdateVersion(version); err != nil {
-				return errors.Wrapf(err, "updating repo to revision %s", version)
-			}
+// vcsRef returns what to check out in a repo of the given VCS for a version.
+// Git refs are qualified so they can't be mistaken for another kind of ref.
+// Other VCSs get the name as is.
+func vcsRef(t vcs.Type, version string) string {
+	refType, name := parseVersion(version)
+	if t != vcs.Git {
+		return name
+	}
+	switch refType {
+	case refTag:
+		return "refs/tags/" + name
+	case refBranch, refTrack:
+		// Only the default branch exists locally, so use the remote's
+		// branch, which is also updated by fetches.
+		return "refs/remotes/origin/" + name
+	}
+	return name
+}
+
+// checkoutVersion updates the working copy of a repo to version, fetching
+// from the remote if the version isn't known locally, and returns the
+// revision it resolved to.
+func checkoutVersion(ctx context.Context, repo vcs.Repo, version string, p retryPolicy) (string, error) {
+	ref := vcsRef(repo.Vcs(), version)
+	if err := repo.UpdateVersion(ref); err != nil {
+		// Revision might just not exist locally.
+		if err := retry(ctx, p, repo.Update); err != nil {
+			return "", errors.Wrap(defaultCredentials.redactError(err), "updating repo")
+		}
+		if err := repo.UpdateVersion(ref); err != nil {
+			return "", errors.Wrapf(err, "updating repo to revision %s", version)
+		}
+	}
+	revision, err := repo.Version()
+	if err != nil {
+		return "", errors.Wrap(err, "determining revision")
+	}
+	return revision, nil
+}
+
+// cloneRepo opens the local copy of a repo, cloning it first if it doesn't
+// exist yet.
+func cloneRepo(ctx context.Context, meta *pkgMeta, path string, p retryPolicy) (repo vcs.Repo, cloned bool, err error) {
+	repo, err = newRepo(meta, path)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "creating repo")
+	}
+	prog := progressFrom(ctx)
+	prog.begin(meta.Root)
+	defer prog.end(meta.Root)
+	if repo.CheckLocal() {
+		return repo, false, nil
+	}
+	limits := cloneLimitsFrom(ctx)
+	get := repo.Get
+	if g, ok := repo.(*authGitRepo); ok && (prog != nil || limits.enabled()) {
+		get = func() error { return gitClone(ctx, g, meta.Root, prog, limits) }
+	}
+	if limits.enabled() {
+		clone := get
+		get = func() error { return limitedGet(meta.Root, path, limits, clone) }
+	}
+	if err := retry(ctx, p, get); err != nil {
+		// Git's output may include credentials of the remote, or of the
+		// user's own configuration.
+		c := defaultCredentials
+		if e, ok := err.(*vcs.RemoteError); ok {
+			return nil, false, c.redactError(errors.Errorf("%s: %s %v", e.Error(), e.Out(), e.Original()))
+		}
+		return nil, false, errors.Wrap(c.redactError(err), "cloning repo")
+	}
+	return repo, true, nil
+}
+
+// headRefs holds, for each VCS, the version that refers to the latest
+// revision of a repo's default branch.
+var headRefs = map[vcs.Type]string{
+	vcs.Git: "origin/HEAD",
+	vcs.Hg:  "default",
+	vcs.Bzr: "-1",
+	vcs.Svn: "HEAD",
+}
+
+// fetchRepo clones a repo into the cache, or fetches the latest changes of a
+// repo that's already cached.
+func fetchRepo(ctx context.Context, c *cache, meta *pkgMeta, p retryPolicy) error {
+	return c.dir(cacheKey(meta.Remote), func(path string) error {
+		repo, cloned, err := cloneRepo(ctx, meta, path, p)
+		if err != nil || cloned {
+			return err
 		}
-		if err := copyDir(to, path); err != nil {
-			return errors.Wrap(err, "copying repo")
+		if err := retry(ctx, p, repo.Update); err != nil {
+			return errors.Wrap(defaultCredentials.redactError(err), "updating repo")
 		}
 		return nil
 	})
 }
 
+// tipRevision fetches a repo and returns the revision version, which names a
+// branch, currently points to.
+func tipRevision(ctx context.Context, c *cache, meta *pkgMeta, version string, p retryPolicy) (string, error) {
+	var revision string
+	err := c.dir(cacheKey(meta.Remote), func(path string) error {
+		repo, cloned, err := cloneRepo(ctx, meta, path, p)
+		if err != nil {
+			return err
+		}
+		if !cloned {
+			if err := retry(ctx, p, repo.Update); err != nil {
+				return errors.Wrap(defaultCredentials.redactError(err), "updating repo")
+			}
+		}
+		revision, err = checkoutVersion(ctx, repo, version, p)
+		return err
+	})
+	return revision, err
+}
+
+// headVersion fetches a repo and returns the latest revision of its default
+// branch.
+func headVersion(ctx context.Context, c *cache, meta *pkgMeta, p retryPolicy) (string, error) {
+	var version string
+	err := c.dir(cacheKey(meta.Remote), func(path string) error {
+		repo, cloned, err := cloneRepo(ctx, meta, path, p)
+		if err != nil {
+			return err
+		}
+		version, err = checkoutHead(ctx, repo, cloned, p)
+		return err
+	})
+	return version, err
+}
+
+// checkoutHead updates the working copy of a repo to the latest revision of
+// its default branch and returns that revision. Repos that weren't just
+// cloned are fetched from the remote first.
+func checkoutHead(ctx context.Context, repo vcs.Repo, cloned bool, p retryPolicy) (string, error) {
+	if !cloned {
+		if err := retry(ctx, p, repo.Update); err != nil {
+			return "", errors.Wrap(defaultCredentials.redactError(err), "updating repo")
+		}
+	}
+
+	ref, ok := headRefs[repo.Vcs()]
+	if !ok {
+		return "", errors.Errorf("unsupported vcs %s", repo.Vcs())
+	}
+	if err := repo.UpdateVersion(ref); err != nil {
+		return "", errors.Wrap(err, "checking out default branch")
+	}
+	version, err := repo.Version()
+	if err != nil {
+		return "", errors.Wrap(err, "determining revision")
+	}
+	return version, nil
+}
+
+// vendorPath returns the directory within a vendor directory that a repo is
+// copied to. It's determined by the import path of the repo root rather than
+// the remote, since 'go-import' meta tags let the two differ. For example the
+// repo root "go4.org" is hosted at "https://github.com/camlistore/go4", and
+// its "lock" directory is imported as "go4.org/lock".
+func vendorPath(vendor string, meta *pkgMeta) string {
+	return filepath.Join(vendor, filepath.FromSlash(meta.Root))
+}
+
+// repoSubdir returns the directory of the repo described by meta that holds
+// pkg, slash separated and empty for the repo root. The import root of a repo
+// needn't resemble where it's hosted, for example go4.org/lock is the "lock"
+// directory of the repo at github.com/camlistore/go4, so only meta.Root is
+// considered. As in parseImportMeta, the root is compared case insensitively.
+// It returns false if pkg isn't below meta.Root.
+func repoSubdir(meta *pkgMeta, pkg string) (string, bool) {
+	root := meta.Root
+	if len(pkg) < len(root) || !strings.EqualFold(pkg[:len(root)], root) {
+		return "", false
+	}
+	rest := pkg[len(root):]
+	if rest != "" && rest[0] != '/' {
+		return "", false
+	}
+	return strings.TrimPrefix(rest, "/"), true
+}
+
+// vendorRepo copies a local checkout of a repo, already at the requested
+// version, to the target directory.
+func vendorRepo(meta *pkgMeta, to, from, version string, opts getOptions) error {
+	if opts.logger != nil {
+		// A go.mod this version of got can't make sense of shouldn't stop
+		// the repo from being vendored.
+		warning, err := goVersionWarning(from, runtime.Version())
+		if err != nil {
+			opts.logger.Errorf("%s: checking go version: %v", meta.Root, err)
+		} else if warning != "" {
+			opts.logger.Errorf("%s: %s", meta.Root, warning)
+		}
+	}
+	if err := os.MkdirAll(to, 0755); err != nil {
+		return errors.Wrap(err, "creating target directory")
+	}
+	copts := opts.copy
+	copts.logger = opts.logger
+	if err := copyDir(to, from, copts); err != nil {
+		return errors.Wrap(err, "copying repo")
+	}
+	if err := checkPackageNames(to); err != nil {
+		return err
+	}
+	if opts.writeInfo {
+		if err := writePkgInfos(to, pinnedPackage{meta: meta, version: version}, otherRoots(opts.roots, to)); err != nil {
+			return errors.Wrap(err, "writing package info")
+		}
+	}
+	return nil
+}
+
+// moduleDir returns the directory of a checkout of meta's repo that's
+// vendored at meta.Root. Like the go command, a module with a major version
+// suffix, such as "example.com/foo/v2", is looked for in a directory named
+// after the suffix if it holds a go.mod file, and otherwise shares its
+// directory with earlier major versions.
+func moduleDir(meta *pkgMeta, local string) string {
+	dir := filepath.Join(local, filepath.FromSlash(meta.Subdir))
+	if _, major, ok := module.SplitPathVersion(meta.Root); ok && strings.HasPrefix(major, "/") {
+		if _, err := os.Stat(filepath.Join(dir, major[1:], "go.mod")); err == nil {
+			return filepath.Join(dir, major[1:])
+		}
+	}
+	return dir
+}
+
+// gopathRepo looks for a checkout of a repo in a GOPATH that's already at the
+// requested revision, returning its directory if found. Checkouts with local
+// modifications, or on a version other than an exact revision match, are
+// skipped. The checkout is never modified.
+func gopathRepo(gopath string, meta *pkgMeta, version string) (string, bool) {
+	for _, dir := range filepath.SplitList(gopath) {
+		local := filepath.Join(dir, "src", filepath.FromSlash(meta.Root))
+		if _, err := os.Stat(local); err != nil {
+			continue
+		}
+
+		// Don't pass a remote since the user's checkout might be of a fork
+		// or use a different URL.
+		repo, err := newRepo(&pkgMeta{Root: meta.Root, VCS: meta.VCS}, local)
+		if err != nil || !repo.CheckLocal() {
+			continue
+		}
+		current, err := repo.Version()
+		if err != nil || current != version || repo.IsDirty() {
+			continue
+		}
+		return local, true
+	}
+	return "", false
+}
+
+// pkgInfoFile is the name of the file written by writePkgInfo. It's ignored
+// by copyDir, so it's never picked up from an upstream repo, and isn't a Go
+// file, so it's never scanned for imports.
+const pkgInfoFile = ".got-info.json"
+
+// writePkgInfos writes a pkgInfoFile into the vendored copy of a repo at dir,
+// and into every directory below it holding Go files, so the provenance of
+// a package can be found from its own directory. Directories in skip, such as
+// the copies of other repos nested below dir, aren't descended into.
+func writePkgInfos(dir string, p pinnedPackage, skip map[string]bool) error {
+	if err := writePkgInfo(dir, p); err != nil {
+		return err
+	}
+	written := map[string]bool{dir: true}
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && skip[path] {
+			return filepath.SkipDir
+		}
+		pkgDir := filepath.Dir(path)
+		if info.IsDir() || filepath.Ext(path) != ".go" || written[pkgDir] {
+			return nil
+		}
+		written[pkgDir] = true
+		return writePkgInfo(pkgDir, p)
+	})
+}
+
+// writePkgInfo writes a pkgInfoFile into dir recording where the vendored
+// package was fetched from and at which revision.
+func writePkgInfo(dir string, p pinnedPackage) error {
+	data, err := json.MarshalIndent(p.pin(), "", "\t")
+	if err != nil {
+		return errors.Wrap(err, "encoding package info")
+	}
+	return ioutil.WriteFile(filepath.Join(dir, pkgInfoFile), append(data, '\n'), 0644)
+}
+
+// goVersionWarning inspects the go.mod file at the root of a repo, if any,
+// and returns a warning if its "go" directive requires a newer version of Go
+// than the provided toolchain version (e.g. "go1.9.2").
+func goVersionWarning(dir, toolchain string) (string, error) {
+	filename := filepath.Join(dir, "go.mod")
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", errors.Wrap(err, "reading go.mod")
+	}
+	// Only the go directive is of interest, so parse leniently to tolerate
+	// directives newer than x/mod.
+	f, err := modfile.ParseLax(filename, b, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "parsing go.mod")
+	}
+	if f.Go == nil {
+		return "", nil
+	}
+	required := f.Go.Version
+
+	want, ok := parseGoVersion(required)
+	if !ok {
+		return "", errors.Errorf("invalid go directive in go.mod: %q", required)
+	}
+	have, ok := parseGoVersion(strings.TrimPrefix(toolchain, "go"))
+	if !ok {
+		// Development builds don't have a comparable version.
+		return "", nil
+	}
+	for i := range want {
+		if want[i] < have[i] {
+			return "", nil
+		}
+		if want[i] > have[i] {
+			return "go.mod requires go " + required + " but toolchain is " + toolchain, nil
+		}
+	}
+	return "", nil
+}
+
+// parseGoVersion parses versions of the form "1.9" or "1.9.2", ignoring any
+// trailing pre-release suffix such as "rc1".
+func parseGoVersion(s string) (v [3]int, ok bool) {
+	parts := strings.SplitN(s, ".", 3)
+	if len(parts) < 2 {
+		return v, false
+	}
+	for i, part := range parts {
+		if j := strings.IndexFunc(part, func(r rune) bool { return r < '0' || r > '9' }); j >= 0 {
+			part = part[:j]
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return v, false
+		}
+		v[i] = n
+	}
+	return v, true
+}
+
+// knownVCS holds the VCS values newRepo understands. An empty VCS is detected
+// from the remote.
+var knownVCS = map[string]bool{
+	"":    true,
+	"git": true,
+	"svn": true,
+	"bzr": true,
+	"hg":  true,
+}
+
 func newRepo(meta *pkgMeta, local string) (vcs.Repo, error) {
 	// Manually setting the VCS prevents another round trip to the
 	// provider to determine what the VCS is.
 	switch meta.VCS {
 	case "git":
-		return vcs.NewGitRepo(meta.Remote, local)
+		env, err := defaultCredentials.gitEnv(meta.Remote)
+		if err != nil {
+			return nil, err
+		}
+		repo, err := vcs.NewGitRepo(meta.Remote, local)
+		if err != nil {
+			return nil, err
+		}
+		return &authGitRepo{repo, env}, nil
 	case "svn":
 		return vcs.NewSvnRepo(meta.Remote, local)
 	case "bzr":
@@ -86,67 +586,311 @@ func newRepo(meta *pkgMeta, local string) (vcs.Repo, error) {
 	}
 }
 
-func copyDir(to, from string) error {
+// copyOptions holds optional behavior for copyDir.
+type copyOptions struct {
+	// xattrs preserves the extended attributes of copied files on platforms
+	// that support them. It's silently ignored elsewhere.
+	xattrs bool
+
+	// platforms, if non-empty, restricts copied Go and assembly files to
+	// those that build on at least one of the platforms, as determined by
+	// filename suffixes and build constraints.
+	platforms []platform
+
+	// exclude holds glob patterns of files and directories that aren't
+	// copied, on top of those always ignored. See excludePath.
+	exclude []string
+
+	// dedupDir, if non-empty, is a directory used as a content-addressed
+	// store. Instead of being copied, files are hard linked to a single
+	// read-only blob per distinct content. See linkBlob and unlinkBlobs.
+	dedupDir string
+
+	// workers is the number of files copied concurrently. Defaults to
+	// runtime.NumCPU().
+	workers int
+
+	// files bounds the files open at once across this and every other
+	// concurrent copy. Defaults to processFiles.
+	files *fileLimit
+	// openFile opens the files copied. Defaults to openCopyFile.
+	openFile func(name string, flag int, perm os.FileMode) (copyFileHandle, error)
+
+	// logger, if non-nil, receives the files left out of the copy, and a
+	// summary of the copy, at the debug level.
+	logger log.Logger
+}
+
+// platform is a GOOS and GOARCH pair.
+type platform struct {
+	goos   string
+	goarch string
+}
+
+// parsePlatform parses a platform of the form "linux/amd64".
+func parsePlatform(s string) (platform, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return platform{}, errors.Errorf("invalid platform %q, expected form GOOS/GOARCH", s)
+	}
+	return platform{parts[0], parts[1]}, nil
+}
+
+// matchPlatforms reports whether a Go or assembly file builds on any of the
+// provided platforms, with cgo either enabled or disabled. Other files always
+// match.
+func matchPlatforms(dir, name string, platforms []platform) (bool, error) {
+	switch filepath.Ext(name) {
+	case ".go", ".s":
+	default:
+		return true, nil
+	}
+
+	ctx := build.Default
+	for _, p := range platforms {
+		ctx.GOOS, ctx.GOARCH = p.goos, p.goarch
+		for _, cgo := range []bool{true, false} {
+			ctx.CgoEnabled = cgo
+			ok, err := ctx.MatchFile(dir, name)
+			if err != nil {
+				return false, errors.Wrapf(err, "evaluating build constraints of %s", name)
+			}
+			if ok {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func copyDir(to, from string, opts copyOptions) error {
 	// TODO: speed this up.
 	//
-	// - Don't need to stat files if ignoreDir and ignoreFile tell us to ignore them.
 	// - Don't need to sort results.
-	// - Can use multiple goroutines.
 	//
-	return filepath.Walk(from, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
+	// Directories are created parents first, but only once a file below them
+	// is going to be copied, so directories left empty by filtering don't
+	// appear. Files are then copied concurrently.
+	files, dirs, err := walkCopies(from, opts)
+	if err != nil {
+		return err
+	}
+
+	var mkdirs func(dir string) error
+	mkdirs = func(dir string) error {
+		mode, ok := dirs[dir]
+		if !ok {
+			return nil
+		}
+		if err := mkdirs(filepath.Dir(dir)); err != nil {
 			return err
 		}
+		// Use Mkdir instead of MkdirAll because the parent directories
+		// should already exist. If they don't, it's an indication that
+		// there's an error in this method's logic.
+		target := filepath.Join(to, dir)
+		if err := os.Mkdir(target, mode); err != nil {
+			return errors.Wrapf(err, "creating directory %s", target)
+		}
+		delete(dirs, dir)
+		return nil
+	}
+	for i := range files {
+		if err := mkdirs(filepath.Dir(files[i].target)); err != nil {
+			return errors.Wrapf(err, "copying directory of %s", files[i].path)
+		}
+		files[i].target = filepath.Join(to, files[i].target)
+	}
 
-		if from == path {
+	workers := opts.workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	group, ctx := errgroup.WithContext(context.Background())
+	queue := make(chan fileCopy)
+	for i := 0; i < workers; i++ {
+		group.Go(func() error {
+			for f := range queue {
+				if err := copyFile(f, opts); err != nil {
+					return err
+				}
+			}
 			return nil
+		})
+	}
+	group.Go(func() error {
+		defer close(queue)
+		for _, f := range files {
+			select {
+			case queue <- f:
+			case <-ctx.Done():
+				return nil
+			}
 		}
+		return nil
+	})
+	if err := group.Wait(); err != nil {
+		return err
+	}
+	if opts.logger != nil {
+		opts.logger.Debugf("copied %d files from %s to %s", len(files), from, to)
+	}
+	return nil
+}
 
-		rel, err := filepath.Rel(from, path)
+// walkCopies walks the directory from and returns the files copyDir copies
+// from it, with targets relative to from, along with the modes of the
+// directories, also relative to from, that may hold them. WalkDir is used so
+// only entries that are actually copied are stat'd, and ignored directories
+// are skipped before being read.
+func walkCopies(from string, opts copyOptions) ([]fileCopy, map[string]os.FileMode, error) {
+	var files []fileCopy
+	dirs := map[string]os.FileMode{}
+	err := filepath.WalkDir(from, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		target := filepath.Join(to, rel)
-
-		name := filepath.Base(path)
 
-		if info.IsDir() {
-			if ignoreDir(name) {
-				return filepath.SkipDir
-			}
-
-			// Use Mkdir instead of MkdirAll because the parent directories
-			// should already exist. If they don't, it's an indication that
-			// there's an error in this method's logic.
-			//
-			// TODO: don't create empty directories.
-			if err := os.Mkdir(target, info.Mode()); err != nil {
-				return errors.Wrapf(err, "copying directory %s", path)
-			}
+		if from == path {
 			return nil
 		}
 
-		if ignoreFile(name) {
+		name := d.Name()
+		if d.IsDir() && ignoreDir(name) {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && ignoreFile(name) {
 			return nil
 		}
 
-		from, err := os.OpenFile(path, os.O_RDONLY, info.Mode())
+		rel, err := filepath.Rel(from, path)
 		if err != nil {
-			return errors.Wrapf(err, "opening file for reading %s", path)
+			return err
+		}
+		if excludePath(opts.exclude, filepath.ToSlash(rel), d.IsDir()) {
+			if opts.logger != nil {
+				opts.logger.Debugf("excluding %s", path)
+			}
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
 		}
-		defer from.Close()
 
-		to, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode())
+		info, err := d.Info()
 		if err != nil {
-			return errors.Wrapf(err, "creating copy of file %s", path)
+			return errors.Wrapf(err, "stat %s", path)
 		}
-		defer to.Close()
 
-		if _, err := io.Copy(to, from); err != nil {
-			return errors.Wrapf(err, "copying file contents of %s", path)
+		if d.IsDir() {
+			dirs[rel] = info.Mode()
+			return nil
+		}
+
+		if len(opts.platforms) > 0 {
+			ok, err := matchPlatforms(filepath.Dir(path), name, opts.platforms)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				if opts.logger != nil {
+					opts.logger.Debugf("skipping %s, it doesn't build on any platform", path)
+				}
+				return nil
+			}
 		}
+		files = append(files, fileCopy{rel, path, info.Mode()})
 		return nil
 	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return files, dirs, nil
+}
+
+// fileCopy is a file to be copied by copyDir.
+type fileCopy struct {
+	target string
+	path   string
+	mode   os.FileMode
+}
+
+func copyFile(f fileCopy, opts copyOptions) error {
+	// Both ways of copying open two files at once: the file and its copy,
+	// or its blob.
+	files := opts.files
+	if files == nil {
+		files = processFiles
+	}
+	files.acquire(2)
+	defer files.release(2)
+
+	path, target := f.path, f.target
+	if opts.dedupDir != "" {
+		return linkBlob(opts.dedupDir, target, path, f.mode)
+	}
+
+	openFile := opts.openFile
+	if openFile == nil {
+		openFile = openCopyFile
+	}
+	from, err := openFile(path, os.O_RDONLY, f.mode)
+	if err != nil {
+		return errors.Wrapf(err, "opening file for reading %s", path)
+	}
+	defer from.Close()
+
+	// Setting extended attributes requires write access to the file, so
+	// read-only files are only made read-only once they've been set.
+	mode := f.mode
+	if opts.xattrs {
+		mode |= 0200
+	}
+	to, err := openFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return errors.Wrapf(err, "creating copy of file %s", path)
+	}
+	defer to.Close()
+
+	if _, err := io.Copy(to, from); err != nil {
+		return errors.Wrapf(err, "copying file contents of %s", path)
+	}
+	if opts.xattrs {
+		if err := copyXattrs(target, path); err != nil {
+			return errors.Wrapf(err, "copying extended attributes of %s", path)
+		}
+		if mode != f.mode {
+			if err := to.Chmod(f.mode); err != nil {
+				return errors.Wrapf(err, "setting mode of copy of %s", path)
+			}
+		}
+	}
+	return nil
+}
+
+// excludePath reports whether the slash separated path of a file or
+// directory, relative to the repo root, matches any of the glob patterns.
+// Patterns ending in a slash only match directories. Patterns without any
+// other slash match the name of a file or directory at any depth, for
+// example "*.md" or "examples/", while others match the whole path, for
+// example "cmd/*/testdata".
+func excludePath(patterns []string, rel string, isDir bool) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/") {
+			if !isDir {
+				continue
+			}
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
 }
 
 func ignoreDir(dirname string) bool {
@@ -163,6 +907,9 @@ func ignoreDir(dirname string) bool {
 var versionFiles = []string{
 	"godeps.json",
 	"glide.yaml",
+	"glide.lock",
+	"gopkg.lock",
+	"vendor.json",
 
 	// "gopkg.toml", // Not understood yet.
 }
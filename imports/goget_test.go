@@ -1,9 +1,16 @@
 package imports
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -23,6 +30,31 @@ func TestCacheKey(t *testing.T) {
 	}
 }
 
+func TestRepoSubdir(t *testing.T) {
+	tests := []struct {
+		root   string
+		pkg    string
+		want   string
+		wantOK bool
+	}{
+		{"go4.org", "go4.org", "", true},
+		{"go4.org", "go4.org/lock", "lock", true},
+		{"go4.org", "go4.org/syncutil/singleflight", "syncutil/singleflight", true},
+		{"github.com/foo/bar", "github.com/foo/bar", "", true},
+		{"github.com/foo/bar", "github.com/foo/bar/baz", "baz", true},
+		{"github.com/foo/bar", "github.com/foo/barbaz", "", false},
+		{"github.com/foo/bar", "github.com/foo", "", false},
+		{"github.com/Foo/bar", "github.com/foo/bar/Baz", "Baz", true},
+		{"github.com/Foo/bar", "github.com/foo/barbaz", "", false},
+	}
+	for _, test := range tests {
+		got, ok := repoSubdir(&pkgMeta{Root: test.root}, test.pkg)
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("repoSubdir(%q, %q): expected (%q, %t), got (%q, %t)", test.root, test.pkg, test.want, test.wantOK, got, ok)
+		}
+	}
+}
+
 func TestIgnoreFile(t *testing.T) {
 	tests := []struct {
 		name string
@@ -54,7 +86,7 @@ func (f file) isDir() bool {
 	return f.data == ""
 }
 
-func writeFiles(t *testing.T, dir string, files []file) {
+func writeFiles(t testing.TB, dir string, files []file) {
 	for _, f := range files {
 		target := filepath.Join(dir, f.path)
 		if f.isDir() {
@@ -114,7 +146,7 @@ func compareFiles(t *testing.T, dir string, files []file) {
 		}
 		got := string(data)
 		if got != f.data {
-			t.Errorf("expected file %s to contain data:\n%s\ngot:\n%s\n", f.data, got)
+			t.Errorf("expected file %s to contain data:\n%s\ngot:\n%s\n", rel, f.data, got)
 		}
 		return nil
 	})
@@ -148,7 +180,22 @@ func TestCopyDir(t *testing.T) {
 				{"a", ""},
 				{"a/b", ""},
 				{"a/b/hi.go", `package b`},
-				{"a/c", ""},
+			},
+		},
+		{
+			// Directories without any retained files aren't created.
+			files: []file{
+				{"foo.go", "package foo"},
+				{"tests", ""},
+				{"tests/foo_test.go", "package tests"},
+				{"docs", ""},
+				{"docs/guide.md", "# Guide"},
+				{"nested", ""},
+				{"nested/empty", ""},
+				{"nested/empty/foo_test.go", "package empty"},
+			},
+			want: []file{
+				{"foo.go", "package foo"},
 			},
 		},
 	}
@@ -169,7 +216,7 @@ func TestCopyDir(t *testing.T) {
 
 			writeFiles(t, src, test.files)
 
-			if err := copyDir(dest, src); err != nil {
+			if err := copyDir(dest, src, copyOptions{}); err != nil {
 				t.Error(err)
 			}
 
@@ -177,3 +224,684 @@ func TestCopyDir(t *testing.T) {
 		}()
 	}
 }
+
+func TestWritePkgInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := pinnedPackage{
+		meta: &pkgMeta{
+			Root:   "go4.org",
+			Remote: "https://github.com/camlistore/go4",
+			VCS:    "git",
+		},
+		version: "034d17a462f7b2dcd1a4a73553ec5357ff6e6c6e",
+	}
+	if err := writePkgInfo(dir, p); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, pkgInfoFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Pin
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := Pin{
+		Root:    p.meta.Root,
+		Remote:  p.meta.Remote,
+		VCS:     p.meta.VCS,
+		Version: p.version,
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("wanted=%#v, got=%#v", want, got)
+	}
+
+	if !ignoreFile(pkgInfoFile) {
+		t.Errorf("expected %s to be ignored when copying", pkgInfoFile)
+	}
+}
+
+func TestWritePkgInfosSkipsNestedRepos(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const nestedInfo = `{"root": "example.com/foo/bar"}`
+	writeFiles(t, dir, []file{
+		{"foo.go", "package foo"},
+		{"sub", ""},
+		{"sub/sub.go", "package sub"},
+		{"bar", ""},
+		{"bar/bar.go", "package bar"},
+		{"bar/" + pkgInfoFile, nestedInfo},
+	})
+	p := pinnedPackage{meta: &pkgMeta{Root: "example.com/foo", VCS: "git"}, version: "v1"}
+	if err := writePkgInfos(dir, p, map[string]bool{filepath.Join(dir, "bar"): true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []string{"", "sub"} {
+		if _, err := os.Stat(filepath.Join(dir, d, pkgInfoFile)); err != nil {
+			t.Errorf("expected package info in %q: %v", d, err)
+		}
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "bar", pkgInfoFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != nestedInfo {
+		t.Errorf("expected package info of nested repo to be left alone, got %s", data)
+	}
+}
+
+func TestGoVersionWarning(t *testing.T) {
+	tests := []struct {
+		gomod       string
+		toolchain   string
+		wantWarning bool
+		wantErr     bool
+	}{
+		{"module example.com/foo\n\ngo 1.99\n", "go1.9.2", true, false},
+		{"module example.com/foo\n\ngo 1.99 // needs generics\n", "go1.9.2", true, false},
+		{"module example.com/foo\n\ngo 1.9\n", "go1.9.2", false, false},
+		{"module example.com/foo\n\ngo 1.8\n", "go1.9.2", false, false},
+		{"module example.com/foo\n\ngo 1.21.0\n", "go1.21rc2", false, false},
+		{"module example.com/foo\n\ngo 1.99\n", "devel +b8a6f2c Tue Oct 10 2017", false, false},
+		{"module example.com/foo\n", "go1.9.2", false, false},
+		{"module example.com/foo\n\ngo one\n", "go1.9.2", false, true},
+		{"", "go1.9.2", false, false},
+	}
+
+	for _, test := range tests {
+		func() {
+			dir, err := ioutil.TempDir("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			if test.gomod != "" {
+				writeFiles(t, dir, []file{{"go.mod", test.gomod}})
+			}
+
+			warning, err := goVersionWarning(dir, test.toolchain)
+			if err != nil {
+				if !test.wantErr {
+					t.Errorf("go.mod %q: %v", test.gomod, err)
+				}
+				return
+			}
+			if test.wantErr {
+				t.Errorf("go.mod %q: expected an error", test.gomod)
+			}
+			if (warning != "") != test.wantWarning {
+				t.Errorf("go.mod %q with toolchain %s, wanted warning=%t, got %q",
+					test.gomod, test.toolchain, test.wantWarning, warning)
+			}
+		}()
+	}
+}
+
+func TestVendorRepoBadGoMod(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	from, to := filepath.Join(dir, "from"), filepath.Join(dir, "to")
+	writeFiles(t, dir, []file{{"from", ""}})
+	writeFiles(t, from, []file{
+		{"go.mod", "module example.com/foo\n\ngo one\n"},
+		{"foo.go", "package foo"},
+	})
+	l := new(testLogger)
+	meta := &pkgMeta{Root: "example.com/foo", VCS: "git"}
+	if err := vendorRepo(meta, to, from, "master", getOptions{logger: l}); err != nil {
+		t.Fatalf("expected an unparsable go.mod not to stop vendoring, got %v", err)
+	}
+	compareFiles(t, to, []file{{"foo.go", "package foo"}})
+	if msgs := l.messages("error"); len(msgs) != 1 {
+		t.Errorf("expected the unparsable go.mod to be reported, got %q", msgs)
+	}
+}
+
+func TestNewRepoSchemelessRemote(t *testing.T) {
+	resp := `<meta name="go-import" content="example.com/foo git github.com/example/foo">`
+	meta, err := parseImportMeta(strings.NewReader(resp), "example.com/foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	repo, err := newRepo(meta, filepath.Join(dir, "repo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://github.com/example/foo"; repo.Remote() != want {
+		t.Errorf("expected repo remote %q, got %q", want, repo.Remote())
+	}
+}
+
+func TestNewRepoPortedRemote(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"example.com/foo git https://git.example.com:8443/foo", "https://git.example.com:8443/foo"},
+		{"example.com/foo git git.example.com:8443/foo", "https://git.example.com:8443/foo"},
+		{"example.com/foo git ssh://git@git.example.com:2222/foo.git", "ssh://git@git.example.com:2222/foo.git"},
+	}
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, test := range tests {
+		resp := `<meta name="go-import" content="` + test.content + `">`
+		meta, err := parseImportMeta(strings.NewReader(resp), "example.com/foo/bar", nil)
+		if err != nil {
+			t.Errorf("%q: %v", test.content, err)
+			continue
+		}
+		if meta.Remote != test.want {
+			t.Errorf("%q: expected remote %q, got %q", test.content, test.want, meta.Remote)
+		}
+		repo, err := newRepo(meta, filepath.Join(dir, strconv.Itoa(i)))
+		if err != nil {
+			t.Errorf("%q: %v", test.content, err)
+			continue
+		}
+		if repo.Remote() != test.want {
+			t.Errorf("%q: expected repo remote %q, got %q", test.content, test.want, repo.Remote())
+		}
+	}
+
+	// The same repo on another port is cached separately.
+	if cacheKey("https://git.example.com:8443/foo") == cacheKey("https://git.example.com/foo") {
+		t.Errorf("expected remotes on different ports to have different cache keys")
+	}
+}
+
+// gitRepo creates a git repository in dir containing the provided files and
+// returns the revision of the commit.
+func gitRepo(t *testing.T, dir string, files []file) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir, files)
+
+	git := func(args ...string) string {
+		args = append([]string{"-c", "user.name=got", "-c", "user.email=got@example.com"}, args...)
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init")
+	// The vcs package requires an origin when opening existing checkouts.
+	git("remote", "add", "origin", "file://"+filepath.ToSlash(dir))
+	git("add", "-A")
+	git("commit", "-m", "initial commit")
+	return git("rev-parse", "HEAD")
+}
+
+func TestGoGetGOPATH(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		gopath, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(gopath)
+
+		files := []file{{"foo.go", "package foo"}}
+		rev := gitRepo(t, filepath.Join(gopath, "src", "example.com", "foo"), files)
+
+		// Cloning from the remote always fails, so goGet can only succeed
+		// by copying from the GOPATH.
+		meta := &pkgMeta{
+			Root:   "example.com/foo",
+			Remote: "file:///nonexistent/foo",
+			VCS:    "git",
+		}
+		opts := getOptions{gopath: gopath, retry: backoff{}}
+
+		dest, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dest)
+
+		if _, err := goGet(context.Background(), c, meta, dest, rev, opts); err != nil {
+			t.Fatalf("expected package to be copied from GOPATH: %v", err)
+		}
+		compareFiles(t, dest, files)
+
+		other, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(other)
+
+		const otherRev = "0123456789abcdef0123456789abcdef01234567"
+		if _, err := goGet(context.Background(), c, meta, other, otherRev, opts); err == nil {
+			t.Errorf("expected GOPATH checkout at a different revision to be ignored")
+		}
+	})
+}
+
+func TestCopyDirWorkers(t *testing.T) {
+	var files []file
+	for i := 0; i < 5; i++ {
+		dir := fmt.Sprintf("dir%d", i)
+		files = append(files, file{dir, ""}, file{dir + "/sub", ""})
+		for j := 0; j < 20; j++ {
+			files = append(files,
+				file{fmt.Sprintf("%s/file%d.go", dir, j), fmt.Sprintf("package dir%d // %d", i, j)},
+				file{fmt.Sprintf("%s/sub/file%d.go", dir, j), fmt.Sprintf("package sub // %d", j)},
+			)
+		}
+	}
+
+	src, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	writeFiles(t, src, files)
+	if err := os.Chmod(filepath.Join(src, "dir0", "file0.go"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workers := range []int{0, 1, 8} {
+		dest, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dest)
+
+		if err := copyDir(dest, src, copyOptions{workers: workers}); err != nil {
+			t.Fatalf("workers=%d: %v", workers, err)
+		}
+		compareFiles(t, dest, files)
+
+		info, err := os.Stat(filepath.Join(dest, "dir0", "file0.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0755 {
+			t.Errorf("workers=%d: expected file mode to be preserved, got %s", workers, info.Mode())
+		}
+	}
+}
+
+// BenchmarkCopyDir copies a small package next to a large testdata directory,
+// which copyDir should skip without reading.
+func BenchmarkCopyDir(b *testing.B) {
+	src, err := ioutil.TempDir("", "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	for i := 0; i < 20; i++ {
+		name := filepath.Join(src, fmt.Sprintf("file%d.go", i))
+		if err := ioutil.WriteFile(name, []byte("package foo"), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		dir := filepath.Join(src, "testdata", fmt.Sprintf("dir%d", i))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			b.Fatal(err)
+		}
+		for j := 0; j < 100; j++ {
+			name := filepath.Join(dir, fmt.Sprintf("input%d.txt", j))
+			if err := ioutil.WriteFile(name, []byte("test input"), 0644); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	dest, err := ioutil.TempDir("", "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		to := filepath.Join(dest, strconv.Itoa(i))
+		if err := os.Mkdir(to, 0755); err != nil {
+			b.Fatal(err)
+		}
+		if err := copyDir(to, src, copyOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCopyDirPlatforms(t *testing.T) {
+	files := []file{
+		{"foo.go", "package foo"},
+		{"foo_linux.go", "package foo"},
+		{"foo_windows.go", "package foo"},
+		{"foo_darwin.go", "package foo"},
+		{"tagged.go", "// +build linux,amd64\n\npackage foo"},
+		{"cgo.go", "// +build cgo\n\npackage foo"},
+		{"nocgo.go", "// +build !cgo\n\npackage foo"},
+		{"asm_amd64.s", "TEXT ·foo(SB),4,$0"},
+		{"LICENSE", "license"},
+	}
+
+	tests := []struct {
+		platforms []string
+		want      []string
+	}{
+		{
+			platforms: nil,
+			want: []string{
+				"foo.go", "foo_linux.go", "foo_windows.go", "foo_darwin.go",
+				"tagged.go", "cgo.go", "nocgo.go", "asm_amd64.s", "LICENSE",
+			},
+		},
+		{
+			platforms: []string{"linux/amd64"},
+			want:      []string{"foo.go", "foo_linux.go", "tagged.go", "cgo.go", "nocgo.go", "asm_amd64.s", "LICENSE"},
+		},
+		{
+			platforms: []string{"windows/386", "darwin/arm64"},
+			want:      []string{"foo.go", "foo_windows.go", "foo_darwin.go", "cgo.go", "nocgo.go", "LICENSE"},
+		},
+	}
+
+	for _, test := range tests {
+		func() {
+			var opts copyOptions
+			for _, s := range test.platforms {
+				p, err := parsePlatform(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				opts.platforms = append(opts.platforms, p)
+			}
+
+			src, err := ioutil.TempDir("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(src)
+
+			dest, err := ioutil.TempDir("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dest)
+
+			writeFiles(t, src, files)
+			if err := copyDir(dest, src, opts); err != nil {
+				t.Fatal(err)
+			}
+
+			var want []file
+			for _, f := range files {
+				for _, name := range test.want {
+					if f.path == name {
+						want = append(want, f)
+					}
+				}
+			}
+			compareFiles(t, dest, want)
+		}()
+	}
+}
+
+func TestCopyDirLogsSkippedFiles(t *testing.T) {
+	src, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	dest, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+
+	writeFiles(t, src, []file{
+		{"docs", ""},
+		{"docs/README", "docs"},
+		{"foo.go", "package foo"},
+		{"foo_windows.go", "package foo"},
+	})
+	l := new(testLogger)
+	opts := copyOptions{
+		exclude:   []string{"docs"},
+		platforms: []platform{{"linux", "amd64"}},
+		logger:    l,
+	}
+	if err := copyDir(dest, src, opts); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"excluding " + filepath.Join(src, "docs"),
+		"skipping " + filepath.Join(src, "foo_windows.go") + ", it doesn't build on any platform",
+		"copied 1 files from " + src + " to " + dest,
+	}
+	if got := l.messages("debug"); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected debug messages %q, got %q", want, got)
+	}
+}
+
+func TestParsePlatform(t *testing.T) {
+	if _, err := parsePlatform("linux/amd64"); err != nil {
+		t.Error(err)
+	}
+	for _, s := range []string{"linux", "linux/", "/amd64", "linux/amd64/v2"} {
+		if _, err := parsePlatform(s); err == nil {
+			t.Errorf("parsePlatform(%q): expected error", s)
+		}
+	}
+}
+
+func TestGoGetVanityImportPath(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		remote, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(remote)
+
+		rev := gitRepo(t, remote, []file{
+			{"lock", ""},
+			{"lock/lock.go", "package lock"},
+			{"LICENSE", "license"},
+		})
+
+		// The repo is hosted somewhere other than its import path.
+		meta := &pkgMeta{
+			Root:   "go4.org",
+			Remote: "file://" + filepath.ToSlash(remote),
+			VCS:    "git",
+		}
+
+		vendor, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(vendor)
+
+		if _, err := goGet(context.Background(), c, meta, vendorPath(vendor, meta), rev, getOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		compareFiles(t, vendor, []file{
+			{"go4.org", ""},
+			{"go4.org/lock", ""},
+			{"go4.org/lock/lock.go", "package lock"},
+			{"go4.org/LICENSE", "license"},
+		})
+	})
+}
+
+func TestGoGetModuleDir(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		remote, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(remote)
+
+		// v2 is kept in a directory of its own, while v3 of the api module
+		// shares its directory with earlier versions.
+		rev := gitRepo(t, remote, []file{
+			{"api", ""},
+			{"v2", ""},
+			{"foo.go", "package foo"},
+			{"api/api.go", "package api"},
+			{"v2/go.mod", "module example.com/foo/v2"},
+			{"v2/foo.go", "package foo"},
+		})
+		meta := func(root, subdir string) *pkgMeta {
+			return &pkgMeta{Root: root, Remote: "file://" + filepath.ToSlash(remote), VCS: "git", Subdir: subdir}
+		}
+
+		vendor, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(vendor)
+
+		for _, m := range []*pkgMeta{meta("example.com/foo/v2", ""), meta("example.com/foo/api/v3", "api")} {
+			if _, err := goGet(context.Background(), c, m, vendorPath(vendor, m), rev, getOptions{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		compareFiles(t, vendor, []file{
+			{"example.com", ""},
+			{"example.com/foo", ""},
+			{"example.com/foo/v2", ""},
+			{"example.com/foo/api", ""},
+			{"example.com/foo/api/v3", ""},
+			{"example.com/foo/v2/foo.go", "package foo"},
+			{"example.com/foo/api/v3/api.go", "package api"},
+		})
+	})
+}
+
+func TestExcludePath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{"examples/", "examples", true, true},
+		{"examples/", "a/b/examples", true, true},
+		{"examples/", "examples", false, false},
+		{"*.md", "README.md", false, true},
+		{"*.md", "docs/README.md", false, true},
+		{"*.md", "README.mdx", false, false},
+		{"cmd/*/testdata", "cmd/foo/testdata", true, true},
+		{"cmd/*/testdata", "other/cmd/foo/testdata", true, false},
+		{"doc.go", "sub/doc.go", false, true},
+	}
+	for _, test := range tests {
+		if got := excludePath([]string{test.pattern}, test.path, test.isDir); got != test.want {
+			t.Errorf("excludePath(%q, %q, %t): expected %t, got %t", test.pattern, test.path, test.isDir, test.want, got)
+		}
+	}
+}
+
+func TestGoGetRefTypes(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		remote := filepath.Join(dir, "remote")
+		tagged := gitRepo(t, remote, []file{{"foo.go", "package foo // tag"}})
+		git := func(args ...string) string {
+			args = append([]string{"-c", "user.name=got", "-c", "user.email=got@example.com"}, args...)
+			cmd := exec.Command("git", args...)
+			cmd.Dir = remote
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("git %v: %v: %s", args, err, out)
+			}
+			return strings.TrimSpace(string(out))
+		}
+		// A tag and a branch both named "release", at different commits.
+		git("tag", "release")
+		git("checkout", "-b", "release")
+		writeFiles(t, remote, []file{{"foo.go", "package foo // branch"}})
+		git("commit", "-a", "-m", "branch commit")
+		branch := git("rev-parse", "HEAD")
+		git("checkout", "-")
+
+		meta := &pkgMeta{Root: "example.com/foo", Remote: "file://" + filepath.ToSlash(remote), VCS: "git"}
+		tests := []struct {
+			version  string
+			revision string
+			content  string
+		}{
+			{"tag:release", tagged, "package foo // tag"},
+			{"branch:release", branch, "package foo // branch"},
+			{"commit:" + branch, branch, "package foo // branch"},
+			{"commit:" + tagged, tagged, "package foo // tag"},
+		}
+		for i, test := range tests {
+			to := filepath.Join(dir, "vendor", strconv.Itoa(i))
+			revision, err := goGet(context.Background(), c, meta, to, test.version, getOptions{retry: backoff{}})
+			if err != nil {
+				t.Errorf("%s: %v", test.version, err)
+				continue
+			}
+			if revision != test.revision {
+				t.Errorf("%s: expected revision %s, got %s", test.version, test.revision, revision)
+			}
+			compareFiles(t, to, []file{{"foo.go", test.content}})
+		}
+	})
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		refType string
+		name    string
+	}{
+		{"v1.0.0", "", "v1.0.0"},
+		{"tag:v1.0.0", refTag, "v1.0.0"},
+		{"branch:feature/x", refBranch, "feature/x"},
+		{"commit:abc123", refCommit, "abc123"},
+		{"other:abc", "", "other:abc"},
+	}
+	for _, test := range tests {
+		refType, name := parseVersion(test.version)
+		if refType != test.refType || name != test.name {
+			t.Errorf("parseVersion(%q): expected (%q, %q), got (%q, %q)", test.version, test.refType, test.name, refType, name)
+		}
+	}
+}
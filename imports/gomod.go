@@ -0,0 +1,189 @@
+package imports
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ericchiang/got/log"
+)
+
+// ExportGoMod writes a go.mod fragment requiring every repo pinned by the
+// manifest of the project in dir at its pinned revision, as an aid to
+// migrating to modules. Repos are fetched into cacheDir to determine the
+// dates of their pseudo-versions. Repos fetched from a mirror are replaced
+// by it.
+func ExportGoMod(w io.Writer, dir, cacheDir string, resolverOpts ResolverOptions, logger log.Logger) error {
+	pins, err := List(dir)
+	if err != nil {
+		return err
+	}
+	c, err := newCache(cacheDir)
+	if err != nil {
+		return err
+	}
+	pkgs := make([]pinnedPackage, len(pins))
+	for i, p := range pins {
+		pkgs[i] = pinnedPackage{meta: p.meta(), version: p.Version}
+	}
+	ctx := context.Background()
+	commits, err := pinnedCommits(ctx, c, pkgs, resolverOpts.retryPolicy())
+	if err != nil {
+		return err
+	}
+	r, err := loggingResolver(resolverOpts, logger)
+	if err != nil {
+		return err
+	}
+	b, err := goModFragment(ctx, r, pkgs, commits)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// pinnedCommit is the revision a pin refers to, and when it was committed.
+// The date is zero if the repo's VCS can't report it.
+type pinnedCommit struct {
+	revision string
+	date     time.Time
+}
+
+// pinnedCommits fetches every pinned repo and returns the commit each is
+// pinned to, keyed by repo root.
+func pinnedCommits(ctx context.Context, c *cache, pkgs []pinnedPackage, p retryPolicy) (map[string]pinnedCommit, error) {
+	commits := make([]pinnedCommit, len(pkgs))
+	group, gctx := errgroup.WithContext(ctx)
+	for i, pkg := range pkgs {
+		i, pkg := i, pkg
+		group.Go(func() error {
+			err := c.dir(cacheKey(pkg.meta.Remote), func(path string) error {
+				repo, _, err := cloneRepo(gctx, pkg.meta, path, p)
+				if err != nil {
+					return err
+				}
+				revision, err := checkoutVersion(gctx, repo, pkg.version, p)
+				if err != nil {
+					return err
+				}
+				commits[i].revision = revision
+				if info, err := repo.CommitInfo(revision); err == nil {
+					commits[i].date = info.Date
+				}
+				return nil
+			})
+			return errors.Wrapf(err, "determining revision of %s", pkg.meta.Root)
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	byRoot := make(map[string]pinnedCommit, len(pkgs))
+	for i, pkg := range pkgs {
+		byRoot[pkg.meta.Root] = commits[i]
+	}
+	return byRoot, nil
+}
+
+// goModFragment formats a require directive for every pinned repo, using the
+// repo root as the module path. Semantic version tags are used as is, other
+// versions become pseudo-versions of the commits they refer to. A repo whose
+// remote differs from the one r resolves its root to is fetched from a
+// mirror, which gets a replace directive.
+func goModFragment(ctx context.Context, r pkgResolver, pkgs []pinnedPackage, commits map[string]pinnedCommit) ([]byte, error) {
+	f := &modfile.File{Syntax: &modfile.FileSyntax{}}
+	for _, pkg := range pkgs {
+		root := pkg.meta.Root
+		commit, ok := commits[root]
+		if !ok {
+			return nil, errors.Errorf("no revision known for %s", root)
+		}
+		version, err := moduleVersion(root, pkg.version, commit)
+		if err != nil {
+			return nil, err
+		}
+		f.AddNewRequire(root, version, false)
+
+		meta, err := r.resolve(ctx, root)
+		if err != nil {
+			return nil, errors.Wrapf(err, "resolving %s", root)
+		}
+		if meta.Remote == pkg.meta.Remote {
+			continue
+		}
+		mirror, err := remoteModulePath(pkg.meta.Remote)
+		if err != nil {
+			return nil, errors.Wrapf(err, "replacing %s", root)
+		}
+		if err := f.AddReplace(root, "", mirror, version); err != nil {
+			return nil, errors.Wrapf(err, "replacing %s", root)
+		}
+	}
+	f.Cleanup()
+	return modfile.Format(f.Syntax), nil
+}
+
+// moduleVersion returns the module version of a repo pinned to version.
+func moduleVersion(root, version string, commit pinnedCommit) (string, error) {
+	_, pathMajor, ok := module.SplitPathVersion(root)
+	if !ok {
+		return "", errors.Errorf("invalid module path %s", root)
+	}
+	refType, name := parseVersion(version)
+	if refType != refCommit && refType != refBranch && refType != refTrack && semver.IsValid(name) && semver.Canonical(name) == name {
+		if module.CheckPathMajor(name, pathMajor) == nil {
+			return name, nil
+		}
+		// Repos at v2 or later without a major version suffix predate
+		// modules.
+		if pathMajor == "" {
+			return name + "+incompatible", nil
+		}
+	}
+	if commit.revision == "" {
+		return "", errors.Errorf("no revision known for %s", root)
+	}
+	rev := commit.revision
+	if len(rev) > 12 {
+		rev = rev[:12]
+	}
+	major := module.PathMajorPrefix(pathMajor)
+	return module.PseudoVersion(major, "", commit.date.UTC(), rev), nil
+}
+
+// remoteModulePath converts a remote into the module path of the repo it
+// refers to, e.g. "https://github.com/foo/bar.git" to "github.com/foo/bar".
+func remoteModulePath(remote string) (string, error) {
+	var host, path string
+	if u, err := url.Parse(remote); err == nil && u.Scheme != "" && u.Host != "" {
+		switch u.Scheme {
+		case "http", "https", "git", "ssh", "git+ssh", "svn", "svn+ssh", "bzr", "bzr+ssh":
+		default:
+			return "", errors.Errorf("remote %s can't be expressed as a module path", remote)
+		}
+		host, path = u.Hostname(), u.Path
+	} else if i := strings.Index(remote, ":"); i > 0 && !strings.Contains(remote[:i], "/") {
+		// scp-like syntax, e.g. "git@github.com:foo/bar.git".
+		host, path = remote[:i], remote[i+1:]
+		if j := strings.LastIndex(host, "@"); j >= 0 {
+			host = host[j+1:]
+		}
+	} else {
+		return "", errors.Errorf("remote %s can't be expressed as a module path", remote)
+	}
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	modPath := host + "/" + path
+	if err := module.CheckPath(modPath); err != nil {
+		return "", errors.Wrapf(err, "remote %s", remote)
+	}
+	return modPath, nil
+}
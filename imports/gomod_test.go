@@ -0,0 +1,135 @@
+package imports
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+func TestGoModFragment(t *testing.T) {
+	r := resolverFunc(func(ctx context.Context, pkg string) (*pkgMeta, error) {
+		meta, ok := importMeta(pkg)
+		if !ok {
+			t.Fatalf("unexpected lookup of %s", pkg)
+		}
+		return meta, nil
+	})
+	pinned := func(root, remote, version string) pinnedPackage {
+		return pinnedPackage{meta: &pkgMeta{Root: root, Remote: remote, VCS: "git"}, version: version}
+	}
+	pkgs := []pinnedPackage{
+		pinned("github.com/foo/bar", "https://github.com/foo/bar", "14c0d48ead0c6d8a5a1e1f0e9d0b2a4c5e6f7a8b"),
+		pinned("github.com/foo/baz", "https://github.com/foo/baz", "v1.2.0"),
+		pinned("github.com/foo/old", "https://github.com/foo/old", "tag:v3.0.1"),
+		pinned("gopkg.in/yaml.v2", "https://gopkg.in/yaml.v2", "branch:v2"),
+		pinned("github.com/foo/mirrored", "git@git.example.com:mirrors/mirrored.git", "v0.1.0"),
+	}
+	date := time.Date(2017, 9, 15, 3, 28, 32, 0, time.UTC)
+	commits := map[string]pinnedCommit{
+		"github.com/foo/bar":      {"14c0d48ead0c6d8a5a1e1f0e9d0b2a4c5e6f7a8b", date},
+		"github.com/foo/baz":      {"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", date},
+		"github.com/foo/old":      {"bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", date},
+		"gopkg.in/yaml.v2":        {"cccccccccccccccccccccccccccccccccccccccc", date},
+		"github.com/foo/mirrored": {"dddddddddddddddddddddddddddddddddddddddd", date},
+	}
+
+	b, err := goModFragment(context.Background(), r, pkgs, commits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := modfile.Parse("go.mod", b, nil)
+	if err != nil {
+		t.Fatalf("parsing generated go.mod: %v\n%s", err, b)
+	}
+
+	var requires []module.Version
+	for _, req := range f.Require {
+		requires = append(requires, req.Mod)
+	}
+	wantRequires := []module.Version{
+		{Path: "github.com/foo/bar", Version: "v0.0.0-20170915032832-14c0d48ead0c"},
+		{Path: "github.com/foo/baz", Version: "v1.2.0"},
+		{Path: "github.com/foo/old", Version: "v3.0.1+incompatible"},
+		{Path: "gopkg.in/yaml.v2", Version: "v2.0.0-20170915032832-cccccccccccc"},
+		{Path: "github.com/foo/mirrored", Version: "v0.1.0"},
+	}
+	if !reflect.DeepEqual(requires, wantRequires) {
+		t.Errorf("expected requires %v, got %v\n%s", wantRequires, requires, b)
+	}
+
+	var replaces [][2]module.Version
+	for _, rep := range f.Replace {
+		replaces = append(replaces, [2]module.Version{rep.Old, rep.New})
+	}
+	wantReplaces := [][2]module.Version{
+		{{Path: "github.com/foo/mirrored"}, {Path: "git.example.com/mirrors/mirrored", Version: "v0.1.0"}},
+	}
+	if !reflect.DeepEqual(replaces, wantReplaces) {
+		t.Errorf("expected replaces %v, got %v\n%s", wantReplaces, replaces, b)
+	}
+}
+
+func TestPinnedCommits(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		fooDir := filepath.Join(dir, "foo")
+		rev := gitRepo(t, fooDir, []file{{"foo.go", "package foo"}})
+		pkgs := []pinnedPackage{
+			{meta: &pkgMeta{Root: "example.com/foo", Remote: "file://" + filepath.ToSlash(fooDir), VCS: "git"}, version: rev},
+		}
+		commits, err := pinnedCommits(context.Background(), c, pkgs, backoff{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := commits["example.com/foo"]
+		if got.revision != rev {
+			t.Errorf("expected revision %s, got %s", rev, got.revision)
+		}
+		if got.date.IsZero() || time.Since(got.date) > time.Hour {
+			t.Errorf("expected commit date close to now, got %s", got.date)
+		}
+	})
+}
+
+func TestRemoteModulePath(t *testing.T) {
+	tests := []struct {
+		remote  string
+		want    string
+		wantErr bool
+	}{
+		{remote: "https://github.com/foo/bar", want: "github.com/foo/bar"},
+		{remote: "https://github.com/foo/bar.git", want: "github.com/foo/bar"},
+		{remote: "ssh://git@git.example.com:2222/foo/bar.git", want: "git.example.com/foo/bar"},
+		{remote: "git@github.com:foo/bar.git", want: "github.com/foo/bar"},
+		{remote: "file:///src/foo", wantErr: true},
+		{remote: "/src/foo", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := remoteModulePath(test.remote)
+		if err != nil {
+			if !test.wantErr {
+				t.Errorf("remoteModulePath(%q): %v", test.remote, err)
+			}
+			continue
+		}
+		if test.wantErr {
+			t.Errorf("remoteModulePath(%q): expected error, got %q", test.remote, got)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("remoteModulePath(%q): expected %q, got %q", test.remote, test.want, got)
+		}
+	}
+}
@@ -2,36 +2,82 @@
 package imports
 
 import (
+	"bytes"
 	"context"
 	"encoding/xml"
 	"fmt"
 	"go/parser"
 	"go/token"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
+
+	"github.com/ericchiang/got/log"
 )
 
-// loadImports loads a file and parses its import declarations and package name
+// loadImports loads a file and parses its non-standard library imports.
 func loadImports(file string) (imports []string, err error) {
+	all, err := parseImports(file)
+	if err != nil {
+		return nil, err
+	}
+	for _, imp := range all {
+		if !isStdPackage(imp) {
+			imports = append(imports, imp)
+		}
+	}
+	return imports, nil
+}
+
+// parseImports loads a file and parses all of its import declarations.
+func parseImports(file string) (imports []string, err error) {
 	fset := token.NewFileSet()
 	f, err := parser.ParseFile(fset, file, nil, parser.ImportsOnly)
 	if err != nil {
 		return nil, errors.Wrap(err, "parsing file")
 	}
 	for _, imp := range f.Imports {
-		if imp.Path == nil || imp.Path.Value == "" || goStdPackages[imp.Path.Value] {
+		if imp.Path == nil || imp.Path.Value == "" {
 			continue
 		}
-		imports = append(imports, imp.Path.Value)
+		// Import paths are string literals and include their quotes.
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid import path %s", imp.Path.Value)
+		}
+		imports = append(imports, path)
 	}
 	return imports, nil
 }
 
+// isStdPackage reports whether an import path belongs to the standard library.
+// Packages added after goStdPackages was generated are recognized by their
+// first path element not containing a dot, which is true of all standard
+// library packages and no go-gettable ones.
+func isStdPackage(path string) bool {
+	if goStdPackages[path] {
+		return true
+	}
+	elem := path
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		elem = path[:i]
+	}
+	return !strings.Contains(elem, ".")
+}
+
 // pkgMeta holds information about a package's remote repo.
 type pkgMeta struct {
 	// Root is the package that corresponds to the root of the remote repo.
@@ -45,30 +91,241 @@ type pkgMeta struct {
 
 	// VCS is the version control system used by the remote repo. For example "git" or "svn"
 	VCS string
+
+	// Subdir is the directory of the repo that's vendored at Root, slash
+	// separated and empty for the repo root. It's set for Go modules that
+	// don't live at the root of their repo, in which case Root is the
+	// module path rather than the repo root.
+	Subdir string
 }
 
 func importMeta(pkg string) (*pkgMeta, bool) {
+	v, root, ok := matchVCS(pkg)
+	if !ok {
+		return nil, false
+	}
+	return &pkgMeta{
+		Root:   root,
+		Remote: "https://" + root,
+		VCS:    v.vcs,
+	}, true
+}
+
+// matchVCS returns the first entry of vcsList matching pkg, and the repo root
+// it determines.
+func matchVCS(pkg string) (*vcsInfo, string, bool) {
 	for _, v := range vcsList {
 		m := v.regex.FindStringSubmatch(pkg)
 		if m == nil {
 			continue
 		}
 
-		if m[1] != "" {
-			root := m[1]
-			return &pkgMeta{
-				Root:   root,
-				Remote: "https://" + root,
-				VCS:    v.vcs,
-			}, true
+		// Patterns may have alternatives, each with their own rootpkg
+		// group.
+		for i, name := range v.regex.SubexpNames() {
+			if name == "rootpkg" && m[i] != "" {
+				return v, m[i], true
+			}
 		}
 	}
-	return nil, false
+	return nil, "", false
+}
+
+// ResolverOptions configure how import paths are resolved to repos, and how
+// the network operations of resolving and fetching them are retried. The zero
+// value is a valid configuration, which doesn't retry.
+type ResolverOptions struct {
+	// Retries is how many times network operations, such as resolving
+	// import paths and cloning or updating repos, are retried when they
+	// fail in a way that's likely to be transient. See DefaultRetries.
+	Retries int
+
+	// Timeout, if non-zero, bounds each HTTP request independently of how
+	// long the operation as a whole may take, so a single hung server
+	// doesn't use up all of it.
+	Timeout time.Duration
+
+	// GuessRoots enables a last resort for hosts without a go-get endpoint:
+	// the first two path elements after the host are assumed to be a git
+	// repo, github style, which is used if it exists.
+	GuessRoots bool
+
+	// MetaNames are additional meta tag names accepted in place of
+	// 'go-import', for legacy servers. Their content must use the same
+	// three field format.
+	MetaNames []string
+
+	// ResponsesDir, if non-empty, holds go-get responses that are consulted
+	// before making any requests, stored at "<root>.html" for each repo
+	// root. Projects can commit them for offline and auditable resolution.
+	ResponsesDir string
+
+	// Overrides force the repo of packages below a root, taking precedence
+	// over all other resolution, as an escape hatch for misconfigured
+	// servers. Each is of the form "<root> <vcs> <remote>", e.g.
+	// "example.com/foo git https://mirror.example.com/foo".
+	Overrides []string
+
+	// InsecureHosts are hosts whose go-get responses may point at remotes
+	// that don't use a secure transport, such as plain HTTP. Such remotes
+	// are rejected for every other host.
+	InsecureHosts []string
+
+	// HTTPFirstHosts are hosts whose packages go straight to their go-get
+	// endpoint rather than being matched against the patterns of known
+	// hosts first, for hosts whose pattern is wrong. Hosts without a port
+	// match any port.
+	HTTPFirstHosts []string
 }
 
-var defaultResolver = new(resolver)
+// retryPolicy returns the policy network operations are retried with.
+func (opts ResolverOptions) retryPolicy() retryPolicy {
+	return transientBackoff(opts.Retries)
+}
+
+// loggingResolver returns a resolver configured by opts that reports to
+// logger, if non-nil.
+func loggingResolver(opts ResolverOptions, logger log.Logger) (*resolver, error) {
+	r, err := newResolver(opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.logger = logger
+	return r, nil
+}
+
+// newResolver returns a resolver configured by opts, making requests with
+// client. If client is nil, one derived from http.DefaultClient is used, see
+// httpClient. The headers sent with every request are read from the
+// environment, see headerEnvPrefix.
+func newResolver(opts ResolverOptions, client *http.Client) (*resolver, error) {
+	if opts.Timeout < 0 {
+		return nil, errors.Errorf("invalid request timeout %s", opts.Timeout)
+	}
+	if opts.Retries < 0 {
+		return nil, errors.Errorf("invalid number of retries %d", opts.Retries)
+	}
+	var overrides []*pkgMeta
+	for _, s := range opts.Overrides {
+		o, err := parseOverride(s)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, o)
+	}
+	return &resolver{
+		timeout:        opts.Timeout,
+		retry:          opts.retryPolicy(),
+		guessRoots:     opts.GuessRoots,
+		metaNames:      opts.MetaNames,
+		responsesDir:   opts.ResponsesDir,
+		header:         headerFromEnv(os.Environ()),
+		httpFirstHosts: opts.HTTPFirstHosts,
+		strictHTTPS:    true,
+		insecureHosts:  opts.InsecureHosts,
+		overrides:      overrides,
+		credentials:    defaultCredentials,
+		breaker:        &circuitBreaker{hostFailures: 5, budget: 20},
+		client:         client,
+	}, nil
+}
 
 type resolver struct {
+	// timeout, if non-zero, bounds each individual request independently
+	// of the deadline of the context passed to fetchImportMeta.
+	timeout time.Duration
+
+	// logger, if non-nil, receives warnings about suspicious results and, at
+	// the debug level, the requests made and the repos packages resolve to.
+	logger log.Logger
+
+	// guessRoots enables a last resort for hosts without a go-get endpoint.
+	// If fetching the 'go-import' meta tag fails, the first two path
+	// elements after the host are assumed to be a git repo, github style,
+	// and used if probe succeeds.
+	guessRoots bool
+	// probe checks that a remote is a git repo. Defaults to probeGit.
+	probe func(ctx context.Context, remote string) error
+
+	// retry determines how failed requests are retried. Defaults to
+	// defaultRetryPolicy.
+	retry retryPolicy
+
+	// metaNames are additional meta tag names accepted in place of
+	// 'go-import', for legacy servers. Their content must use the same
+	// three field format.
+	metaNames []string
+
+	// strictHTTPS rejects remotes from go-get responses that don't use a
+	// secure transport, unless their host is listed in insecureHosts. This
+	// prevents a malicious response from downgrading a repo to plain HTTP.
+	// It's enabled for the CLI.
+	strictHTTPS   bool
+	insecureHosts []string
+
+	// header is attached to every request, for example to authenticate
+	// against a proxy. Values are never logged.
+	header http.Header
+	// credentials, if non-nil, authenticate requests to hosts they're
+	// configured for, unless header already sets "Authorization". They're
+	// never logged either.
+	credentials *credentials
+
+	// failureCache, if non-nil, records packages that definitively failed to
+	// resolve, such as ones without a 'go-import' meta tag, for failureTTL.
+	// Until a record expires, the failure is returned without making any
+	// requests. Transient errors are never recorded. See isNotFound.
+	failureCache *cache
+	failureTTL   time.Duration
+	// metaCache, if non-nil, persists resolved repos across runs. Entries
+	// are loaded by the first fetchImportMeta call and expire after
+	// metaTTL, defaulting to defaultMetaTTL, so changed vanity redirects
+	// are eventually picked up.
+	metaCache *cache
+	metaTTL   time.Duration
+	loadMeta  sync.Once
+
+	// breaker, if non-nil, fails requests fast once a host, or the run as a
+	// whole, has seen too many transient failures. Unlike retry, it's meant
+	// to be shared by every request of a run.
+	breaker *circuitBreaker
+
+	// now returns the current time. Defaults to time.Now.
+	now func() time.Time
+
+	// client, if non-nil, makes every request as is, for example to use a
+	// proxy or custom TLS configuration for internal vanity hosts.
+	// Otherwise one is derived from http.DefaultClient by httpClient.
+	client     *http.Client
+	clientOnce sync.Once
+
+	// dialTimeout and tlsHandshakeTimeout bound connecting to a server,
+	// independently of timeout, so an unreachable host fails fast. They
+	// default to defaultDialTimeout and defaultTLSHandshakeTimeout. They
+	// don't apply to an explicit client.
+	dialTimeout         time.Duration
+	tlsHandshakeTimeout time.Duration
+
+	// userAgent is sent with every request. Defaults to defaultUserAgent.
+	// A "User-Agent" entry in header takes precedence.
+	userAgent string
+
+	// responsesDir, if non-empty, holds go-get responses that are consulted
+	// before making any requests. This lets projects commit the responses
+	// for fully offline and auditable resolution. The response for a repo
+	// root is stored at "<root>.html", e.g. "golang.org/x/net.html".
+	responsesDir string
+
+	// overrides force the repo of packages below their roots, taking
+	// precedence over all other resolution. This is an escape hatch for
+	// misconfigured servers. See parseOverride.
+	overrides []*pkgMeta
+
+	// httpFirstHosts are hosts whose packages skip static matching against
+	// vcsList and go straight to their go-get endpoint, for hosts whose
+	// static pattern is wrong.
+	httpFirstHosts []string
+
 	mu sync.Mutex
 
 	// inflight requests
@@ -89,35 +346,149 @@ type resolverInflight struct {
 	err  error
 }
 
-func (r *resolver) fetchImportMeta(ctx context.Context, pkg string) (*pkgMeta, error) {
-	r.mu.Lock()
+// resolve resolves a package statically if possible, falling back to its
+// go-get endpoint.
+func (r *resolver) resolve(ctx context.Context, pkg string) (*pkgMeta, error) {
+	if meta, ok := matchOverride(r.overrides, pkg); ok {
+		return meta, nil
+	}
+	if !r.httpFirst(pkg) {
+		if meta, ok := importMeta(pkg); ok {
+			return meta, nil
+		}
+	}
+	if r.responsesDir != "" {
+		meta, ok, err := loadResponse(r.responsesDir, pkg)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return meta, r.checkRemote(pkg, meta)
+		}
+	}
+	return r.fetchImportMeta(ctx, pkg)
+}
 
-	// First check the cache.
-	for _, result := range r.results {
-		if !strings.HasPrefix(pkg, result.Root) {
-			continue
+// parseOverride parses a repo override, which uses the same format as the
+// content of a 'go-import' meta tag: "<root> <vcs> <remote>".
+func parseOverride(s string) (*pkgMeta, error) {
+	f := strings.Fields(s)
+	if len(f) != 3 {
+		return nil, errors.Errorf("invalid override %q, expected form '<root> <vcs> <remote>'", s)
+	}
+	remote, err := normalizeRemote(f[2])
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid override %q", s)
+	}
+	return &pkgMeta{Root: f[0], VCS: f[1], Remote: remote}, nil
+}
+
+// httpFirst reports whether pkg's host is one of httpFirstHosts. Hosts
+// without a port match any port.
+func (r *resolver) httpFirst(pkg string) bool {
+	host := pkg
+	if i := strings.IndexByte(pkg, '/'); i >= 0 {
+		host = pkg[:i]
+	}
+	hostname := host
+	if i := strings.LastIndexByte(host, ':'); i >= 0 {
+		hostname = host[:i]
+	}
+	for _, h := range r.httpFirstHosts {
+		if strings.EqualFold(h, host) || strings.EqualFold(h, hostname) {
+			return true
 		}
+	}
+	return false
+}
 
-		result := result
-		r.mu.Unlock()
-		return result, nil
+// matchOverride returns the override with the longest root that's a parent
+// of pkg.
+func matchOverride(overrides []*pkgMeta, pkg string) (*pkgMeta, bool) {
+	var match *pkgMeta
+	for _, o := range overrides {
+		if hasPathPrefix(pkg, o.Root) && (match == nil || len(o.Root) > len(match.Root)) {
+			match = o
+		}
 	}
+	return match, match != nil
+}
 
-	// Then check if there's an inflight request that can satisfy the same query.
-	for _, inflight := range r.inflight {
-		if !strings.HasPrefix(pkg, inflight.pkg) && !strings.HasPrefix(inflight.pkg, pkg) {
-			continue
+// loadResponse looks for a stored go-get response for a package, trying each
+// of the package's parent paths as the repo root. Import paths come from
+// source files and manifests, so ones that could name a file outside of dir
+// are rejected.
+func loadResponse(dir, pkg string) (*pkgMeta, bool, error) {
+	if path.IsAbs(pkg) || path.Clean(pkg) != pkg || strings.Contains(pkg, `\`) {
+		return nil, false, errors.Errorf("invalid import path %q", pkg)
+	}
+	for _, elem := range strings.Split(pkg, "/") {
+		if elem == ".." {
+			return nil, false, errors.Errorf("invalid import path %q", pkg)
+		}
+	}
+	for root := pkg; root != "." && root != "/"; root = path.Dir(root) {
+		filename := filepath.Join(dir, filepath.FromSlash(root)+".html")
+		f, err := os.Open(filename)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, false, errors.Wrap(err, "opening stored go-get response")
+		}
+		meta, err := parseImportMeta(f, pkg, nil)
+		f.Close()
+		if err != nil {
+			return nil, false, errors.Wrapf(err, "parsing stored go-get response %s", filename)
+		}
+		if !hasPathPrefix(pkg, meta.Root) {
+			return nil, false, errors.Errorf("stored go-get response %s is for %s, not %s", filename, meta.Root, pkg)
+		}
+		return meta, true, nil
+	}
+	return nil, false, nil
+}
+
+func (r *resolver) fetchImportMeta(ctx context.Context, pkg string) (*pkgMeta, error) {
+	if r.metaCache != nil {
+		r.loadMeta.Do(r.loadMetaCache)
+	}
+	r.mu.Lock()
+	for {
+		// First check the cache. Results loaded from the metaCache may
+		// have been stored by a run allowing insecure hosts, so they're
+		// checked again.
+		if result, ok := r.cachedResult(pkg); ok {
+			r.mu.Unlock()
+			if err := r.checkRemote(pkg, result); err != nil {
+				return nil, err
+			}
+			return result, nil
+		}
+
+		// Then check if there's an inflight request that's likely to
+		// resolve to the same repo.
+		inflight, ok := r.sharedInflight(pkg)
+		if !ok {
+			break
 		}
 		// Found an inflight request, just wait on that.
-		inflight := inflight
 		r.mu.Unlock()
-
 		select {
 		case <-ctx.Done():
 			return nil, errors.Wrap(ctx.Err(), "stopped waiting for inflight request")
 		case <-inflight.done:
-			return inflight.meta, inflight.err
 		}
+		if inflight.err != nil {
+			if hasPathPrefix(pkg, inflight.pkg) {
+				return nil, inflight.err
+			}
+		} else if hasPathPrefix(pkg, inflight.meta.Root) {
+			return inflight.meta, nil
+		}
+		// The request was for a different repo, such as a sibling of
+		// pkg in a repo of its own, so check again.
+		r.mu.Lock()
 	}
 
 	// No inflight request, have to set one up.
@@ -126,21 +497,30 @@ func (r *resolver) fetchImportMeta(ctx context.Context, pkg string) (*pkgMeta, e
 	r.inflight = append(r.inflight, inflight)
 	r.mu.Unlock()
 
-	// Fetch metadata.
-	inflight.meta, inflight.err = fetchImportMeta(ctx, pkg)
-
-	// Signal to other goroutines that the results can be checked.
-	close(done)
+	// Fetch metadata, tagging the messages of the fetch with the package
+	// so they can be told apart from those of concurrent fetches.
+	fctx := ctx
+	if r.logger != nil {
+		fctx = context.WithValue(ctx, fetchLoggerKey{}, r.logger.With("pkg", pkg))
+	}
+	inflight.meta, inflight.err = r.fetch(fctx, pkg)
 
-	// Remove inflight from query. Record result if no errors were experienced.
+	// Record result if no errors were experienced.
+	if inflight.err == nil && r.metaCache != nil {
+		if err := r.storeMetaCache(inflight.meta); err != nil && r.logger != nil {
+			r.logger.Errorf("caching repo of %s: %v", pkg, err)
+		}
+	}
 	r.mu.Lock()
 	if inflight.err == nil {
 		r.results = append(r.results, inflight.meta)
 	}
 
+	// Remove inflight from query before signaling, so goroutines waiting
+	// on it for a different repo don't find it again.
 	n := 0
 	for _, inf := range r.inflight {
-		if inf.pkg == pkg {
+		if inf == inflight {
 			continue
 		}
 		r.inflight[n] = inf
@@ -149,73 +529,534 @@ func (r *resolver) fetchImportMeta(ctx context.Context, pkg string) (*pkgMeta, e
 	r.inflight = r.inflight[:n]
 	r.mu.Unlock()
 
+	// Signal to other goroutines that the results can be checked.
+	close(done)
+
 	return inflight.meta, inflight.err
 }
 
-func fetchImportMeta(ctx context.Context, pkg string) (*pkgMeta, error) {
+// cachedResult returns the repo of a previous request holding pkg. Repos can
+// be nested, so the one with the longest root wins. r.mu must be held.
+func (r *resolver) cachedResult(pkg string) (*pkgMeta, bool) {
+	var meta *pkgMeta
+	for _, result := range r.results {
+		if hasPathPrefix(pkg, result.Root) && (meta == nil || len(result.Root) > len(meta.Root)) {
+			meta = result
+		}
+	}
+	return meta, meta != nil
+}
+
+// sharedRootElems is the number of leading path elements two packages must
+// share for a request for one to wait on a request for the other, since
+// they likely belong to the same repo. Most repo roots, such as
+// "github.com/foo/bar" or "golang.org/x/net", have three elements, so
+// subpackages of the same repo wait on each other while requests for
+// different repos of the same host run concurrently.
+const sharedRootElems = 3
+
+// sharedInflight returns an inflight request that's likely to resolve to the
+// repo holding pkg. That's the case if one of the packages is below the other,
+// or if they have the first sharedRootElems path elements in common. r.mu
+// must be held.
+func (r *resolver) sharedInflight(pkg string) (*resolverInflight, bool) {
+	for _, inflight := range r.inflight {
+		if hasPathPrefix(pkg, inflight.pkg) || hasPathPrefix(inflight.pkg, pkg) {
+			return inflight, true
+		}
+		if prefix := rootPrefix(pkg); prefix != "" && prefix == rootPrefix(inflight.pkg) {
+			return inflight, true
+		}
+	}
+	return nil, false
+}
+
+// rootPrefix returns the first sharedRootElems path elements of pkg, or an
+// empty string if it has fewer.
+func rootPrefix(pkg string) string {
+	elems := strings.SplitN(pkg, "/", sharedRootElems+1)
+	if len(elems) < sharedRootElems {
+		return ""
+	}
+	return strings.Join(elems[:sharedRootElems], "/")
+}
+
+// fetchLoggerKey is the context key of the logger of an inflight fetch.
+type fetchLoggerKey struct{}
+
+// fetchLogger returns the logger for messages about requests made with ctx:
+// the one of the inflight fetch they belong to, if any, or r.logger.
+func (r *resolver) fetchLogger(ctx context.Context) log.Logger {
+	if l, ok := ctx.Value(fetchLoggerKey{}).(log.Logger); ok {
+		return l
+	}
+	return r.logger
+}
+
+func (r *resolver) fetch(ctx context.Context, pkg string) (*pkgMeta, error) {
+	if r.failureCache == nil {
+		return r.fetchUncached(ctx, pkg)
+	}
+	if err := r.cachedFailure(pkg); err != nil {
+		return nil, err
+	}
+	meta, err := r.fetchUncached(ctx, pkg)
+	if err != nil && isNotFound(err) {
+		if rerr := r.recordFailure(pkg, err); rerr != nil && r.logger != nil {
+			r.fetchLogger(ctx).Errorf("caching resolution failure of %s: %v", pkg, rerr)
+		}
+	}
+	return meta, err
+}
+
+func (r *resolver) fetchUncached(ctx context.Context, pkg string) (*pkgMeta, error) {
+	var meta *pkgMeta
+	host := strings.SplitN(pkg, "/", 2)[0]
+	err := retry(ctx, r.retry, func() error {
+		if r.breaker != nil {
+			if err := r.breaker.allow(host); err != nil {
+				return err
+			}
+		}
+		ctx := ctx
+		if r.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, r.timeout)
+			defer cancel()
+		}
+		var err error
+		meta, err = r.get(ctx, pkg)
+		if r.breaker != nil {
+			r.breaker.record(host, err)
+		}
+		return err
+	})
+	if err != nil {
+		if !r.guessRoots {
+			return nil, err
+		}
+		guessed, gerr := r.guessRoot(ctx, pkg)
+		if gerr != nil {
+			return nil, errors.Wrapf(err, "guessing repo root failed (%v)", gerr)
+		}
+		if r.logger != nil {
+			r.fetchLogger(ctx).Infof("%s: no go-import meta tag, guessed repo root %s", pkg, guessed.Root)
+		}
+		return guessed, nil
+	}
+	if err := r.checkRemote(pkg, meta); err != nil {
+		return nil, err
+	}
+	if r.logger != nil && caseMismatch(pkg, meta.Root) {
+		// Import paths are case sensitive, but filesystems like the macOS
+		// default aren't, which can hide the mismatch until build time.
+		r.fetchLogger(ctx).Errorf("import path %s differs in case from its repo root %s", pkg, meta.Root)
+	}
+	if r.logger != nil {
+		r.fetchLogger(ctx).Debugf("%s: resolved to %s repo %s at %s", pkg, meta.VCS, meta.Root, meta.Remote)
+	}
+	return meta, nil
+}
+
+func (r *resolver) guessRoot(ctx context.Context, pkg string) (*pkgMeta, error) {
+	parts := strings.SplitN(pkg, "/", 4)
+	if len(parts) < 3 {
+		return nil, errors.Errorf("package %s has too few path elements to guess repo root", pkg)
+	}
+	root := strings.Join(parts[:3], "/")
+	remote := "https://" + root
+
+	probe := r.probe
+	if probe == nil {
+		probe = probeGit
+	}
+	if err := probe(ctx, remote); err != nil {
+		return nil, errors.Wrapf(err, "probing guessed remote %s", remote)
+	}
+	return &pkgMeta{Root: root, Remote: remote, VCS: "git"}, nil
+}
+
+// probeGit checks that a remote is a git repo without cloning it.
+func probeGit(ctx context.Context, remote string) error {
+	env, err := defaultCredentials.gitEnv(remote)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, "git", "ls-remote", "--", remote, "HEAD")
+	// Don't prompt for credentials, treat the remote as unavailable.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd.Env = append(cmd.Env, env...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Errorf("git ls-remote: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// checkRemote enforces strictHTTPS on the repo pkg resolved to, wherever the
+// result came from.
+func (r *resolver) checkRemote(pkg string, meta *pkgMeta) error {
+	if !r.strictHTTPS {
+		return nil
+	}
+	if err := checkSecureRemote(meta.Remote, r.insecureHosts); err != nil {
+		return errors.Wrapf(err, "resolving %s", pkg)
+	}
+	return nil
+}
+
+// checkSecureRemote returns an error if a remote doesn't use a secure
+// transport and its host isn't one of insecureHosts.
+func checkSecureRemote(remote string, insecureHosts []string) error {
+	u, err := url.Parse(remote)
+	if err != nil {
+		return errors.Wrap(err, "parsing remote")
+	}
+	switch u.Scheme {
+	case "https", "ssh", "git+ssh":
+		return nil
+	}
+	for _, host := range insecureHosts {
+		if u.Hostname() == host {
+			return nil
+		}
+	}
+	return errors.Errorf("remote %s uses insecure scheme %q", remote, u.Scheme)
+}
+
+// caseMismatch reports whether root is a prefix of pkg when compared case
+// insensitively, but not when compared exactly.
+func caseMismatch(pkg, root string) bool {
+	if len(pkg) < len(root) || strings.HasPrefix(pkg, root) {
+		return false
+	}
+	return strings.EqualFold(pkg[:len(root)], root)
+}
+
+// get makes a single request to a package's go-get endpoint.
+func (r *resolver) get(ctx context.Context, pkg string) (*pkgMeta, error) {
+	resp, u, err := r.request(ctx, pkg)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	meta, err := parseImportMeta(resp.Body, pkg, r.metaNames)
+	if err == nil {
+		return meta, nil
+	}
+	chain := redirectChain(resp)
+	if errors.Cause(err) == errNoGoImport && len(chain) > 1 {
+		// Some vanity hosts redirect to a page that only serves the meta
+		// tag for go-get requests, but drop the query on the way, so ask
+		// the final location again.
+		if final := resp.Request.URL; final.Query().Get("go-get") != "1" {
+			meta, chain, err = r.getRedirected(ctx, pkg, goGetURL(final), chain)
+			if err == nil {
+				return meta, nil
+			}
+		}
+	}
+	if len(chain) > 1 {
+		return nil, errors.Wrapf(err, "parsing response from %s (redirected %s)", u, strings.Join(chain, " -> "))
+	}
+	return nil, errors.Wrapf(err, "parsing response from %s", u)
+}
+
+// getRedirected re-issues a go-get request for pkg to the location a previous
+// request was redirected to, returning the redirect chain extended by the new
+// request's.
+func (r *resolver) getRedirected(ctx context.Context, pkg, u string, chain []string) (*pkgMeta, []string, error) {
+	resp, err := r.requestURL(ctx, u)
+	if err != nil {
+		return nil, append(chain, u), err
+	}
+	defer resp.Body.Close()
+	chain = append(chain, redirectChain(resp)...)
+	meta, err := parseImportMeta(resp.Body, pkg, r.metaNames)
+	return meta, chain, err
+}
+
+// redirectChain returns the URLs requested to get a response, starting with
+// the original request and ending with the one that was answered.
+func redirectChain(resp *http.Response) []string {
+	var chain []string
+	for req := resp.Request; req != nil; {
+		chain = append([]string{req.URL.String()}, chain...)
+		if req.Response == nil {
+			break
+		}
+		req = req.Response.Request
+	}
+	return chain
+}
+
+// goGetURL returns u with the go-get query parameter set.
+func goGetURL(u *url.URL) string {
+	v := *u
+	q := v.Query()
+	q.Set("go-get", "1")
+	v.RawQuery = q.Encode()
+	return v.String()
+}
+
+// request requests a package's go-get endpoint, returning the response and the
+// URL requested. Responses without a 2xx status are returned as an
+// *httpStatusError.
+func (r *resolver) request(ctx context.Context, pkg string) (*http.Response, string, error) {
 	u := "https://" + pkg
 	if strings.ContainsRune(u, '?') {
 		u = u + "&go-get=1"
 	} else {
 		u = u + "?go-get=1"
 	}
+	resp, err := r.requestURL(ctx, u)
+	return resp, u, err
+}
+
+// requestURL issues a go-get request for a URL, which must include the query.
+func (r *resolver) requestURL(ctx context.Context, u string) (*http.Response, error) {
+	resp, err := r.do(ctx, u)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting go-get url %s", u)
+	}
+	if resp.StatusCode/100 != 2 {
+		resp.Body.Close()
+		return nil, &httpStatusError{url: u, status: resp.Status, code: resp.StatusCode}
+	}
+	return resp, nil
+}
+
+// do issues a GET request for a URL using the resolver's client, user agent,
+// headers and credentials.
+func (r *resolver) do(ctx context.Context, u string) (*http.Response, error) {
 	req, err := http.NewRequest(http.MethodGet, u, nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "create request")
 	}
 	req = req.WithContext(ctx)
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, errors.Wrapf(err, "getting go-get url %s", u)
+	req.Header.Set("User-Agent", defaultUserAgent)
+	if r.userAgent != "" {
+		req.Header.Set("User-Agent", r.userAgent)
 	}
-	defer resp.Body.Close()
+	for name, values := range r.header {
+		req.Header[name] = values
+	}
+	r.credentials.authorize(req)
+	if r.logger != nil {
+		r.fetchLogger(ctx).Debugf("fetching %s %s", u, maskHeader(r.header))
+	}
+	return r.httpClient().Do(req)
+}
 
-	if resp.StatusCode/100 != 2 {
-		return nil, errors.Errorf("getting go-get url %s: %s", u, resp.Status)
+const (
+	defaultClientTimeout       = 30 * time.Second
+	defaultDialTimeout         = 10 * time.Second
+	defaultTLSHandshakeTimeout = 10 * time.Second
+)
+
+// httpClient returns the resolver's client if set. Otherwise it returns
+// http.DefaultClient with the resolver's connection timeouts applied to its
+// transport, bounded by defaultClientTimeout unless it sets its own timeout.
+func (r *resolver) httpClient() *http.Client {
+	r.clientOnce.Do(func() {
+		if r.client != nil {
+			return
+		}
+		client := *http.DefaultClient
+		if client.Timeout == 0 {
+			client.Timeout = defaultClientTimeout
+		}
+		t, ok := client.Transport.(*http.Transport)
+		if client.Transport == nil {
+			t, ok = http.DefaultTransport.(*http.Transport)
+		}
+		if !ok {
+			// A custom transport is responsible for its own timeouts.
+			r.client = &client
+			return
+		}
+
+		dialTimeout := r.dialTimeout
+		if dialTimeout == 0 {
+			dialTimeout = defaultDialTimeout
+		}
+		t = t.Clone()
+		t.DialContext = (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+		t.TLSHandshakeTimeout = r.tlsHandshakeTimeout
+		if t.TLSHandshakeTimeout == 0 {
+			t.TLSHandshakeTimeout = defaultTLSHandshakeTimeout
+		}
+		client.Transport = t
+		r.client = &client
+	})
+	return r.client
+}
+
+// defaultUserAgent identifies got to the servers it makes requests to, so
+// operators can tell its traffic apart from other Go HTTP clients.
+const defaultUserAgent = "got/devel"
+
+// headerEnvPrefix is the prefix of environment variables setting headers for
+// the default resolver. Underscores in the rest of the variable name are
+// replaced with dashes, so GOT_HTTP_HEADER_X_TOKEN sets "X-Token".
+const headerEnvPrefix = "GOT_HTTP_HEADER_"
+
+// headerFromEnv parses request headers from environment variables of the form
+// returned by os.Environ.
+func headerFromEnv(environ []string) http.Header {
+	h := http.Header{}
+	for _, kv := range environ {
+		if !strings.HasPrefix(kv, headerEnvPrefix) {
+			continue
+		}
+		kv = strings.TrimPrefix(kv, headerEnvPrefix)
+		i := strings.IndexByte(kv, '=')
+		if i <= 0 {
+			continue
+		}
+		h.Add(strings.Replace(kv[:i], "_", "-", -1), kv[i+1:])
 	}
+	return h
+}
 
-	meta, err := parseImportMeta(resp.Body)
-	if err != nil {
-		return nil, errors.Wrapf(err, "parsing response from %s", u)
+// maskHeader formats the names of headers with their values masked, so they
+// can be logged.
+func maskHeader(h http.Header) string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name+": ****")
 	}
-	return meta, nil
+	sort.Strings(names)
+	return "[" + strings.Join(names, ", ") + "]"
 }
 
-func parseImportMeta(r io.Reader) (*pkgMeta, error) {
+// httpStatusError is returned when a go-get endpoint responds with a non-2xx
+// status code.
+type httpStatusError struct {
+	url    string
+	status string
+	code   int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("getting go-get url %s: %s", e.url, e.status)
+}
+
+// errNoGoImport is returned when a go-get response has no 'go-import' meta
+// tag for the package.
+var errNoGoImport = errors.New("no 'go-import' meta field found")
+
+// parseImportMeta returns the 'go-import' meta tag in the head of a go-get
+// response for pkg. Some hosts serve several tags, such as one for a module
+// proxy next to one for the repo, or tags for other repos of the host, so the
+// tag whose prefix is the longest match for pkg is picked, preferring VCSs to
+// module proxies, which can't be cloned. Tags with any of the extraNames are
+// also accepted, for legacy servers which predate the 'go-import' name.
+func parseImportMeta(r io.Reader, pkg string, extraNames []string) (*pkgMeta, error) {
 	d := xml.NewDecoder(r)
 	d.CharsetReader = charsetReader
 	d.Strict = false
+	var candidates [][]string
+tokens:
 	for {
-		t, err := d.Token()
+		// RawToken skips the bookkeeping Token does to match start and end
+		// elements and resolve namespaces, neither of which matter for HTML.
+		t, err := d.RawToken()
 		if err != nil {
-			if err == io.EOF {
-				// If we hit the end of the markup and don't have anything
-				// we return an error.
-				return nil, errors.Errorf("no 'go-import' meta field found")
+			if err == io.EOF || len(candidates) > 0 {
+				// Use whatever was found before the end of the markup,
+				// or markup too broken to parse further.
+				break
 			}
 			return nil, errors.Wrap(err, "parsing go-get response")
 		}
-		if e, ok := t.(xml.StartElement); ok && strings.EqualFold(e.Name.Local, "body") {
-			return nil, errors.Errorf("no 'go-import' meta field found")
-		}
-		if e, ok := t.(xml.EndElement); ok && strings.EqualFold(e.Name.Local, "head") {
-			return nil, errors.Errorf("no 'go-import' meta field found")
+
+		switch e := t.(type) {
+		case xml.StartElement:
+			switch {
+			case strings.EqualFold(e.Name.Local, "body"):
+				break tokens
+			case !strings.EqualFold(e.Name.Local, "meta"):
+				continue
+			}
+			if !isImportMetaName(attrValue(e.Attr, "name"), extraNames) {
+				continue
+			}
+			if f := strings.Fields(attrValue(e.Attr, "content")); len(f) == 3 {
+				candidates = append(candidates, f)
+			}
+		case xml.EndElement:
+			if strings.EqualFold(e.Name.Local, "head") {
+				break tokens
+			}
 		}
-		e, ok := t.(xml.StartElement)
-		if !ok || !strings.EqualFold(e.Name.Local, "meta") {
+	}
+	if len(candidates) == 0 {
+		return nil, errNoGoImport
+	}
+
+	var best []string
+	for _, f := range candidates {
+		// Roots differing from the package in case are matched, and
+		// reported by the resolver, see caseMismatch.
+		if !hasPathPrefix(strings.ToLower(pkg), strings.ToLower(f[0])) {
 			continue
 		}
-		if attrValue(e.Attr, "name") != "go-import" {
-			continue
+		switch {
+		case best == nil, len(f[0]) > len(best[0]):
+			best = f
+		case len(f[0]) == len(best[0]) && best[1] == "mod" && f[1] != "mod":
+			best = f
+		}
+	}
+	if best == nil {
+		var found []string
+		for _, f := range candidates {
+			found = append(found, strings.Join(f, " "))
 		}
-		if f := strings.Fields(attrValue(e.Attr, "content")); len(f) == 3 {
-			return &pkgMeta{
-				Root:   f[0],
-				VCS:    f[1],
-				Remote: f[2],
-			}, nil
+		return nil, errors.Errorf("no 'go-import' meta field matches %s, found %q", pkg, found)
+	}
+	remote, err := normalizeRemote(best[2])
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid 'go-import' meta field for %s", best[0])
+	}
+	return &pkgMeta{
+		Root:   best[0],
+		VCS:    best[1],
+		Remote: remote,
+	}, nil
+}
+
+func isImportMetaName(name string, extraNames []string) bool {
+	if name == "go-import" {
+		return true
+	}
+	for _, extra := range extraNames {
+		if name == extra {
+			return true
 		}
 	}
+	return false
+}
+
+// normalizeRemote validates the repo URL of a 'go-import' meta field.
+// Misconfigured servers sometimes omit the scheme ("github.com/foo/bar"),
+// in which case HTTPS is assumed.
+func normalizeRemote(remote string) (string, error) {
+	if !strings.Contains(remote, "://") {
+		remote = "https://" + remote
+	}
+	u, err := url.Parse(remote)
+	if err != nil {
+		return "", errors.Wrap(err, "parsing repo url")
+	}
+	if u.Host == "" || u.Scheme == "" {
+		return "", errors.Errorf("repo url %q has no host", remote)
+	}
+	return u.String(), nil
 }
 
 func charsetReader(charset string, input io.Reader) (io.Reader, error) {
@@ -244,12 +1085,26 @@ type vcsInfo struct {
 }
 
 func init() {
+	if err := checkVCSList(vcsList); err != nil {
+		panic(err)
+	}
 	// Precompile the regular expressions used to check VCS locations.
 	for _, v := range vcsList {
 		v.regex = regexp.MustCompile(v.pattern)
 	}
 }
 
+// checkVCSList catches entries with a VCS newRepo doesn't understand, which
+// would otherwise silently fall back to detecting the VCS over the network.
+func checkVCSList(list []*vcsInfo) error {
+	for _, v := range list {
+		if !knownVCS[v.vcs] {
+			return errors.Errorf("vcs list: unknown vcs %q for pattern %s", v.vcs, v.pattern)
+		}
+	}
+	return nil
+}
+
 var vcsList = []*vcsInfo{
 	{
 		host:    "github.com",
@@ -261,6 +1116,30 @@ var vcsList = []*vcsInfo{
 		pattern: `^(?P<rootpkg>bitbucket\.org/([A-Za-z0-9_.\-]+/[A-Za-z0-9_.\-]+))(/[A-Za-z0-9_.\-]+)*$`,
 		// Bitbucket can host multiple kind of repos.
 	},
+	// sourcehut usernames are prefixed with "~".
+	{
+		host:    "git.sr.ht",
+		pattern: `^(?P<rootpkg>git\.sr\.ht/~[A-Za-z0-9_.\-]+/[A-Za-z0-9_.\-]+)(/[A-Za-z0-9_.\-]+)*$`,
+		vcs:     "git",
+	},
+	// GitLab supports nested subgroups, so the root of a path with more than
+	// two elements is ambiguous without a request, unless the repo is
+	// marked by a ".git" suffix as GitLab recommends for subgroups.
+	{
+		host:    "gitlab.com",
+		pattern: `^(?P<rootpkg>gitlab\.com/[A-Za-z0-9_.\-]+/([A-Za-z0-9_.\-]+/)*?[A-Za-z0-9_.\-]+\.git)(/[A-Za-z0-9_.\-]+)*$|^(?P<rootpkg>gitlab\.com/[A-Za-z0-9_.\-]+/[A-Za-z0-9_.\-]+)$`,
+		vcs:     "git",
+	},
+	// gopkg.in serves major versions of packages hosted on GitHub as git
+	// repos, either gopkg.in/pkg.vN or gopkg.in/user/pkg.vN.
+	{
+		host:    "gopkg.in",
+		pattern: `^(?P<rootpkg>gopkg\.in/([A-Za-z0-9][A-Za-z0-9_\-]*/)?[A-Za-z0-9][A-Za-z0-9_\-]*\.v[0-9]+(-unstable)?)(/[A-Za-z0-9_.\-]+)*$`,
+		vcs:     "git",
+	},
+	// The second element of a launchpad.net path may be a series of the
+	// project, a branch of its own, or a package of the project's main
+	// branch. Like the go tool, it's assumed to be a series.
 	{
 		host:    "launchpad.net",
 		pattern: `^(?P<rootpkg>launchpad\.net/(([A-Za-z0-9_.\-]+)(/[A-Za-z0-9_.\-]+)?|~[A-Za-z0-9_.\-]+/(\+junk|[A-Za-z0-9_.\-]+)/[A-Za-z0-9_.\-]+))(/[A-Za-z0-9_.\-]+)*$`,
@@ -268,7 +1147,7 @@ var vcsList = []*vcsInfo{
 	},
 	{
 		host:    "git.launchpad.net",
-		pattern: `^(?P<rootpkg>git\.launchpad\.net/(([A-Za-z0-9_.\-]+)|~[A-Za-z0-9_.\-]+/(\+git|[A-Za-z0-9_.\-]+)/[A-Za-z0-9_.\-]+))$`,
+		pattern: `^(?P<rootpkg>git\.launchpad\.net/(([A-Za-z0-9_.\-]+)|~[A-Za-z0-9_.\-]+/(\+git|[A-Za-z0-9_.\-]+)/[A-Za-z0-9_.\-]+))(/[A-Za-z0-9_.\-]+)*$`,
 		vcs:     "git",
 	},
 	{
@@ -278,7 +1157,7 @@ var vcsList = []*vcsInfo{
 	},
 	{
 		host:    "go.googlesource.com",
-		pattern: `^(?P<rootpkg>go\.googlesource\.com/[A-Za-z0-9_.\-]+/?)$`,
+		pattern: `^(?P<rootpkg>go\.googlesource\.com/[A-Za-z0-9_.\-]+)(/[A-Za-z0-9_.\-]+)*$`,
 	},
 	// TODO: Once Google Code becomes fully deprecated this can be removed.
 	{
@@ -288,15 +1167,16 @@ var vcsList = []*vcsInfo{
 	},
 	// Alternative Google setup for SVN. This is the previous structure but it still works... until Google Code goes away.
 	{
-		pattern: `^(?P<rootpkg>[a-z0-9_\-.]+\.googlecode\.com/svn(/.*)?)$`,
-		vcs:     "svc",
+		pattern: `^(?P<rootpkg>[a-z0-9_\-.]+\.googlecode\.com/svn)(/.*)?$`,
+		vcs:     "svn",
 	},
 	// Alternative Google setup. This is the previous structure but it still works... until Google Code goes away.
 	{
 		pattern: `^(?P<rootpkg>[a-z0-9_\-.]+\.googlecode\.com/(git|hg))(/.*)?$`,
 	},
 	// If none of the previous detect the type they will fall to this looking for the type in a generic sense
-	// by the extension to the path.
+	// by the extension to the path. The path before the extension is matched lazily, so the root ends at
+	// the first element with a VCS extension.
 	{
 		pattern: `^(?P<rootpkg>(?P<repo>([a-z0-9.\-]+\.)+[a-z0-9.\-]+(:[0-9]+)?/[A-Za-z0-9_.\-/]*?)\.(bzr|git|hg|svn))(/[A-Za-z0-9_.\-]+)*$`,
 	},
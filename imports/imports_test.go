@@ -1,11 +1,24 @@
 package imports
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ericchiang/got/log"
 )
 
 func TestLoadInfo(t *testing.T) {
@@ -43,7 +56,7 @@ import (
 		if err != nil {
 			t.Fatalf("loading file %s: %v", target, err)
 		}
-		if reflect.DeepEqual(imports, test.imports) {
+		if !reflect.DeepEqual(imports, test.imports) {
 			t.Errorf("expected package imports %q got %q", test.imports, imports)
 		}
 	}
@@ -73,6 +86,48 @@ func TestImportMeta(t *testing.T) {
 			root:   "bitbucket.org/bertimus9/systemstat",
 			remote: "https://bitbucket.org/bertimus9/systemstat",
 		},
+		{
+			name:   "foo.googlecode.com/svn/trunk",
+			root:   "foo.googlecode.com/svn",
+			remote: "https://foo.googlecode.com/svn",
+			vcs:    "svn",
+		},
+		{
+			name:   "gopkg.in/yaml.v2",
+			root:   "gopkg.in/yaml.v2",
+			remote: "https://gopkg.in/yaml.v2",
+			vcs:    "git",
+		},
+		{
+			name:   "gopkg.in/src-d/go-git.v4/plumbing",
+			root:   "gopkg.in/src-d/go-git.v4",
+			remote: "https://gopkg.in/src-d/go-git.v4",
+			vcs:    "git",
+		},
+		{
+			name:   "git.sr.ht/~user/repo",
+			root:   "git.sr.ht/~user/repo",
+			remote: "https://git.sr.ht/~user/repo",
+			vcs:    "git",
+		},
+		{
+			name:   "git.sr.ht/~user/repo/sub",
+			root:   "git.sr.ht/~user/repo",
+			remote: "https://git.sr.ht/~user/repo",
+			vcs:    "git",
+		},
+		{
+			name:   "gitlab.com/foo/bar",
+			root:   "gitlab.com/foo/bar",
+			remote: "https://gitlab.com/foo/bar",
+			vcs:    "git",
+		},
+		{
+			name:   "gitlab.com/foo/sub/subsub/bar.git/pkg",
+			root:   "gitlab.com/foo/sub/subsub/bar.git",
+			remote: "https://gitlab.com/foo/sub/subsub/bar.git",
+			vcs:    "git",
+		},
 	}
 
 	for _, test := range tests {
@@ -95,6 +150,78 @@ func TestImportMeta(t *testing.T) {
 	}
 }
 
+func TestMatchVCSGitLabAmbiguous(t *testing.T) {
+	// Without a ".git" suffix, the root of a path below a GitLab subgroup
+	// can't be determined statically.
+	for _, pkg := range []string{"gitlab.com/foo/bar/baz", "gitlab.com/foo/sub/bar/pkg"} {
+		if _, root, ok := matchVCS(pkg); ok {
+			t.Errorf("%s: expected no static match, got root %s", pkg, root)
+		}
+	}
+}
+
+func TestCheckVCSList(t *testing.T) {
+	if err := checkVCSList(vcsList); err != nil {
+		t.Errorf("vcsList: %v", err)
+	}
+	bad := []*vcsInfo{{pattern: `^(?P<rootpkg>example\.com/[a-z]+)$`, vcs: "svc"}}
+	if err := checkVCSList(bad); err == nil {
+		t.Errorf("expected unknown vcs to be rejected")
+	}
+}
+
+func TestMatchVCSDeepPaths(t *testing.T) {
+	tests := []struct {
+		pkg  string
+		root string
+	}{
+		{"github.com/foo/bar/a/b/c", "github.com/foo/bar"},
+		{"bitbucket.org/foo/bar/a/b/c", "bitbucket.org/foo/bar"},
+		{"git.sr.ht/~user/repo/a/b", "git.sr.ht/~user/repo"},
+		{"gopkg.in/yaml.v2/a/b", "gopkg.in/yaml.v2"},
+		{"gopkg.in/user/pkg.v1/a.v2/b", "gopkg.in/user/pkg.v1"},
+		{"gitlab.com/foo/sub/bar.git/a/b", "gitlab.com/foo/sub/bar.git"},
+		{"gitlab.com/foo/bar.git/a.git/b", "gitlab.com/foo/bar.git"},
+		{"launchpad.net/foo/a/b/c", "launchpad.net/foo/a"},
+		{"launchpad.net/~user/foo/bar/a/b", "launchpad.net/~user/foo/bar"},
+		{"launchpad.net/~user/+junk/bar/a/b", "launchpad.net/~user/+junk/bar"},
+		{"git.launchpad.net/foo/a/b", "git.launchpad.net/foo"},
+		{"git.launchpad.net/~user/+git/foo/a/b", "git.launchpad.net/~user/+git/foo"},
+		{"hub.jazz.net/git/user/foo/a/b", "hub.jazz.net/git/user/foo"},
+		{"go.googlesource.com/net/a/b", "go.googlesource.com/net"},
+		{"code.google.com/p/foo/a/b", "code.google.com/p/foo"},
+		{"code.google.com/p/foo.wiki/a/b", "code.google.com/p/foo.wiki"},
+		{"foo.googlecode.com/svn/trunk/a/b", "foo.googlecode.com/svn"},
+		{"foo.googlecode.com/git/a/b", "foo.googlecode.com/git"},
+		{"example.com/foo.git/a/b", "example.com/foo.git"},
+		{"example.com/foo/bar.hg/a.git/b", "example.com/foo/bar.hg"},
+		{"example.com/foo.github/bar.git/a", "example.com/foo.github/bar.git"},
+		{"example.com:8080/foo.git/a/b", "example.com:8080/foo.git"},
+	}
+	for _, test := range tests {
+		_, root, ok := matchVCS(test.pkg)
+		if !ok {
+			t.Errorf("%s: no match", test.pkg)
+			continue
+		}
+		if root != test.root {
+			t.Errorf("%s: expected root %s, got %s", test.pkg, test.root, root)
+		}
+	}
+
+	// Every pattern is covered.
+	matched := map[*vcsInfo]bool{}
+	for _, test := range tests {
+		v, _, _ := matchVCS(test.pkg)
+		matched[v] = true
+	}
+	for _, v := range vcsList {
+		if !matched[v] {
+			t.Errorf("no deep path tested for pattern %s", v.pattern)
+		}
+	}
+}
+
 func TestPartImportMeta(t *testing.T) {
 	tests := []struct {
 		name string
@@ -185,13 +312,28 @@ go get gopkg.in/gcfg.v1/scanner
 				VCS:    "git",
 			},
 		},
+		{
+			name: "example.com/schemeless",
+			resp: `
+<html>
+<head>
+<meta name="go-import" content="example.com/schemeless git github.com/example/schemeless">
+</head>
+</html>
+			`,
+			want: pkgMeta{
+				Root:   "example.com/schemeless",
+				Remote: "https://github.com/example/schemeless",
+				VCS:    "git",
+			},
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			resp := strings.NewReader(strings.TrimSpace(test.resp))
 
-			got, err := parseImportMeta(resp)
+			got, err := parseImportMeta(resp, test.name, nil)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -201,3 +343,1033 @@ go get gopkg.in/gcfg.v1/scanner
 		})
 	}
 }
+
+func TestNormalizeRemote(t *testing.T) {
+	tests := []struct {
+		remote  string
+		want    string
+		wantErr bool
+	}{
+		{remote: "https://github.com/foo/bar", want: "https://github.com/foo/bar"},
+		{remote: "github.com/foo/bar", want: "https://github.com/foo/bar"},
+		{remote: "ssh://git@example.com/foo/bar", want: "ssh://git@example.com/foo/bar"},
+		{remote: "/foo/bar", wantErr: true},
+		{remote: "https://", wantErr: true},
+		{remote: "://github.com/foo/bar", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := normalizeRemote(test.remote)
+		if err != nil {
+			if !test.wantErr {
+				t.Errorf("normalizeRemote(%q): %v", test.remote, err)
+			}
+			continue
+		}
+		if test.wantErr {
+			t.Errorf("normalizeRemote(%q): expected error, got %q", test.remote, got)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("normalizeRemote(%q), wanted=%q, got=%q", test.remote, test.want, got)
+		}
+	}
+}
+
+// withTestServer starts a TLS server and points the default HTTP client at it
+// for the duration of the test. The test is passed the server's host, which
+// can be used as the prefix of import paths served by it.
+func withTestServer(t *testing.T, h http.Handler, test func(t *testing.T, host string)) {
+	s := httptest.NewTLSServer(h)
+	defer s.Close()
+
+	defaultClient := http.DefaultClient
+	http.DefaultClient = s.Client()
+	defer func() { http.DefaultClient = defaultClient }()
+
+	test(t, strings.TrimPrefix(s.URL, "https://"))
+}
+
+// goImportHandler serves a 'go-import' meta tag for the requested path.
+func goImportHandler(w http.ResponseWriter, r *http.Request) {
+	root := r.Host + r.URL.Path
+	fmt.Fprintf(w, `<meta name="go-import" content="%s git https://%s">`, root, root)
+}
+
+func TestResolverTimeout(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(10 * time.Second):
+			}
+			return
+		}
+		goImportHandler(w, r)
+	})
+
+	withTestServer(t, h, func(t *testing.T, host string) {
+		r := &resolver{timeout: 100 * time.Millisecond, retry: backoff{}}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var (
+			wg      sync.WaitGroup
+			slowErr error
+			fastErr error
+		)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, slowErr = r.fetchImportMeta(ctx, host+"/slow")
+		}()
+		go func() {
+			defer wg.Done()
+			_, fastErr = r.fetchImportMeta(ctx, host+"/fast")
+		}()
+		wg.Wait()
+
+		if slowErr == nil {
+			t.Errorf("expected request to hung server to time out")
+		}
+		if fastErr != nil {
+			t.Errorf("expected request to responsive server to succeed: %v", fastErr)
+		}
+		if ctx.Err() != nil {
+			t.Errorf("overall deadline exceeded")
+		}
+	})
+}
+
+// testLogger records all messages logged to it.
+type testLogger struct {
+	mu   sync.Mutex
+	msgs []testMessage
+
+	// root and fields are set on loggers returned by With, which record
+	// their messages to root.
+	root   *testLogger
+	fields []string
+}
+
+type testMessage struct {
+	level  string
+	msg    string
+	fields []string
+}
+
+func (l *testLogger) Infof(format string, v ...interface{})  { l.printf("info", format, v...) }
+func (l *testLogger) Debugf(format string, v ...interface{}) { l.printf("debug", format, v...) }
+func (l *testLogger) Errorf(format string, v ...interface{}) { l.printf("error", format, v...) }
+
+func (l *testLogger) With(key string, value interface{}) log.Logger {
+	root := l
+	if l.root != nil {
+		root = l.root
+	}
+	fields := append(append([]string(nil), l.fields...), fmt.Sprintf("%s=%v", key, value))
+	return &testLogger{root: root, fields: fields}
+}
+
+func (l *testLogger) printf(level, format string, v ...interface{}) {
+	root := l
+	if l.root != nil {
+		root = l.root
+	}
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	root.msgs = append(root.msgs, testMessage{level, fmt.Sprintf(format, v...), l.fields})
+}
+
+// messages returns the messages logged at a level, or at all levels if level
+// is empty.
+func (l *testLogger) messages(level string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var msgs []string
+	for _, m := range l.msgs {
+		if level == "" || m.level == level {
+			msgs = append(msgs, m.msg)
+		}
+	}
+	return msgs
+}
+
+func TestResolverCaseMismatch(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		root := r.Host + strings.ToLower(r.URL.Path)
+		fmt.Fprintf(w, `<meta name="go-import" content="%s git https://%s">`, root, root)
+	})
+
+	withTestServer(t, h, func(t *testing.T, host string) {
+		l := new(testLogger)
+		r := &resolver{logger: l}
+
+		if _, err := r.fetchImportMeta(context.Background(), host+"/foo/bar"); err != nil {
+			t.Fatal(err)
+		}
+		if msgs := l.messages("error"); len(msgs) != 0 {
+			t.Errorf("expected no warnings for matching case, got %q", msgs)
+		}
+
+		if _, err := r.fetchImportMeta(context.Background(), host+"/Foo/Baz"); err != nil {
+			t.Fatal(err)
+		}
+		if msgs := l.messages("error"); len(msgs) != 1 {
+			t.Errorf("expected a warning for mismatched case, got %q", msgs)
+		}
+	})
+}
+
+func TestCaseMismatch(t *testing.T) {
+	tests := []struct {
+		pkg, root string
+		want      bool
+	}{
+		{"github.com/foo/bar/baz", "github.com/foo/bar", false},
+		{"github.com/Foo/bar/baz", "github.com/foo/bar", true},
+		{"github.com/foo/bar", "github.com/foo/bar/baz", false},
+		{"github.com/foo/bar", "gitlab.com/foo/bar", false},
+	}
+	for _, test := range tests {
+		if got := caseMismatch(test.pkg, test.root); got != test.want {
+			t.Errorf("caseMismatch(%q, %q), wanted=%t, got=%t", test.pkg, test.root, test.want, got)
+		}
+	}
+}
+
+func TestResolverGuessRoot(t *testing.T) {
+	withTestServer(t, http.NotFoundHandler(), func(t *testing.T, host string) {
+		var probed []string
+		probe := func(ctx context.Context, remote string) error {
+			probed = append(probed, remote)
+			if remote != "https://"+host+"/foo/bar" {
+				return fmt.Errorf("not a git repo")
+			}
+			return nil
+		}
+
+		r := &resolver{probe: probe}
+		if _, err := r.fetchImportMeta(context.Background(), host+"/foo/bar/baz"); err == nil {
+			t.Errorf("expected resolution to fail without guessing roots")
+		}
+		if len(probed) != 0 {
+			t.Errorf("expected no probes when guessing is disabled, got %q", probed)
+		}
+
+		r = &resolver{guessRoots: true, probe: probe}
+		got, err := r.fetchImportMeta(context.Background(), host+"/foo/bar/baz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := pkgMeta{
+			Root:   host + "/foo/bar",
+			Remote: "https://" + host + "/foo/bar",
+			VCS:    "git",
+		}
+		if !reflect.DeepEqual(want, *got) {
+			t.Errorf("wanted=%#v, got=%#v", want, *got)
+		}
+
+		if _, err := r.fetchImportMeta(context.Background(), host+"/foo/qux"); err == nil {
+			t.Errorf("expected resolution to fail when probe fails")
+		}
+	})
+}
+
+func TestParseImportMetaMultiple(t *testing.T) {
+	resp := `
+<html>
+<head>
+<meta name="go-import" content="example.com mod https://proxy.example.com">
+<meta name="go-import" content="example.com/foo git https://git.example.com/foo">
+<meta name="go-import" content="example.com/foo mod https://proxy.example.com">
+<meta name="go-import" content="example.com/foo/bar hg https://hg.example.com/bar">
+<meta name="go-import" content="example.com/foobar git https://git.example.com/foobar">
+</head>
+</html>
+`
+	tests := []struct {
+		pkg     string
+		want    pkgMeta
+		wantErr string
+	}{
+		{
+			pkg:  "example.com/foo/baz",
+			want: pkgMeta{Root: "example.com/foo", VCS: "git", Remote: "https://git.example.com/foo"},
+		},
+		{
+			// The VCS is picked over the module proxy serving the
+			// same prefix.
+			pkg:  "example.com/foo",
+			want: pkgMeta{Root: "example.com/foo", VCS: "git", Remote: "https://git.example.com/foo"},
+		},
+		{
+			pkg:  "example.com/foo/bar/baz",
+			want: pkgMeta{Root: "example.com/foo/bar", VCS: "hg", Remote: "https://hg.example.com/bar"},
+		},
+		{
+			pkg:  "example.com/foobar",
+			want: pkgMeta{Root: "example.com/foobar", VCS: "git", Remote: "https://git.example.com/foobar"},
+		},
+		{
+			pkg:  "example.com/other",
+			want: pkgMeta{Root: "example.com", VCS: "mod", Remote: "https://proxy.example.com"},
+		},
+		{
+			pkg:     "other.com/foo",
+			wantErr: `no 'go-import' meta field matches other.com/foo, found ["example.com mod https://proxy.example.com" "example.com/foo git https://git.example.com/foo"`,
+		},
+	}
+	for _, test := range tests {
+		got, err := parseImportMeta(strings.NewReader(resp), test.pkg, nil)
+		if test.wantErr != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.wantErr) {
+				t.Errorf("%s: expected error starting with %q, got %v", test.pkg, test.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.pkg, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, test.want) {
+			t.Errorf("%s: wanted %#v, got %#v", test.pkg, test.want, *got)
+		}
+	}
+}
+
+func TestParseImportMetaExtraNames(t *testing.T) {
+	resp := `
+<html>
+<head>
+<meta name="go-legacy-import" content="example.com/foo git https://example.com/foo.git">
+</head>
+</html>
+`
+	if _, err := parseImportMeta(strings.NewReader(resp), "example.com/foo", nil); err == nil {
+		t.Errorf("expected non-standard meta name to be ignored by default")
+	}
+
+	got, err := parseImportMeta(strings.NewReader(resp), "example.com/foo", []string{"go-legacy-import"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := pkgMeta{
+		Root:   "example.com/foo",
+		Remote: "https://example.com/foo.git",
+		VCS:    "git",
+	}
+	if !reflect.DeepEqual(want, *got) {
+		t.Errorf("wanted=%#v, got=%#v", want, *got)
+	}
+}
+
+func TestResolverResolve(t *testing.T) {
+	var requests []string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		goImportHandler(w, r)
+	})
+
+	withTestServer(t, h, func(t *testing.T, host string) {
+		var r pkgResolver = new(resolver)
+
+		meta, err := r.resolve(context.Background(), "github.com/spf13/cobra/doc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta.Root != "github.com/spf13/cobra" {
+			t.Errorf("expected static root github.com/spf13/cobra, got %s", meta.Root)
+		}
+		if len(requests) != 0 {
+			t.Errorf("expected statically resolved package to make no requests, got %q", requests)
+		}
+
+		meta, err = r.resolve(context.Background(), host+"/foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta.Root != host+"/foo" {
+			t.Errorf("expected root %s/foo, got %s", host, meta.Root)
+		}
+		if len(requests) != 1 {
+			t.Errorf("expected one go-get request, got %q", requests)
+		}
+	})
+}
+
+func TestResolverHTTPFirstHosts(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.Path)
+		mu.Unlock()
+		goImportHandler(w, r)
+	})
+
+	withTestServer(t, h, func(t *testing.T, host string) {
+		// The VCS suffix matches a static pattern, which would make the
+		// repo root "<host>/foo.git".
+		pkg := host + "/foo.git/bar"
+		r := &resolver{retry: backoff{}}
+		meta, err := r.resolve(context.Background(), pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := host + "/foo.git"; meta.Root != want {
+			t.Errorf("expected static root %s, got %s", want, meta.Root)
+		}
+		if len(requests) != 0 {
+			t.Errorf("expected statically resolved package to make no requests, got %q", requests)
+		}
+
+		hostname := strings.Split(host, ":")[0]
+		for _, hosts := range [][]string{{host}, {strings.ToUpper(hostname)}} {
+			mu.Lock()
+			requests = nil
+			mu.Unlock()
+
+			r := &resolver{retry: backoff{}, httpFirstHosts: hosts}
+			meta, err := r.resolve(context.Background(), pkg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if meta.Root != pkg {
+				t.Errorf("hosts %q: expected root %s from go-get endpoint, got %s", hosts, pkg, meta.Root)
+			}
+			mu.Lock()
+			if len(requests) != 1 {
+				t.Errorf("hosts %q: expected one go-get request, got %q", hosts, requests)
+			}
+			mu.Unlock()
+		}
+	})
+}
+
+func TestNewResolverOptions(t *testing.T) {
+	r, err := newResolver(ResolverOptions{
+		Retries:        1,
+		Timeout:        90 * time.Second,
+		GuessRoots:     true,
+		HTTPFirstHosts: []string{"example.com"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.timeout != 90*time.Second {
+		t.Errorf("expected request timeout 1m30s, got %s", r.timeout)
+	}
+	transient := &httpStatusError{code: http.StatusServiceUnavailable}
+	if _, ok := r.retry.retry(1, transient); !ok {
+		t.Errorf("expected a transient error to be retried once")
+	}
+	if _, ok := r.retry.retry(2, transient); ok {
+		t.Errorf("expected a transient error to be retried only once")
+	}
+	if !r.guessRoots {
+		t.Errorf("expected guessing repo roots to be enabled")
+	}
+	if !r.httpFirst("example.com/foo") || r.httpFirst("github.com/foo/bar") {
+		t.Errorf("expected only example.com to be resolved HTTP first")
+	}
+	if _, err := newResolver(ResolverOptions{Timeout: -time.Second}, nil); err == nil {
+		t.Errorf("expected a negative timeout to be rejected")
+	}
+	if _, err := newResolver(ResolverOptions{Retries: -1}, nil); err == nil {
+		t.Errorf("expected a negative number of retries to be rejected")
+	}
+}
+
+func TestNewResolverOverrides(t *testing.T) {
+	r, err := newResolver(ResolverOptions{Overrides: []string{
+		"github.com/foo/bar git https://git.example.com/bar",
+		"example.com/baz hg https://hg.example.com/baz",
+	}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*pkgMeta{
+		{Root: "github.com/foo/bar", VCS: "git", Remote: "https://git.example.com/bar"},
+		{Root: "example.com/baz", VCS: "hg", Remote: "https://hg.example.com/baz"},
+	}
+	if !reflect.DeepEqual(r.overrides, want) {
+		t.Errorf("expected overrides %#v, got %#v", want, r.overrides)
+	}
+	got, err := r.resolve(context.Background(), "github.com/foo/bar/baz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Remote != "https://git.example.com/bar" {
+		t.Errorf("expected override to be used, got remote %s", got.Remote)
+	}
+
+	if _, err := newResolver(ResolverOptions{Overrides: []string{"github.com/foo/bar"}}, nil); err == nil {
+		t.Errorf("expected an invalid override to fail creating the resolver")
+	}
+}
+
+func TestNewResolverResponsesDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, []file{
+		{"example.com", ""},
+		{"example.com/foo.html", `<meta name="go-import" content="example.com/foo git https://git.example.com/foo">`},
+	})
+
+	r, err := newResolver(ResolverOptions{ResponsesDir: dir}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The host doesn't exist, so the stored response must be used.
+	meta, err := r.resolve(context.Background(), "example.com/foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Remote != "https://git.example.com/foo" {
+		t.Errorf("expected the stored response to be used, got remote %s", meta.Remote)
+	}
+}
+
+func TestNewResolverMetaNames(t *testing.T) {
+	r, err := newResolver(ResolverOptions{MetaNames: []string{"go-legacy-import"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := `<meta name="go-legacy-import" content="example.com/foo git https://example.com/foo.git">`
+	if _, err := parseImportMeta(strings.NewReader(resp), "example.com/foo", r.metaNames); err != nil {
+		t.Errorf("expected configured meta names to be accepted: %v", err)
+	}
+}
+
+func TestResolverStrictHTTPS(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		root := r.Host + r.URL.Path
+		fmt.Fprintf(w, `<meta name="go-import" content="%s git http://%s">`, root, root)
+	})
+
+	withTestServer(t, h, func(t *testing.T, host string) {
+		tests := []struct {
+			r       *resolver
+			wantErr bool
+		}{
+			{&resolver{}, false},
+			{&resolver{strictHTTPS: true}, true},
+			{&resolver{strictHTTPS: true, insecureHosts: []string{"127.0.0.1"}}, false},
+		}
+		for i, test := range tests {
+			_, err := test.r.fetchImportMeta(context.Background(), host+"/foo")
+			if (err != nil) != test.wantErr {
+				t.Errorf("case %d: wanted error=%t, got %v", i, test.wantErr, err)
+			}
+		}
+
+		// The CLI's resolver is strict unless the host is opted out.
+		for _, insecure := range [][]string{nil, {"127.0.0.1"}} {
+			r, err := newResolver(ResolverOptions{InsecureHosts: insecure}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.retry = backoff{}
+			_, err = r.fetchImportMeta(context.Background(), host+"/foo")
+			if wantErr := insecure == nil; (err != nil) != wantErr {
+				t.Errorf("insecure hosts %q: wanted error=%t, got %v", insecure, wantErr, err)
+			}
+		}
+	})
+}
+
+func TestResolverStrictHTTPSStored(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, []file{
+		{"example.com", ""},
+		{"example.com/foo.html", `<meta name="go-import" content="example.com/foo git http://example.com/foo">`},
+	})
+
+	// Stored responses are held to the same rules as fetched ones.
+	r := &resolver{strictHTTPS: true, responsesDir: dir}
+	if _, err := r.resolve(context.Background(), "example.com/foo"); err == nil || !strings.Contains(err.Error(), "insecure") {
+		t.Errorf("expected stored response with an insecure remote to be rejected, got %v", err)
+	}
+	r = &resolver{strictHTTPS: true, insecureHosts: []string{"example.com"}, responsesDir: dir}
+	if _, err := r.resolve(context.Background(), "example.com/foo"); err != nil {
+		t.Errorf("expected stored response of an insecure host to be allowed: %v", err)
+	}
+
+	// So are repos cached by a run that allowed the host.
+	withCache(t, func(t *testing.T, c *cache) {
+		r := &resolver{metaCache: c}
+		if err := r.storeMetaCache(&pkgMeta{Root: "example.com/bar", VCS: "git", Remote: "http://example.com/bar"}); err != nil {
+			t.Fatal(err)
+		}
+		r = &resolver{strictHTTPS: true, metaCache: c, retry: backoff{}}
+		if _, err := r.resolve(context.Background(), "example.com/bar"); err == nil || !strings.Contains(err.Error(), "insecure") {
+			t.Errorf("expected cached repo with an insecure remote to be rejected, got %v", err)
+		}
+	})
+}
+
+func TestCheckSecureRemote(t *testing.T) {
+	tests := []struct {
+		remote  string
+		wantErr bool
+	}{
+		{"https://github.com/foo/bar", false},
+		{"ssh://git@github.com/foo/bar", false},
+		{"http://github.com/foo/bar", true},
+		{"git://github.com/foo/bar", true},
+		{"http://internal.example.com/foo/bar", false},
+	}
+	for _, test := range tests {
+		err := checkSecureRemote(test.remote, []string{"internal.example.com"})
+		if (err != nil) != test.wantErr {
+			t.Errorf("checkSecureRemote(%q), wanted error=%t, got %v", test.remote, test.wantErr, err)
+		}
+	}
+}
+
+func TestResolverHeader(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		goImportHandler(w, r)
+	})
+
+	withTestServer(t, h, func(t *testing.T, host string) {
+		r := &resolver{retry: backoff{}}
+		_, err := r.fetchImportMeta(context.Background(), host+"/foo")
+		if e, ok := errors.Cause(err).(*httpStatusError); !ok || e.code != http.StatusForbidden {
+			t.Errorf("expected request without header to be forbidden, got %v", err)
+		}
+
+		l := new(testLogger)
+		header := headerFromEnv([]string{"HOME=/root", "GOT_HTTP_HEADER_X_TOKEN=secret"})
+		r = &resolver{header: header, logger: l}
+		if _, err := r.fetchImportMeta(context.Background(), host+"/foo"); err != nil {
+			t.Errorf("expected request with header to succeed: %v", err)
+		}
+		msgs := l.messages("debug")
+		if len(msgs) == 0 {
+			t.Errorf("expected request to be logged")
+		}
+		for _, msg := range msgs {
+			if strings.Contains(msg, "secret") {
+				t.Errorf("header value logged: %q", msg)
+			}
+		}
+	})
+}
+
+func TestResolverDialTimeout(t *testing.T) {
+	// 10.255.255.1 is non-routable, so connecting hangs until the dial
+	// times out, or fails immediately if the network is unreachable.
+	r := &resolver{dialTimeout: 200 * time.Millisecond, retry: backoff{}}
+
+	start := time.Now()
+	_, err := r.fetchImportMeta(context.Background(), "10.255.255.1/foo")
+	if err == nil {
+		t.Fatal("expected request to non-routable address to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected dial to time out within its bound, took %s: %v", elapsed, err)
+	}
+}
+
+func TestNewResolverClient(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(goImportHandler))
+	defer s.Close()
+	host := strings.TrimPrefix(s.URL, "https://")
+
+	// The default client doesn't trust the test server.
+	r, err := newResolver(ResolverOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.retry = backoff{}
+	if _, err := r.fetchImportMeta(context.Background(), host+"/foo"); err == nil {
+		t.Errorf("expected default client to reject the test server's certificate")
+	}
+	if got := r.httpClient().Timeout; got != defaultClientTimeout {
+		t.Errorf("expected default client timeout %s, got %s", defaultClientTimeout, got)
+	}
+
+	client := s.Client()
+	if r, err = newResolver(ResolverOptions{}, client); err != nil {
+		t.Fatal(err)
+	}
+	r.retry = backoff{}
+	meta, err := r.fetchImportMeta(context.Background(), host+"/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := host + "/foo"; meta.Root != want {
+		t.Errorf("expected root %q, got %q", want, meta.Root)
+	}
+	if r.httpClient() != client {
+		t.Errorf("expected explicit client to be used as is")
+	}
+}
+
+func TestResolverUserAgent(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		userAgent string
+	)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		userAgent = r.UserAgent()
+		mu.Unlock()
+		goImportHandler(w, r)
+	})
+
+	withTestServer(t, h, func(t *testing.T, host string) {
+		tests := []struct {
+			r    *resolver
+			want string
+		}{
+			{&resolver{}, defaultUserAgent},
+			{&resolver{userAgent: "got/v1.2.3 (ci)"}, "got/v1.2.3 (ci)"},
+			{&resolver{header: http.Header{"User-Agent": {"custom"}}}, "custom"},
+		}
+		for _, test := range tests {
+			test.r.retry = backoff{}
+			if _, err := test.r.fetchImportMeta(context.Background(), host+"/foo"); err != nil {
+				t.Fatal(err)
+			}
+			mu.Lock()
+			got := userAgent
+			mu.Unlock()
+			if got != test.want {
+				t.Errorf("expected User-Agent %q, got %q", test.want, got)
+			}
+		}
+	})
+}
+
+// largeGoGetPage is a go-get response resembling a hosting provider's full
+// repo page, with the 'go-import' meta tag following many other elements.
+var largeGoGetPage = func() string {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n")
+	b.WriteString(`<meta http-equiv="Content-Type" content="text/html; charset=utf-8"/>` + "\n")
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&b, `<link rel="stylesheet" href="https://assets.example.com/css/%d.css" integrity="sha512-%040d" crossorigin="anonymous" media="all"/>`+"\n", i, i)
+		fmt.Fprintf(&b, `<meta property="og:item-%d" content="some value for item %d"/>`+"\n", i, i)
+	}
+	b.WriteString(`<meta name="go-import" content="example.com/foo/bar git https://example.com/foo/bar.git">` + "\n")
+	b.WriteString("</head>\n<body>\n")
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&b, `<div class="row"><a href="/foo/bar/blob/master/file%d.go">file%d.go</a></div>`+"\n", i, i)
+	}
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}()
+
+func BenchmarkParseImportMeta(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := parseImportMeta(strings.NewReader(largeGoGetPage), "example.com/foo/bar", nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestResolverResponsesDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFiles(t, dir, []file{
+		{"example.invalid", ""},
+		{"example.invalid/foo", ""},
+		{"example.invalid/foo/bar.html", `<html>
+<head>
+<meta name="go-import" content="example.invalid/foo/bar git https://git.example.invalid/bar">
+</head>
+</html>`},
+	})
+
+	// The host doesn't exist, so any network request would fail.
+	r := &resolver{responsesDir: dir, retry: backoff{}}
+	got, err := r.resolve(context.Background(), "example.invalid/foo/bar/baz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := pkgMeta{
+		Root:   "example.invalid/foo/bar",
+		Remote: "https://git.example.invalid/bar",
+		VCS:    "git",
+	}
+	if !reflect.DeepEqual(want, *got) {
+		t.Errorf("wanted=%#v, got=%#v", want, *got)
+	}
+}
+
+func TestLoadResponseTraversal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A response outside of the responses directory.
+	writeFiles(t, dir, []file{
+		{"responses", ""},
+		{"evil.html", `<meta name="go-import" content="evil git https://git.example.invalid/evil">`},
+	})
+	responses := filepath.Join(dir, "responses")
+	for _, pkg := range []string{
+		"../evil",
+		"example.invalid/../../evil",
+		"example.invalid/./foo",
+		"/evil",
+		`..\evil`,
+	} {
+		if _, ok, err := loadResponse(responses, pkg); err == nil || ok {
+			t.Errorf("expected import path %q to be rejected, got ok=%t err=%v", pkg, ok, err)
+		}
+	}
+}
+
+func TestResolverOverrides(t *testing.T) {
+	var overrides []*pkgMeta
+	for _, s := range []string{
+		"github.com/foo/bar git https://git.example.com/bar",
+		"github.com/foo/bar/sub hg https://hg.example.com/sub",
+	} {
+		o, err := parseOverride(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		overrides = append(overrides, o)
+	}
+	r := &resolver{overrides: overrides}
+
+	tests := []struct {
+		pkg  string
+		want pkgMeta
+	}{
+		{
+			pkg: "github.com/foo/bar/baz",
+			want: pkgMeta{
+				Root:   "github.com/foo/bar",
+				Remote: "https://git.example.com/bar",
+				VCS:    "git",
+			},
+		},
+		{
+			pkg: "github.com/foo/bar/sub/pkg",
+			want: pkgMeta{
+				Root:   "github.com/foo/bar/sub",
+				Remote: "https://hg.example.com/sub",
+				VCS:    "hg",
+			},
+		},
+		{
+			// Shares a string prefix, but isn't below the override's root.
+			pkg: "github.com/foo/barbaz",
+			want: pkgMeta{
+				Root:   "github.com/foo/barbaz",
+				Remote: "https://github.com/foo/barbaz",
+				VCS:    "git",
+			},
+		},
+	}
+	for _, test := range tests {
+		got, err := r.resolve(context.Background(), test.pkg)
+		if err != nil {
+			t.Errorf("resolve %s: %v", test.pkg, err)
+			continue
+		}
+		if !reflect.DeepEqual(test.want, *got) {
+			t.Errorf("resolve %s, wanted=%#v, got=%#v", test.pkg, test.want, *got)
+		}
+	}
+
+	if _, err := parseOverride("github.com/foo/bar=https://git.example.com/bar"); err == nil {
+		t.Errorf("expected malformed override to be rejected")
+	}
+}
+
+func TestResolverSharesSiblingRequests(t *testing.T) {
+	var requests int32
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		// Keep the request inflight long enough for every sibling to
+		// find it.
+		time.Sleep(100 * time.Millisecond)
+		fmt.Fprintf(w, `<meta name="go-import" content="%s/foo/bar git https://%s/foo/bar">`, r.Host, r.Host)
+	})
+
+	withTestServer(t, h, func(t *testing.T, host string) {
+		r := &resolver{retry: backoff{}}
+
+		var wg sync.WaitGroup
+		errs := make([]error, 50)
+		for i := range errs {
+			i := i
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				pkg := fmt.Sprintf("%s/foo/bar/sub%d/pkg", host, i)
+				meta, err := r.fetchImportMeta(context.Background(), pkg)
+				if err == nil && meta.Root != host+"/foo/bar" {
+					err = fmt.Errorf("unexpected root %s", meta.Root)
+				}
+				errs[i] = err
+			}()
+		}
+		wg.Wait()
+
+		for i, err := range errs {
+			if err != nil {
+				t.Errorf("resolving sub%d: %v", i, err)
+			}
+		}
+		if n := atomic.LoadInt32(&requests); n != 1 {
+			t.Errorf("expected sibling subpackages to share a single request, got %d", n)
+		}
+	})
+}
+
+func TestResolverTagsFetchMessages(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		root := r.Host + strings.Join(strings.SplitN(r.URL.Path, "/", 3)[:2], "/")
+		fmt.Fprintf(w, `<meta name="go-import" content="%s git https://%s">`, root, root)
+	})
+
+	withTestServer(t, h, func(t *testing.T, host string) {
+		l := new(testLogger)
+		r := &resolver{retry: backoff{}, logger: l}
+
+		// Different repos are fetched concurrently.
+		pkgs := []string{host + "/foo/pkg", host + "/bar/pkg", host + "/baz/pkg"}
+		group, ctx := errgroup.WithContext(context.Background())
+		for _, pkg := range pkgs {
+			pkg := pkg
+			group.Go(func() error {
+				_, err := r.fetchImportMeta(ctx, pkg)
+				return err
+			})
+		}
+		if err := group.Wait(); err != nil {
+			t.Fatal(err)
+		}
+
+		fetched := map[string]bool{}
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for _, m := range l.msgs {
+			if !strings.HasPrefix(m.msg, "fetching ") {
+				continue
+			}
+			// The message names the URL of the package it was fetched
+			// for.
+			want := []string{"pkg=" + strings.TrimSuffix(strings.TrimPrefix(strings.Fields(m.msg)[1], "https://"), "?go-get=1")}
+			if !reflect.DeepEqual(m.fields, want) {
+				t.Errorf("expected %q to have fields %q, got %q", m.msg, want, m.fields)
+			}
+			fetched[m.fields[0]] = true
+		}
+		if len(fetched) != len(pkgs) {
+			t.Errorf("expected messages tagged with each of %q, got %v", pkgs, fetched)
+		}
+	})
+}
+
+func TestResolverSiblingRepos(t *testing.T) {
+	var requests int32
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(50 * time.Millisecond)
+		goImportHandler(w, r)
+	})
+
+	withTestServer(t, h, func(t *testing.T, host string) {
+		r := &resolver{retry: backoff{}}
+
+		// Siblings that turn out to be repos of their own are each
+		// fetched, even when they waited on each other.
+		var wg sync.WaitGroup
+		pkgs := []string{host + "/foo/bar/a", host + "/foo/bar/b"}
+		metas := make([]*pkgMeta, len(pkgs))
+		for i, pkg := range pkgs {
+			i, pkg := i, pkg
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				meta, err := r.fetchImportMeta(context.Background(), pkg)
+				if err != nil {
+					t.Errorf("resolving %s: %v", pkg, err)
+					return
+				}
+				metas[i] = meta
+			}()
+		}
+		wg.Wait()
+
+		for i, pkg := range pkgs {
+			if metas[i] != nil && metas[i].Root != pkg {
+				t.Errorf("expected %s to be its own repo, got root %s", pkg, metas[i].Root)
+			}
+		}
+		if n := atomic.LoadInt32(&requests); n != 2 {
+			t.Errorf("expected a request per repo, got %d", n)
+		}
+	})
+}
+
+func TestResolverRedirectDropsQuery(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/vanity/foo", "/broken/foo":
+			// Redirect to the repo's page, losing the go-get query.
+			http.Redirect(w, r, "/page"+strings.TrimSuffix(r.URL.Path, "/foo"), http.StatusFound)
+		case "/page/vanity":
+			if r.URL.Query().Get("go-get") != "1" {
+				fmt.Fprint(w, "<html><body>repo page</body></html>")
+				return
+			}
+			fmt.Fprintf(w, `<meta name="go-import" content="%s/vanity/foo git https://%s/repo">`, r.Host, r.Host)
+		default:
+			fmt.Fprint(w, "<html><body>no meta tags here</body></html>")
+		}
+	})
+
+	withTestServer(t, h, func(t *testing.T, host string) {
+		r := &resolver{retry: backoff{}}
+
+		meta, err := r.fetchImportMeta(context.Background(), host+"/vanity/foo")
+		if err != nil {
+			t.Fatalf("expected the redirected location to be asked again: %v", err)
+		}
+		if want := host + "/vanity/foo"; meta.Root != want {
+			t.Errorf("expected root %s, got %s", want, meta.Root)
+		}
+
+		_, err = r.fetchImportMeta(context.Background(), host+"/broken/foo")
+		if err == nil {
+			t.Fatal("expected an error for a redirect to a page without meta tags")
+		}
+		chain := fmt.Sprintf("https://%s/broken/foo?go-get=1 -> https://%s/page/broken -> https://%s/page/broken?go-get=1", host, host, host)
+		if !strings.Contains(err.Error(), chain) {
+			t.Errorf("expected error to contain redirect chain %q, got %v", chain, err)
+		}
+		if !isNotFound(err) {
+			t.Errorf("expected a missing meta tag to still be reported as such, got %v", err)
+		}
+	})
+}
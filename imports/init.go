@@ -0,0 +1,124 @@
+package imports
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ericchiang/got/log"
+)
+
+// Init writes an initial manifest for the project in dir, pinning every repo
+// the project imports to the latest revision of its default branch. Repos are
+// fetched into cacheDir to determine those revisions. An existing manifest is
+// only overwritten if force is true. If progress is non-nil, it receives a
+// single line summarizing the progress of all clones.
+//
+// If pkg is non-empty, only the repos imported by the package in that
+// directory of the project, such as "cmd/server", are pinned, along with
+// those imported by the project's packages it imports.
+func Init(dir, cacheDir, pkg string, force bool, progress io.Writer, resolverOpts ResolverOptions, logger log.Logger) ([]Pin, error) {
+	c, err := newCache(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	if progress != nil {
+		ctx = withProgress(ctx, newProgress(progress))
+	}
+	r, err := loggingResolver(resolverOpts, logger)
+	if err != nil {
+		return nil, err
+	}
+	return initManifest(ctx, r, c, dir, pkg, force, resolverOpts.retryPolicy())
+}
+
+func initManifest(ctx context.Context, r pkgResolver, c *cache, dir, pkg string, force bool, p retryPolicy) ([]Pin, error) {
+	filename := filepath.Join(dir, ManifestFile)
+	if !force {
+		if _, err := os.Stat(filename); err == nil {
+			return nil, errors.Errorf("%s already exists, use force to overwrite it", filename)
+		} else if !os.IsNotExist(err) {
+			return nil, errors.Wrap(err, "checking for manifest")
+		}
+	}
+
+	self, err := projectImportPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	var imports []string
+	if pkg != "" {
+		imports, err = collectPackageImports(dir, self, pkg)
+	} else {
+		imports, err = collectImports(dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []string
+	for _, imp := range imports {
+		if isStdPackage(imp) || (self != "" && hasPathPrefix(imp, self)) {
+			continue
+		}
+		pkgs = append(pkgs, imp)
+	}
+
+	metas := make([]*pkgMeta, len(pkgs))
+	group, gctx := errgroup.WithContext(ctx)
+	for i, pkg := range pkgs {
+		i, pkg := i, pkg
+		group.Go(func() error {
+			meta, err := r.resolve(gctx, pkg)
+			if err != nil {
+				return errors.Wrapf(err, "lookup metatags for package %s", pkg)
+			}
+			metas[i] = meta
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	// Several packages may come from the same repo, but each repo only needs
+	// to be fetched and pinned once.
+	var roots []*pkgMeta
+	seen := map[string]bool{}
+	for _, meta := range metas {
+		if !seen[meta.Root] {
+			seen[meta.Root] = true
+			roots = append(roots, meta)
+		}
+	}
+
+	prog := progressFrom(ctx)
+	prog.expect(len(roots))
+	pins := make([]Pin, len(roots))
+	group, gctx = errgroup.WithContext(ctx)
+	for i, meta := range roots {
+		i, meta := i, meta
+		group.Go(func() error {
+			version, err := headVersion(gctx, c, meta, p)
+			if err != nil {
+				return errors.Wrapf(err, "determining latest revision of %s", meta.Root)
+			}
+			pins[i] = pinnedPackage{meta: meta, version: version}.pin()
+			return nil
+		})
+	}
+	err = group.Wait()
+	prog.finish()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeManifest(filename, pins); err != nil {
+		return nil, err
+	}
+	return pins, nil
+}
@@ -0,0 +1,161 @@
+package imports
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestInitManifest(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		remote := filepath.Join(dir, "remote")
+		rev := gitRepo(t, remote, []file{{"foo.go", "package foo"}})
+
+		project := filepath.Join(dir, "project")
+		if err := os.Mkdir(project, 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeFiles(t, project, []file{
+			{"go.mod", "module example.com/project\n"},
+			{"main.go", `package main
+
+import (
+	"fmt"
+
+	"example.com/foo"
+	"example.com/foo/bar"
+	"example.com/project/internal/baz"
+)
+`},
+		})
+
+		r := resolverFunc(func(ctx context.Context, pkg string) (*pkgMeta, error) {
+			if !hasPathPrefix(pkg, "example.com/foo") {
+				t.Errorf("unexpected lookup of %s", pkg)
+			}
+			return &pkgMeta{Root: "example.com/foo", VCS: "git", Remote: "file://" + filepath.ToSlash(remote)}, nil
+		})
+
+		pins, err := initManifest(context.Background(), r, c, project, "", false, backoff{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []Pin{{
+			Root:    "example.com/foo",
+			Remote:  "file://" + filepath.ToSlash(remote),
+			VCS:     "git",
+			Version: rev,
+		}}
+		if !reflect.DeepEqual(pins, want) {
+			t.Errorf("expected pins %#v, got %#v", want, pins)
+		}
+
+		filename := filepath.Join(project, ManifestFile)
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := parseGotManifest(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || !reflect.DeepEqual(got[0].pin(), want[0]) {
+			t.Errorf("expected manifest to contain %#v, got %s", want, data)
+		}
+
+		_, err = initManifest(context.Background(), r, c, project, "", false, backoff{})
+		if err == nil || !strings.Contains(err.Error(), "already exists") {
+			t.Errorf("expected init to refuse to overwrite manifest, got %v", err)
+		}
+		if _, err := initManifest(context.Background(), r, c, project, "", true, backoff{}); err != nil {
+			t.Errorf("expected init to overwrite manifest with force: %v", err)
+		}
+	})
+}
+
+func TestInitManifestPackage(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		remotes := map[string]string{}
+		for _, name := range []string{"client", "server", "shared", "unused"} {
+			remote := filepath.Join(dir, name)
+			gitRepo(t, remote, []file{{name + ".go", "package " + name}})
+			remotes["example.com/"+name] = "file://" + filepath.ToSlash(remote)
+		}
+
+		project := filepath.Join(dir, "project")
+		if err := os.Mkdir(project, 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeFiles(t, project, []file{
+			{"go.mod", "module example.com/project\n"},
+			{"cmd", ""},
+			{"cmd/server", ""},
+			{"cmd/server/main.go", "package main\n\nimport (\n\t\"example.com/project/internal/db\"\n\t\"example.com/server\"\n)\n"},
+			{"cmd/client", ""},
+			{"cmd/client/main.go", "package main\n\nimport \"example.com/client\"\n"},
+			{"internal", ""},
+			{"internal/db", ""},
+			{"internal/db/db.go", "package db\n\nimport \"example.com/shared/sub\"\n"},
+			{"internal/unused", ""},
+			{"internal/unused/unused.go", "package unused\n\nimport \"example.com/unused\"\n"},
+		})
+
+		r := resolverFunc(func(ctx context.Context, pkg string) (*pkgMeta, error) {
+			for root, remote := range remotes {
+				if hasPathPrefix(pkg, root) {
+					return &pkgMeta{Root: root, VCS: "git", Remote: remote}, nil
+				}
+			}
+			t.Errorf("unexpected lookup of %s", pkg)
+			return nil, errors.Errorf("unknown package %s", pkg)
+		})
+
+		pins, err := initManifest(context.Background(), r, c, project, "cmd/server", false, backoff{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var roots []string
+		for _, p := range pins {
+			roots = append(roots, p.Root)
+		}
+		sort.Strings(roots)
+		// The server's own imports, and those of the internal package it
+		// imports.
+		if want := []string{"example.com/server", "example.com/shared"}; !reflect.DeepEqual(roots, want) {
+			t.Errorf("expected only %q to be pinned, got %q", want, roots)
+		}
+		if _, err := vendorManifest(context.Background(), c, project, getOptions{retry: backoff{}}); err != nil {
+			t.Fatal(err)
+		}
+		compareFiles(t, filepath.Join(project, "vendor"), []file{
+			{"example.com", ""},
+			{"example.com/server", ""},
+			{"example.com/server/server.go", "package server"},
+			{"example.com/shared", ""},
+			{"example.com/shared/shared.go", "package shared"},
+		})
+
+		if _, err := initManifest(context.Background(), r, c, project, "cmd/missing", true, backoff{}); err == nil {
+			t.Errorf("expected an error for a directory without Go files")
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package imports
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// CloneLimits bound how long cloning a single repo may take and how large it
+// may get, so one pathologically large dependency doesn't stall a vendor run.
+// Zero values mean no limit.
+type CloneLimits struct {
+	// Timeout is the longest a clone may take.
+	Timeout time.Duration
+	// MaxSize is the largest a clone may be, in bytes.
+	MaxSize int64
+	// Strict fails the run when a repo exceeds a limit, rather than skipping
+	// the repo and reporting it at the end.
+	Strict bool
+}
+
+func (l CloneLimits) enabled() bool {
+	return l.Timeout > 0 || l.MaxSize > 0
+}
+
+// limitError is returned when cloning a repo exceeds its CloneLimits.
+type limitError struct {
+	root   string
+	reason string
+}
+
+func (e *limitError) Error() string {
+	return fmt.Sprintf("%s: %s", e.root, e.reason)
+}
+
+func timeoutError(root string, d time.Duration) error {
+	return &limitError{root, fmt.Sprintf("clone took longer than %s", d)}
+}
+
+func sizeError(root string, max int64) error {
+	return &limitError{root, fmt.Sprintf("clone is larger than %s", formatBytes(float64(max)))}
+}
+
+// limitsKey is the context key of the limits clones are held to.
+type limitsKey struct{}
+
+// withCloneLimits returns a context whose clones are held to l.
+func withCloneLimits(ctx context.Context, l CloneLimits) context.Context {
+	return context.WithValue(ctx, limitsKey{}, l)
+}
+
+// cloneLimitsFrom returns the limits clones made with ctx are held to.
+func cloneLimitsFrom(ctx context.Context) CloneLimits {
+	l, _ := ctx.Value(limitsKey{}).(CloneLimits)
+	return l
+}
+
+// limitedGet calls get, which clones a repo into path, and checks the clone
+// against l afterwards. Clones that can't be aborted part way, such as those
+// of VCSs other than git, are only caught once they're done. A clone that
+// exceeds a limit is removed, so it's attempted again by the next run.
+func limitedGet(root, path string, l CloneLimits, get func() error) error {
+	start := time.Now()
+	if err := get(); err != nil {
+		return err
+	}
+	var err error
+	if l.Timeout > 0 && time.Since(start) > l.Timeout {
+		err = timeoutError(root, l.Timeout)
+	} else if l.MaxSize > 0 {
+		size, serr := dirSize(path)
+		if serr != nil {
+			return serr
+		}
+		if size > l.MaxSize {
+			err = sizeError(root, l.MaxSize)
+		}
+	}
+	if err != nil {
+		os.RemoveAll(path)
+	}
+	return err
+}
@@ -0,0 +1,86 @@
+package imports
+
+import (
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestVendorManifestCloneLimits(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		smallDir, bigDir := filepath.Join(dir, "small"), filepath.Join(dir, "big")
+		small := gitRepo(t, smallDir, []file{{"small.go", "package small"}})
+		// Random data doesn't compress, so the clone is as large as the
+		// file.
+		data := make([]byte, 256<<10)
+		rand.New(rand.NewSource(1)).Read(data)
+		big := gitRepo(t, bigDir, []file{{"big.go", "package big"}, {"blob", string(data)}})
+
+		// A remote that never responds.
+		done := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-done
+		}))
+		defer srv.Close()
+		defer close(done)
+
+		project := filepath.Join(dir, "project")
+		if err := os.Mkdir(project, 0755); err != nil {
+			t.Fatal(err)
+		}
+		pins := []Pin{
+			{Root: "example.com/big", Remote: "file://" + filepath.ToSlash(bigDir), VCS: "git", Version: big},
+			{Root: "example.com/slow", Remote: srv.URL + "/slow", VCS: "git", Version: "master"},
+			{Root: "example.com/small", Remote: "file://" + filepath.ToSlash(smallDir), VCS: "git", Version: small},
+		}
+		filename := filepath.Join(project, ManifestFile)
+		if err := writeManifest(filename, pins); err != nil {
+			t.Fatal(err)
+		}
+
+		limits := CloneLimits{Timeout: time.Second, MaxSize: 64 << 10}
+		l := new(testLogger)
+		opts := getOptions{retry: backoff{}, logger: l, limits: limits}
+		got, err := vendorManifest(context.Background(), c, project, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range got {
+			if vendored := len(p.Files) > 0; vendored != (p.Root == "example.com/small") {
+				t.Errorf("%s: unexpected vendored files %q", p.Root, p.Files)
+			}
+		}
+		compareFiles(t, filepath.Join(project, "vendor", "example.com", "small"), []file{{"small.go", "package small"}})
+
+		want := []string{
+			"example.com/big: skipped, clone is larger than 64.00 KiB",
+			"example.com/slow: skipped, clone took longer than 1s",
+		}
+		if msgs := l.messages("error"); strings.Join(msgs, "\n") != strings.Join(want, "\n") {
+			t.Errorf("expected skipped repos to be reported as %q, got %q", want, msgs)
+		}
+
+		// Skipped repos are tried again, and fail the run when strict.
+		opts.logger = nil
+		opts.limits.Strict = true
+		_, err = vendorManifest(context.Background(), c, project, opts)
+		if _, ok := errors.Cause(err).(*limitError); !ok {
+			t.Errorf("expected a strict run to fail with a limit error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package imports
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// List returns the pins of the manifest of the project in dir.
+func List(dir string) ([]Pin, error) {
+	filename := filepath.Join(dir, ManifestFile)
+	pins, err := readManifest(filename)
+	if err != nil {
+		return nil, err
+	}
+	if pins == nil {
+		return nil, errors.Errorf("no manifest found at %s", filename)
+	}
+	return pins, nil
+}
+
+// PinStatus compares a pin to the latest revision of its repo.
+type PinStatus struct {
+	Pin
+	// Latest is the latest revision of the repo's default branch.
+	Latest string `json:"latest"`
+	// Outdated is set if the pinned version is at a revision other than
+	// Latest.
+	Outdated bool `json:"outdated"`
+}
+
+// Outdated fetches every repo pinned by the manifest of the project in dir
+// into cacheDir, and reports whether each pin is behind the latest revision
+// of its repo's default branch. Fetches are retried as configured by
+// resolverOpts.
+func Outdated(dir, cacheDir string, resolverOpts ResolverOptions) ([]PinStatus, error) {
+	pins, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+	c, err := newCache(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	return pinStatuses(context.Background(), c, pins, resolverOpts.retryPolicy())
+}
+
+func pinStatuses(ctx context.Context, c *cache, pins []Pin, p retryPolicy) ([]PinStatus, error) {
+	statuses := make([]PinStatus, len(pins))
+	group, gctx := errgroup.WithContext(ctx)
+	for i, pin := range pins {
+		i, pin := i, pin
+		group.Go(func() error {
+			meta := pin.meta()
+			pinned, latest, err := compareHead(gctx, c, meta, pin.Version, p)
+			if err != nil {
+				return errors.Wrapf(err, "determining latest revision of %s", pin.Root)
+			}
+			statuses[i] = PinStatus{Pin: pin, Latest: latest, Outdated: pinned != latest}
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// compareHead fetches a repo and returns both the revision version refers
+// to and the latest revision of the default branch. Versions can be tags or
+// branches, so they're compared as revisions.
+func compareHead(ctx context.Context, c *cache, meta *pkgMeta, version string, p retryPolicy) (pinned, latest string, err error) {
+	err = c.dir(cacheKey(meta.Remote), func(path string) error {
+		repo, cloned, err := cloneRepo(ctx, meta, path, p)
+		if err != nil {
+			return err
+		}
+		if latest, err = checkoutHead(ctx, repo, cloned, p); err != nil {
+			return err
+		}
+		pinned, err = checkoutVersion(ctx, repo, version, p)
+		return err
+	})
+	return pinned, latest, err
+}
@@ -0,0 +1,63 @@
+package imports
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPinStatuses(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		fooDir, barDir := filepath.Join(dir, "foo"), filepath.Join(dir, "bar")
+		oldFoo := gitRepo(t, fooDir, []file{{"foo.go", "package foo"}})
+		bar := gitRepo(t, barDir, []file{{"bar.go", "package bar"}})
+
+		git := func(dir string, args ...string) string {
+			args = append([]string{"-c", "user.name=got", "-c", "user.email=got@example.com"}, args...)
+			cmd := exec.Command("git", args...)
+			cmd.Dir = dir
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("git %v: %v: %s", args, err, out)
+			}
+			return strings.TrimSpace(string(out))
+		}
+		// Move foo past its pin, and pin bar by a tag of its latest revision.
+		writeFiles(t, fooDir, []file{{"new.go", "package foo"}})
+		git(fooDir, "add", "-A")
+		git(fooDir, "commit", "-m", "second commit")
+		newFoo := git(fooDir, "rev-parse", "HEAD")
+		git(barDir, "tag", "v1.0.0")
+
+		pins := []Pin{
+			{Root: "example.com/bar", Remote: "file://" + filepath.ToSlash(barDir), VCS: "git", Version: "v1.0.0"},
+			{Root: "example.com/foo", Remote: "file://" + filepath.ToSlash(fooDir), VCS: "git", Version: oldFoo},
+		}
+		got, err := pinStatuses(context.Background(), c, pins, backoff{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []PinStatus{
+			{Pin: pins[0], Latest: bar, Outdated: false},
+			{Pin: pins[1], Latest: newFoo, Outdated: true},
+		}
+		if len(got) != len(want) {
+			t.Fatalf("expected %d statuses, got %d", len(want), len(got))
+		}
+		for i := range want {
+			if got[i].Root != want[i].Root || got[i].Latest != want[i].Latest || got[i].Outdated != want[i].Outdated {
+				t.Errorf("expected status %+v, got %+v", want[i], got[i])
+			}
+		}
+	})
+}
@@ -3,25 +3,384 @@ package imports
 import (
 	"context"
 	"encoding/json"
-	"sync"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/BurntSushi/toml"
 	"github.com/pkg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
 	"golang.org/x/sync/errgroup"
+	"gopkg.in/yaml.v2"
+
+	"github.com/ericchiang/got/log"
 )
 
 type pinnedPackage struct {
 	meta    *pkgMeta
 	version string
+	// constraint is the semantic version range updates must stay within,
+	// see Pin.Constraint.
+	constraint string
+}
+
+// Pin describes a repo pinned to a version.
+type Pin struct {
+	// Root is the import path of the repo root, e.g. "golang.org/x/net".
+	Root string `json:"root"`
+	// Remote is the address the repo is fetched from. When a mirror is
+	// substituted for a repo, such as through a resolver override, this is
+	// the mirror, so later runs fetch from the same place.
+	Remote string `json:"remote"`
+	// VCS is the version control system of the repo, e.g. "git".
+	VCS string `json:"vcs"`
+	// Subdir is the directory of the repo vendored at Root, if not the repo
+	// root. It's set for Go modules kept in a directory of a larger repo,
+	// such as "example.com/foo/api", whose Root is then the module path.
+	Subdir string `json:"subdir,omitempty"`
+	// Version is the revision, tag or branch the repo is pinned to. It may
+	// be prefixed by "commit:", "tag:" or "branch:" to say which, in case a
+	// name is ambiguous. A branch prefixed by "track:" is vendored at its
+	// latest revision on every vendor run.
+	Version string `json:"version"`
+	// Revision is the revision Version resolved to when the repo was last
+	// vendored. It's only recorded for versions with one of those prefixes.
+	Revision string `json:"revision,omitempty"`
+	// Files lists the files of the vendored copy of the repo, relative to
+	// its vendor directory. It's only recorded in got's native manifest,
+	// and is used to detect incomplete copies.
+	Files []string `json:"files,omitempty"`
+	// Hash is the tree hash of the vendored files, in the "h1:" format of
+	// go.sum. It's recorded along with Files and is used to detect copies
+	// whose files were modified.
+	Hash string `json:"hash,omitempty"`
+	// Constraint, if set, is a semantic version range, such as "^1.2.0".
+	// Updates pin the repo to its highest tag within the range, see
+	// versionConstraint for the syntax.
+	Constraint string `json:"constraint,omitempty"`
+}
+
+func (p pinnedPackage) pin() Pin {
+	return Pin{
+		Root:       p.meta.Root,
+		Remote:     p.meta.Remote,
+		VCS:        p.meta.VCS,
+		Subdir:     p.meta.Subdir,
+		Version:    p.version,
+		Constraint: p.constraint,
+	}
+}
+
+// lockedVersion returns the version that checks out the revision the repo was
+// at when it was last vendored, if one was recorded, or the pinned version
+// otherwise.
+func (p Pin) lockedVersion() string {
+	if p.Revision == "" {
+		return p.Version
+	}
+	return refCommit + ":" + p.Revision
+}
+
+// meta returns where the pinned repo is fetched from.
+func (p Pin) meta() *pkgMeta {
+	return &pkgMeta{Root: p.Root, VCS: p.VCS, Remote: p.Remote, Subdir: p.Subdir}
+}
+
+// ManifestFile is the name of got's native manifest, which pins every repo a
+// project depends on along with where to fetch it from.
+const ManifestFile = "got.json"
+
+// manifest is the format of ManifestFile.
+type manifest struct {
+	Packages []Pin `json:"packages"`
+	// VendorExclude holds glob patterns of files and directories never
+	// copied from any repo, on top of the ones always ignored. See
+	// excludePath for how they're matched.
+	VendorExclude []string `json:"vendor_exclude_patterns,omitempty"`
+	// WritePackageInfo records where each vendored package was fetched
+	// from in a pkgInfoFile in its directory.
+	WritePackageInfo bool `json:"write_package_info,omitempty"`
+	// PreserveXattrs keeps the extended attributes of copied files, on
+	// platforms that support them.
+	PreserveXattrs bool `json:"preserve_xattrs,omitempty"`
+	// Platforms, of the form "GOOS/GOARCH", restricts vendored Go and
+	// assembly files to those that build on at least one of them.
+	Platforms []string `json:"platforms,omitempty"`
+}
+
+// configure applies the settings of the manifest to opts.
+func (m *manifest) configure(opts *getOptions) {
+	opts.copy.exclude = m.VendorExclude
+	opts.writeInfo = m.WritePackageInfo
+	opts.copy.xattrs = m.PreserveXattrs
+	opts.copy.platforms = nil
+	for _, s := range m.Platforms {
+		// Platforms are validated by decodeManifestFile.
+		if p, err := parsePlatform(s); err == nil {
+			opts.copy.platforms = append(opts.copy.platforms, p)
+		}
+	}
+}
+
+// parseGotManifest parses got's native manifest. Since pins already record
+// the remote and VCS of each repo, no lookups are required.
+func parseGotManifest(b []byte) ([]pinnedPackage, error) {
+	pins, err := decodeManifest(b)
+	if err != nil {
+		return nil, err
+	}
+	packages := make([]pinnedPackage, len(pins))
+	for i, p := range pins {
+		meta := p.meta()
+		packages[i] = pinnedPackage{meta: meta, version: p.Version, constraint: p.Constraint}
+	}
+	return packages, nil
+}
+
+func decodeManifest(b []byte) ([]Pin, error) {
+	m, err := decodeManifestFile(b)
+	if err != nil {
+		return nil, err
+	}
+	return m.Packages, nil
+}
+
+func decodeManifestFile(b []byte) (*manifest, error) {
+	var m manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, errors.Wrap(err, "parsing got manifest")
+	}
+	for i, p := range m.Packages {
+		if p.Root == "" || p.Remote == "" || p.VCS == "" {
+			return nil, errors.Errorf("manifest entry %d is missing a root, remote or vcs", i)
+		}
+		if p.Version == "" {
+			return nil, errors.Errorf("repo %s didn't have an associated version", p.Root)
+		}
+		if p.Constraint != "" {
+			if _, err := parseConstraint(p.Constraint); err != nil {
+				return nil, errors.Wrapf(err, "repo %s", p.Root)
+			}
+		}
+	}
+	for _, pattern := range m.VendorExclude {
+		if _, err := path.Match(strings.TrimSuffix(pattern, "/"), ""); err != nil {
+			return nil, errors.Errorf("invalid vendor exclude pattern %q", pattern)
+		}
+	}
+	for _, s := range m.Platforms {
+		if _, err := parsePlatform(s); err != nil {
+			return nil, err
+		}
+	}
+	return &m, nil
+}
+
+// readManifest reads the pins of a manifest in got's native format. A
+// missing manifest holds no pins.
+func readManifest(filename string) ([]Pin, error) {
+	m, err := readManifestFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return m.Packages, nil
+}
+
+// readManifestFile reads a manifest in got's native format, including its
+// settings. A missing manifest is empty.
+func readManifestFile(filename string) (*manifest, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &manifest{}, nil
+		}
+		return nil, errors.Wrap(err, "reading manifest")
+	}
+	return decodeManifestFile(data)
+}
+
+// writeManifest writes pins to a manifest file in got's native format,
+// sorted by repo root so the output is stable. Settings of an existing
+// manifest, such as VendorExclude, are kept. The manifest is written to a
+// temporary file that's renamed into place, so an interrupted write never
+// leaves a truncated manifest behind.
+func writeManifest(filename string, pins []Pin) error {
+	m, err := readManifestFile(filename)
+	if err != nil {
+		return err
+	}
+	m.Packages = append([]Pin{}, pins...)
+	sort.Slice(m.Packages, func(i, j int) bool {
+		return m.Packages[i].Root < m.Packages[j].Root
+	})
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return errors.Wrap(err, "encoding manifest")
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), ".got")
+	if err != nil {
+		return errors.Wrap(err, "creating manifest")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "writing manifest")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "writing manifest")
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return errors.Wrap(err, "setting manifest permissions")
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return errors.Wrap(err, "writing manifest")
+	}
+	return nil
+}
+
+// pkgResolver determines the repo a package belongs to. The public entry points
+// use the resolver returned by newResolver, while tests pass fakes, usually a
+// resolverFunc, so no lookups leave the machine.
+type pkgResolver interface {
+	resolve(ctx context.Context, pkg string) (*pkgMeta, error)
+}
+
+// resolverFunc adapts a function to the pkgResolver interface.
+type resolverFunc func(ctx context.Context, pkg string) (*pkgMeta, error)
+
+func (f resolverFunc) resolve(ctx context.Context, pkg string) (*pkgMeta, error) {
+	return f(ctx, pkg)
+}
+
+// Resolve reads a manifest file, such as "Godeps/Godeps.json", and resolves
+// the repo of each package it pins. Nothing is cloned or written to disk.
+// replaceLayout is where go.mod replacements with a newer major version of
+// the same module are vendored, either "target", the default, or "original".
+// Reading a legacy manifest logs a deprecation notice, see Migrate.
+func Resolve(filename, replaceLayout string, resolverOpts ResolverOptions, logger log.Logger) ([]Pin, error) {
+	layout, err := parseReplaceLayout(replaceLayout)
+	if err != nil {
+		return nil, err
+	}
+	r, err := loggingResolver(resolverOpts, logger)
+	if err != nil {
+		return nil, err
+	}
+	deprecationNotices.warn(logger, filename)
+	return resolveManifest(r, filename, layout)
+}
+
+// resolveManifest reads a manifest and resolves the repo of each package it
+// pins. If any packages fail to resolve, every one of them is listed in a
+// *ResolveError.
+func resolveManifest(r pkgResolver, filename string, layout replaceLayout) ([]Pin, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading manifest")
+	}
+	isolated := &isolatingResolver{next: r}
+	pkgs, err := parseManifest(isolated, filename, data, layout)
+	// Failures to resolve take precedence, since the placeholder repos of
+	// failed packages may cause other errors.
+	if rerr := isolated.err(); rerr != nil {
+		return nil, rerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	pins := make([]Pin, len(pkgs))
+	for i, pkg := range pkgs {
+		pins[i] = pkg.pin()
+	}
+	return pins, nil
+}
+
+// parseManifest parses a manifest, choosing a parser based on its filename.
+// layout only applies to go.mod files.
+func parseManifest(r pkgResolver, filename string, b []byte, layout replaceLayout) ([]pinnedPackage, error) {
+	switch name := filepath.Base(filename); {
+	case name == ManifestFile:
+		return parseGotManifest(b)
+	case strings.EqualFold(name, "godeps.json"):
+		return parseGodeps(r, b)
+	case name == "go.mod":
+		return parseGoMod(r, b, layout)
+	case strings.EqualFold(name, "vendor.json"):
+		return parseVendorJSON(r, b)
+	case strings.EqualFold(name, "gopkg.lock"):
+		return parseGopkgLock(r, b)
+	case strings.EqualFold(name, "glide.yaml"):
+		lock, err := readSibling(filename, "glide.lock")
+		if err != nil {
+			return nil, err
+		}
+		return parseGlide(r, b, lock)
+	case strings.EqualFold(name, "glide.lock"):
+		config, err := readSibling(filename, "glide.yaml")
+		if err != nil {
+			return nil, err
+		}
+		return parseGlide(r, config, b)
+	default:
+		return nil, errors.Errorf("unrecognized manifest file %s", name)
+	}
+}
+
+// readSibling reads a file in the same directory as filename, returning nil
+// if it doesn't exist.
+func readSibling(filename, name string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filepath.Join(filepath.Dir(filename), name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "reading %s", name)
+	}
+	return data, nil
+}
+
+// godepsDescribe matches the suffix 'git describe' adds when a revision isn't
+// tagged itself, e.g. the "-78-gdea108d" of "v0.3.1-78-gdea108d".
+var godepsDescribe = regexp.MustCompile(`-[0-9]+-g[0-9a-f]+$`)
+
+// godepsTag returns the tag recorded in the comment of a Godeps dependency,
+// or an empty string if the comment doesn't name a tag of the revision
+// itself.
+func godepsTag(comment string) string {
+	if comment == "" || strings.ContainsAny(comment, " \t") || godepsDescribe.MatchString(comment) || isConstraint(comment) {
+		return ""
+	}
+	return comment
 }
 
-type resolverFunc func(ctx context.Context, name string) (*pkgMeta, error)
+// godepsConstraint returns the version constraint recorded in the comment of
+// a Godeps dependency, such as "^1.2.0", or an empty string if the comment
+// isn't a valid constraint.
+func godepsConstraint(comment string) string {
+	if !isConstraint(comment) {
+		return ""
+	}
+	if _, err := parseConstraint(comment); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(comment)
+}
 
-func parseGodeps(lookupPkgMeta resolverFunc, b []byte) ([]pinnedPackage, error) {
+func parseGodeps(r pkgResolver, b []byte) ([]pinnedPackage, error) {
 	var deps struct {
 		Deps []struct {
 			ImportPath string
 			Rev        string
-			// Comment can be a tag, but for now we'll ignore it.
+			// Comment is the output of 'git describe' for the rev, for
+			// example "v0.3.1" or "v0.3.1-78-gdea108d". See godepsTag.
+			// It may also hold a version constraint, such as "^1.2.0",
+			// that updates must satisfy. See godepsConstraint.
 			Comment string
 		}
 	}
@@ -30,9 +389,9 @@ func parseGodeps(lookupPkgMeta resolverFunc, b []byte) ([]pinnedPackage, error)
 		return nil, errors.Wrap(err, "parsing godep file")
 	}
 
-	// We need to actually resolve the repo these package come from. While doing
-	// this, if two packages have the same rev, assume they originate from the
-	// same repo. For example if we see dependencies like:
+	// We need to actually resolve the repo these package come from. Packages
+	// resolving to the same repo root are collapsed into a single pin, for
+	// example:
 	//
 	//		{
 	//			"ImportPath": "github.com/coreos/go-oidc/jose",
@@ -43,42 +402,482 @@ func parseGodeps(lookupPkgMeta resolverFunc, b []byte) ([]pinnedPackage, error)
 	//			"Rev": "a4973d9a4225417aecf5d450a9522f00c1f7130f"
 	//		},
 	//
-	// assume they're from the same repo and only look up the repo of one of them.
-	toLookup := map[string]string{} // rev -> importPath
+	// Revs are compared after lookup rather than used to group packages
+	// beforehand, since unrelated repos can share a rev string, and one repo
+	// must not be pinned to several revisions.
+	type dep struct {
+		importPath string
+		rev        string
+		// tag is the tag pointing at rev, if any.
+		tag string
+		// constraint is the version range updates must satisfy, if any.
+		constraint string
+	}
+	var toLookup []dep
 
-	for _, dep := range deps.Deps {
-		if dep.ImportPath == "" {
+	for _, d := range deps.Deps {
+		if d.ImportPath == "" {
 			continue
 		}
-		if dep.Rev == "" {
-			return nil, errors.Errorf("import %s didn't have an associated ref", dep.ImportPath)
+		if d.Rev == "" {
+			return nil, errors.Errorf("import %s didn't have an associated ref", d.ImportPath)
 		}
-		toLookup[dep.Rev] = dep.ImportPath
+		toLookup = append(toLookup, dep{d.ImportPath, d.Rev, godepsTag(d.Comment), godepsConstraint(d.Comment)})
 	}
 
-	var (
-		mu       sync.Mutex
-		packages []pinnedPackage
-	)
+	metas := make([]*pkgMeta, len(toLookup))
 
 	group, ctx := errgroup.WithContext(context.Background())
 
-	for rev, importPath := range toLookup {
-		rev, importPath := rev, importPath
+	for i, d := range toLookup {
+		i, importPath := i, d.importPath
 
 		group.Go(func() error {
-			meta, err := lookupPkgMeta(ctx, importPath)
+			meta, err := r.resolve(ctx, importPath)
 			if err != nil {
 				return errors.Wrapf(err, "lookup metatags for package %s", importPath)
 			}
+			metas[i] = meta
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
 
-			mu.Lock()
-			packages = append(packages, pinnedPackage{meta, rev})
-			mu.Unlock()
+	var packages []pinnedPackage
+	seen := map[string]dep{} // root -> first package seen from that repo
+	for i, d := range toLookup {
+		meta := metas[i]
+		if prev, ok := seen[meta.Root]; ok {
+			if prev.rev != d.rev {
+				return nil, errors.Errorf("repo %s pinned to multiple revisions: %s at %s, %s at %s",
+					meta.Root, prev.importPath, prev.rev, d.importPath, d.rev)
+			}
+			continue
+		}
+		seen[meta.Root] = d
 
+		// Prefer a tag of the rev, if any package from the repo knows one,
+		// so a human readable version is checked out. It's pinned as a tag,
+		// so it can't be mistaken for a branch of the same name.
+		version := d.rev
+		for j := i; j < len(toLookup); j++ {
+			if metas[j].Root == meta.Root && toLookup[j].rev == d.rev && toLookup[j].tag != "" {
+				version = refTag + ":" + toLookup[j].tag
+				break
+			}
+		}
+		// Likewise, any package may carry the constraint of the repo.
+		var constraint string
+		for j := i; j < len(toLookup) && constraint == ""; j++ {
+			if metas[j].Root == meta.Root {
+				constraint = toLookup[j].constraint
+			}
+		}
+		packages = append(packages, pinnedPackage{meta: meta, version: version, constraint: constraint})
+	}
+	return packages, nil
+}
+
+// glidePackage is a package entry of a glide.yaml or glide.lock file.
+type glidePackage struct {
+	// Name is used by glide.lock, Package by glide.yaml.
+	Name    string `yaml:"name"`
+	Package string `yaml:"package"`
+	Version string `yaml:"version"`
+	// Repo and VCS override the resolved remote of the package.
+	Repo string `yaml:"repo"`
+	VCS  string `yaml:"vcs"`
+}
+
+// parseGlide parses a glide.yaml config and its glide.lock, either of which
+// may be nil. Glide records every package the project depends on in the
+// lock, including transitive ones, so versions in the lock take precedence
+// over the config.
+func parseGlide(r pkgResolver, config, lock []byte) ([]pinnedPackage, error) {
+	var c struct {
+		Imports     []glidePackage `yaml:"import"`
+		TestImports []glidePackage `yaml:"testImport"`
+	}
+	if err := yaml.Unmarshal(config, &c); err != nil {
+		return nil, errors.Wrap(err, "parsing glide.yaml")
+	}
+	var l struct {
+		Hash        string         `yaml:"hash"`
+		Imports     []glidePackage `yaml:"imports"`
+		TestImports []glidePackage `yaml:"testImports"`
+	}
+	if err := yaml.Unmarshal(lock, &l); err != nil {
+		return nil, errors.Wrap(err, "parsing glide.lock")
+	}
+	if lock != nil && l.Hash == "" {
+		return nil, errors.New("glide.lock has no hash, it may not have been generated by glide")
+	}
+
+	var pkgs []glidePackage
+	locked := map[string]bool{}
+	for _, p := range append(l.Imports, l.TestImports...) {
+		if p.Name == "" {
+			continue
+		}
+		if p.Version == "" {
+			return nil, errors.Errorf("import %s didn't have an associated version in glide.lock", p.Name)
+		}
+		locked[p.Name] = true
+		pkgs = append(pkgs, p)
+	}
+	for _, p := range append(c.Imports, c.TestImports...) {
+		if p.Package == "" || locked[p.Package] {
+			continue
+		}
+		if p.Version == "" {
+			return nil, errors.Errorf("import %s didn't have an associated version", p.Package)
+		}
+		p.Name = p.Package
+		pkgs = append(pkgs, p)
+	}
+
+	metas := make([]*pkgMeta, len(pkgs))
+	group, ctx := errgroup.WithContext(context.Background())
+	for i, p := range pkgs {
+		i, p := i, p
+		group.Go(func() error {
+			meta, err := r.resolve(ctx, p.Name)
+			if err != nil {
+				return errors.Wrapf(err, "lookup metatags for package %s", p.Name)
+			}
+			if p.Repo != "" || p.VCS != "" {
+				override := *meta
+				if p.Repo != "" {
+					if override.Remote, err = normalizeRemote(p.Repo); err != nil {
+						return errors.Wrapf(err, "invalid repo for package %s", p.Name)
+					}
+				}
+				if p.VCS != "" {
+					override.VCS = p.VCS
+				}
+				meta = &override
+			}
+			metas[i] = meta
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	var packages []pinnedPackage
+	seen := map[string]string{} // root -> version
+	for i, p := range pkgs {
+		meta := metas[i]
+		if version, ok := seen[meta.Root]; ok {
+			if version != p.Version {
+				return nil, errors.Errorf("repo %s pinned to multiple versions: %s and %s", meta.Root, version, p.Version)
+			}
+			continue
+		}
+		seen[meta.Root] = p.Version
+		packages = append(packages, pinnedPackage{meta: meta, version: p.Version})
+	}
+	return packages, nil
+}
+
+// parseGopkgLock parses dep's Gopkg.lock file. Each project is a repo root,
+// pinned to a revision, and may set a source that overrides its remote.
+func parseGopkgLock(r pkgResolver, b []byte) ([]pinnedPackage, error) {
+	var lock struct {
+		Projects []struct {
+			Name     string   `toml:"name"`
+			Revision string   `toml:"revision"`
+			Source   string   `toml:"source"`
+			Packages []string `toml:"packages"`
+		} `toml:"projects"`
+	}
+	if err := toml.Unmarshal(b, &lock); err != nil {
+		return nil, errors.Wrap(err, "parsing Gopkg.lock")
+	}
+	for _, p := range lock.Projects {
+		if p.Name == "" {
+			return nil, errors.New("Gopkg.lock project missing a name")
+		}
+		if p.Revision == "" {
+			return nil, errors.Errorf("project %s didn't have an associated revision", p.Name)
+		}
+	}
+
+	packages := make([]pinnedPackage, len(lock.Projects))
+	group, ctx := errgroup.WithContext(context.Background())
+	for i, p := range lock.Projects {
+		i, p := i, p
+		group.Go(func() error {
+			meta, err := r.resolve(ctx, p.Name)
+			if err != nil {
+				return errors.Wrapf(err, "lookup metatags for package %s", p.Name)
+			}
+			if p.Source != "" {
+				override := *meta
+				if override.Remote, err = normalizeRemote(p.Source); err != nil {
+					return errors.Wrapf(err, "invalid source for project %s", p.Name)
+				}
+				meta = &override
+			}
+			packages[i] = pinnedPackage{meta: meta, version: p.Revision}
 			return nil
 		})
 	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	return packages, nil
+}
+
+// parseGoMod parses the require directives of a go.mod file, including
+// indirect ones. Each module is pinned at its module path, so modules sharing
+// a repo, such as different major versions, are vendored side by side. Replace
+// directives pointing at other modules redirect the remote a module is
+// fetched from. Requirements on excluded versions are an error, since go
+// would pick another version. Replacements with local directories aren't
+// supported. Where replacements with a newer major version of the same module
+// are vendored is determined by layout.
+func parseGoMod(r pkgResolver, b []byte, layout replaceLayout) ([]pinnedPackage, error) {
+	f, err := modfile.Parse("go.mod", b, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing go.mod")
+	}
+
+	excluded := map[module.Version]bool{}
+	for _, e := range f.Exclude {
+		excluded[e.Mod] = true
+	}
 
-	return packages, group.Wait()
+	type dep struct {
+		path    string // module path, used for the vendor directory
+		version string
+		// replacement of the module, if any.
+		replace *module.Version
+	}
+	var deps []dep
+	for _, req := range f.Require {
+		if excluded[req.Mod] {
+			return nil, errors.Errorf("module %s is required at excluded version %s", req.Mod.Path, req.Mod.Version)
+		}
+		d := dep{path: req.Mod.Path, version: req.Mod.Version}
+		for _, rep := range f.Replace {
+			if rep.Old.Path != req.Mod.Path || (rep.Old.Version != "" && rep.Old.Version != req.Mod.Version) {
+				continue
+			}
+			if rep.New.Version == "" {
+				return nil, errors.Errorf("module %s is replaced by local directory %s, which isn't supported", req.Mod.Path, rep.New.Path)
+			}
+			// A replacement of a specific version takes precedence.
+			if d.replace == nil || rep.Old.Version != "" {
+				newMod := rep.New
+				d.replace = &newMod
+			}
+		}
+		deps = append(deps, d)
+	}
+
+	packages := make([]pinnedPackage, len(deps))
+	group, ctx := errgroup.WithContext(context.Background())
+	for i, d := range deps {
+		i, d := i, d
+		group.Go(func() error {
+			meta, err := r.resolve(ctx, d.path)
+			if err != nil {
+				return errors.Wrapf(err, "lookup metatags for module %s", d.path)
+			}
+			version := moduleRevision(d.path, meta.Root, d.version)
+			meta = &pkgMeta{Root: d.path, VCS: meta.VCS, Remote: meta.Remote, Subdir: moduleSubdir(d.path, meta.Root)}
+			if d.replace != nil {
+				rep, err := r.resolve(ctx, d.replace.Path)
+				if err != nil {
+					return errors.Wrapf(err, "lookup metatags for module %s", d.replace.Path)
+				}
+				// The code is fetched from the replacement, but is still
+				// imported, and vendored, using the original path. A new
+				// major version imports its own packages using its path,
+				// so it may be vendored at that path instead, see
+				// replaceLayout.
+				meta = &pkgMeta{Root: d.path, VCS: rep.VCS, Remote: rep.Remote, Subdir: moduleSubdir(d.replace.Path, rep.Root)}
+				if layout == replaceTarget && isMajorBump(d.path, d.replace.Path) {
+					meta.Root = d.replace.Path
+				}
+				version = moduleRevision(d.replace.Path, rep.Root, d.replace.Version)
+			}
+			packages[i] = pinnedPackage{meta: meta, version: version}
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	var pinned []pinnedPackage
+	seen := map[string]string{} // module path -> version
+	for _, p := range packages {
+		if version, ok := seen[p.meta.Root]; ok {
+			if version != p.version {
+				return nil, errors.Errorf("module %s pinned to multiple versions: %s and %s", p.meta.Root, version, p.version)
+			}
+			continue
+		}
+		seen[p.meta.Root] = p.version
+		pinned = append(pinned, p)
+	}
+	return pinned, nil
+}
+
+// replaceLayout determines where a module replaced by a new major version of
+// itself, e.g. "replace example.com/foo => example.com/foo/v2 v2.1.0", is
+// vendored.
+type replaceLayout int
+
+const (
+	// replaceTarget vendors the module at the replacement's module path,
+	// e.g. "vendor/example.com/foo/v2", so the packages of the new major
+	// version, which import each other using that path, are found.
+	replaceTarget replaceLayout = iota
+	// replaceOriginal vendors the module under the original path, like
+	// other replacements.
+	replaceOriginal
+)
+
+// parseReplaceLayout parses a replaceLayout, either "target", the default, or
+// "original".
+func parseReplaceLayout(s string) (replaceLayout, error) {
+	switch s {
+	case "", "target":
+		return replaceTarget, nil
+	case "original":
+		return replaceOriginal, nil
+	}
+	return 0, errors.Errorf("invalid replace layout %q, expected \"target\" or \"original\"", s)
+}
+
+// isMajorBump reports whether the module path to is a newer major version of
+// the module path from, such as "example.com/foo/v2" for "example.com/foo".
+func isMajorBump(from, to string) bool {
+	fromPrefix, fromMajor, ok := module.SplitPathVersion(from)
+	if !ok {
+		return false
+	}
+	toPrefix, toMajor, ok := module.SplitPathVersion(to)
+	if !ok || fromPrefix != toPrefix || toMajor == "" {
+		return false
+	}
+	return majorNumber(toMajor) > majorNumber(fromMajor)
+}
+
+// majorNumber returns the number of a major version suffix, such as 2 for
+// "/v2" or ".v2". Paths without a suffix are major version 0 or 1.
+func majorNumber(suffix string) int {
+	n, err := strconv.Atoi(strings.TrimLeft(suffix, "/.v"))
+	if err != nil {
+		return 1
+	}
+	return n
+}
+
+// moduleSubdir returns the directory of the repo at root that holds the
+// module modPath, without any major version suffix, e.g. "api" for
+// "example.com/foo/api/v3" in the repo of "example.com/foo". See moduleDir for
+// where major versions are found.
+func moduleSubdir(modPath, root string) string {
+	dir := strings.TrimPrefix(modPath, root)
+	if prefix, _, ok := module.SplitPathVersion(dir); ok {
+		dir = prefix
+	}
+	return strings.TrimPrefix(dir, "/")
+}
+
+// moduleRevision converts a module version into a version the module's repo
+// can be checked out at. Pseudo-versions, e.g.
+// "v0.0.0-20170915032832-14c0d48ead0c", refer to a revision. Other versions
+// are tags, which are prefixed by the module's directory in the repo if it
+// isn't at the repo root, e.g. "api/v1.2.0".
+func moduleRevision(modPath, root, version string) string {
+	if module.IsPseudoVersion(version) {
+		if rev, err := module.PseudoVersionRev(version); err == nil {
+			return rev
+		}
+	}
+	version = strings.TrimSuffix(version, "+incompatible")
+	dir := moduleSubdir(modPath, root)
+	if dir == "" {
+		return version
+	}
+	return dir + "/" + version
+}
+
+// parseVendorJSON parses govendor's vendor/vendor.json file. Packages from the
+// same repo are collapsed into a single pin. A package's origin is the import
+// path its code is actually fetched from, such as a fork, and overrides the
+// remote of its repo.
+func parseVendorJSON(r pkgResolver, b []byte) ([]pinnedPackage, error) {
+	var v struct {
+		Package []struct {
+			Path         string `json:"path"`
+			Origin       string `json:"origin"`
+			Revision     string `json:"revision"`
+			RevisionTime string `json:"revisionTime"`
+		} `json:"package"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, errors.Wrap(err, "parsing vendor.json")
+	}
+	for _, p := range v.Package {
+		if p.Path == "" {
+			return nil, errors.New("vendor.json package missing a path")
+		}
+		if p.Revision == "" {
+			return nil, errors.Errorf("import %s didn't have an associated revision", p.Path)
+		}
+	}
+
+	metas := make([]*pkgMeta, len(v.Package))
+	group, ctx := errgroup.WithContext(context.Background())
+	for i, p := range v.Package {
+		i, p := i, p
+		group.Go(func() error {
+			meta, err := r.resolve(ctx, p.Path)
+			if err != nil {
+				return errors.Wrapf(err, "lookup metatags for package %s", p.Path)
+			}
+			if p.Origin != "" {
+				origin, err := r.resolve(ctx, p.Origin)
+				if err != nil {
+					return errors.Wrapf(err, "lookup metatags for origin %s", p.Origin)
+				}
+				meta = &pkgMeta{Root: meta.Root, VCS: origin.VCS, Remote: origin.Remote}
+			}
+			metas[i] = meta
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	var packages []pinnedPackage
+	seen := map[string]int{} // root -> index of first package from that repo
+	for i, p := range v.Package {
+		meta := metas[i]
+		if j, ok := seen[meta.Root]; ok {
+			prev := v.Package[j]
+			if prev.Revision != p.Revision {
+				return nil, errors.Errorf("repo %s pinned to multiple revisions: %s at %s, %s at %s",
+					meta.Root, prev.Path, prev.Revision, p.Path, p.Revision)
+			}
+			if metas[j].Remote != meta.Remote {
+				return nil, errors.Errorf("repo %s fetched from multiple origins: %s and %s",
+					meta.Root, metas[j].Remote, meta.Remote)
+			}
+			continue
+		}
+		seen[meta.Root] = i
+		packages = append(packages, pinnedPackage{meta: meta, version: p.Revision})
+	}
+	return packages, nil
 }
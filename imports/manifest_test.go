@@ -3,6 +3,9 @@ package imports
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"testing"
@@ -89,7 +92,7 @@ func TestParseGodeps(t *testing.T) {
 		},
 	}
 
-	pkgs, err := parseGodeps(lookup, []byte(data))
+	pkgs, err := parseGodeps(resolverFunc(lookup), []byte(data))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -100,3 +103,809 @@ func TestParseGodeps(t *testing.T) {
 		t.Errorf("wanted %#v, got #%v", want, pkgs)
 	}
 }
+
+func TestParseGodepsSharedRev(t *testing.T) {
+	lookup := func(ctx context.Context, name string) (*pkgMeta, error) {
+		meta, ok := importMeta(name)
+		if !ok {
+			return nil, fmt.Errorf("lookup failed for package %s", name)
+		}
+		return meta, nil
+	}
+
+	// Two unrelated repos that happen to share a rev string.
+	data := `{
+	"Deps": [
+		{
+			"ImportPath": "github.com/foo/bar",
+			"Rev": "v1.0.0"
+		},
+		{
+			"ImportPath": "github.com/foo/baz/qux",
+			"Rev": "v1.0.0"
+		}
+	]
+}`
+	pkgs, err := parseGodeps(resolverFunc(lookup), []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var roots []string
+	for _, pkg := range pkgs {
+		roots = append(roots, pkg.meta.Root)
+	}
+	sort.Strings(roots)
+	want := []string{"github.com/foo/bar", "github.com/foo/baz"}
+	if !reflect.DeepEqual(roots, want) {
+		t.Errorf("expected repo roots %q, got %q", want, roots)
+	}
+
+	// One repo pinned to two different revs.
+	data = `{
+	"Deps": [
+		{
+			"ImportPath": "github.com/foo/bar/a",
+			"Rev": "a4973d9a4225417aecf5d450a9522f00c1f7130f"
+		},
+		{
+			"ImportPath": "github.com/foo/bar/b",
+			"Rev": "dea108d3aa0c67d7162a3fd8aa65f38a430019fd"
+		}
+	]
+}`
+	if _, err := parseGodeps(resolverFunc(lookup), []byte(data)); err == nil {
+		t.Errorf("expected error for repo pinned to multiple revisions")
+	}
+}
+
+func TestResolveManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "Godeps.json")
+	data := `{
+	"Deps": [
+		{
+			"ImportPath": "github.com/coreos/go-oidc/jose",
+			"Rev": "a4973d9a4225417aecf5d450a9522f00c1f7130f"
+		},
+		{
+			"ImportPath": "github.com/docker/go-connections/nat",
+			"Rev": "3ede32e2033de7505e6500d6c868c2b9ed9f169d"
+		}
+	]
+}`
+	if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lookup := func(ctx context.Context, name string) (*pkgMeta, error) {
+		meta, ok := importMeta(name)
+		if !ok {
+			return nil, fmt.Errorf("lookup failed for package %s", name)
+		}
+		return meta, nil
+	}
+	got, err := resolveManifest(resolverFunc(lookup), filename, replaceTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Pin{
+		{
+			Root:    "github.com/coreos/go-oidc",
+			Remote:  "https://github.com/coreos/go-oidc",
+			VCS:     "git",
+			Version: "a4973d9a4225417aecf5d450a9522f00c1f7130f",
+		},
+		{
+			Root:    "github.com/docker/go-connections",
+			Remote:  "https://github.com/docker/go-connections",
+			VCS:     "git",
+			Version: "3ede32e2033de7505e6500d6c868c2b9ed9f169d",
+		},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("wanted %#v, got %#v", want, got)
+	}
+
+	// Resolving must not write anything next to the manifest.
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("expected only the manifest in %s, found %d files", dir, len(files))
+	}
+}
+
+func TestParseGlide(t *testing.T) {
+	config := `package: k8s.io/kubernetes
+import:
+- package: github.com/coreos/go-oidc
+  version: v1.0.0
+  subpackages:
+  - jose
+  - oidc
+- package: github.com/spf13/pflag
+  repo: https://github.com/kubernetes/pflag
+- package: github.com/ghodss/yaml
+  version: 73d445a93680fa1a78ae23a5839bad48f32ba1ee
+testImport:
+- package: github.com/davecgh/go-spew
+  subpackages:
+  - spew
+`
+	lock := `hash: 1a9c4e5ee8e2ac5b0ec1b52e8c4bab4d6d0e4b6e4e9a8f3f5b1a8c2c3d4e5f60
+updated: 2017-06-12T14:02:41.829738436-07:00
+imports:
+- name: github.com/coreos/go-oidc
+  version: a4973d9a4225417aecf5d450a9522f00c1f7130f
+  subpackages:
+  - http
+  - jose
+  - key
+  - oauth2
+  - oidc
+- name: github.com/docker/engine-api
+  version: dea108d3aa0c67d7162a3fd8aa65f38a430019fd
+  subpackages:
+  - client
+  - types
+- name: github.com/spf13/pflag
+  version: 9ff6c6923cfffbcd502984b8e0c80539a94968b7
+  repo: https://github.com/kubernetes/pflag
+testImports:
+- name: github.com/davecgh/go-spew
+  version: 5215b55f46b2b919f50a1df0eaa5886afe4e3b3d
+  subpackages:
+  - spew
+`
+	lookup := func(ctx context.Context, name string) (*pkgMeta, error) {
+		meta, ok := importMeta(name)
+		if !ok {
+			return nil, fmt.Errorf("lookup failed for package %s", name)
+		}
+		return meta, nil
+	}
+	pinned := func(root, remote, version string) pinnedPackage {
+		return pinnedPackage{meta: &pkgMeta{Root: root, Remote: remote, VCS: "git"}, version: version}
+	}
+
+	tests := []struct {
+		name         string
+		config, lock string
+		want         []pinnedPackage
+		wantErr      bool
+	}{
+		{
+			name:   "config and lock",
+			config: config,
+			lock:   lock,
+			want: []pinnedPackage{
+				// Versions from the lock take precedence over the config.
+				pinned("github.com/coreos/go-oidc", "https://github.com/coreos/go-oidc", "a4973d9a4225417aecf5d450a9522f00c1f7130f"),
+				pinned("github.com/davecgh/go-spew", "https://github.com/davecgh/go-spew", "5215b55f46b2b919f50a1df0eaa5886afe4e3b3d"),
+				pinned("github.com/docker/engine-api", "https://github.com/docker/engine-api", "dea108d3aa0c67d7162a3fd8aa65f38a430019fd"),
+				// Packages only in the config use its version.
+				pinned("github.com/ghodss/yaml", "https://github.com/ghodss/yaml", "73d445a93680fa1a78ae23a5839bad48f32ba1ee"),
+				pinned("github.com/spf13/pflag", "https://github.com/kubernetes/pflag", "9ff6c6923cfffbcd502984b8e0c80539a94968b7"),
+			},
+		},
+		{
+			name: "lock only",
+			lock: lock,
+			want: []pinnedPackage{
+				pinned("github.com/coreos/go-oidc", "https://github.com/coreos/go-oidc", "a4973d9a4225417aecf5d450a9522f00c1f7130f"),
+				pinned("github.com/davecgh/go-spew", "https://github.com/davecgh/go-spew", "5215b55f46b2b919f50a1df0eaa5886afe4e3b3d"),
+				pinned("github.com/docker/engine-api", "https://github.com/docker/engine-api", "dea108d3aa0c67d7162a3fd8aa65f38a430019fd"),
+				pinned("github.com/spf13/pflag", "https://github.com/kubernetes/pflag", "9ff6c6923cfffbcd502984b8e0c80539a94968b7"),
+			},
+		},
+		{
+			name: "config only",
+			config: `import:
+- package: github.com/ghodss/yaml
+  version: 73d445a93680fa1a78ae23a5839bad48f32ba1ee
+`,
+			want: []pinnedPackage{
+				pinned("github.com/ghodss/yaml", "https://github.com/ghodss/yaml", "73d445a93680fa1a78ae23a5839bad48f32ba1ee"),
+			},
+		},
+		{
+			// Without a lock, pflag has no version.
+			name:    "config without versions",
+			config:  config,
+			wantErr: true,
+		},
+		{
+			name: "lock without hash",
+			lock: `imports:
+- name: github.com/ghodss/yaml
+  version: 73d445a93680fa1a78ae23a5839bad48f32ba1ee
+`,
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		var configData, lockData []byte
+		if test.config != "" {
+			configData = []byte(test.config)
+		}
+		if test.lock != "" {
+			lockData = []byte(test.lock)
+		}
+		pkgs, err := parseGlide(resolverFunc(lookup), configData, lockData)
+		if err != nil {
+			if !test.wantErr {
+				t.Errorf("%s: %v", test.name, err)
+			}
+			continue
+		}
+		if test.wantErr {
+			t.Errorf("%s: expected error", test.name)
+			continue
+		}
+		sort.Slice(pkgs, func(i, j int) bool {
+			return pkgs[i].meta.Root < pkgs[j].meta.Root
+		})
+		if !reflect.DeepEqual(pkgs, test.want) {
+			t.Errorf("%s: wanted %#v, got %#v", test.name, test.want, pkgs)
+		}
+	}
+}
+
+func TestParseGopkgLock(t *testing.T) {
+	data := `# This file is autogenerated, do not edit; changes may be undone by the next 'dep ensure'.
+
+
+[[projects]]
+  name = "github.com/coreos/go-oidc"
+  packages = [
+    "jose",
+    "oidc"
+  ]
+  revision = "a4973d9a4225417aecf5d450a9522f00c1f7130f"
+
+[[projects]]
+  branch = "master"
+  name = "github.com/docker/engine-api"
+  packages = ["client","types"]
+  revision = "dea108d3aa0c67d7162a3fd8aa65f38a430019fd"
+
+[[projects]]
+  name = "github.com/spf13/pflag"
+  packages = ["."]
+  revision = "9ff6c6923cfffbcd502984b8e0c80539a94968b7"
+  source = "github.com/kubernetes/pflag"
+  version = "v1.0.0"
+
+[solve-meta]
+  analyzer-name = "dep"
+  analyzer-version = 1
+  inputs-digest = "6f9a0e1ce4e8a2b1d02e2a30ae4e3b8c2cd4e41ab8c1f0d0e1c3e0f4a6b2e1d0"
+  solver-name = "gps-cdcl"
+  solver-version = 1
+`
+	lookup := func(ctx context.Context, name string) (*pkgMeta, error) {
+		meta, ok := importMeta(name)
+		if !ok {
+			return nil, fmt.Errorf("lookup failed for package %s", name)
+		}
+		return meta, nil
+	}
+
+	want := []pinnedPackage{
+		{
+			meta: &pkgMeta{
+				Root:   "github.com/coreos/go-oidc",
+				Remote: "https://github.com/coreos/go-oidc",
+				VCS:    "git",
+			},
+			version: "a4973d9a4225417aecf5d450a9522f00c1f7130f",
+		},
+		{
+			meta: &pkgMeta{
+				Root:   "github.com/docker/engine-api",
+				Remote: "https://github.com/docker/engine-api",
+				VCS:    "git",
+			},
+			version: "dea108d3aa0c67d7162a3fd8aa65f38a430019fd",
+		},
+		{
+			// The source overrides the remote, but not the root.
+			meta: &pkgMeta{
+				Root:   "github.com/spf13/pflag",
+				Remote: "https://github.com/kubernetes/pflag",
+				VCS:    "git",
+			},
+			version: "9ff6c6923cfffbcd502984b8e0c80539a94968b7",
+		},
+	}
+
+	pkgs, err := parseGopkgLock(resolverFunc(lookup), []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pkgs, want) {
+		t.Errorf("wanted %#v, got %#v", want, pkgs)
+	}
+
+	missingRev := `[[projects]]
+  name = "github.com/coreos/go-oidc"
+  packages = ["jose"]
+`
+	if _, err := parseGopkgLock(resolverFunc(lookup), []byte(missingRev)); err == nil {
+		t.Errorf("expected error for project without a revision")
+	}
+}
+
+func TestParseGoMod(t *testing.T) {
+	data := `module example.com/project
+
+go 1.12
+
+require (
+	github.com/coreos/go-oidc v2.1.0+incompatible
+	github.com/coreos/go-oidc/api/v3 v3.0.1
+	github.com/go-yaml/yaml v1.1.0
+	github.com/go-yaml/yaml/v2 v2.2.8
+	github.com/pkg/errors v0.8.1
+	github.com/spf13/pflag v1.0.5 // indirect
+	golang.org/x/net v0.0.0-20190311183353-d8887717615a
+)
+
+exclude github.com/pkg/errors v0.8.0
+
+replace github.com/spf13/pflag => github.com/kubernetes/pflag v1.0.6-fork
+`
+	lookup := func(ctx context.Context, name string) (*pkgMeta, error) {
+		if hasPathPrefix(name, "golang.org/x/net") {
+			return &pkgMeta{Root: "golang.org/x/net", Remote: "https://go.googlesource.com/net", VCS: "git"}, nil
+		}
+		meta, ok := importMeta(name)
+		if !ok {
+			return nil, fmt.Errorf("lookup failed for package %s", name)
+		}
+		return meta, nil
+	}
+
+	want := []pinnedPackage{
+		{
+			meta: &pkgMeta{
+				Root:   "github.com/coreos/go-oidc",
+				Remote: "https://github.com/coreos/go-oidc",
+				VCS:    "git",
+			},
+			version: "v2.1.0",
+		},
+		{
+			// A module in a directory of a larger repo is vendored at its
+			// module path, and copied from its directory.
+			meta: &pkgMeta{
+				Root:   "github.com/coreos/go-oidc/api/v3",
+				Remote: "https://github.com/coreos/go-oidc",
+				VCS:    "git",
+				Subdir: "api",
+			},
+			version: "api/v3.0.1",
+		},
+		{
+			meta: &pkgMeta{
+				Root:   "github.com/go-yaml/yaml",
+				Remote: "https://github.com/go-yaml/yaml",
+				VCS:    "git",
+			},
+			version: "v1.1.0",
+		},
+		{
+			// Major versions are vendored side by side.
+			meta: &pkgMeta{
+				Root:   "github.com/go-yaml/yaml/v2",
+				Remote: "https://github.com/go-yaml/yaml",
+				VCS:    "git",
+			},
+			version: "v2.2.8",
+		},
+		{
+			meta: &pkgMeta{
+				Root:   "github.com/pkg/errors",
+				Remote: "https://github.com/pkg/errors",
+				VCS:    "git",
+			},
+			version: "v0.8.1",
+		},
+		{
+			// The fork is cloned, but vendored under the original path.
+			meta: &pkgMeta{
+				Root:   "github.com/spf13/pflag",
+				Remote: "https://github.com/kubernetes/pflag",
+				VCS:    "git",
+			},
+			version: "v1.0.6-fork",
+		},
+		{
+			meta: &pkgMeta{
+				Root:   "golang.org/x/net",
+				Remote: "https://go.googlesource.com/net",
+				VCS:    "git",
+			},
+			version: "d8887717615a",
+		},
+	}
+
+	pkgs, err := parseGoMod(resolverFunc(lookup), []byte(data), replaceTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pkgs, want) {
+		t.Errorf("wanted %#v, got %#v", want, pkgs)
+	}
+
+	local := "module example.com/project\n\nrequire github.com/pkg/errors v0.8.1\n\nreplace github.com/pkg/errors => ../errors\n"
+	if _, err := parseGoMod(resolverFunc(lookup), []byte(local), replaceTarget); err == nil {
+		t.Errorf("expected error for replacement with a local directory")
+	}
+
+	excluded := "module example.com/project\n\nrequire github.com/pkg/errors v0.8.1\n\nexclude github.com/pkg/errors v0.8.1\n"
+	if _, err := parseGoMod(resolverFunc(lookup), []byte(excluded), replaceTarget); err == nil {
+		t.Errorf("expected error for requirement on an excluded version")
+	}
+}
+
+func TestParseGoModReplaceMajor(t *testing.T) {
+	data := `module example.com/project
+
+require (
+	example.com/foo v1.4.0
+	github.com/foo/bar v1.2.0
+)
+
+replace example.com/foo => example.com/foo/v2 v2.1.0
+
+replace github.com/foo/bar => github.com/foo/bar/v2 v2.1.0
+`
+	// example.com keeps each major version in a repo of its own, while
+	// GitHub keeps them in the same repo.
+	lookup := func(ctx context.Context, name string) (*pkgMeta, error) {
+		switch {
+		case hasPathPrefix(name, "example.com/foo/v2"):
+			return &pkgMeta{Root: "example.com/foo/v2", Remote: "https://git.example.com/foo-v2", VCS: "git"}, nil
+		case hasPathPrefix(name, "example.com/foo"):
+			return &pkgMeta{Root: "example.com/foo", Remote: "https://git.example.com/foo", VCS: "git"}, nil
+		}
+		meta, ok := importMeta(name)
+		if !ok {
+			return nil, fmt.Errorf("lookup failed for package %s", name)
+		}
+		return meta, nil
+	}
+
+	tests := []struct {
+		layout replaceLayout
+		want   []pinnedPackage
+		// vendored is where each replacement ends up.
+		vendored []string
+	}{
+		{
+			layout: replaceTarget,
+			want: []pinnedPackage{
+				{
+					meta:    &pkgMeta{Root: "example.com/foo/v2", Remote: "https://git.example.com/foo-v2", VCS: "git"},
+					version: "v2.1.0",
+				},
+				{
+					meta:    &pkgMeta{Root: "github.com/foo/bar/v2", Remote: "https://github.com/foo/bar", VCS: "git"},
+					version: "v2.1.0",
+				},
+			},
+			vendored: []string{"vendor/example.com/foo/v2", "vendor/github.com/foo/bar/v2"},
+		},
+		{
+			layout: replaceOriginal,
+			want: []pinnedPackage{
+				{
+					meta:    &pkgMeta{Root: "example.com/foo", Remote: "https://git.example.com/foo-v2", VCS: "git"},
+					version: "v2.1.0",
+				},
+				{
+					meta:    &pkgMeta{Root: "github.com/foo/bar", Remote: "https://github.com/foo/bar", VCS: "git"},
+					version: "v2.1.0",
+				},
+			},
+			vendored: []string{"vendor/example.com/foo", "vendor/github.com/foo/bar"},
+		},
+	}
+	for _, test := range tests {
+		pkgs, err := parseGoMod(resolverFunc(lookup), []byte(data), test.layout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(pkgs, test.want) {
+			t.Errorf("layout %d: wanted %#v, got %#v", test.layout, test.want, pkgs)
+			continue
+		}
+		for i, want := range test.vendored {
+			if got := filepath.ToSlash(vendorPath("vendor", pkgs[i].meta)); got != want {
+				t.Errorf("layout %d: expected replacement to be vendored at %s, got %s", test.layout, want, got)
+			}
+		}
+	}
+}
+
+func TestParseReplaceLayout(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    replaceLayout
+		wantErr bool
+	}{
+		{"", replaceTarget, false},
+		{"target", replaceTarget, false},
+		{"original", replaceOriginal, false},
+		{"nested", 0, true},
+	}
+	for _, test := range tests {
+		got, err := parseReplaceLayout(test.s)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%q: expected error=%t, got %v", test.s, test.wantErr, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%q: expected layout %d, got %d", test.s, test.want, got)
+		}
+	}
+}
+
+func TestIsMajorBump(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{"example.com/foo", "example.com/foo/v2", true},
+		{"example.com/foo/v2", "example.com/foo/v3", true},
+		{"gopkg.in/yaml.v2", "gopkg.in/yaml.v3", true},
+		{"example.com/foo/v3", "example.com/foo/v2", false},
+		{"example.com/foo", "example.com/foo", false},
+		{"example.com/foo", "example.com/fork/v2", false},
+	}
+	for _, test := range tests {
+		if got := isMajorBump(test.from, test.to); got != test.want {
+			t.Errorf("isMajorBump(%q, %q): expected %t, got %t", test.from, test.to, test.want, got)
+		}
+	}
+}
+
+func TestModuleRevision(t *testing.T) {
+	tests := []struct {
+		modPath, root, version string
+		want                   string
+	}{
+		{"github.com/pkg/errors", "github.com/pkg/errors", "v0.8.1", "v0.8.1"},
+		{"github.com/coreos/go-oidc", "github.com/coreos/go-oidc", "v2.1.0+incompatible", "v2.1.0"},
+		{"github.com/go-yaml/yaml/v2", "github.com/go-yaml/yaml", "v2.2.8", "v2.2.8"},
+		{"golang.org/x/net", "golang.org/x/net", "v0.0.0-20190311183353-d8887717615a", "d8887717615a"},
+		{"github.com/foo/bar/api", "github.com/foo/bar", "v1.2.0", "api/v1.2.0"},
+		{"github.com/foo/bar/api/v3", "github.com/foo/bar", "v3.0.1", "api/v3.0.1"},
+	}
+	for _, test := range tests {
+		if got := moduleRevision(test.modPath, test.root, test.version); got != test.want {
+			t.Errorf("moduleRevision(%q, %q, %q): expected %q, got %q", test.modPath, test.root, test.version, test.want, got)
+		}
+	}
+}
+
+func TestParseVendorJSON(t *testing.T) {
+	data := `{
+	"comment": "",
+	"ignore": "test",
+	"package": [
+		{
+			"checksumSHA1": "2m+JXuQA5ynR8JQDXsN2TkkCl7k=",
+			"path": "github.com/coreos/go-oidc/jose",
+			"revision": "a4973d9a4225417aecf5d450a9522f00c1f7130f",
+			"revisionTime": "2016-08-05T20:49:52Z"
+		},
+		{
+			"checksumSHA1": "Bq1jG1BW2bYLSK3BZVUmjkkxHBY=",
+			"path": "github.com/coreos/go-oidc/oidc",
+			"revision": "a4973d9a4225417aecf5d450a9522f00c1f7130f",
+			"revisionTime": "2016-08-05T20:49:52Z"
+		},
+		{
+			"checksumSHA1": "fuvg8wdj3JJLyXmZoVMKFgzwUQE=",
+			"origin": "github.com/kubernetes/pflag",
+			"path": "github.com/spf13/pflag",
+			"revision": "9ff6c6923cfffbcd502984b8e0c80539a94968b7",
+			"revisionTime": "2017-01-30T21:42:45Z"
+		}
+	],
+	"rootPath": "k8s.io/kubernetes"
+}`
+	lookup := func(ctx context.Context, name string) (*pkgMeta, error) {
+		meta, ok := importMeta(name)
+		if !ok {
+			return nil, fmt.Errorf("lookup failed for package %s", name)
+		}
+		return meta, nil
+	}
+
+	want := []pinnedPackage{
+		{
+			meta: &pkgMeta{
+				Root:   "github.com/coreos/go-oidc",
+				Remote: "https://github.com/coreos/go-oidc",
+				VCS:    "git",
+			},
+			version: "a4973d9a4225417aecf5d450a9522f00c1f7130f",
+		},
+		{
+			meta: &pkgMeta{
+				Root:   "github.com/spf13/pflag",
+				Remote: "https://github.com/kubernetes/pflag",
+				VCS:    "git",
+			},
+			version: "9ff6c6923cfffbcd502984b8e0c80539a94968b7",
+		},
+	}
+	pkgs, err := parseVendorJSON(resolverFunc(lookup), []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pkgs, want) {
+		t.Errorf("wanted %#v, got %#v", want, pkgs)
+	}
+
+	conflict := `{"package": [
+		{"path": "github.com/foo/bar/a", "revision": "v1"},
+		{"path": "github.com/foo/bar/b", "revision": "v2"}
+	]}`
+	if _, err := parseVendorJSON(resolverFunc(lookup), []byte(conflict)); err == nil {
+		t.Errorf("expected error for repo pinned to multiple revisions")
+	}
+}
+
+func TestParseGodepsComment(t *testing.T) {
+	data := `{
+	"Deps": [
+		{
+			"ImportPath": "github.com/docker/engine-api/client",
+			"Comment": "v0.3.1-78-gdea108d",
+			"Rev": "dea108d3aa0c67d7162a3fd8aa65f38a430019fd"
+		},
+		{
+			"ImportPath": "github.com/docker/go-connections/nat",
+			"Comment": "v0.2.1",
+			"Rev": "3ede32e2033de7505e6500d6c868c2b9ed9f169d"
+		},
+		{
+			"ImportPath": "github.com/coreos/go-oidc/jose",
+			"Rev": "a4973d9a4225417aecf5d450a9522f00c1f7130f"
+		},
+		{
+			"ImportPath": "github.com/coreos/go-oidc/oidc",
+			"Comment": "v1.0.0",
+			"Rev": "a4973d9a4225417aecf5d450a9522f00c1f7130f"
+		},
+		{
+			"ImportPath": "github.com/pkg/errors",
+			"Comment": "^0.8.0",
+			"Rev": "645ef00459ed84a119197bfb8d8205042c6df63d"
+		}
+	]
+}`
+	lookup := func(ctx context.Context, name string) (*pkgMeta, error) {
+		meta, ok := importMeta(name)
+		if !ok {
+			return nil, fmt.Errorf("lookup failed for package %s", name)
+		}
+		return meta, nil
+	}
+	pkgs, err := parseGodeps(resolverFunc(lookup), []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]string{}
+	constraints := map[string]string{}
+	for _, p := range pkgs {
+		got[p.meta.Root] = p.version
+		if p.constraint != "" {
+			constraints[p.meta.Root] = p.constraint
+		}
+	}
+	want := map[string]string{
+		// Not a tag of the rev itself.
+		"github.com/docker/engine-api":     "dea108d3aa0c67d7162a3fd8aa65f38a430019fd",
+		"github.com/docker/go-connections": "tag:v0.2.1",
+		// Any package of the repo can provide the tag.
+		"github.com/coreos/go-oidc": "tag:v1.0.0",
+		// A constraint pins the rev until the repo is updated.
+		"github.com/pkg/errors": "645ef00459ed84a119197bfb8d8205042c6df63d",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wanted versions %v, got %v", want, got)
+	}
+	wantConstraints := map[string]string{"github.com/pkg/errors": "^0.8.0"}
+	if !reflect.DeepEqual(constraints, wantConstraints) {
+		t.Errorf("wanted constraints %v, got %v", wantConstraints, constraints)
+	}
+}
+
+func TestGodepsTag(t *testing.T) {
+	tests := []struct {
+		comment string
+		want    string
+	}{
+		{"", ""},
+		{"v0.3.1", "v0.3.1"},
+		{"v0.3.1-78-gdea108d", ""},
+		{"release-1.2", "release-1.2"},
+		{"release-1.2-3-gabc1234", ""},
+		{"some free form comment", ""},
+		{"^1.2.0", ""},
+	}
+	for _, test := range tests {
+		if got := godepsTag(test.comment); got != test.want {
+			t.Errorf("godepsTag(%q): expected %q, got %q", test.comment, test.want, got)
+		}
+	}
+}
+
+func TestGodepsConstraint(t *testing.T) {
+	tests := []struct {
+		comment string
+		want    string
+	}{
+		{"", ""},
+		{"v1.2.0", ""},
+		{"^1.2.0", "^1.2.0"},
+		{" >=1.2.0, <1.4.0 ", ">=1.2.0, <1.4.0"},
+		{"~1.2 || ^2.0.0", "~1.2 || ^2.0.0"},
+		{"^not-a-version", ""},
+	}
+	for _, test := range tests {
+		if got := godepsConstraint(test.comment); got != test.want {
+			t.Errorf("godepsConstraint(%q): expected %q, got %q", test.comment, test.want, got)
+		}
+	}
+}
+
+func TestDecodeManifestBadExclude(t *testing.T) {
+	data := `{"packages": [], "vendor_exclude_patterns": ["[examples"]}`
+	if _, err := decodeManifestFile([]byte(data)); err == nil {
+		t.Errorf("expected invalid exclude pattern to be rejected")
+	}
+}
+
+func TestManifestConfigure(t *testing.T) {
+	data := `{
+	"packages": [],
+	"vendor_exclude_patterns": ["examples/"],
+	"write_package_info": true,
+	"preserve_xattrs": true,
+	"platforms": ["linux/amd64", "windows/386"]
+}`
+	m, err := decodeManifestFile([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got getOptions
+	m.configure(&got)
+	want := getOptions{writeInfo: true, copy: copyOptions{
+		exclude:   []string{"examples/"},
+		xattrs:    true,
+		platforms: []platform{{"linux", "amd64"}, {"windows", "386"}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected options %#v, got %#v", want, got)
+	}
+}
+
+func TestDecodeManifestBadPlatform(t *testing.T) {
+	data := `{"packages": [], "platforms": ["linux"]}`
+	if _, err := decodeManifestFile([]byte(data)); err == nil {
+		t.Errorf("expected invalid platform to be rejected")
+	}
+}
@@ -0,0 +1,98 @@
+package imports
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// metaCacheFile is the file in a resolver's metaCache holding resolved repos.
+const metaCacheFile = "resolved.json"
+
+// defaultMetaTTL is how long resolved repos are cached on disk by default.
+const defaultMetaTTL = 24 * time.Hour
+
+type cachedMeta struct {
+	Meta    *pkgMeta  `json:"meta"`
+	Fetched time.Time `json:"fetched"`
+}
+
+func (r *resolver) metaExpired(m cachedMeta, now time.Time) bool {
+	ttl := r.metaTTL
+	if ttl == 0 {
+		ttl = defaultMetaTTL
+	}
+	return !now.Before(m.Fetched.Add(ttl))
+}
+
+// loadMetaCache adds the unexpired repos in the metaCache to the in-memory
+// results. Errors are logged rather than returned, since the cache only
+// saves requests.
+func (r *resolver) loadMetaCache() {
+	var entries []cachedMeta
+	err := r.metaCache.file(metaCacheFile, func(filename string) error {
+		var err error
+		entries, err = readMetaCache(filename)
+		return err
+	})
+	if err != nil {
+		if r.logger != nil {
+			r.logger.Errorf("loading cached repos: %v", err)
+		}
+		return
+	}
+
+	now := r.timeNow()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range entries {
+		if e.Meta != nil && !r.metaExpired(e, now) {
+			r.results = append(r.results, e.Meta)
+		}
+	}
+}
+
+// storeMetaCache merges a resolved repo into the metaCache, replacing any
+// previous entry for the same root and dropping expired ones.
+func (r *resolver) storeMetaCache(meta *pkgMeta) error {
+	now := r.timeNow()
+	return r.metaCache.file(metaCacheFile, func(filename string) error {
+		entries, err := readMetaCache(filename)
+		if err != nil {
+			return err
+		}
+		n := 0
+		for _, e := range entries {
+			if e.Meta == nil || e.Meta.Root == meta.Root || r.metaExpired(e, now) {
+				continue
+			}
+			entries[n] = e
+			n++
+		}
+		entries = append(entries[:n], cachedMeta{Meta: meta, Fetched: now})
+
+		data, err := json.Marshal(entries)
+		if err != nil {
+			return errors.Wrap(err, "encoding cached repos")
+		}
+		return ioutil.WriteFile(filename, data, 0644)
+	})
+}
+
+func readMetaCache(filename string) ([]cachedMeta, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "reading cached repos")
+	}
+	var entries []cachedMeta
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, errors.Wrap(err, "parsing cached repos")
+	}
+	return entries, nil
+}
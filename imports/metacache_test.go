@@ -0,0 +1,79 @@
+package imports
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResolverMetaCache(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests int
+	)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		goImportHandler(w, r)
+	})
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+
+	withCache(t, func(t *testing.T, c *cache) {
+		withTestServer(t, h, func(t *testing.T, host string) {
+			now := time.Now()
+			newResolver := func() *resolver {
+				return &resolver{
+					retry:     backoff{},
+					metaCache: c,
+					metaTTL:   time.Hour,
+					now:       func() time.Time { return now },
+				}
+			}
+
+			want := &pkgMeta{Root: host + "/foo", VCS: "git", Remote: "https://" + host + "/foo"}
+			for i, wantRequests := range []int{1, 1} {
+				// Each resolver represents a separate run of got.
+				meta, err := newResolver().fetchImportMeta(context.Background(), host+"/foo")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if *meta != *want {
+					t.Errorf("run %d: expected %#v, got %#v", i, want, meta)
+				}
+				if got := count(); got != wantRequests {
+					t.Errorf("run %d: expected %d requests, got %d", i, wantRequests, got)
+				}
+			}
+
+			// Other repos are still fetched and merged into the cache.
+			if _, err := newResolver().fetchImportMeta(context.Background(), host+"/bar"); err != nil {
+				t.Fatal(err)
+			}
+			r := newResolver()
+			for _, pkg := range []string{host + "/foo", host + "/bar"} {
+				if _, err := r.fetchImportMeta(context.Background(), pkg); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := count(); got != 2 {
+				t.Errorf("expected cached repos to be reused, got %d requests", got)
+			}
+
+			// Expired entries are fetched again.
+			now = now.Add(2 * time.Hour)
+			if _, err := newResolver().fetchImportMeta(context.Background(), host+"/foo"); err != nil {
+				t.Fatal(err)
+			}
+			if got := count(); got != 3 {
+				t.Errorf("expected expired repo to be fetched again, got %d requests", got)
+			}
+		})
+	})
+}
@@ -0,0 +1,488 @@
+package imports
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/ericchiang/got/log"
+)
+
+// manifestFiles are the manifests got reads, in the order they're looked for
+// when migrating a project, along with the vendoring tool that writes them if
+// they're legacy manifests, which predate got's native manifest and Go
+// modules.
+var manifestFiles = []struct {
+	path string
+	tool string
+}{
+	{ManifestFile, ""},
+	{"Godeps/Godeps.json", "godep"},
+	{"glide.lock", "glide"},
+	{"glide.yaml", "glide"},
+	{"Gopkg.lock", "dep"},
+	{"vendor/vendor.json", "govendor"},
+	{"go.mod", ""},
+}
+
+// legacyTool returns the vendoring tool that writes a manifest, or an empty
+// string if the manifest isn't a legacy one.
+func legacyTool(filename string) string {
+	name := filepath.Base(filename)
+	for _, m := range manifestFiles {
+		if strings.EqualFold(name, filepath.Base(m.path)) {
+			return m.tool
+		}
+	}
+	return ""
+}
+
+// deprecations records the legacy manifest formats a notice has been logged
+// for, so each is only reported once however often it's read.
+type deprecations struct {
+	mu     sync.Mutex
+	warned map[string]bool
+}
+
+// deprecationNotices are the notices logged by the current process.
+var deprecationNotices = &deprecations{}
+
+// warn logs a deprecation notice if filename is a legacy manifest, suggesting
+// it's migrated to got's native manifest.
+func (d *deprecations) warn(logger log.Logger, filename string) {
+	tool := legacyTool(filename)
+	if tool == "" || logger == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.warned[tool] {
+		return
+	}
+	if d.warned == nil {
+		d.warned = map[string]bool{}
+	}
+	d.warned[tool] = true
+	logger.Errorf("%s: %s manifests are deprecated, run 'got migrate' to convert it to %s", filename, tool, ManifestFile)
+}
+
+// detectManifest returns the manifest of the project in dir, other than the
+// one at the slash separated path except, or another manifest of the same
+// tool. It's an error if there's none, or
+// several, since it's unclear which one the project actually uses.
+func detectManifest(dir, except string) (string, error) {
+	var found []string
+	for _, m := range manifestFiles {
+		if m.path == except || (m.tool != "" && m.tool == legacyTool(except)) {
+			continue
+		}
+		filename := filepath.Join(dir, filepath.FromSlash(m.path))
+		if _, err := os.Stat(filename); err == nil {
+			// glide.yaml and glide.lock are read together.
+			if m.tool != "" && len(found) > 0 && legacyTool(found[len(found)-1]) == m.tool {
+				continue
+			}
+			found = append(found, filename)
+		} else if !os.IsNotExist(err) {
+			return "", errors.Wrap(err, "checking for manifest")
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", errors.Errorf("no manifest found in %s", dir)
+	case 1:
+		return found[0], nil
+	}
+	return "", errors.Errorf("found several manifests, specify which to migrate: %s", strings.Join(found, ", "))
+}
+
+// MigrateOptions configures a migration between manifest formats.
+type MigrateOptions struct {
+	// Manifest is the manifest to convert, such as "Godeps/Godeps.json".
+	// If empty, the manifest of the project is detected.
+	Manifest string
+	// To is the format to convert to, one of MigrateFormats. It defaults
+	// to "native", got's own manifest.
+	To string
+	// Force overwrites an existing manifest of the target format. got.json
+	// is always updated in place, see relock.
+	Force bool
+}
+
+// MigrateFormats are the formats a manifest can be migrated to.
+var MigrateFormats = []string{"dep", "glide", "godeps", "gomod", "native"}
+
+// migrateTargets are the manifests written for each format, relative to the
+// project, and how pins are encoded into them. The native format is written
+// by relock instead.
+var migrateTargets = map[string]struct {
+	path   string
+	encode func(m *migration, pins []Pin) ([]byte, error)
+}{
+	"dep":    {"Gopkg.lock", encodeGopkgLock},
+	"glide":  {"glide.yaml", encodeGlide},
+	"godeps": {"Godeps/Godeps.json", encodeGodeps},
+	"gomod":  {"go.mod", encodeGoMod},
+	"native": {ManifestFile, nil},
+}
+
+// Migrate converts a manifest of the project in dir into another format. By
+// default, a legacy manifest such as "Godeps/Godeps.json" is converted into
+// got's native manifest, keeping the pins of repos already in it, see
+// relock. Repos whose revision the target format needs, but the manifest
+// doesn't record, are fetched into cacheDir. Anything the target format
+// can't represent, such as a repo fetched from a mirror, is logged as a
+// warning. The pins of the converted manifest are returned.
+func Migrate(dir, cacheDir string, opts MigrateOptions, resolverOpts ResolverOptions, logger log.Logger) ([]Pin, error) {
+	c, err := newCache(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	r, err := loggingResolver(resolverOpts, logger)
+	if err != nil {
+		return nil, err
+	}
+	m := &migration{
+		ctx:    context.Background(),
+		r:      r,
+		c:      c,
+		retry:  resolverOpts.retryPolicy(),
+		logger: logger,
+	}
+	return m.migrate(dir, opts)
+}
+
+// migration holds what's needed to convert pins between formats.
+type migration struct {
+	ctx   context.Context
+	r     pkgResolver
+	c     *cache
+	retry retryPolicy
+	// project is the import path of the project, set by migrate.
+	project string
+	// format is the name of the target format, used in warnings.
+	format string
+	logger log.Logger
+}
+
+func (m *migration) migrate(dir string, opts MigrateOptions) ([]Pin, error) {
+	if opts.To == "" {
+		opts.To = "native"
+	}
+	target, ok := migrateTargets[opts.To]
+	if !ok {
+		return nil, errors.Errorf("unknown manifest format %q, expected one of %s", opts.To, strings.Join(MigrateFormats, ", "))
+	}
+	m.format = opts.To
+	filename := opts.Manifest
+	if filename == "" {
+		var err error
+		if filename, err = detectManifest(dir, target.path); err != nil {
+			return nil, err
+		}
+	}
+	out := filepath.Join(dir, filepath.FromSlash(target.path))
+	if sameFile(filename, out) {
+		return nil, errors.Errorf("%s is already in the %s format", filename, opts.To)
+	}
+
+	if target.encode == nil {
+		if err := relock(m.r, dir, filename); err != nil {
+			return nil, err
+		}
+		return readManifest(filepath.Join(dir, ManifestFile))
+	}
+
+	if !opts.Force {
+		if _, err := os.Stat(out); err == nil {
+			return nil, errors.Errorf("%s already exists, use force to overwrite it", out)
+		} else if !os.IsNotExist(err) {
+			return nil, errors.Wrap(err, "checking for manifest")
+		}
+	}
+	project, err := projectImportPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	m.project = project
+	pins, err := m.read(dir, filename)
+	if err != nil {
+		return nil, err
+	}
+	data, err := target.encode(m, pins)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return nil, errors.Wrap(err, "creating manifest directory")
+	}
+	if err := ioutil.WriteFile(out, data, 0644); err != nil {
+		return nil, errors.Wrap(err, "writing manifest")
+	}
+	return pins, nil
+}
+
+// sameFile reports whether two paths refer to the same file, with file names
+// compared case insensitively like parseManifest does.
+func sameFile(a, b string) bool {
+	a, errA := filepath.Abs(a)
+	b, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && strings.EqualFold(a, b)
+}
+
+// read returns the pins of the manifest filename. got.json is read as is, so
+// the revisions it records are kept. Packages of other manifests belonging to
+// repos pinned by got.json aren't looked up again, see lockedResolver.
+func (m *migration) read(dir, filename string) ([]Pin, error) {
+	if filepath.Base(filename) == ManifestFile {
+		return readManifest(filename)
+	}
+	locked, err := readManifest(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	return resolveManifest(lockedResolver{locked, m.r}, filename, replaceTarget)
+}
+
+// warnf logs that a pinned repo can't be fully represented by the target
+// format.
+func (m *migration) warnf(p Pin, format string, v ...interface{}) {
+	m.logger.Errorf("%s: "+format+", which %s manifests can't record", append([]interface{}{p.Root}, append(v, m.format)...)...)
+}
+
+// mirrored reports whether a pinned repo is fetched from another remote or
+// VCS than the one its root resolves to, such as a mirror or fork.
+func (m *migration) mirrored(p Pin) (bool, error) {
+	meta, err := m.r.resolve(m.ctx, p.Root)
+	if err != nil {
+		return false, errors.Wrapf(err, "resolving %s", p.Root)
+	}
+	return meta.Remote != p.Remote || meta.VCS != p.VCS, nil
+}
+
+// fullRevision matches a full git revision, which legacy manifests pin repos
+// to without a "commit:" prefix.
+var fullRevision = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// revisions returns the revision each pin refers to, keyed by repo root. Only
+// repos whose manifest entry doesn't record a revision are fetched.
+func (m *migration) revisions(pins []Pin) (map[string]string, error) {
+	revs := map[string]string{}
+	var fetch []pinnedPackage
+	for _, p := range pins {
+		refType, name := parseVersion(p.Version)
+		switch {
+		case p.Revision != "":
+			revs[p.Root] = p.Revision
+		case refType == refCommit, refType == "" && fullRevision.MatchString(name):
+			revs[p.Root] = name
+		default:
+			fetch = append(fetch, pinnedPackage{meta: p.meta(), version: p.Version})
+		}
+	}
+	if len(fetch) == 0 {
+		return revs, nil
+	}
+	commits, err := pinnedCommits(m.ctx, m.c, fetch, m.retry)
+	if err != nil {
+		return nil, err
+	}
+	for root, commit := range commits {
+		revs[root] = commit.revision
+	}
+	return revs, nil
+}
+
+// checkCommon warns about what none of the legacy formats can record: repos
+// vendored from a subdirectory of their repo, and branches followed on every
+// vendor run.
+func (m *migration) checkCommon(p Pin) {
+	if p.Subdir != "" {
+		m.warnf(p, "is vendored from the %s directory of its repo", p.Subdir)
+	}
+	if refType, name := parseVersion(p.Version); refType == refTrack {
+		m.warnf(p, "follows the latest revision of branch %s", name)
+	}
+}
+
+// checkConstraint warns about a version constraint of a repo, for formats
+// that can only record the pinned version.
+func (m *migration) checkConstraint(p Pin) {
+	if p.Constraint != "" {
+		m.warnf(p, "has version constraint %s", p.Constraint)
+	}
+}
+
+// encodeGodeps encodes pins as a Godeps/Godeps.json file. Godeps pins every
+// repo to a revision, so repos pinned to a branch are recorded at the revision
+// they refer to. Tags are kept in the comment of the revision, which
+// parseGodeps reads back, as are version constraints of repos that aren't
+// pinned to a tag.
+func encodeGodeps(m *migration, pins []Pin) ([]byte, error) {
+	type dep struct {
+		ImportPath string
+		Comment    string `json:",omitempty"`
+		Rev        string
+	}
+	revs, err := m.revisions(pins)
+	if err != nil {
+		return nil, err
+	}
+	deps := []dep{}
+	for _, p := range pins {
+		m.checkCommon(p)
+		if mirrored, err := m.mirrored(p); err != nil {
+			return nil, err
+		} else if mirrored {
+			m.warnf(p, "is fetched from %s", p.Remote)
+		}
+		d := dep{ImportPath: p.Root, Rev: revs[p.Root], Comment: p.Constraint}
+		switch refType, name := parseVersion(p.Version); refType {
+		case refTag:
+			if p.Constraint != "" {
+				m.warnf(p, "is pinned to tag %s along with constraint %s", name, p.Constraint)
+			}
+			d.Comment = name
+		case refBranch:
+			m.warnf(p, "is pinned to branch %s", name)
+		}
+		deps = append(deps, d)
+	}
+	sort.Slice(deps, func(i, j int) bool { return deps[i].ImportPath < deps[j].ImportPath })
+	godeps := struct {
+		ImportPath string
+		Deps       []dep
+	}{m.project, deps}
+	b, err := json.MarshalIndent(godeps, "", "\t")
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding Godeps.json")
+	}
+	return append(b, '\n'), nil
+}
+
+// encodeGlide encodes pins as a glide.yaml file. Glide accepts any version
+// name, and can override the remote and VCS of a package, so only revisions
+// recorded when repos were vendored are lost, which glide records in its own
+// lock file when installing.
+func encodeGlide(m *migration, pins []Pin) ([]byte, error) {
+	type pkg struct {
+		Package string `yaml:"package"`
+		Version string `yaml:"version"`
+		Repo    string `yaml:"repo,omitempty"`
+		VCS     string `yaml:"vcs,omitempty"`
+	}
+	var pkgs []pkg
+	for _, p := range pins {
+		m.checkCommon(p)
+		m.checkConstraint(p)
+		_, name := parseVersion(p.Version)
+		gp := pkg{Package: p.Root, Version: name}
+		if mirrored, err := m.mirrored(p); err != nil {
+			return nil, err
+		} else if mirrored {
+			gp.Repo, gp.VCS = p.Remote, p.VCS
+		}
+		pkgs = append(pkgs, gp)
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Package < pkgs[j].Package })
+	config := struct {
+		Package string `yaml:"package,omitempty"`
+		Import  []pkg  `yaml:"import"`
+	}{m.project, pkgs}
+	b, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding glide.yaml")
+	}
+	return b, nil
+}
+
+// encodeGopkgLock encodes pins as dep's Gopkg.lock file. Each project is
+// locked to a revision, with the tag or branch it was pinned to recorded
+// alongside it. A remote other than the one the root resolves to is kept as
+// the project's source.
+func encodeGopkgLock(m *migration, pins []Pin) ([]byte, error) {
+	type project struct {
+		Name     string `toml:"name"`
+		Branch   string `toml:"branch,omitempty"`
+		Revision string `toml:"revision"`
+		Source   string `toml:"source,omitempty"`
+		Version  string `toml:"version,omitempty"`
+	}
+	revs, err := m.revisions(pins)
+	if err != nil {
+		return nil, err
+	}
+	var projects []project
+	for _, p := range pins {
+		m.checkCommon(p)
+		m.checkConstraint(p)
+		dp := project{Name: p.Root, Revision: revs[p.Root]}
+		switch refType, name := parseVersion(p.Version); refType {
+		case refTag:
+			dp.Version = name
+		case refBranch, refTrack:
+			dp.Branch = name
+		}
+		if mirrored, err := m.mirrored(p); err != nil {
+			return nil, err
+		} else if mirrored {
+			dp.Source = p.Remote
+		}
+		projects = append(projects, dp)
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].Name < projects[j].Name })
+	lock := struct {
+		Projects []project `toml:"projects"`
+	}{projects}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(lock); err != nil {
+		return nil, errors.Wrap(err, "encoding Gopkg.lock")
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeGoMod encodes pins as a go.mod file of the project's module, see
+// goModFragment. Every repo is fetched to determine the dates of its
+// pseudo-versions.
+func encodeGoMod(m *migration, pins []Pin) ([]byte, error) {
+	if m.project == "" {
+		return nil, errors.New("can't determine the module path of the project, it's neither in a GOPATH nor has a go.mod")
+	}
+	pkgs := make([]pinnedPackage, len(pins))
+	for i, p := range pins {
+		if p.Subdir != "" {
+			m.warnf(p, "is vendored from the %s directory of its repo", p.Subdir)
+		}
+		switch refType, name := parseVersion(p.Version); refType {
+		case refBranch, refTrack:
+			m.warnf(p, "is pinned to branch %s", name)
+		}
+		m.checkConstraint(p)
+		pkgs[i] = pinnedPackage{meta: p.meta(), version: p.lockedVersion()}
+	}
+	commits, err := pinnedCommits(m.ctx, m.c, pkgs, m.retry)
+	if err != nil {
+		return nil, err
+	}
+	// Versions are only locked to find the commit, tags are kept so they
+	// become module versions.
+	for i, p := range pins {
+		pkgs[i].version = p.Version
+	}
+	fragment, err := goModFragment(m.ctx, m.r, pkgs, commits)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("module "+m.project+"\n\n"), fragment...), nil
+}
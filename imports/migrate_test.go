@@ -0,0 +1,421 @@
+package imports
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testGodeps pins packages of three repos, one of them by tag.
+const testGodeps = `{
+	"ImportPath": "example.com/project",
+	"Deps": [
+		{
+			"ImportPath": "github.com/coreos/go-oidc/jose",
+			"Rev": "a4973d9a4225417aecf5d450a9522f00c1f7130f"
+		},
+		{
+			"ImportPath": "github.com/coreos/go-oidc/key",
+			"Rev": "a4973d9a4225417aecf5d450a9522f00c1f7130f"
+		},
+		{
+			"ImportPath": "github.com/docker/go-connections/nat",
+			"Comment": "v0.2.1",
+			"Rev": "3ede32e2033de7505e6500d6c868c2b9ed9f169d"
+		},
+		{
+			"ImportPath": "github.com/docker/engine-api/types/time",
+			"Comment": "v0.3.1-78-gdea108d",
+			"Rev": "dea108d3aa0c67d7162a3fd8aa65f38a430019fd"
+		}
+	]
+}`
+
+func lookupImportMeta(ctx context.Context, name string) (*pkgMeta, error) {
+	meta, ok := importMeta(name)
+	if !ok {
+		return nil, fmt.Errorf("lookup failed for package %s", name)
+	}
+	return meta, nil
+}
+
+func TestMigrateGodeps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, []file{{"Godeps", ""}, {"Godeps/Godeps.json", testGodeps}})
+
+	pkgs, err := parseGodeps(resolverFunc(lookupImportMeta), []byte(testGodeps))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Pin{}
+	for _, pkg := range pkgs {
+		want[pkg.meta.Root] = pkg.pin()
+	}
+
+	// The manifest is detected.
+	m := &migration{r: resolverFunc(lookupImportMeta)}
+	pins, err := m.migrate(dir, MigrateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	written, err := readManifest(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pins, written) {
+		t.Errorf("returned pins %#v don't match the written manifest %#v", pins, written)
+	}
+	got := map[string]Pin{}
+	for _, p := range written {
+		got[p.Root] = p
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("wanted pins %#v, got %#v", want, got)
+	}
+	if v := got["github.com/docker/go-connections"].Version; v != "tag:v0.2.1" {
+		t.Errorf("expected the tag of the comment to be kept, got version %q", v)
+	}
+
+	// The native manifest pins the same set without any lookups.
+	fail := resolverFunc(func(ctx context.Context, pkg string) (*pkgMeta, error) {
+		return nil, fmt.Errorf("unexpected lookup of %s", pkg)
+	})
+	data, err := ioutil.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	native, err := parseManifest(fail, ManifestFile, data, replaceTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(native) != len(pkgs) {
+		t.Fatalf("expected %d pinned repos, got %d", len(pkgs), len(native))
+	}
+	for _, pkg := range native {
+		if !reflect.DeepEqual(want[pkg.meta.Root], pkg.pin()) {
+			t.Errorf("repo %s: wanted %#v, got %#v", pkg.meta.Root, want[pkg.meta.Root], pkg.pin())
+		}
+	}
+}
+
+func TestDetectManifest(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []file
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "godeps",
+			files: []file{{"Godeps", ""}, {"Godeps/Godeps.json", "{}"}},
+			want:  "Godeps/Godeps.json",
+		},
+		{
+			name:  "glide",
+			files: []file{{"glide.yaml", "import: []"}, {"glide.lock", "hash: abc"}},
+			want:  "glide.lock",
+		},
+		{
+			name:  "govendor",
+			files: []file{{"vendor", ""}, {"vendor/vendor.json", "{}"}},
+			want:  "vendor/vendor.json",
+		},
+		{
+			name:  "gomod",
+			files: []file{{"go.mod", "module example.com/project"}},
+			want:  "go.mod",
+		},
+		{
+			name:    "none",
+			files:   []file{{ManifestFile, "{}"}},
+			wantErr: true,
+		},
+		{
+			name:    "several",
+			files:   []file{{"Gopkg.lock", "[[projects]]"}, {"glide.yaml", "import: []"}},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			writeFiles(t, dir, test.files)
+
+			got, err := detectManifest(dir, ManifestFile)
+			if err != nil {
+				if !test.wantErr {
+					t.Fatal(err)
+				}
+				return
+			}
+			if test.wantErr {
+				t.Fatalf("expected error, got %s", got)
+			}
+			if want := filepath.Join(dir, filepath.FromSlash(test.want)); got != want {
+				t.Errorf("wanted %s, got %s", want, got)
+			}
+		})
+	}
+}
+
+func TestDeprecationNotice(t *testing.T) {
+	d := &deprecations{}
+	l := new(testLogger)
+	for _, filename := range []string{
+		"Godeps/Godeps.json",
+		"other/Godeps/Godeps.json",
+		"go.mod",
+		ManifestFile,
+		"glide.yaml",
+		"glide.lock",
+	} {
+		d.warn(l, filename)
+	}
+	msgs := l.messages("error")
+	if len(msgs) != 2 {
+		t.Fatalf("expected one notice each for godep and glide, got %q", msgs)
+	}
+	for i, tool := range []string{"godep", "glide"} {
+		if !strings.Contains(msgs[i], tool) || !strings.Contains(msgs[i], "got migrate") {
+			t.Errorf("expected a notice for %s suggesting got migrate, got %q", tool, msgs[i])
+		}
+	}
+}
+
+// defaultMeta resolves every root to its own remote, so any other remote is a
+// mirror.
+func defaultMeta(ctx context.Context, pkg string) (*pkgMeta, error) {
+	return &pkgMeta{Root: pkg, VCS: "git", Remote: "https://" + pkg}, nil
+}
+
+func TestMigrateRoundTrip(t *testing.T) {
+	rev := func(c string) string { return strings.Repeat(c, 40) }
+	pins := []Pin{
+		{Root: "example.com/bar", Remote: "https://example.com/bar", VCS: "git", Version: "commit:" + rev("2"), Revision: rev("2")},
+		{Root: "example.com/baz", Remote: "https://example.com/baz", VCS: "git", Version: "branch:main", Revision: rev("3")},
+		{Root: "example.com/foo", Remote: "https://example.com/foo", VCS: "git", Version: "tag:v1.0.0", Revision: rev("1")},
+		{Root: "example.com/qux", Remote: "https://mirror.example.com/qux", VCS: "git", Version: rev("4")},
+		{Root: "example.com/tracked", Remote: "https://example.com/tracked", VCS: "git", Version: "track:dev", Revision: rev("5")},
+	}
+	pin := func(root, version string) Pin {
+		return Pin{Root: root, Remote: "https://" + root, VCS: "git", Version: version}
+	}
+	mirror := Pin{Root: "example.com/qux", Remote: "https://mirror.example.com/qux", VCS: "git", Version: rev("4")}
+
+	tests := []struct {
+		to   string
+		want []Pin
+		// warned are the repos warnings are expected for.
+		warned []string
+	}{
+		{
+			to: "godeps",
+			want: []Pin{
+				pin("example.com/bar", rev("2")),
+				pin("example.com/baz", rev("3")),
+				pin("example.com/foo", "tag:v1.0.0"),
+				pin("example.com/qux", rev("4")),
+				pin("example.com/tracked", rev("5")),
+			},
+			warned: []string{"example.com/baz", "example.com/qux", "example.com/tracked"},
+		},
+		{
+			to: "glide",
+			want: []Pin{
+				pin("example.com/bar", rev("2")),
+				pin("example.com/baz", "main"),
+				pin("example.com/foo", "v1.0.0"),
+				mirror,
+				pin("example.com/tracked", "dev"),
+			},
+			warned: []string{"example.com/tracked"},
+		},
+		{
+			to: "dep",
+			want: []Pin{
+				pin("example.com/bar", rev("2")),
+				pin("example.com/baz", rev("3")),
+				pin("example.com/foo", rev("1")),
+				mirror,
+				pin("example.com/tracked", rev("5")),
+			},
+			warned: []string{"example.com/tracked"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.to, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			writeFiles(t, dir, []file{{"go.mod", "module example.com/project\n"}})
+			source := filepath.Join(dir, ManifestFile)
+			if err := writeManifest(source, pins); err != nil {
+				t.Fatal(err)
+			}
+
+			l := new(testLogger)
+			m := &migration{r: resolverFunc(defaultMeta), logger: l}
+			opts := MigrateOptions{Manifest: source, To: test.to}
+			if _, err := m.migrate(dir, opts); err != nil {
+				t.Fatal(err)
+			}
+
+			out := filepath.Join(dir, filepath.FromSlash(migrateTargets[test.to].path))
+			data, err := ioutil.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pkgs, err := parseManifest(resolverFunc(defaultMeta), out, data, replaceTarget)
+			if err != nil {
+				t.Fatalf("parsing migrated manifest: %v\n%s", err, data)
+			}
+			var got []Pin
+			for _, pkg := range pkgs {
+				got = append(got, pkg.pin())
+			}
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("wanted %#v, got %#v\n%s", test.want, got, data)
+			}
+
+			warnings := l.messages("error")
+			if len(warnings) != len(test.warned) {
+				t.Fatalf("expected warnings for %q, got %q", test.warned, warnings)
+			}
+			for i, root := range test.warned {
+				if !strings.HasPrefix(warnings[i], root+": ") || !strings.Contains(warnings[i], test.to) {
+					t.Errorf("expected a warning for %s naming %s, got %q", root, test.to, warnings[i])
+				}
+			}
+
+			// Migrating again doesn't overwrite the manifest, unless
+			// forced.
+			if _, err := m.migrate(dir, opts); err == nil {
+				t.Errorf("expected migrating over an existing manifest to fail")
+			}
+			opts.Force = true
+			if _, err := m.migrate(dir, opts); err != nil {
+				t.Errorf("forced migration: %v", err)
+			}
+		})
+	}
+}
+
+func TestMigrateCrossFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Without the tag, every repo is pinned to a full revision.
+	godeps := strings.Replace(testGodeps, `"Comment": "v0.2.1",`, "", 1)
+	writeFiles(t, dir, []file{{"Godeps", ""}, {"Godeps/Godeps.json", godeps}})
+
+	r := resolverFunc(lookupImportMeta)
+	m := &migration{r: r, logger: new(testLogger)}
+
+	// Godeps to dep to glide, each detected as the only manifest of the
+	// project, since the previous one is removed. Revisions of the
+	// Godeps file are used as is, nothing is fetched.
+	var want map[string]string
+	for _, to := range []string{"dep", "glide"} {
+		pins, err := m.migrate(dir, MigrateOptions{To: to})
+		if err != nil {
+			t.Fatalf("migrating to %s: %v", to, err)
+		}
+		got := map[string]string{}
+		for _, p := range pins {
+			_, got[p.Root] = parseVersion(p.Version)
+		}
+		if want == nil {
+			want = got
+		} else if !reflect.DeepEqual(want, got) {
+			t.Errorf("migrating to %s: wanted versions %q, got %q", to, want, got)
+		}
+		for _, m := range manifestFiles {
+			if m.path != migrateTargets[to].path {
+				os.RemoveAll(filepath.Join(dir, filepath.FromSlash(m.path)))
+			}
+		}
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "glide.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkgs, err := parseGlide(r, data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, pkg := range pkgs {
+		got[pkg.meta.Root] = pkg.version
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("wanted glide versions %q, got %q", want, got)
+	}
+	if len(want) != 3 || want["github.com/docker/go-connections"] != "3ede32e2033de7505e6500d6c868c2b9ed9f169d" {
+		t.Errorf("unexpected versions %q", want)
+	}
+}
+
+func TestMigrateGoMod(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		fooDir := filepath.Join(dir, "foo")
+		rev := gitRepo(t, fooDir, []file{{"foo.go", "package foo"}})
+		project := filepath.Join(dir, "project")
+		writeFiles(t, dir, []file{{"project", ""}, {"project/go.mod", "module example.com/project\n"}})
+		remote := "file://" + filepath.ToSlash(fooDir)
+		pins := []Pin{{Root: "example.com/foo", Remote: remote, VCS: "git", Version: "branch:master", Revision: rev}}
+		if err := writeManifest(filepath.Join(project, ManifestFile), pins); err != nil {
+			t.Fatal(err)
+		}
+
+		r := resolverFunc(func(ctx context.Context, pkg string) (*pkgMeta, error) {
+			return &pkgMeta{Root: "example.com/foo", VCS: "git", Remote: remote}, nil
+		})
+		l := new(testLogger)
+		m := &migration{ctx: context.Background(), r: r, c: c, retry: backoff{}, logger: l}
+		if _, err := m.migrate(project, MigrateOptions{Manifest: filepath.Join(project, ManifestFile), To: "gomod", Force: true}); err != nil {
+			t.Fatal(err)
+		}
+		if msgs := l.messages("error"); len(msgs) != 1 || !strings.Contains(msgs[0], "branch master") {
+			t.Errorf("expected a warning about the branch, got %q", msgs)
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(project, "go.mod"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkgs, err := parseGoMod(r, data, replaceTarget)
+		if err != nil {
+			t.Fatalf("parsing go.mod: %v\n%s", err, data)
+		}
+		if len(pkgs) != 1 || pkgs[0].meta.Root != "example.com/foo" || pkgs[0].version != rev[:12] {
+			t.Errorf("expected foo at %s, got %s", rev[:12], data)
+		}
+		if !strings.HasPrefix(string(data), "module example.com/project\n") {
+			t.Errorf("expected the project's module path, got %s", data)
+		}
+	})
+}
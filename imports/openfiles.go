@@ -0,0 +1,92 @@
+package imports
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// fileLimit bounds the number of files open at once across all copies, on
+// top of the workers of each copy, so vendoring several repos concurrently
+// can't run out of file descriptors. A nil fileLimit doesn't bound anything.
+type fileLimit struct {
+	max int
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	open int
+}
+
+func newFileLimit(max int) *fileLimit {
+	l := &fileLimit{max: max}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire waits until n more files can be opened. Files needed together are
+// acquired at once, so copies holding some of them can't starve each other.
+func (l *fileLimit) acquire(n int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// A single copy needing more than the limit still gets to run alone.
+	for l.open > 0 && l.open+n > l.max {
+		l.cond.Wait()
+	}
+	l.open += n
+}
+
+// release records that n files acquired earlier have been closed.
+func (l *fileLimit) release(n int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.open -= n
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
+
+const (
+	// defaultCopyFiles is the number of files copies may have open at
+	// once if the process's limit is unknown.
+	defaultCopyFiles = 256
+	// maxCopyFiles caps the number of files copies may have open at once,
+	// however high the process's limit is.
+	maxCopyFiles = 4096
+)
+
+// copyFiles returns how many files copies may have open at once: half of the
+// process's limit on open files, leaving the rest to clones, requests and the
+// runtime.
+func copyFiles() int {
+	n := openFileLimit() / 2
+	switch {
+	case n == 0:
+		return defaultCopyFiles
+	case n > maxCopyFiles:
+		return maxCopyFiles
+	case n < 2:
+		return 2
+	}
+	return int(n)
+}
+
+// processFiles is the fileLimit shared by every copy of the process, since
+// file descriptors are a per-process resource.
+var processFiles = newFileLimit(copyFiles())
+
+// copyFileHandle is a file opened by a copy.
+type copyFileHandle interface {
+	io.Reader
+	io.Writer
+	io.Closer
+	Chmod(mode os.FileMode) error
+}
+
+// openCopyFile opens a file with os.OpenFile.
+func openCopyFile(name string, flag int, perm os.FileMode) (copyFileHandle, error) {
+	return os.OpenFile(name, flag, perm)
+}
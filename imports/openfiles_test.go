@@ -0,0 +1,98 @@
+package imports
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// countingFile decrements the count of open files when closed.
+type countingFile struct {
+	*os.File
+	close func()
+}
+
+func (f *countingFile) Close() error {
+	f.close()
+	return f.File.Close()
+}
+
+func TestCopyDirFileLimit(t *testing.T) {
+	src, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	var files []file
+	for i := 0; i < 50; i++ {
+		files = append(files, file{fmt.Sprintf("file%d.go", i), "package foo"})
+	}
+	writeFiles(t, src, files)
+
+	var (
+		mu      sync.Mutex
+		open    int
+		maxOpen int
+	)
+	openFile := func(name string, flag int, perm os.FileMode) (copyFileHandle, error) {
+		f, err := os.OpenFile(name, flag, perm)
+		if err != nil {
+			return nil, err
+		}
+		mu.Lock()
+		open++
+		if open > maxOpen {
+			maxOpen = open
+		}
+		mu.Unlock()
+		return &countingFile{f, func() {
+			mu.Lock()
+			open--
+			mu.Unlock()
+		}}, nil
+	}
+
+	dest, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+
+	// Several copies with many workers each share the limit.
+	const limit = 4
+	opts := copyOptions{workers: 8, files: newFileLimit(limit), openFile: openFile}
+	var g errgroup.Group
+	for i := 0; i < 4; i++ {
+		to := filepath.Join(dest, fmt.Sprint(i))
+		if err := os.Mkdir(to, 0755); err != nil {
+			t.Fatal(err)
+		}
+		g.Go(func() error { return copyDir(to, src, opts) })
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		compareFiles(t, filepath.Join(dest, fmt.Sprint(i)), files)
+	}
+	if maxOpen > limit {
+		t.Errorf("expected at most %d files open at once, got %d", limit, maxOpen)
+	}
+	if maxOpen < 2 {
+		t.Errorf("expected files to be opened through the hook, got at most %d open", maxOpen)
+	}
+	if open != 0 {
+		t.Errorf("expected every file to be closed, %d still open", open)
+	}
+}
+
+func TestCopyFiles(t *testing.T) {
+	if n := copyFiles(); n < 2 || n > maxCopyFiles {
+		t.Errorf("expected a limit between 2 and %d open files, got %d", maxCopyFiles, n)
+	}
+}
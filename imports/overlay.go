@@ -0,0 +1,124 @@
+package imports
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/ericchiang/got/log"
+)
+
+// overlayStore is the directory of the cache holding the files referred to by
+// overlays. It's a content-addressed store, see storeBlob.
+const overlayStore = "blobs"
+
+// Overlay writes a build overlay for the project in dir to w, in the format
+// accepted by the go command's -overlay flag. The overlay maps every file the
+// manifest would vendor to a copy kept in cacheDir, so builds can use the
+// pinned repos without them being copied into the vendor directory. Fetches
+// are retried as configured by resolverOpts.
+func Overlay(w io.Writer, dir, cacheDir string, resolverOpts ResolverOptions, logger log.Logger) error {
+	c, err := newCache(cacheDir)
+	if err != nil {
+		return err
+	}
+	replace, err := overlayManifest(context.Background(), c, dir, getOptions{logger: logger, retry: resolverOpts.retryPolicy()})
+	if err != nil {
+		return err
+	}
+	return writeOverlay(w, replace)
+}
+
+// goOverlay is the format of the file passed to the go command's -overlay
+// flag. Replace maps absolute paths to the absolute paths of the files that
+// replace them.
+type goOverlay struct {
+	Replace map[string]string
+}
+
+func writeOverlay(w io.Writer, replace map[string]string) error {
+	data, err := json.MarshalIndent(goOverlay{replace}, "", "\t")
+	if err != nil {
+		return errors.Wrap(err, "encoding overlay")
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return errors.Wrap(err, "writing overlay")
+	}
+	return nil
+}
+
+func overlayManifest(ctx context.Context, c *cache, dir string, opts getOptions) (map[string]string, error) {
+	filename := filepath.Join(dir, ManifestFile)
+	m, err := readManifestFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	pins := m.Packages
+	if pins == nil {
+		return nil, errors.Errorf("no manifest found at %s", filename)
+	}
+	m.configure(&opts)
+
+	// The go command requires absolute paths on both sides of the overlay.
+	vendor, err := filepath.Abs(filepath.Join(dir, "vendor"))
+	if err != nil {
+		return nil, errors.Wrap(err, "determining vendor directory")
+	}
+	store, err := filepath.Abs(filepath.Join(c.dirname, overlayStore))
+	if err != nil {
+		return nil, errors.Wrap(err, "determining blob store")
+	}
+	if err := os.MkdirAll(store, 0755); err != nil {
+		return nil, errors.Wrap(err, "creating blob store")
+	}
+
+	// Like vendoring, parents are handled before nested repos, whose files
+	// replace any the parent has below them.
+	sort.Slice(pins, func(i, j int) bool { return pins[i].Root < pins[j].Root })
+	replace := map[string]string{}
+	for _, p := range pins {
+		meta := p.meta()
+		to := vendorPath(vendor, meta)
+		for path := range replace {
+			if hasPathPrefix(filepath.ToSlash(path), filepath.ToSlash(to)) {
+				delete(replace, path)
+			}
+		}
+		if opts.logger != nil {
+			opts.logger.Infof("%s: overlaying %s", p.Root, p.Version)
+		}
+
+		err := c.dir(cacheKey(meta.Remote), func(path string) error {
+			repo, _, err := cloneRepo(ctx, meta, path, opts.retry)
+			if err != nil {
+				return err
+			}
+			if _, err := checkoutVersion(ctx, repo, p.Version, opts.retry); err != nil {
+				return err
+			}
+			// The working copy only stays at this version while the cache
+			// is locked, so files are referred to by their stored copies.
+			files, _, err := walkCopies(path, opts.copy)
+			if err != nil {
+				return errors.Wrap(err, "listing repo files")
+			}
+			for _, f := range files {
+				blob, err := storeBlob(store, f.path, f.mode)
+				if err != nil {
+					return err
+				}
+				replace[filepath.Join(to, f.target)] = blob
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "overlaying %s", p.Root)
+		}
+	}
+	return replace, nil
+}
@@ -0,0 +1,98 @@
+package imports
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestOverlayManifest(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		files := []file{
+			{"foo.go", "package foo"},
+			{"foo_test.go", "package foo"},
+			{"LICENSE", "license"},
+			{"bar", ""},
+			{"bar/bar.go", "package bar"},
+		}
+		remote := filepath.Join(dir, "remote")
+		rev := gitRepo(t, remote, files)
+
+		project := filepath.Join(dir, "project")
+		if err := os.Mkdir(project, 0755); err != nil {
+			t.Fatal(err)
+		}
+		pin := Pin{Root: "example.com/foo", Remote: "file://" + filepath.ToSlash(remote), VCS: "git", Version: rev}
+		if err := writeManifest(filepath.Join(project, ManifestFile), []Pin{pin}); err != nil {
+			t.Fatal(err)
+		}
+
+		replace, err := overlayManifest(context.Background(), c, project, getOptions{retry: backoff{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		if err := writeOverlay(buf, replace); err != nil {
+			t.Fatal(err)
+		}
+		var overlay struct {
+			Replace map[string]string
+		}
+		if err := json.Unmarshal(buf.Bytes(), &overlay); err != nil {
+			t.Fatalf("decoding overlay %s: %v", buf, err)
+		}
+
+		to := filepath.Join(project, "vendor", "example.com", "foo")
+		want := map[string]string{
+			filepath.Join(to, "foo.go"):        "package foo",
+			filepath.Join(to, "LICENSE"):       "license",
+			filepath.Join(to, "bar", "bar.go"): "package bar",
+		}
+		var got, wantPaths []string
+		for path := range overlay.Replace {
+			got = append(got, path)
+		}
+		for path := range want {
+			wantPaths = append(wantPaths, path)
+		}
+		sort.Strings(got)
+		sort.Strings(wantPaths)
+		if !reflect.DeepEqual(got, wantPaths) {
+			t.Fatalf("expected overlay of %q, got %q", wantPaths, got)
+		}
+
+		for path, blob := range overlay.Replace {
+			if !filepath.IsAbs(path) || !filepath.IsAbs(blob) {
+				t.Errorf("expected absolute paths, got %s -> %s", path, blob)
+			}
+			if filepath.Dir(blob) != filepath.Join(c.dirname, overlayStore) {
+				t.Errorf("expected %s to be replaced by a file in the cache, got %s", path, blob)
+			}
+			data, err := ioutil.ReadFile(blob)
+			if err != nil {
+				t.Errorf("reading replacement of %s: %v", path, err)
+				continue
+			}
+			if string(data) != want[path] {
+				t.Errorf("expected %s to be replaced by %q, got %q", path, want[path], data)
+			}
+		}
+
+		// Nothing is copied into the project.
+		if _, err := os.Stat(filepath.Join(project, "vendor")); !os.IsNotExist(err) {
+			t.Errorf("expected no vendor directory to be created, got %v", err)
+		}
+	})
+}
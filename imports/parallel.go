@@ -0,0 +1,42 @@
+package imports
+
+import (
+	"context"
+	"runtime"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// forEach calls f with every index below n, running at most workers calls at
+// once, or one per CPU if workers isn't positive. It returns the first error
+// and stops starting new calls once one fails. Callers store results by
+// index, so they don't depend on the order the calls finish in.
+func forEach(n, workers int, f func(i int) error) error {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	group, ctx := errgroup.WithContext(context.Background())
+	queue := make(chan int)
+	for w := 0; w < workers; w++ {
+		group.Go(func() error {
+			for i := range queue {
+				if err := f(i); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	group.Go(func() error {
+		defer close(queue)
+		for i := 0; i < n; i++ {
+			select {
+			case queue <- i:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		return nil
+	})
+	return group.Wait()
+}
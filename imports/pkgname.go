@@ -0,0 +1,143 @@
+package imports
+
+import (
+	"fmt"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// packageConflict is a directory whose Go files declare different packages,
+// which the go tool refuses to build.
+type packageConflict struct {
+	dir string
+	// files maps each package name to the files declaring it.
+	files map[string][]string
+}
+
+// packageConflictError reports every directory with conflicting package
+// names.
+type packageConflictError struct {
+	conflicts []packageConflict
+}
+
+func (e *packageConflictError) Error() string {
+	var dirs []string
+	for _, c := range e.conflicts {
+		var names []string
+		for name := range c.files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var pkgs []string
+		for _, name := range names {
+			pkgs = append(pkgs, fmt.Sprintf("%s (%s)", name, strings.Join(c.files[name], ", ")))
+		}
+		dirs = append(dirs, fmt.Sprintf("%s: %s", c.dir, strings.Join(pkgs, ", ")))
+	}
+	return "conflicting package names in " + strings.Join(dirs, "; ")
+}
+
+// checkPackageNames parses the package clause of every Go file below dir,
+// returning a *packageConflictError for directories declaring more than one
+// package. External test packages, and files excluded by an "ignore" build
+// tag, such as generators declaring package main, are allowed.
+func checkPackageNames(dir string) error {
+	var conflicts []packageConflict
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		files, err := packageNames(path)
+		if err != nil {
+			return err
+		}
+		if len(files) > 1 {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			conflicts = append(conflicts, packageConflict{dir: filepath.ToSlash(rel), files: files})
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "checking package names")
+	}
+	if len(conflicts) > 0 {
+		return &packageConflictError{conflicts}
+	}
+	return nil
+}
+
+// packageNames returns the packages declared by the Go files directly in dir,
+// mapped to the names of the files declaring them.
+func packageNames(dir string) (map[string][]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]string{}
+	for _, file := range matches {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, file, nil, parser.PackageClauseOnly|parser.ParseComments)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing %s", file)
+		}
+		name := f.Name.Name
+		if strings.HasSuffix(file, "_test.go") || strings.HasSuffix(name, "_test") {
+			continue
+		}
+		ignored := false
+		for _, group := range f.Comments {
+			if group.Pos() >= f.Package {
+				break
+			}
+			for _, c := range group.List {
+				ignored = ignored || hasIgnoreTag(c.Text)
+			}
+		}
+		if ignored {
+			continue
+		}
+		files[name] = append(files[name], filepath.Base(file))
+	}
+	return files, nil
+}
+
+// hasIgnoreTag reports whether a comment is a build constraint using the
+// "ignore" tag, which conventionally excludes a file from all builds.
+func hasIgnoreTag(comment string) bool {
+	if !constraint.IsGoBuild(comment) && !constraint.IsPlusBuild(comment) {
+		return false
+	}
+	expr, err := constraint.Parse(comment)
+	if err != nil {
+		return false
+	}
+	return hasTag(expr, "ignore")
+}
+
+// hasTag reports whether a build constraint mentions tag.
+func hasTag(expr constraint.Expr, tag string) bool {
+	switch x := expr.(type) {
+	case *constraint.TagExpr:
+		return x.Tag == tag
+	case *constraint.NotExpr:
+		return hasTag(x.X, tag)
+	case *constraint.AndExpr:
+		return hasTag(x.X, tag) || hasTag(x.Y, tag)
+	case *constraint.OrExpr:
+		return hasTag(x.X, tag) || hasTag(x.Y, tag)
+	}
+	return false
+}
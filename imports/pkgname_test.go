@@ -0,0 +1,56 @@
+package imports
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheckPackageNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFiles(t, dir, []file{
+		{"ok", ""},
+		{"ok/a.go", "package a"},
+		{"ok/a_test.go", "package a_test"},
+		{"ok/gen.go", "// +build ignore\n\npackage main"},
+		{"ok/tool.go", "//go:build ignore && tools\n\npackage main"},
+		{"bad", ""},
+		{"bad/a.go", "package a"},
+		{"bad/b.go", "// Package b is misplaced.\npackage b"},
+		{"bad/c.go", "package a"},
+		{"bad/linux.go", "// +build linux\n\npackage b"},
+	})
+
+	err = checkPackageNames(dir)
+	e, ok := err.(*packageConflictError)
+	if !ok {
+		t.Fatalf("expected a package conflict error, got %v", err)
+	}
+	want := []packageConflict{{
+		dir: "bad",
+		files: map[string][]string{
+			"a": {"a.go", "c.go"},
+			"b": {"b.go", "linux.go"},
+		},
+	}}
+	if !reflect.DeepEqual(e.conflicts, want) {
+		t.Errorf("expected conflicts %+v, got %+v", want, e.conflicts)
+	}
+	if got, want := err.Error(), "conflicting package names in bad: a (a.go, c.go), b (b.go, linux.go)"; got != want {
+		t.Errorf("expected error %q, got %q", want, got)
+	}
+
+	if err := os.RemoveAll(filepath.Join(dir, "bad")); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPackageNames(dir); err != nil {
+		t.Errorf("expected no conflicts, got %v", err)
+	}
+}
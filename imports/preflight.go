@@ -0,0 +1,89 @@
+package imports
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// preflightWorkers bounds the number of remotes checked concurrently.
+const preflightWorkers = 8
+
+// unreachableRepo is a repo whose remote failed a preflight check.
+type unreachableRepo struct {
+	root   string
+	remote string
+	err    error
+}
+
+// preflightError lists every repo whose remote is unreachable.
+type preflightError struct {
+	repos []unreachableRepo
+}
+
+func (e *preflightError) Error() string {
+	lines := []string{"unreachable repos:"}
+	for _, r := range e.repos {
+		lines = append(lines, "  "+r.root+" ("+r.remote+"): "+r.err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// preflight checks that the remotes of the repos are reachable, without
+// cloning them, so that problems are reported up front rather than after
+// other repos have been fetched. All repos are checked concurrently, and all
+// unreachable ones are returned in a single *preflightError.
+func preflight(ctx context.Context, metas []*pkgMeta) error {
+	var (
+		mu          sync.Mutex
+		wg          sync.WaitGroup
+		unreachable []unreachableRepo
+	)
+	sem := make(chan struct{}, preflightWorkers)
+	for _, meta := range metas {
+		meta := meta
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if err := pingRemote(ctx, meta); err != nil {
+				mu.Lock()
+				unreachable = append(unreachable, unreachableRepo{meta.Root, meta.Remote, err})
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(unreachable) == 0 {
+		return nil
+	}
+	sort.Slice(unreachable, func(i, j int) bool { return unreachable[i].root < unreachable[j].root })
+	return errors.WithStack(&preflightError{unreachable})
+}
+
+// pingRemote checks that the remote of a repo is reachable without cloning
+// it.
+func pingRemote(ctx context.Context, meta *pkgMeta) error {
+	if meta.VCS == "git" {
+		return defaultCredentials.redactError(probeGit(ctx, meta.Remote))
+	}
+	// The local path must not exist, or it'd be inspected for an existing
+	// checkout.
+	local := filepath.Join(os.TempDir(), "got-preflight-"+cacheKey(meta.Remote))
+	repo, err := newRepo(meta, local)
+	if err != nil {
+		return errors.Wrap(err, "creating repo")
+	}
+	if !repo.Ping() {
+		return errors.Errorf("%s remote not reachable", repo.Vcs())
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+package imports
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/vcs"
+)
+
+// progress aggregates the progress of concurrent clones into a single line,
+// rather than interleaving the output of every clone. A nil progress
+// discards all updates, so callers don't have to check whether progress is
+// being reported.
+type progress struct {
+	// w receives the rendered line, overwritten in place using carriage
+	// returns.
+	w io.Writer
+	// now returns the current time. Defaults to time.Now.
+	now func() time.Time
+
+	mu       sync.Mutex
+	start    time.Time
+	total    int
+	repos    map[string]*repoProgress
+	rendered time.Time
+	width    int
+}
+
+// repoProgress is the progress of a single clone.
+type repoProgress struct {
+	objects      int
+	totalObjects int
+	bytes        int64
+	done         bool
+}
+
+// progressRenderInterval limits how often the line is redrawn, except for
+// repos starting or finishing.
+const progressRenderInterval = 100 * time.Millisecond
+
+func newProgress(w io.Writer) *progress {
+	return &progress{w: w, repos: map[string]*repoProgress{}}
+}
+
+func (p *progress) timeNow() time.Time {
+	if p.now != nil {
+		return p.now()
+	}
+	return time.Now()
+}
+
+// expect adds n repos to the total number of repos.
+func (p *progress) expect(n int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total += n
+	p.render(true)
+}
+
+// begin marks a repo as in progress. A repo that already finished isn't
+// started again, since repos are commonly revisited once they're cached.
+func (p *progress) begin(root string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.repos[root]; ok {
+		return
+	}
+	if p.start.IsZero() {
+		p.start = p.timeNow()
+	}
+	p.repos[root] = &repoProgress{}
+	p.render(true)
+}
+
+// update records the objects and bytes a repo has received so far.
+func (p *progress) update(root string, objects, totalObjects int, n int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r, ok := p.repos[root]
+	if !ok || r.done {
+		return
+	}
+	r.objects, r.totalObjects, r.bytes = objects, totalObjects, n
+	p.render(false)
+}
+
+// end marks a repo as completed.
+func (p *progress) end(root string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r, ok := p.repos[root]
+	if !ok || r.done {
+		return
+	}
+	r.done = true
+	p.render(true)
+}
+
+// finish terminates the line.
+func (p *progress) finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.render(true)
+	if p.width > 0 {
+		fmt.Fprintln(p.w)
+	}
+}
+
+// progressSnapshot holds the aggregated counters of all clones.
+type progressSnapshot struct {
+	Total      int
+	Completed  int
+	InProgress int
+
+	Objects      int
+	TotalObjects int
+	Bytes        int64
+	// Throughput is the combined number of bytes received per second since
+	// the first repo started.
+	Throughput float64
+}
+
+func (p *progress) snapshot() progressSnapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.snapshotLocked()
+}
+
+func (p *progress) snapshotLocked() progressSnapshot {
+	s := progressSnapshot{Total: p.total}
+	for _, r := range p.repos {
+		if r.done {
+			s.Completed++
+		} else {
+			s.InProgress++
+		}
+		s.Objects += r.objects
+		s.TotalObjects += r.totalObjects
+		s.Bytes += r.bytes
+	}
+	// Repos can be cloned without being expected, such as nested repos.
+	if n := s.Completed + s.InProgress; n > s.Total {
+		s.Total = n
+	}
+	if !p.start.IsZero() {
+		if elapsed := p.timeNow().Sub(p.start).Seconds(); elapsed > 0 {
+			s.Throughput = float64(s.Bytes) / elapsed
+		}
+	}
+	return s
+}
+
+func (s progressSnapshot) String() string {
+	return fmt.Sprintf("repos: %d total, %d completed, %d in progress; objects: %d/%d; %s at %s/s",
+		s.Total, s.Completed, s.InProgress, s.Objects, s.TotalObjects, formatBytes(float64(s.Bytes)), formatBytes(s.Throughput))
+}
+
+// render redraws the line, at most every progressRenderInterval unless force
+// is set. The caller must hold p.mu.
+func (p *progress) render(force bool) {
+	now := p.timeNow()
+	if !force && now.Sub(p.rendered) < progressRenderInterval {
+		return
+	}
+	p.rendered = now
+	line := p.snapshotLocked().String()
+	// Pad the line to clear what's left of a longer previous one.
+	pad := p.width - len(line)
+	if pad < 0 {
+		pad = 0
+	}
+	fmt.Fprintf(p.w, "\r%s%s", line, bytes.Repeat([]byte(" "), pad))
+	p.width = len(line)
+}
+
+// formatBytes formats a number of bytes using binary units, like git.
+func formatBytes(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB"}
+	i := 0
+	for ; n >= 1024 && i < len(units)-1; i++ {
+		n /= 1024
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[i])
+	}
+	return fmt.Sprintf("%.2f %s", n, units[i])
+}
+
+// progressKey is the context key of the progress clones report to.
+type progressKey struct{}
+
+// withProgress returns a context whose clones report to p.
+func withProgress(ctx context.Context, p *progress) context.Context {
+	return context.WithValue(ctx, progressKey{}, p)
+}
+
+// progressFrom returns the progress clones made with ctx report to, or nil.
+func progressFrom(ctx context.Context) *progress {
+	p, _ := ctx.Value(progressKey{}).(*progress)
+	return p
+}
+
+// gitProgressRE matches the "Receiving objects" progress git prints to
+// stderr, e.g. "Receiving objects:  45% (450/1000), 1.20 MiB | 2.00 MiB/s".
+var gitProgressRE = regexp.MustCompile(`^Receiving objects:\s+\d+% \((\d+)/(\d+)\)(?:, ([0-9.]+) (bytes|KiB|MiB|GiB))?`)
+
+// gitProgressWriter parses the progress git prints to stderr, reporting it
+// to a callback. Other output is kept for error messages.
+type gitProgressWriter struct {
+	report func(objects, totalObjects int, n int64)
+	// output holds the lines that aren't progress.
+	output bytes.Buffer
+	line   []byte
+}
+
+func (w *gitProgressWriter) Write(b []byte) (int, error) {
+	for _, c := range b {
+		// Progress lines are redrawn using carriage returns.
+		if c != '\r' && c != '\n' {
+			w.line = append(w.line, c)
+			continue
+		}
+		w.flush()
+	}
+	return len(b), nil
+}
+
+// flush handles the current line.
+func (w *gitProgressWriter) flush() {
+	line := w.line
+	w.line = w.line[:0]
+	if len(line) == 0 {
+		return
+	}
+	m := gitProgressRE.FindSubmatch(line)
+	if m == nil {
+		if !gitStageRE.Match(bytes.TrimPrefix(line, []byte("remote: "))) {
+			w.output.Write(line)
+			w.output.WriteByte('\n')
+		}
+		return
+	}
+	objects, _ := strconv.Atoi(string(m[1]))
+	totalObjects, _ := strconv.Atoi(string(m[2]))
+	var n int64
+	if len(m[3]) > 0 {
+		size, _ := strconv.ParseFloat(string(m[3]), 64)
+		switch string(m[4]) {
+		case "KiB":
+			size *= 1 << 10
+		case "MiB":
+			size *= 1 << 20
+		case "GiB":
+			size *= 1 << 30
+		}
+		n = int64(size)
+	}
+	w.report(objects, totalObjects, n)
+}
+
+// gitStageRE matches the progress of other stages of a clone, which isn't
+// aggregated.
+var gitStageRE = regexp.MustCompile(`^[A-Z][a-z ]+:\s+\d+% \(\d+/\d+\)`)
+
+// gitClone clones a git repo like repo.Get, but reports the progress of the
+// clone to p and aborts it as soon as it exceeds l.
+func gitClone(ctx context.Context, repo *authGitRepo, root string, p *progress, l CloneLimits) error {
+	var cctx context.Context
+	var cancel context.CancelFunc
+	if l.Timeout > 0 {
+		cctx, cancel = context.WithTimeout(ctx, l.Timeout)
+	} else {
+		cctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	// Only written by the progress writer, which is done once the command
+	// has run.
+	var exceeded error
+	w := &gitProgressWriter{report: func(objects, totalObjects int, n int64) {
+		p.update(root, objects, totalObjects, n)
+		if l.MaxSize > 0 && n > l.MaxSize && exceeded == nil {
+			exceeded = sizeError(root, l.MaxSize)
+			cancel()
+		}
+	}}
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(cctx, "git", "clone", "--recursive", "--progress", "--", repo.Remote(), repo.LocalPath())
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd.Env = append(cmd.Env, repo.env...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = w
+	// Helpers such as git-remote-https outlive an aborted clone and keep
+	// its output open, so don't wait for them.
+	cmd.WaitDelay = time.Second
+	err := cmd.Run()
+	w.flush()
+	if exceeded == nil && cctx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		exceeded = timeoutError(root, l.Timeout)
+	}
+	if err != nil || exceeded != nil {
+		// Don't leave a partial clone behind for a retry to trip over.
+		os.RemoveAll(repo.LocalPath())
+	}
+	if exceeded != nil {
+		return exceeded
+	}
+	if err != nil {
+		return vcs.NewRemoteError("Unable to get repository", err, stdout.String()+w.output.String())
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package imports
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProgressAggregates(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	var buf bytes.Buffer
+	p := newProgress(&buf)
+	p.now = func() time.Time { return now }
+
+	p.expect(3)
+	if got, want := p.snapshot(), (progressSnapshot{Total: 3}); got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	// Fake clones report concurrently.
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		root := fmt.Sprintf("example.com/repo%d", i)
+		p.begin(root)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 1; n <= 100; n++ {
+				p.update(root, n, 100, int64(n)*1024)
+			}
+		}()
+	}
+	wg.Wait()
+
+	now = start.Add(2 * time.Second)
+	want := progressSnapshot{
+		Total:        3,
+		InProgress:   3,
+		Objects:      300,
+		TotalObjects: 300,
+		Bytes:        300 * 1024,
+		Throughput:   150 * 1024,
+	}
+	if got := p.snapshot(); got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	p.end("example.com/repo0")
+	p.end("example.com/repo0")
+	// Revisiting a finished repo, once it's cached, doesn't restart it.
+	p.begin("example.com/repo0")
+	p.update("example.com/repo0", 1, 1, 1)
+	want.Completed, want.InProgress = 1, 2
+	if got := p.snapshot(); got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	// Repos that weren't expected still count towards the total.
+	p.begin("example.com/nested")
+	p.end("example.com/nested")
+	p.end("example.com/repo1")
+	p.end("example.com/repo2")
+	want.Total, want.Completed, want.InProgress = 4, 4, 0
+	if got := p.snapshot(); got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	p.finish()
+	out := buf.String()
+	if !strings.HasSuffix(out, "\n") {
+		t.Errorf("expected output to end with a newline, got %q", out)
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\r")
+	last := strings.TrimSpace(lines[len(lines)-1])
+	if wantLine := "repos: 4 total, 4 completed, 0 in progress; objects: 300/300; 300.00 KiB at 150.00 KiB/s"; last != wantLine {
+		t.Errorf("expected last line %q, got %q", wantLine, last)
+	}
+}
+
+func TestNilProgress(t *testing.T) {
+	var p *progress
+	p.expect(1)
+	p.begin("example.com/foo")
+	p.update("example.com/foo", 1, 1, 1)
+	p.end("example.com/foo")
+	p.finish()
+	if got := progressFrom(context.Background()); got != nil {
+		t.Errorf("expected no progress in an empty context, got %v", got)
+	}
+}
+
+func TestGitProgressWriter(t *testing.T) {
+	type report struct {
+		objects, total int
+		n              int64
+	}
+	var reports []report
+	w := &gitProgressWriter{report: func(objects, total int, n int64) {
+		reports = append(reports, report{objects, total, n})
+	}}
+	// Writes split lines at arbitrary points.
+	output := "Cloning into 'foo'...\n" +
+		"remote: Counting objects:  50% (1/2)\rremote: Counting objects: 100% (2/2), done.\n" +
+		"Receiving objects:  10% (10/100)\rReceiving objects:  50% (50/100), 512 bytes | 1.00 KiB/s\r" +
+		"Receiving objects: 100% (100/100), 1.50 MiB | 2.00 MiB/s, done.\n" +
+		"Resolving deltas: 100% (3/3), done.\n" +
+		"fatal: something went wrong\n"
+	for i := 0; i < len(output); i += 7 {
+		end := i + 7
+		if end > len(output) {
+			end = len(output)
+		}
+		w.Write([]byte(output[i:end]))
+	}
+	w.flush()
+
+	want := []report{
+		{10, 100, 0},
+		{50, 100, 512},
+		{100, 100, 3 << 19},
+	}
+	if !reflect.DeepEqual(reports, want) {
+		t.Errorf("expected reports %v, got %v", want, reports)
+	}
+	if got, want := w.output.String(), "Cloning into 'foo'...\nfatal: something went wrong\n"; got != want {
+		t.Errorf("expected other output %q, got %q", want, got)
+	}
+}
+
+func TestCloneReportsProgress(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		fooDir := filepath.Join(dir, "foo")
+		gitRepo(t, fooDir, []file{{"foo.go", "package foo"}})
+		meta := &pkgMeta{Root: "example.com/foo", Remote: "file://" + filepath.ToSlash(fooDir), VCS: "git"}
+
+		var buf bytes.Buffer
+		p := newProgress(&buf)
+		ctx := withProgress(context.Background(), p)
+		if _, err := headVersion(ctx, c, meta, backoff{}); err != nil {
+			t.Fatal(err)
+		}
+		s := p.snapshot()
+		if s.Completed != 1 || s.InProgress != 0 {
+			t.Errorf("expected clone to be completed, got %+v", s)
+		}
+		if s.Objects == 0 || s.Objects != s.TotalObjects {
+			t.Errorf("expected clone to report received objects, got %+v", s)
+		}
+	})
+}
@@ -0,0 +1,193 @@
+package imports
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/modfile"
+)
+
+// collectImports parses every Go file of a project, including tests, and
+// returns the sorted set of packages they import. Directories ignored when
+// vendoring, such as "vendor" and "testdata", aren't scanned.
+func collectImports(dir string) ([]string, error) {
+	seen := map[string]bool{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && ignoreDir(info.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".go" {
+			return nil
+		}
+
+		imports, err := parseImports(path)
+		if err != nil {
+			return errors.Wrapf(err, "loading imports of %s", path)
+		}
+		for _, imp := range imports {
+			seen[imp] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	imports := make([]string, 0, len(seen))
+	for imp := range seen {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+	return imports, nil
+}
+
+// collectPackageImports parses the Go files, including tests, of the package
+// in the directory pkg of the project in dir, and of the project's own
+// packages it imports, directly or indirectly, and returns the sorted set of
+// packages they import. self is the import path of the project, see
+// projectImportPath. If it's empty, no imports are followed.
+func collectPackageImports(dir, self, pkg string) ([]string, error) {
+	seen := map[string]bool{}
+	visited := map[string]bool{}
+	queue := []string{filepath.Join(dir, filepath.FromSlash(pkg))}
+	for len(queue) > 0 {
+		d := queue[0]
+		queue = queue[1:]
+		if visited[d] {
+			continue
+		}
+		visited[d] = true
+
+		files, err := filepath.Glob(filepath.Join(d, "*.go"))
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, errors.Errorf("no Go files in %s", d)
+		}
+		for _, file := range files {
+			imports, err := parseImports(file)
+			if err != nil {
+				return nil, errors.Wrapf(err, "loading imports of %s", file)
+			}
+			for _, imp := range imports {
+				seen[imp] = true
+				if self != "" && hasPathPrefix(imp, self) {
+					rel := strings.TrimPrefix(strings.TrimPrefix(imp, self), "/")
+					queue = append(queue, filepath.Join(dir, filepath.FromSlash(rel)))
+				}
+			}
+		}
+	}
+
+	imports := make([]string, 0, len(seen))
+	for imp := range seen {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+	return imports, nil
+}
+
+// ImportReport classifies the imports of a project.
+type ImportReport struct {
+	// Std holds imported standard library packages.
+	Std []string `json:"std"`
+	// Vendored holds third-party packages present in the vendor directory.
+	Vendored []string `json:"vendored"`
+	// Missing holds third-party packages not present in the vendor directory.
+	Missing []string `json:"missing"`
+}
+
+// Imports reports the packages imported by the project in dir, split into
+// standard library, vendored and missing packages. The project's own
+// packages, including its internal packages, aren't reported.
+func Imports(dir string) (*ImportReport, error) {
+	imports, err := collectImports(dir)
+	if err != nil {
+		return nil, err
+	}
+	self, err := projectImportPath(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	vendor := filepath.Join(dir, "vendor")
+	r := new(ImportReport)
+	for _, imp := range imports {
+		switch {
+		case self != "" && hasPathPrefix(imp, self):
+			continue
+		case isStdPackage(imp):
+			r.Std = append(r.Std, imp)
+		case isVendored(vendor, imp):
+			r.Vendored = append(r.Vendored, imp)
+		default:
+			r.Missing = append(r.Missing, imp)
+		}
+	}
+	return r, nil
+}
+
+// projectImportPath determines the import path of a project from the module
+// directive of its go.mod file or, failing that, its location in GOPATH. It
+// returns an empty string if neither applies.
+func projectImportPath(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", errors.Wrap(err, "determining project directory")
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(abs, "go.mod"))
+	if err == nil {
+		if path := modfile.ModulePath(data); path != "" {
+			return path, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", errors.Wrap(err, "reading go.mod")
+	}
+
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		gopath = build.Default.GOPATH
+	}
+	for _, p := range filepath.SplitList(gopath) {
+		src := filepath.Join(p, "src") + string(filepath.Separator)
+		if strings.HasPrefix(abs, src) {
+			return filepath.ToSlash(strings.TrimPrefix(abs, src)), nil
+		}
+	}
+	return "", nil
+}
+
+// hasPathPrefix reports whether an import path is either prefix or a package
+// below it. Unlike strings.HasPrefix, "github.com/foo/barbaz" isn't below
+// "github.com/foo/bar".
+func hasPathPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// isVendored reports whether the vendor directory contains Go files for a
+// package.
+func isVendored(vendor, pkg string) bool {
+	files, err := filepath.Glob(filepath.Join(vendor, filepath.FromSlash(pkg), "*.go"))
+	if err != nil {
+		return false
+	}
+	for _, file := range files {
+		if !strings.HasSuffix(file, "_test.go") {
+			return true
+		}
+	}
+	return false
+}
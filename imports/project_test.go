@@ -0,0 +1,152 @@
+package imports
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestImports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFiles(t, dir, []file{
+		{"main.go", `package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+`},
+		{"main_test.go", `package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+`},
+		{"testdata", ""},
+		{"testdata/ignored.go", `package ignored
+
+import "example.com/ignored"
+`},
+		{"vendor", ""},
+		{"vendor/github.com", ""},
+		{"vendor/github.com/pkg", ""},
+		{"vendor/github.com/pkg/errors", ""},
+		{"vendor/github.com/pkg/errors/errors.go", `package errors
+
+import "example.com/ignored"
+`},
+	})
+
+	got, err := Imports(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ImportReport{
+		Std:      []string{"fmt", "net/http", "testing"},
+		Vendored: []string{"github.com/pkg/errors"},
+		Missing:  []string{"github.com/stretchr/testify/assert", "golang.org/x/net/context"},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("wanted %#v, got %#v", want, got)
+	}
+}
+
+func TestIsStdPackage(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"fmt", true},
+		{"net/http", true},
+		{"C", true},
+		{"io/fs", true},
+		{"internal/cpu", true},
+		{"github.com/foo/bar/internal/baz", false},
+		{"github.com/pkg/errors", false},
+		{"golang.org/x/net/context", false},
+	}
+	for _, test := range tests {
+		if got := isStdPackage(test.path); got != test.want {
+			t.Errorf("isStdPackage(%q), wanted=%t, got=%t", test.path, test.want, got)
+		}
+	}
+}
+
+func TestProjectImportPath(t *testing.T) {
+	tests := []struct {
+		gomod string
+		want  string
+	}{
+		{"module example.com/proj\n", "example.com/proj"},
+		{"// The project.\nmodule \"example.com/proj\" // quoted\n\ngo 1.20\n", "example.com/proj"},
+	}
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		writeFiles(t, dir, []file{{"go.mod", test.gomod}})
+
+		got, err := projectImportPath(dir)
+		if err != nil {
+			t.Errorf("%q: %v", test.gomod, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%q: expected import path %q, got %q", test.gomod, test.want, got)
+		}
+	}
+}
+
+func TestImportsInternal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFiles(t, dir, []file{
+		{"go.mod", "module example.com/proj\n"},
+		{"main.go", `package main
+
+import (
+	"example.com/proj/internal/util"
+	"example.com/project/foo"
+	"github.com/foo/bar"
+)
+`},
+		{"internal", ""},
+		{"internal/util", ""},
+		{"internal/util/util.go", `package util
+
+import "github.com/foo/bar/baz"
+`},
+	})
+
+	got, err := Imports(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ImportReport{
+		Missing: []string{
+			"example.com/project/foo",
+			"github.com/foo/bar",
+			"github.com/foo/bar/baz",
+		},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("wanted %#v, got %#v", want, got)
+	}
+}
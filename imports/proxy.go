@@ -0,0 +1,341 @@
+package imports
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/module"
+)
+
+// proxyFromEnv returns the module proxies configured by GOPROXY, if any.
+func proxyFromEnv() string {
+	return os.Getenv("GOPROXY")
+}
+
+// goProxy is an entry of a GOPROXY list.
+type goProxy struct {
+	// url is the base URL of the proxy, "direct" or "off".
+	url string
+	// fallback is set if any error, rather than only a missing module or
+	// version, moves on to the next entry. Such entries are followed by a
+	// "|" rather than a ",".
+	fallback bool
+}
+
+// parseGoProxy parses a GOPROXY list, e.g.
+// "https://proxy.example.com,https://proxy.golang.org|direct".
+func parseGoProxy(list string) ([]goProxy, error) {
+	var proxies []goProxy
+	for list != "" {
+		i := strings.IndexAny(list, ",|")
+		entry, fallback := list, false
+		if i >= 0 {
+			entry, fallback = list[:i], list[i] == '|'
+			list = list[i+1:]
+		} else {
+			list = ""
+		}
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		switch entry {
+		case "direct", "off":
+		default:
+			if !strings.HasPrefix(entry, "https://") && !strings.HasPrefix(entry, "http://") {
+				return nil, errors.Errorf("invalid GOPROXY entry %q, must be a URL, \"direct\" or \"off\"", entry)
+			}
+			entry = strings.TrimSuffix(entry, "/")
+		}
+		proxies = append(proxies, goProxy{url: entry, fallback: fallback})
+	}
+	return proxies, nil
+}
+
+// errUseVCS is returned by proxyGet when the repo must be fetched from its
+// VCS instead.
+var errUseVCS = errors.New("fetch from vcs")
+
+// proxyStatusError is returned when a module proxy responds with a non-2xx
+// status code.
+type proxyStatusError struct {
+	url    string
+	status string
+	code   int
+}
+
+func (e *proxyStatusError) Error() string {
+	return "getting " + e.url + ": " + e.status
+}
+
+// proxyNotFound reports whether a proxy doesn't have a module or version,
+// which always moves on to the next proxy.
+func proxyNotFound(err error) bool {
+	e, ok := errors.Cause(err).(*proxyStatusError)
+	return ok && (e.code == http.StatusNotFound || e.code == http.StatusGone)
+}
+
+// proxyInfo is the metadata a proxy serves for a module version.
+type proxyInfo struct {
+	Version string
+	// Origin is only reported by some proxies.
+	Origin *struct {
+		Hash string
+	}
+}
+
+// revision returns the revision of the version, or an empty string if the
+// proxy didn't report it. Pseudo-versions only hold a prefix of the revision,
+// so the revision isn't derived from the version.
+func (info *proxyInfo) revision() string {
+	if info.Origin != nil {
+		return info.Origin.Hash
+	}
+	return ""
+}
+
+// proxyGet downloads the module zip of a repo at version from the first
+// proxy of proxies that has it, caches its extracted contents and vendors it
+// into to. The repo's root is used as the module path. It returns errUseVCS
+// if every proxy lacks the version, or the list says to use the VCS.
+func proxyGet(ctx context.Context, c *cache, meta *pkgMeta, to, version string, opts getOptions) (string, error) {
+	proxies, err := parseGoProxy(opts.proxy)
+	if err != nil {
+		return "", err
+	}
+	_, name := parseVersion(version)
+	// Tags of modules in a directory of their repo are prefixed by it.
+	if meta.Subdir != "" {
+		name = strings.TrimPrefix(name, meta.Subdir+"/")
+	}
+	r := opts.resolver
+	if r == nil {
+		r = &resolver{credentials: defaultCredentials}
+	}
+	for _, p := range proxies {
+		switch p.url {
+		case "direct":
+			return "", errUseVCS
+		case "off":
+			return "", errors.Errorf("fetching %s: module downloads disabled by GOPROXY=off", meta.Root)
+		}
+		revision, err := proxyVendor(ctx, r, c, p.url, meta, to, name, opts)
+		if err == nil {
+			return revision, nil
+		}
+		if !proxyNotFound(err) && !p.fallback {
+			return "", errors.Wrapf(err, "fetching %s from proxy %s", meta.Root, p.url)
+		}
+		if opts.logger != nil {
+			opts.logger.Debugf("%s: proxy %s: %v", meta.Root, p.url, err)
+		}
+	}
+	return "", errUseVCS
+}
+
+// proxyVendor vendors a module version downloaded from a single proxy.
+// Downloads are held to the clone limits of ctx and report to its progress.
+func proxyVendor(ctx context.Context, r *resolver, c *cache, proxy string, meta *pkgMeta, to, version string, opts getOptions) (string, error) {
+	modPath, err := module.EscapePath(meta.Root)
+	if err != nil {
+		return "", errors.Wrap(err, "escaping module path")
+	}
+	escVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return "", errors.Wrap(err, "escaping version")
+	}
+	base := proxy + "/" + modPath + "/@v/"
+
+	var info proxyInfo
+	b, err := r.proxyFetch(ctx, meta.Root, base+escVersion+".info", opts.retry)
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal(b, &info); err != nil || info.Version == "" {
+		return "", errors.Errorf("invalid version info from %s", base+escVersion+".info")
+	}
+	// Queries such as revisions resolve to a canonical version, which is
+	// what zips are served for.
+	if escVersion, err = module.EscapeVersion(info.Version); err != nil {
+		return "", errors.Wrap(err, "escaping version")
+	}
+
+	key := "proxy-" + cacheKey(proxy+"/"+meta.Root+"@"+info.Version)
+	err = c.dir(key, func(dir string) error {
+		src := filepath.Join(dir, "src")
+		if _, err := os.Stat(src); err != nil {
+			if !os.IsNotExist(err) {
+				return err
+			}
+			data, err := proxyDownload(ctx, r, meta.Root, base+escVersion+".zip", opts.retry)
+			if err != nil {
+				return err
+			}
+			// Extract into a temporary directory first, so an interrupted
+			// extraction is never mistaken for a complete one.
+			tmp := src + ".tmp"
+			os.RemoveAll(tmp)
+			if err := unzipModule(tmp, data, meta.Root+"@"+info.Version); err != nil {
+				os.RemoveAll(tmp)
+				return errors.Wrap(err, "extracting module zip")
+			}
+			if err := os.Rename(tmp, src); err != nil {
+				return err
+			}
+		}
+		return vendorRepo(meta, to, src, version, opts)
+	})
+	if err != nil {
+		return "", err
+	}
+	return info.revision(), nil
+}
+
+// proxyDownload fetches a module zip, reporting its progress to the progress
+// of ctx and holding it to the clone limits of ctx.
+func proxyDownload(ctx context.Context, r *resolver, root, u string, p retryPolicy) ([]byte, error) {
+	prog := progressFrom(ctx)
+	prog.begin(root)
+	defer prog.end(root)
+
+	limits := cloneLimitsFrom(ctx)
+	dctx := ctx
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		dctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+	data, err := r.proxyFetch(dctx, root, u, p)
+	if err != nil && ctx.Err() == nil && dctx.Err() == context.DeadlineExceeded {
+		return nil, timeoutError(root, limits.Timeout)
+	}
+	return data, err
+}
+
+// proxyFetch returns the body of a proxy URL, requested like go-get URLs with
+// the resolver's client, timeout, headers and credentials. Transient failures
+// are retried according to p. Bodies larger than the MaxSize of the clone
+// limits of ctx fail with a limitError for root.
+func (r *resolver) proxyFetch(ctx context.Context, root, u string, p retryPolicy) ([]byte, error) {
+	maxSize := cloneLimitsFrom(ctx).MaxSize
+	prog := progressFrom(ctx)
+	var b []byte
+	err := retry(ctx, p, func() error {
+		ctx := ctx
+		if r.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, r.timeout)
+			defer cancel()
+		}
+		resp, err := r.do(ctx, u)
+		if err != nil {
+			return errors.Wrapf(err, "getting %s", u)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return &proxyStatusError{url: u, status: resp.Status, code: resp.StatusCode}
+		}
+		var body io.Reader = &progressReader{r: resp.Body, prog: prog, root: root}
+		if maxSize > 0 {
+			body = io.LimitReader(body, maxSize+1)
+		}
+		if b, err = ioutil.ReadAll(body); err != nil {
+			return errors.Wrapf(err, "reading %s", u)
+		}
+		if maxSize > 0 && int64(len(b)) > maxSize {
+			return sizeError(root, maxSize)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// progressReader reports the bytes read from a download to a progress.
+type progressReader struct {
+	r    io.Reader
+	prog *progress
+	root string
+	n    int64
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.n += int64(n)
+	r.prog.update(r.root, 0, 0, r.n)
+	return n, err
+}
+
+// unzipModule extracts a module zip, whose files are all prefixed by
+// "<module>@<version>/", into dir. Files and directories that would never be
+// vendored are skipped, see ignoreFile and ignoreDir.
+func unzipModule(dir string, data []byte, prefix string) error {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	prefix += "/"
+	for _, f := range r.File {
+		if !strings.HasPrefix(f.Name, prefix) {
+			return errors.Errorf("unexpected file %s outside of %s", f.Name, prefix)
+		}
+		rel := strings.TrimPrefix(f.Name, prefix)
+		if rel == "" || strings.HasSuffix(rel, "/") {
+			continue
+		}
+		if path.Clean(rel) != rel || strings.HasPrefix(rel, "../") || path.IsAbs(rel) {
+			return errors.Errorf("invalid file name %s", f.Name)
+		}
+		if ignoreModuleFile(rel) {
+			continue
+		}
+		if err := extractFile(filepath.Join(dir, filepath.FromSlash(rel)), f); err != nil {
+			return errors.Wrapf(err, "extracting %s", f.Name)
+		}
+	}
+	return nil
+}
+
+// ignoreModuleFile reports whether a file of a module, given by its slash
+// separated path, is ignored.
+func ignoreModuleFile(rel string) bool {
+	elems := strings.Split(rel, "/")
+	for _, elem := range elems[:len(elems)-1] {
+		if ignoreDir(elem) {
+			return true
+		}
+	}
+	return ignoreFile(elems[len(elems)-1])
+}
+
+func extractFile(to string, f *zip.File) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	w, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, rc); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
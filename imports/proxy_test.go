@@ -0,0 +1,223 @@
+package imports
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestParseGoProxy(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []goProxy
+		wantErr bool
+	}{
+		{list: "", want: nil},
+		{
+			list: "https://proxy.example.com/,https://proxy.golang.org|direct",
+			want: []goProxy{
+				{url: "https://proxy.example.com"},
+				{url: "https://proxy.golang.org", fallback: true},
+				{url: "direct"},
+			},
+		},
+		{list: "off", want: []goProxy{{url: "off"}}},
+		{list: "proxy.example.com", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseGoProxy(test.list)
+		if err != nil {
+			if !test.wantErr {
+				t.Errorf("parseGoProxy(%q): %v", test.list, err)
+			}
+			continue
+		}
+		if test.wantErr {
+			t.Errorf("parseGoProxy(%q): expected error", test.list)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseGoProxy(%q): expected %+v, got %+v", test.list, test.want, got)
+		}
+	}
+}
+
+// moduleZip returns a module zip holding files.
+func moduleZip(t *testing.T, prefix string, files []file) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, f := range files {
+		fw, err := w.Create(prefix + "/" + f.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(f.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGoGetProxy(t *testing.T) {
+	const pseudo = "v0.0.0-20180101000000-0123456789ab"
+	const hash = "0123456789abcdef0123456789abcdef01234567"
+	zipData := moduleZip(t, "example.com/foo@"+pseudo, []file{
+		{"foo.go", "package foo"},
+		{"foo_test.go", "package foo"},
+		{"LICENSE", "license"},
+		{"testdata/data.go", "package data"},
+		{"bar/bar.go", "package bar"},
+	})
+	tagZip := moduleZip(t, "example.com/foo@v1.0.0", []file{{"foo.go", "package foo // v1.0.0"}})
+
+	var (
+		mu       sync.Mutex
+		requests []string
+		tokens   []string
+	)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.Path)
+		tokens = append(tokens, r.Header.Get("X-Token"))
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/example.com/foo/@v/0123456789ab.info":
+			w.Write([]byte(`{"Version": "` + pseudo + `"}`))
+		case "/example.com/foo/@v/" + pseudo + ".zip":
+			w.Write(zipData)
+		case "/example.com/foo/@v/v1.0.0.info":
+			w.Write([]byte(`{"Version": "v1.0.0", "Origin": {"Hash": "` + hash + `"}}`))
+		case "/example.com/foo/@v/v1.0.0.zip":
+			w.Write(tagZip)
+		default:
+			http.Error(w, "not found", http.StatusGone)
+		}
+	})
+
+	withTestServer(t, h, func(t *testing.T, host string) {
+		withCache(t, func(t *testing.T, c *cache) {
+			dir, err := ioutil.TempDir("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			// The remote doesn't exist, so the repo can only come from the
+			// proxy.
+			meta := &pkgMeta{Root: "example.com/foo", VCS: "git", Remote: "file://" + filepath.ToSlash(filepath.Join(dir, "missing"))}
+			r := &resolver{header: http.Header{"X-Token": {"secret"}}}
+			opts := getOptions{retry: backoff{}, proxy: "https://" + host, resolver: r}
+			for i := 0; i < 2; i++ {
+				to := filepath.Join(dir, "vendor", "example.com", "foo")
+				os.RemoveAll(to)
+				revision, err := goGet(context.Background(), c, meta, to, "0123456789ab", opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// Without an origin, the proxy doesn't say which
+				// revision the version is.
+				if revision != "" {
+					t.Errorf("expected no revision, got %s", revision)
+				}
+				compareFiles(t, to, []file{
+					{"LICENSE", "license"},
+					{"bar", ""},
+					{"bar/bar.go", "package bar"},
+					{"foo.go", "package foo"},
+				})
+			}
+			// The extracted zip is cached.
+			mu.Lock()
+			zips := 0
+			for _, r := range requests {
+				if strings.HasSuffix(r, ".zip") {
+					zips++
+				}
+			}
+			if zips != 1 {
+				t.Errorf("expected zip to be downloaded once, got %d downloads", zips)
+			}
+			// Requests are made with the resolver's headers.
+			for i, token := range tokens {
+				if token != "secret" {
+					t.Errorf("request for %s: expected X-Token header secret, got %q", requests[i], token)
+				}
+			}
+			mu.Unlock()
+
+			// Downloads are held to the clone limits.
+			to := filepath.Join(dir, "vendor", "example.com", "foo")
+			os.RemoveAll(to)
+			ctx := withCloneLimits(context.Background(), CloneLimits{MaxSize: 10})
+			if _, err := goGet(ctx, c, meta, to, "tag:v1.0.0", opts); err == nil {
+				t.Errorf("expected zip larger than the size limit to fail")
+			} else if _, ok := errors.Cause(err).(*limitError); !ok {
+				t.Errorf("expected a limit error, got %v", err)
+			}
+
+			// The revision reported by the proxy is used.
+			revision, err := goGet(context.Background(), c, meta, to, "tag:v1.0.0", opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if revision != hash {
+				t.Errorf("expected revision %s, got %s", hash, revision)
+			}
+			compareFiles(t, to, []file{{"foo.go", "package foo // v1.0.0"}})
+
+			// Versions the proxy doesn't have fall back to the VCS.
+			barDir := filepath.Join(dir, "bar")
+			rev := gitRepo(t, barDir, []file{{"bar.go", "package bar"}})
+			meta = &pkgMeta{Root: "example.com/bar", VCS: "git", Remote: "file://" + filepath.ToSlash(barDir)}
+			to = filepath.Join(dir, "vendor", "example.com", "bar")
+			revision, err = goGet(context.Background(), c, meta, to, rev, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if revision != rev {
+				t.Errorf("expected revision %s, got %s", rev, revision)
+			}
+			compareFiles(t, to, []file{{"bar.go", "package bar"}})
+
+			opts.proxy = "off"
+			if _, err := goGet(context.Background(), c, meta, to, rev, opts); err == nil {
+				t.Errorf("expected GOPROXY=off to disable downloads")
+			}
+		})
+	})
+}
+
+func TestUnzipModuleRejectsEscapes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, files := range [][]file{
+		{{"../evil.go", "package evil"}},
+		{{"a/../../evil.go", "package evil"}},
+	} {
+		data := moduleZip(t, "example.com/foo@v1.0.0", files)
+		if err := unzipModule(filepath.Join(dir, "out"), data, "example.com/foo@v1.0.0"); err == nil {
+			t.Errorf("expected extracting %s to fail", files[0].path)
+		}
+	}
+	data := moduleZip(t, "example.com/other@v1.0.0", []file{{"foo.go", "package foo"}})
+	if err := unzipModule(filepath.Join(dir, "out"), data, "example.com/foo@v1.0.0"); err == nil {
+		t.Errorf("expected extracting files of another module to fail")
+	}
+}
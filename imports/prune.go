@@ -0,0 +1,272 @@
+package imports
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ericchiang/got/log"
+)
+
+// Prune removes vendored packages the project in dir no longer uses, directly
+// or through other vendored packages. Legal files, such as licenses, are kept
+// as long as some package of their repo is still used. It returns the removed
+// directories, relative to dir.
+func Prune(dir string, logger log.Logger) ([]string, error) {
+	return prunePackages(dir, 0, logger)
+}
+
+// prunePackages prunes up to workers directories at once, see forEach. The
+// result doesn't depend on the number of workers.
+func prunePackages(dir string, workers int, logger log.Logger) ([]string, error) {
+	vendor := filepath.Join(dir, "vendor")
+	if _, err := os.Stat(vendor); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "checking vendor directory")
+	}
+
+	used, err := usedPackages(dir, vendor)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := filepath.Join(dir, ManifestFile)
+	pins, err := readManifest(filename)
+	if err != nil {
+		return nil, err
+	}
+	var roots []string
+	for _, p := range pins {
+		roots = append(roots, p.Root)
+	}
+	usedRoots := map[string]bool{}
+	for pkg := range used {
+		if root := repoRoot(roots, pkg); root != "" {
+			usedRoots[root] = true
+		}
+	}
+
+	// Every directory is considered independently, since a used package may
+	// be nested below an unused one.
+	var pkgs []string
+	err = filepath.Walk(vendor, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && path != vendor {
+			rel, err := filepath.Rel(vendor, path)
+			if err != nil {
+				return err
+			}
+			pkgs = append(pkgs, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "walking vendor directory")
+	}
+
+	// Directories are pruned concurrently, but reported in the order they
+	// were walked.
+	removed := make([]bool, len(pkgs))
+	err = forEach(len(pkgs), workers, func(i int) error {
+		pkg := pkgs[i]
+		if used[pkg] {
+			return nil
+		}
+		keepLegal := usedRoots[repoRoot(roots, pkg)]
+		ok, err := pruneDir(filepath.Join(vendor, filepath.FromSlash(pkg)), keepLegal)
+		if err != nil {
+			return errors.Wrapf(err, "pruning %s", pkg)
+		}
+		removed[i] = ok
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []string
+	for i, pkg := range pkgs {
+		if !removed[i] {
+			continue
+		}
+		path := filepath.Join(vendor, filepath.FromSlash(pkg))
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil, err
+		}
+		if logger != nil {
+			logger.Infof("removed %s", rel)
+		}
+		pruned = append(pruned, rel)
+	}
+
+	// Directories are visited parents first, so remove the ones left empty
+	// in reverse.
+	for i := len(pkgs) - 1; i >= 0; i-- {
+		path := filepath.Join(vendor, filepath.FromSlash(pkgs[i]))
+		if err := removeIfEmpty(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(pruned) == 0 || pins == nil {
+		return pruned, nil
+	}
+	// Keep the files recorded in the manifest in sync with the vendor
+	// directory, so vendor doesn't mistake pruned repos for partial copies.
+	dirs := map[string]bool{}
+	for _, root := range roots {
+		dirs[vendorPath(vendor, &pkgMeta{Root: root})] = true
+	}
+	var rehash []int
+	for i := range pins {
+		p := &pins[i]
+		if len(p.Files) == 0 {
+			continue
+		}
+		to := vendorPath(vendor, &pkgMeta{Root: p.Root})
+		skip := map[string]bool{}
+		for d := range dirs {
+			if d != to {
+				skip[d] = true
+			}
+		}
+		if _, err := os.Stat(to); os.IsNotExist(err) {
+			p.Files = nil
+			p.Hash = ""
+			continue
+		}
+		if p.Files, err = listFiles(to, skip); err != nil {
+			return nil, errors.Wrapf(err, "listing vendored files of %s", p.Root)
+		}
+		if p.Hash != "" {
+			rehash = append(rehash, i)
+		}
+	}
+	hashed := make([]Pin, len(rehash))
+	for j, i := range rehash {
+		hashed[j] = pins[i]
+	}
+	hashes, err := hashTrees(vendor, hashed, workers)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range rehash {
+		pins[i].Hash = hashes[j]
+	}
+	if err := writeManifest(filename, pins); err != nil {
+		return nil, err
+	}
+	return pruned, nil
+}
+
+// usedPackages returns the set of third-party packages imported by the
+// project in dir, including those only imported by other vendored packages.
+func usedPackages(dir, vendor string) (map[string]bool, error) {
+	imports, err := collectImports(dir)
+	if err != nil {
+		return nil, err
+	}
+	self, err := projectImportPath(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	used := map[string]bool{}
+	queue := imports
+	for len(queue) > 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+		if used[pkg] || isStdPackage(pkg) || (self != "" && hasPathPrefix(pkg, self)) {
+			continue
+		}
+		used[pkg] = true
+
+		files, err := filepath.Glob(filepath.Join(vendor, filepath.FromSlash(pkg), "*.go"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if strings.HasSuffix(file, "_test.go") {
+				continue
+			}
+			imports, err := loadImports(file)
+			if err != nil {
+				return nil, errors.Wrapf(err, "loading imports of %s", file)
+			}
+			queue = append(queue, imports...)
+		}
+	}
+	return used, nil
+}
+
+// repoRoot returns the root of the repo holding pkg, preferring the longest
+// matching root from the manifest. It returns an empty string if the root
+// can't be determined without a network request.
+func repoRoot(roots []string, pkg string) string {
+	root := ""
+	for _, r := range roots {
+		if hasPathPrefix(pkg, r) && len(r) > len(root) {
+			root = r
+		}
+	}
+	if root != "" {
+		return root
+	}
+	if meta, ok := importMeta(pkg); ok {
+		return meta.Root
+	}
+	return ""
+}
+
+// pruneDir removes the files directly in dir, keeping legal files if
+// keepLegal is true. Subdirectories are left alone. It reports whether any
+// files were removed.
+func pruneDir(dir string, keepLegal bool) (bool, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return false, err
+	}
+	infos, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		return false, err
+	}
+
+	removed := false
+	for _, info := range infos {
+		if info.IsDir() || (keepLegal && isLegalFile(info.Name())) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, info.Name())); err != nil {
+			return false, err
+		}
+		removed = true
+	}
+	return removed, nil
+}
+
+// removeIfEmpty removes dir if it has no entries.
+func removeIfEmpty(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	_, err = f.Readdirnames(1)
+	f.Close()
+	if err != io.EOF {
+		// Either the directory isn't empty or reading it failed.
+		return err
+	}
+	return os.Remove(dir)
+}
@@ -0,0 +1,184 @@
+package imports
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPrunePackages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFiles(t, dir, []file{
+		{"go.mod", "module example.com/project\n"},
+		{"main.go", `package main
+
+import (
+	"fmt"
+
+	"example.com/foo/used"
+	"example.com/project/internal"
+)
+`},
+		{"internal", ""},
+		{"internal/internal.go", "package internal"},
+		{"vendor", ""},
+		{"vendor/example.com", ""},
+		{"vendor/example.com/foo", ""},
+		{"vendor/example.com/foo/LICENSE", "license"},
+		{"vendor/example.com/foo/foo.go", "package foo"},
+		{"vendor/example.com/foo/used", ""},
+		{"vendor/example.com/foo/used/used.go", `package used
+
+import "example.com/dep"
+`},
+		{"vendor/example.com/foo/unused", ""},
+		{"vendor/example.com/foo/unused/COPYING", "license"},
+		{"vendor/example.com/foo/unused/unused.go", "package unused"},
+		{"vendor/example.com/dep", ""},
+		{"vendor/example.com/dep/dep.go", "package dep"},
+		{"vendor/example.com/gone", ""},
+		{"vendor/example.com/gone/LICENSE", "license"},
+		{"vendor/example.com/gone/gone.go", "package gone"},
+	})
+	filename := filepath.Join(dir, ManifestFile)
+	pins := []Pin{
+		{Root: "example.com/dep", Remote: "https://example.com/dep", VCS: "git", Version: "v1", Files: []string{"dep.go"}},
+		{Root: "example.com/foo", Remote: "https://example.com/foo", VCS: "git", Version: "v1", Files: []string{"LICENSE", "foo.go", "unused/COPYING", "unused/unused.go", "used/used.go"}},
+		{Root: "example.com/gone", Remote: "https://example.com/gone", VCS: "git", Version: "v1", Files: []string{"LICENSE", "gone.go"}},
+	}
+	if err := writeManifest(filename, pins); err != nil {
+		t.Fatal(err)
+	}
+
+	l := new(testLogger)
+	pruned, err := prunePackages(dir, 0, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join("vendor", "example.com", "foo"),
+		filepath.Join("vendor", "example.com", "foo", "unused"),
+		filepath.Join("vendor", "example.com", "gone"),
+	}
+	if !reflect.DeepEqual(pruned, want) {
+		t.Errorf("expected pruned directories %q, got %q", want, pruned)
+	}
+	if got := len(l.messages("info")); got != len(want) {
+		t.Errorf("expected %d removals to be logged, got %d", len(want), got)
+	}
+
+	compareFiles(t, filepath.Join(dir, "vendor"), []file{
+		{"example.com", ""},
+		{"example.com/foo", ""},
+		{"example.com/foo/LICENSE", "license"},
+		{"example.com/foo/used", ""},
+		{"example.com/foo/used/used.go", "package used\n\nimport \"example.com/dep\"\n"},
+		{"example.com/foo/unused", ""},
+		{"example.com/foo/unused/COPYING", "license"},
+		{"example.com/dep", ""},
+		{"example.com/dep/dep.go", "package dep"},
+	})
+
+	got, err := readManifest(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPins := []Pin{
+		{Root: "example.com/dep", Remote: "https://example.com/dep", VCS: "git", Version: "v1", Files: []string{"dep.go"}},
+		{Root: "example.com/foo", Remote: "https://example.com/foo", VCS: "git", Version: "v1", Files: []string{"LICENSE", "unused/COPYING", "used/used.go"}},
+		{Root: "example.com/gone", Remote: "https://example.com/gone", VCS: "git", Version: "v1"},
+	}
+	if !reflect.DeepEqual(got, wantPins) {
+		t.Errorf("expected manifest %#v, got %#v", wantPins, got)
+	}
+
+	// Pruning again is a no-op.
+	if pruned, err := prunePackages(dir, 0, nil); err != nil || len(pruned) != 0 {
+		t.Errorf("expected nothing left to prune, got %q, %v", pruned, err)
+	}
+}
+
+func TestPrunePackagesParallel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	type result struct {
+		pruned []string
+		files  []string
+		pins   []Pin
+	}
+	prune := func(workers int) result {
+		project := filepath.Join(dir, fmt.Sprint(workers))
+		if err := os.Mkdir(project, 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeSyntheticProject(t, project, 8, 8)
+		pruned, err := prunePackages(project, workers, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, err := listFiles(filepath.Join(project, "vendor"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pins, err := readManifest(filepath.Join(project, ManifestFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result{pruned, files, pins}
+	}
+
+	sequential, parallel := prune(1), prune(8)
+	if len(sequential.pruned) == 0 {
+		t.Fatal("expected unused packages to be pruned")
+	}
+	if !reflect.DeepEqual(sequential, parallel) {
+		t.Errorf("expected sequential and parallel prunes to match, got:\n%#v\n%#v", sequential, parallel)
+	}
+	// The manifest still matches the repos that are left. Entirely pruned
+	// repos have no recorded files.
+	mismatched, err := verifyVendor(filepath.Join(dir, "8"), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"example.com/repo1", "example.com/repo3", "example.com/repo5", "example.com/repo7"}
+	if !reflect.DeepEqual(mismatched, want) {
+		t.Errorf("expected only the pruned repos %q not to match, got %q", want, mismatched)
+	}
+}
+
+func BenchmarkPrunePackages(b *testing.B) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, workers := range []int{1, 0} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				project, err := ioutil.TempDir(dir, "")
+				if err != nil {
+					b.Fatal(err)
+				}
+				writeSyntheticProject(b, project, 32, 16)
+				b.StartTimer()
+				if _, err := prunePackages(project, workers, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package imports
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// ExportRequirements writes a flat list of the repos pinned by the manifest
+// of the project in dir, one per line, sorted by import path:
+//
+//	<root>\t<revision>\t<tree hash>
+//
+// The revision is the one the pin resolved to when last vendored, or its
+// version if none was recorded. The tree hash covers the vendored files of
+// the repo, using the "h1:" format of go.sum. Unlike the manifest, the format
+// never changes, so the list can be committed and diffed, or grepped by other
+// tools.
+func ExportRequirements(w io.Writer, dir string) error {
+	pins, err := List(dir)
+	if err != nil {
+		return err
+	}
+	b, err := requirements(filepath.Join(dir, "vendor"), pins)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func requirements(vendor string, pins []Pin) ([]byte, error) {
+	sorted := make([]Pin, len(pins))
+	copy(sorted, pins)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Root < sorted[j].Root })
+
+	for _, p := range sorted {
+		if len(p.Files) == 0 {
+			return nil, errors.Errorf("%s: no vendored files recorded, vendor the manifest first", p.Root)
+		}
+	}
+	hashes, err := hashTrees(vendor, sorted, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var b []byte
+	for i, p := range sorted {
+		hash := hashes[i]
+		revision := p.Revision
+		if revision == "" {
+			revision = p.Version
+		}
+		b = append(b, fmt.Sprintf("%s\t%s\t%s\n", p.Root, revision, hash)...)
+	}
+	return b, nil
+}
+
+// hashTrees returns the tree hashes of the vendored copies of pins, in the same
+// order, hashing up to workers copies at once. See forEach.
+func hashTrees(vendor string, pins []Pin, workers int) ([]string, error) {
+	hashes := make([]string, len(pins))
+	err := forEach(len(pins), workers, func(i int) error {
+		p := pins[i]
+		hash, err := treeHash(vendorPath(vendor, &pkgMeta{Root: p.Root}), p.Files)
+		if err != nil {
+			return errors.Wrapf(err, "hashing vendored files of %s", p.Root)
+		}
+		hashes[i] = hash
+		return nil
+	})
+	return hashes, err
+}
+
+// treeHash hashes the files below dir, which are slash separated and relative
+// to it. The hash only depends on the names and contents of the files.
+func treeHash(dir string, files []string) (string, error) {
+	return dirhash.Hash1(files, func(name string) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(dir, filepath.FromSlash(name)))
+	})
+}
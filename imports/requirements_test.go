@@ -0,0 +1,76 @@
+package imports
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRequirements(t *testing.T) {
+	vendor, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(vendor)
+
+	writeFiles(t, vendor, []file{
+		{"golang.org", ""},
+		{"golang.org/x", ""},
+		{"golang.org/x/net", ""},
+		{"golang.org/x/net/context", ""},
+		{"golang.org/x/net/context/context.go", "package context"},
+		{"golang.org/x/net/LICENSE", "license"},
+		{"github.com", ""},
+		{"github.com/pkg", ""},
+		{"github.com/pkg/errors", ""},
+		{"github.com/pkg/errors/errors.go", "package errors"},
+	})
+	pins := []Pin{
+		{
+			Root:    "golang.org/x/net",
+			Version: "d8887717615a",
+			// The order files are recorded in doesn't matter.
+			Files: []string{"context/context.go", "LICENSE"},
+		},
+		{
+			Root:     "github.com/pkg/errors",
+			Version:  "tag:v0.8.1",
+			Revision: "645ef00459ed84a119197bfb8d8205042c6df63d",
+			Files:    []string{"errors.go"},
+		},
+	}
+
+	got, err := requirements(vendor, pins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The hashes are go.sum style "h1:" hashes of the vendored files.
+	want := "github.com/pkg/errors\t645ef00459ed84a119197bfb8d8205042c6df63d\th1:XkXWEKVLvgbum6qQer/gLZlqzYPI7rzRMN4zYw0DPdY=\n" +
+		"golang.org/x/net\td8887717615a\th1:dbuCurXxlY8Sj75Wgvo40kJlhZZalXz9p2ntkJdLiUc=\n"
+	if string(got) != want {
+		t.Errorf("expected requirements:\n%s\ngot:\n%s", want, got)
+	}
+
+	// Changing a vendored file changes its repo's hash.
+	writeFiles(t, vendor, []file{{"golang.org/x/net/LICENSE", "modified"}})
+	changed, err := requirements(vendor, pins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(changed) == string(got) {
+		t.Errorf("expected modified files to change the tree hash")
+	}
+
+	// Pins that were never vendored can't be hashed.
+	pins = append(pins, Pin{Root: "example.com/foo", Version: "v1.0.0"})
+	if _, err := requirements(vendor, pins); err == nil {
+		t.Errorf("expected an error for a pin without vendored files")
+	}
+	if err := os.RemoveAll(filepath.Join(vendor, "github.com")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := requirements(vendor, pins[:2]); err == nil {
+		t.Errorf("expected an error for missing vendored files")
+	}
+}
@@ -0,0 +1,120 @@
+package imports
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/vcs"
+	"github.com/pkg/errors"
+)
+
+// retryPolicy determines how failed network operations are retried.
+type retryPolicy interface {
+	// retry is called after the nth failed attempt, starting at 1, and
+	// returns how long to wait before trying again. If it returns false the
+	// error is returned to the caller.
+	retry(attempt int, err error) (time.Duration, bool)
+}
+
+// DefaultRetries is how many times transient errors are retried by the CLI,
+// and by operations that aren't given a number of retries.
+const DefaultRetries = 2
+
+// defaultRetryPolicy retries transient errors a couple of times.
+var defaultRetryPolicy retryPolicy = transientBackoff(DefaultRetries)
+
+func transientBackoff(retries int) retryPolicy {
+	return backoff{
+		retries:   retries,
+		delay:     500 * time.Millisecond,
+		retryable: isTransient,
+	}
+}
+
+// backoff is a retryPolicy that retries a fixed number of times, doubling the
+// wait between each attempt.
+type backoff struct {
+	retries int
+	delay   time.Duration
+	// retryable reports whether an error should be retried. If nil, all
+	// errors are.
+	retryable func(err error) bool
+}
+
+func (b backoff) retry(attempt int, err error) (time.Duration, bool) {
+	if attempt > b.retries {
+		return 0, false
+	}
+	if b.retryable != nil && !b.retryable(err) {
+		return 0, false
+	}
+	return b.delay << uint(attempt-1), true
+}
+
+// isTransient reports whether an error is likely to succeed if retried, such
+// as a network error or server error.
+func isTransient(err error) bool {
+	switch err := errors.Cause(err).(type) {
+	case *httpStatusError:
+		return err.code/100 == 5
+	case *proxyStatusError:
+		return err.code/100 == 5
+	case *vcs.RemoteError:
+		// Remotes that don't exist or reject our credentials won't change
+		// their mind, so only retry failures to reach them.
+		out := strings.ToLower(err.Out())
+		for _, s := range transientOutputs {
+			if strings.Contains(out, s) {
+				return true
+			}
+		}
+		return false
+	case net.Error:
+		return true
+	}
+	return false
+}
+
+// transientOutputs are lower case fragments of VCS command output that
+// indicate a network failure or a server error.
+var transientOutputs = []string{
+	"could not resolve host",
+	"temporary failure in name resolution",
+	"connection refused",
+	"connection reset",
+	"connection timed out",
+	"operation timed out",
+	"network is unreachable",
+	"early eof",
+	"rpc failed",
+	// git: "The requested URL returned error: 503".
+	"returned error: 5",
+	// hg: "HTTP Error 503", svn: "unexpected HTTP status 503".
+	"http error 5",
+	"http status 5",
+}
+
+// retry calls f until it succeeds or the policy stops retrying. A nil policy
+// uses defaultRetryPolicy. Errors caused by ctx are never retried.
+func retry(ctx context.Context, p retryPolicy, f func() error) error {
+	if p == nil {
+		p = defaultRetryPolicy
+	}
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		wait, ok := p.retry(attempt, err)
+		if !ok {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
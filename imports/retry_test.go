@@ -0,0 +1,91 @@
+package imports
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Masterminds/vcs"
+)
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		policy retryPolicy
+		want   int
+	}{
+		{backoff{}, 1},
+		{backoff{retries: 3}, 4},
+		{backoff{retries: 3, retryable: func(error) bool { return false }}, 1},
+	}
+	for _, test := range tests {
+		attempts := 0
+		err := retry(context.Background(), test.policy, func() error {
+			attempts++
+			return errors.New("failed")
+		})
+		if err == nil {
+			t.Errorf("%#v: expected error", test.policy)
+		}
+		if attempts != test.want {
+			t.Errorf("%#v: wanted %d attempts, got %d", test.policy, test.want, attempts)
+		}
+	}
+}
+
+func TestResolverRetry(t *testing.T) {
+	var requests int32
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+
+	withTestServer(t, h, func(t *testing.T, host string) {
+		tests := []struct {
+			policy retryPolicy
+			want   int32
+		}{
+			{backoff{}, 1},
+			{backoff{retries: 2, retryable: isTransient}, 3},
+		}
+		for _, test := range tests {
+			atomic.StoreInt32(&requests, 0)
+
+			r := &resolver{retry: test.policy}
+			if _, err := r.fetchImportMeta(context.Background(), host+"/foo"); err == nil {
+				t.Errorf("expected request to fail")
+			}
+			if got := atomic.LoadInt32(&requests); got != test.want {
+				t.Errorf("%#v: wanted %d requests, got %d", test.policy, test.want, got)
+			}
+		}
+	})
+}
+
+func TestIsTransient(t *testing.T) {
+	remote := func(out string) error {
+		return vcs.NewRemoteError("Unable to get repository", errors.New("exit status 128"), out)
+	}
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&httpStatusError{code: http.StatusBadGateway, status: "502 Bad Gateway"}, true},
+		{&httpStatusError{code: http.StatusNotFound, status: "404 Not Found"}, false},
+		{&net.DNSError{Err: "no such host", Name: "example.com", IsTimeout: true}, true},
+		{remote("fatal: unable to access 'https://example.com/foo/': Could not resolve host: example.com\n"), true},
+		{remote("fatal: unable to access 'https://example.com/foo/': The requested URL returned error: 503\n"), true},
+		{remote("error: RPC failed; curl 56 GnuTLS recv error (-54)\nfatal: early EOF\n"), true},
+		{remote("remote: Repository not found.\nfatal: repository 'https://example.com/foo/' not found\n"), false},
+		{remote("fatal: Authentication failed for 'https://example.com/foo/'\n"), false},
+		{remote("fatal: unable to access 'https://example.com/foo/': The requested URL returned error: 403\n"), false},
+		{errors.New("failed"), false},
+	}
+	for _, test := range tests {
+		if got := isTransient(test.err); got != test.want {
+			t.Errorf("isTransient(%q) = %t, want %t", test.err, got, test.want)
+		}
+	}
+}
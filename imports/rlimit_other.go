@@ -0,0 +1,8 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package imports
+
+// openFileLimit returns zero, since the limit on open files can't be
+// determined on this platform.
+func openFileLimit() uint64 { return 0 }
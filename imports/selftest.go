@@ -0,0 +1,58 @@
+package imports
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SelfTest checks that packages can be resolved, cloned and copied by
+// vendoring pkg into a temporary directory, which is removed afterwards. If
+// responsesDir is non-empty, stored go-get responses in it are used before
+// making any requests.
+func SelfTest(cacheDir, pkg, responsesDir string) error {
+	c, err := newCache(cacheDir)
+	if err != nil {
+		return err
+	}
+	r := &resolver{header: headerFromEnv(os.Environ()), responsesDir: responsesDir}
+	return selfTest(context.Background(), r, c, pkg, getOptions{})
+}
+
+func selfTest(ctx context.Context, r pkgResolver, c *cache, pkg string, opts getOptions) error {
+	dir, err := ioutil.TempDir("", "got-selftest")
+	if err != nil {
+		return errors.Wrap(err, "creating temporary directory")
+	}
+	defer os.RemoveAll(dir)
+
+	meta, err := r.resolve(ctx, pkg)
+	if err != nil {
+		return errors.Wrapf(err, "resolving %s", pkg)
+	}
+	version, err := headVersion(ctx, c, meta, opts.retry)
+	if err != nil {
+		return errors.Wrapf(err, "fetching %s", meta.Remote)
+	}
+	vendor := filepath.Join(dir, "vendor")
+	if _, err := goGet(ctx, c, meta, vendorPath(vendor, meta), version, opts); err != nil {
+		return errors.Wrapf(err, "vendoring %s", meta.Root)
+	}
+
+	pkgDir := filepath.Join(vendor, filepath.FromSlash(path.Clean(pkg)))
+	files, err := ioutil.ReadDir(pkgDir)
+	if err != nil {
+		return errors.Wrapf(err, "reading vendored package %s", pkg)
+	}
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ".go") {
+			return nil
+		}
+	}
+	return errors.Errorf("vendored package %s contains no Go files", pkg)
+}
@@ -0,0 +1,43 @@
+package imports
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		remote := filepath.Join(dir, "remote")
+		gitRepo(t, remote, []file{
+			{"foo.go", "package foo"},
+			{"README", "no Go files here"},
+		})
+		r := resolverFunc(func(ctx context.Context, pkg string) (*pkgMeta, error) {
+			return &pkgMeta{Root: "example.com/foo", VCS: "git", Remote: "file://" + filepath.ToSlash(remote)}, nil
+		})
+
+		tests := []struct {
+			pkg     string
+			wantErr bool
+		}{
+			{"example.com/foo", false},
+			// Directory doesn't exist in the repo.
+			{"example.com/foo/bar", true},
+		}
+		for _, test := range tests {
+			err := selfTest(context.Background(), r, c, test.pkg, getOptions{retry: backoff{}})
+			if (err != nil) != test.wantErr {
+				t.Errorf("selftest %s: expected error=%t, got %v", test.pkg, test.wantErr, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,172 @@
+package imports
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ericchiang/got/log"
+)
+
+// Drift lists the differences between the vendored copy of a repo and the
+// files it would have if it were vendored at its pinned version. Paths are
+// slash separated and relative to the repo's vendor directory.
+type Drift struct {
+	Root string `json:"root"`
+	// Added files only exist in the vendored copy.
+	Added []string `json:"added,omitempty"`
+	// Modified files exist in both, with different contents.
+	Modified []string `json:"modified,omitempty"`
+	// Removed files are missing from the vendored copy.
+	Removed []string `json:"removed,omitempty"`
+
+	// Hash is the tree hash of the re-created copy.
+	Hash string `json:"hash"`
+	// RecordedHash is the tree hash recorded in the manifest when the repo
+	// was last vendored, if any.
+	RecordedHash string `json:"recorded_hash,omitempty"`
+}
+
+// Clean reports whether the vendored copy matches the pinned version.
+func (d Drift) Clean() bool {
+	return len(d.Added) == 0 && len(d.Modified) == 0 && len(d.Removed) == 0
+}
+
+// Reproducible reports whether vendoring the repo again produced the files
+// recorded in the manifest. If it didn't, vendoring the same revision isn't
+// deterministic, or the manifest was edited by hand.
+func (d Drift) Reproducible() bool {
+	return d.RecordedHash == "" || d.RecordedHash == d.Hash
+}
+
+// Status re-creates the vendored copy of every repo pinned by the manifest of
+// the project in dir, fetching repos into cacheDir, and compares it to the
+// project's vendor directory. Repos are re-created at the revision recorded
+// when they were last vendored, so the tree hash of the copy can be compared
+// to the recorded one, see Drift.Reproducible. It returns the drift of every
+// pinned repo, in manifest order.
+func Status(dir, cacheDir string, resolverOpts ResolverOptions, logger log.Logger) ([]Drift, error) {
+	c, err := newCache(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	r, err := loggingResolver(resolverOpts, logger)
+	if err != nil {
+		return nil, err
+	}
+	return vendorStatus(context.Background(), c, dir, getOptions{logger: logger, retry: resolverOpts.retryPolicy(), proxy: proxyFromEnv(), resolver: r})
+}
+
+func vendorStatus(ctx context.Context, c *cache, dir string, opts getOptions) ([]Drift, error) {
+	filename := filepath.Join(dir, ManifestFile)
+	m, err := readManifestFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	pins := m.Packages
+	if pins == nil {
+		return nil, errors.Errorf("no manifest found at %s", filename)
+	}
+	m.configure(&opts)
+
+	vendor := filepath.Join(dir, "vendor")
+	roots := pinRoots(vendor, pins)
+
+	tmp, err := ioutil.TempDir("", "got-status")
+	if err != nil {
+		return nil, errors.Wrap(err, "creating temporary directory")
+	}
+	defer os.RemoveAll(tmp)
+
+	drifts := make([]Drift, len(pins))
+	group, gctx := errgroup.WithContext(ctx)
+	for i, p := range pins {
+		i, p := i, p
+		group.Go(func() error {
+			meta := p.meta()
+			// Each repo gets its own directory, so nested repos don't end
+			// up in the copies of their parents.
+			want := filepath.Join(tmp, strconv.Itoa(i))
+			if _, err := goGet(gctx, c, meta, want, p.lockedVersion(), opts); err != nil {
+				return errors.Wrapf(err, "fetching %s", p.Root)
+			}
+			got := vendorPath(vendor, meta)
+			drift, err := diffDirs(got, want, otherRoots(roots, got))
+			if err != nil {
+				return errors.Wrapf(err, "comparing vendored files of %s", p.Root)
+			}
+			files, err := listFiles(want, nil)
+			if err != nil {
+				return errors.Wrapf(err, "listing files of %s", p.Root)
+			}
+			if drift.Hash, err = treeHash(want, files); err != nil {
+				return errors.Wrapf(err, "hashing files of %s", p.Root)
+			}
+			drift.Root = p.Root
+			drift.RecordedHash = p.Hash
+			drifts[i] = drift
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	return drifts, nil
+}
+
+// diffDirs compares the files below got to the ones below want. Directories
+// of got in skip, such as nested repos, aren't compared.
+func diffDirs(got, want string, skip map[string]bool) (Drift, error) {
+	var d Drift
+	gotFiles, err := listFiles(got, skip)
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return d, err
+	}
+	wantFiles, err := listFiles(want, nil)
+	if err != nil {
+		return d, err
+	}
+
+	// Both lists are sorted.
+	i, j := 0, 0
+	for i < len(gotFiles) || j < len(wantFiles) {
+		switch {
+		case j == len(wantFiles) || (i < len(gotFiles) && gotFiles[i] < wantFiles[j]):
+			d.Added = append(d.Added, gotFiles[i])
+			i++
+		case i == len(gotFiles) || wantFiles[j] < gotFiles[i]:
+			d.Removed = append(d.Removed, wantFiles[j])
+			j++
+		default:
+			same, err := sameContents(filepath.Join(got, filepath.FromSlash(gotFiles[i])), filepath.Join(want, filepath.FromSlash(wantFiles[j])))
+			if err != nil {
+				return d, err
+			}
+			if !same {
+				d.Modified = append(d.Modified, gotFiles[i])
+			}
+			i++
+			j++
+		}
+	}
+	return d, nil
+}
+
+// sameContents reports whether two files have the same contents.
+func sameContents(a, b string) (bool, error) {
+	dataA, err := ioutil.ReadFile(a)
+	if err != nil {
+		return false, err
+	}
+	dataB, err := ioutil.ReadFile(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(dataA, dataB), nil
+}
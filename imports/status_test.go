@@ -0,0 +1,158 @@
+package imports
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVendorStatus(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		fooDir, barDir := filepath.Join(dir, "foo"), filepath.Join(dir, "bar")
+		foo := gitRepo(t, fooDir, []file{
+			{"a.go", "package foo"},
+			{"b.go", "package foo"},
+			{"c.go", "package foo"},
+		})
+		bar := gitRepo(t, barDir, []file{{"bar.go", "package bar"}})
+
+		project := filepath.Join(dir, "project")
+		if err := os.Mkdir(project, 0755); err != nil {
+			t.Fatal(err)
+		}
+		pins := []Pin{
+			{Root: "example.com/foo", Remote: "file://" + filepath.ToSlash(fooDir), VCS: "git", Version: foo},
+			{Root: "example.com/foo/bar", Remote: "file://" + filepath.ToSlash(barDir), VCS: "git", Version: bar},
+		}
+		if err := writeManifest(filepath.Join(project, ManifestFile), pins); err != nil {
+			t.Fatal(err)
+		}
+		opts := getOptions{retry: backoff{}}
+		vendored, err := vendorManifest(context.Background(), c, project, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		drifts, err := vendorStatus(context.Background(), c, project, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, d := range drifts {
+			if !d.Reproducible() || d.Hash != vendored[i].Hash {
+				t.Errorf("%s: expected vendoring again to reproduce hash %s, got %+v", d.Root, vendored[i].Hash, d)
+			}
+		}
+		want := []Drift{{Root: "example.com/foo"}, {Root: "example.com/foo/bar"}}
+		if stripHashes(drifts); !reflect.DeepEqual(drifts, want) {
+			t.Errorf("expected no drift right after vendoring, got %+v", drifts)
+		}
+
+		to := filepath.Join(project, "vendor", "example.com", "foo")
+		writeFiles(t, to, []file{
+			{"b.go", "package foo // changed"},
+			{"d.go", "package foo"},
+		})
+		if err := os.Remove(filepath.Join(to, "c.go")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.RemoveAll(filepath.Join(to, "bar")); err != nil {
+			t.Fatal(err)
+		}
+
+		drifts, err = vendorStatus(context.Background(), c, project, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = []Drift{
+			{Root: "example.com/foo", Added: []string{"d.go"}, Modified: []string{"b.go"}, Removed: []string{"c.go"}},
+			{Root: "example.com/foo/bar", Removed: []string{"bar.go"}},
+		}
+		if stripHashes(drifts); !reflect.DeepEqual(drifts, want) {
+			t.Errorf("expected drift %+v, got %+v", want, drifts)
+		}
+		for _, d := range drifts {
+			if d.Clean() {
+				t.Errorf("expected %s not to be clean", d.Root)
+			}
+		}
+	})
+}
+
+// stripHashes clears the hashes of drifts, which depend on the contents of
+// the files.
+func stripHashes(drifts []Drift) {
+	for i := range drifts {
+		drifts[i].Hash = ""
+		drifts[i].RecordedHash = ""
+	}
+}
+
+func TestVendorStatusReproducible(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		remote := filepath.Join(dir, "remote")
+		gitRepo(t, remote, []file{{"bar", ""}, {"bar/bar.go", "package bar"}, {"foo.go", "package foo"}})
+		pins := []Pin{{Root: "example.com/foo", Remote: "file://" + filepath.ToSlash(remote), VCS: "git", Version: "branch:master"}}
+
+		// Independent runs vendoring the same manifest into different
+		// projects, with different caches, produce the same trees.
+		var runs [][]Pin
+		for _, name := range []string{"a", "b"} {
+			project := filepath.Join(dir, name)
+			if err := os.Mkdir(project, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := writeManifest(filepath.Join(project, ManifestFile), pins); err != nil {
+				t.Fatal(err)
+			}
+			cacheDir := filepath.Join(dir, name+"-cache")
+			if err := os.Mkdir(cacheDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			vendored, err := vendorManifest(context.Background(), &cache{dirname: cacheDir}, project, getOptions{retry: backoff{}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			runs = append(runs, vendored)
+		}
+		if !reflect.DeepEqual(runs[0], runs[1]) {
+			t.Errorf("expected identical runs, got %#v and %#v", runs[0], runs[1])
+		}
+		if runs[0][0].Hash == "" {
+			t.Errorf("expected a tree hash to be recorded, got %#v", runs[0][0])
+		}
+
+		// A recorded hash that vendoring can't reproduce is reported, even
+		// if the vendor directory matches.
+		project := filepath.Join(dir, "a")
+		tampered := runs[0]
+		tampered[0].Hash = "h1:tampered"
+		if err := writeManifest(filepath.Join(project, ManifestFile), tampered); err != nil {
+			t.Fatal(err)
+		}
+		drifts, err := vendorStatus(context.Background(), c, project, getOptions{retry: backoff{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(drifts) != 1 || !drifts[0].Clean() || drifts[0].Reproducible() {
+			t.Errorf("expected a clean but unreproducible repo, got %+v", drifts)
+		}
+		if drifts[0].Hash != runs[1][0].Hash {
+			t.Errorf("expected hash %s, got %s", runs[1][0].Hash, drifts[0].Hash)
+		}
+	})
+}
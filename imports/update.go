@@ -0,0 +1,172 @@
+package imports
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ericchiang/got/log"
+)
+
+// Update re-pins every repo in the manifest of the project in dir to the
+// latest revision of its default branch and re-vendors it. Repos pinned to a
+// version with a "branch:" or "track:" prefix follow the latest revision of
+// that branch instead, and keep their version. Those pinned with a "commit:" or "tag:"
+// prefix are left alone, since those never move. Repos with a version
+// constraint are pinned to their highest tag within it instead, whatever
+// they're pinned to, see Pin.Constraint. If root is
+// non-empty, only the repo with that root is updated. The logger reports
+// which repos changed revision. If progress is non-nil, it receives a single
+// line summarizing the progress of all clones. If gopath is non-empty, its
+// workspaces are searched for existing checkouts of the new revisions before
+// cloning.
+func Update(dir, cacheDir, root, gopath string, progress io.Writer, resolverOpts ResolverOptions, logger log.Logger) ([]Pin, error) {
+	c, err := newCache(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	if progress != nil {
+		ctx = withProgress(ctx, newProgress(progress))
+	}
+	r, err := loggingResolver(resolverOpts, logger)
+	if err != nil {
+		return nil, err
+	}
+	return updateManifest(ctx, c, dir, root, getOptions{logger: logger, retry: resolverOpts.retryPolicy(), gopath: gopath, proxy: proxyFromEnv(), resolver: r})
+}
+
+func updateManifest(ctx context.Context, c *cache, dir, root string, opts getOptions) ([]Pin, error) {
+	filename := filepath.Join(dir, ManifestFile)
+	m, err := readManifestFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	pins := m.Packages
+	if pins == nil {
+		return nil, errors.Errorf("no manifest found at %s", filename)
+	}
+	m.configure(&opts)
+
+	var toUpdate []int
+	for i, p := range pins {
+		if root == "" || p.Root == root {
+			toUpdate = append(toUpdate, i)
+		}
+	}
+	if len(toUpdate) == 0 {
+		return nil, errors.Errorf("repo %s isn't pinned in %s", root, filename)
+	}
+
+	updated := make([]Pin, len(pins))
+	copy(updated, pins)
+
+	var toFetch []int
+	for _, i := range toUpdate {
+		if refType, _ := parseVersion(pins[i].Version); (refType != refCommit && refType != refTag) || pins[i].Constraint != "" {
+			toFetch = append(toFetch, i)
+		}
+	}
+
+	// The latest revisions are looked up concurrently, but repos are
+	// vendored one at a time, parents before nested repos, since
+	// re-vendoring a parent removes the copies of repos nested below it.
+	prog := progressFrom(ctx)
+	prog.expect(len(toFetch))
+	versions := make([]string, len(pins))
+	group, gctx := errgroup.WithContext(ctx)
+	for _, i := range toFetch {
+		i := i
+		group.Go(func() error {
+			p := pins[i]
+			if p.Constraint != "" {
+				tag, err := constrainedTag(gctx, c, p.meta(), p.Constraint, opts.retry)
+				if err != nil {
+					return errors.Wrapf(err, "determining latest tag of %s", p.Root)
+				}
+				versions[i] = refTag + ":" + tag
+				return nil
+			}
+			if refType, _ := parseVersion(p.Version); refType == refBranch || refType == refTrack {
+				// The branch is checked out when the repo is vendored.
+				if err := fetchRepo(gctx, c, p.meta(), opts.retry); err != nil {
+					return errors.Wrapf(err, "fetching %s", p.Root)
+				}
+				versions[i] = p.Version
+				return nil
+			}
+			version, err := headVersion(gctx, c, p.meta(), opts.retry)
+			if err != nil {
+				return errors.Wrapf(err, "determining latest revision of %s", p.Root)
+			}
+			versions[i] = version
+			return nil
+		})
+	}
+	err = group.Wait()
+	prog.finish()
+	if err != nil {
+		return nil, err
+	}
+
+	order := make([]int, len(pins))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return pins[order[i]].Root < pins[order[j]].Root })
+
+	roots := pinRoots(filepath.Join(dir, "vendor"), pins)
+	var revendored []string
+	for _, i := range order {
+		p := &updated[i]
+		version := versions[i]
+		if version == "" {
+			// Repos that aren't being updated are only re-vendored, at
+			// their pinned version, if a parent's copy replaced theirs.
+			nested := false
+			for _, parent := range revendored {
+				nested = nested || hasPathPrefix(p.Root, parent)
+			}
+			if !nested {
+				continue
+			}
+			version = p.Version
+		}
+		meta := p.meta()
+		vendored, err := revendor(ctx, c, dir, meta, version, roots, opts)
+		if err != nil {
+			return nil, err
+		}
+		revendored = append(revendored, p.Root)
+		p.setVendored(version, vendored)
+	}
+
+	if opts.logger != nil {
+		for _, i := range toUpdate {
+			old, p := pins[i], updated[i]
+			from, to := old.Version, p.Version
+			switch refType, _ := parseVersion(p.Version); {
+			case p.Constraint != "":
+			case refType == refCommit, refType == refTag:
+				opts.logger.Infof("%s: skipped, pinned to %s", p.Root, p.Version)
+				continue
+			case refType == refBranch, refType == refTrack:
+				from, to = old.Revision, p.Revision
+			}
+			if from != to {
+				opts.logger.Infof("%s: updated %s -> %s", p.Root, from, to)
+			} else {
+				opts.logger.Infof("%s: unchanged at %s", p.Root, to)
+			}
+		}
+	}
+
+	if err := writeManifest(filename, updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
@@ -0,0 +1,287 @@
+package imports
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUpdateManifest(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		fooDir, barDir := filepath.Join(dir, "foo"), filepath.Join(dir, "bar")
+		oldFoo := gitRepo(t, fooDir, []file{{"foo.go", "package foo"}})
+		bar := gitRepo(t, barDir, []file{{"bar.go", "package bar"}})
+
+		// Add a second commit to foo after it was pinned.
+		writeFiles(t, fooDir, []file{{"new.go", "package foo"}})
+		var newFoo string
+		for _, args := range [][]string{
+			{"add", "-A"},
+			{"-c", "user.name=got", "-c", "user.email=got@example.com", "commit", "-m", "second commit"},
+			{"rev-parse", "HEAD"},
+		} {
+			cmd := exec.Command("git", args...)
+			cmd.Dir = fooDir
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("git %v: %v: %s", args, err, out)
+			}
+			newFoo = strings.TrimSpace(string(out))
+		}
+
+		project := filepath.Join(dir, "project")
+		if err := os.Mkdir(project, 0755); err != nil {
+			t.Fatal(err)
+		}
+		pins := []Pin{
+			{Root: "example.com/bar", Remote: "file://" + filepath.ToSlash(barDir), VCS: "git", Version: bar},
+			{Root: "example.com/foo", Remote: "file://" + filepath.ToSlash(fooDir), VCS: "git", Version: oldFoo},
+		}
+		if err := writeManifest(filepath.Join(project, ManifestFile), pins); err != nil {
+			t.Fatal(err)
+		}
+
+		// Updating a single repo leaves the others alone.
+		if _, err := updateManifest(context.Background(), c, project, "example.com/bar", getOptions{retry: backoff{}}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(project, "vendor", "example.com", "foo")); !os.IsNotExist(err) {
+			t.Errorf("expected foo not to be vendored when only updating bar")
+		}
+
+		l := new(testLogger)
+		got, err := updateManifest(context.Background(), c, project, "", getOptions{retry: backoff{}, logger: l})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []Pin{pins[0], pins[1]}
+		want[0].Files = []string{"bar.go"}
+		want[0].Hash = vendoredHash(t, project, want[0].Root, want[0].Files)
+		want[1].Version = newFoo
+		want[1].Files = []string{"foo.go", "new.go"}
+		want[1].Hash = vendoredHash(t, project, want[1].Root, want[1].Files)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected pins %#v, got %#v", want, got)
+		}
+		compareFiles(t, filepath.Join(project, "vendor", "example.com", "foo"), []file{
+			{"foo.go", "package foo"},
+			{"new.go", "package foo"},
+		})
+
+		wantMsgs := []string{
+			fmt.Sprintf("example.com/bar: unchanged at %s", bar),
+			fmt.Sprintf("example.com/foo: updated %s -> %s", oldFoo, newFoo),
+		}
+		if msgs := l.messages("info"); !reflect.DeepEqual(msgs, wantMsgs) {
+			t.Errorf("expected messages %q, got %q", wantMsgs, msgs)
+		}
+
+		if _, err := updateManifest(context.Background(), c, project, "example.com/baz", getOptions{retry: backoff{}}); err == nil {
+			t.Errorf("expected updating an unpinned repo to fail")
+		}
+	})
+}
+
+func TestUpdateManifestNestedRoot(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		fooDir, barDir := filepath.Join(dir, "foo"), filepath.Join(dir, "bar")
+		foo := gitRepo(t, fooDir, []file{
+			{"bar", ""},
+			{"foo.go", "package foo"},
+			{"bar/old.go", "package bar"},
+		})
+		bar := gitRepo(t, barDir, []file{{"bar.go", "package bar"}})
+
+		project := filepath.Join(dir, "project")
+		if err := os.Mkdir(project, 0755); err != nil {
+			t.Fatal(err)
+		}
+		pins := []Pin{
+			{Root: "example.com/foo", Remote: "file://" + filepath.ToSlash(fooDir), VCS: "git", Version: foo},
+			{Root: "example.com/foo/bar", Remote: "file://" + filepath.ToSlash(barDir), VCS: "git", Version: bar},
+		}
+		if err := writeManifest(filepath.Join(project, ManifestFile), pins); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := vendorManifest(context.Background(), c, project, getOptions{retry: backoff{}}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Updating the parent replaces its copy, and with it the nested
+		// repo's, which has to be vendored again.
+		got, err := updateManifest(context.Background(), c, project, "example.com/foo", getOptions{retry: backoff{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []Pin{pins[0], pins[1]}
+		want[0].Files = []string{"foo.go"}
+		want[0].Hash = vendoredHash(t, project, want[0].Root, want[0].Files)
+		want[1].Files = []string{"bar.go"}
+		want[1].Hash = vendoredHash(t, project, want[1].Root, want[1].Files)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected pins %#v, got %#v", want, got)
+		}
+		compareFiles(t, filepath.Join(project, "vendor", "example.com", "foo"), []file{
+			{"bar", ""},
+			{"foo.go", "package foo"},
+			{"bar/bar.go", "package bar"},
+		})
+	})
+}
+
+func TestUpdateManifestRefTypes(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		fooDir := filepath.Join(dir, "foo")
+		gitRepo(t, fooDir, []file{{"foo.go", "package foo"}})
+		git := func(args ...string) string {
+			cmd := exec.Command("git", append([]string{"-c", "user.name=got", "-c", "user.email=got@example.com"}, args...)...)
+			cmd.Dir = fooDir
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("git %v: %v: %s", args, err, out)
+			}
+			return strings.TrimSpace(string(out))
+		}
+		git("tag", "v1.0.0")
+		git("checkout", "-q", "-b", "dev")
+		writeFiles(t, fooDir, []file{{"dev.go", "package foo"}})
+		git("add", "-A")
+		git("commit", "-q", "-m", "dev commit")
+		oldDev := git("rev-parse", "HEAD")
+
+		project := filepath.Join(dir, "project")
+		if err := os.Mkdir(project, 0755); err != nil {
+			t.Fatal(err)
+		}
+		remote := "file://" + filepath.ToSlash(fooDir)
+		pins := []Pin{
+			{Root: "example.com/branch", Remote: remote, VCS: "git", Version: "branch:dev"},
+			{Root: "example.com/tag", Remote: remote, VCS: "git", Version: "tag:v1.0.0"},
+		}
+		if err := writeManifest(filepath.Join(project, ManifestFile), pins); err != nil {
+			t.Fatal(err)
+		}
+		if pins, err = vendorManifest(context.Background(), c, project, getOptions{retry: backoff{}}); err != nil {
+			t.Fatal(err)
+		}
+		if pins[0].Revision != oldDev {
+			t.Fatalf("expected branch to be vendored at %s, got %s", oldDev, pins[0].Revision)
+		}
+
+		writeFiles(t, fooDir, []file{{"new.go", "package foo"}})
+		git("add", "-A")
+		git("commit", "-q", "-m", "second dev commit")
+		newDev := git("rev-parse", "HEAD")
+
+		l := new(testLogger)
+		got, err := updateManifest(context.Background(), c, project, "", getOptions{retry: backoff{}, logger: l})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []Pin{pins[0], pins[1]}
+		want[0].Revision = newDev
+		want[0].Files = []string{"dev.go", "foo.go", "new.go"}
+		want[0].Hash = vendoredHash(t, project, want[0].Root, want[0].Files)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected pins %#v, got %#v", want, got)
+		}
+		compareFiles(t, filepath.Join(project, "vendor", "example.com", "tag"), []file{{"foo.go", "package foo"}})
+
+		wantMsgs := []string{
+			fmt.Sprintf("example.com/branch: updated %s -> %s", oldDev, newDev),
+			"example.com/tag: skipped, pinned to tag:v1.0.0",
+		}
+		if msgs := l.messages("info"); !reflect.DeepEqual(msgs, wantMsgs) {
+			t.Errorf("expected messages %q, got %q", wantMsgs, msgs)
+		}
+	})
+}
+
+func TestUpdateManifestConstraint(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		fooDir := filepath.Join(dir, "foo")
+		gitRepo(t, fooDir, []file{{"foo.go", "package foo"}})
+		git := func(args ...string) {
+			cmd := exec.Command("git", append([]string{"-c", "user.name=got", "-c", "user.email=got@example.com"}, args...)...)
+			cmd.Dir = fooDir
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("git %v: %v: %s", args, err, out)
+			}
+		}
+		git("tag", "v1.2.0")
+		for _, tag := range []string{"v1.3.0", "v2.0.0"} {
+			writeFiles(t, fooDir, []file{{tag + ".go", "package foo"}})
+			git("add", "-A")
+			git("commit", "-q", "-m", tag)
+			git("tag", tag)
+		}
+
+		project := filepath.Join(dir, "project")
+		if err := os.Mkdir(project, 0755); err != nil {
+			t.Fatal(err)
+		}
+		remote := "file://" + filepath.ToSlash(fooDir)
+		pins := []Pin{
+			{Root: "example.com/foo", Remote: remote, VCS: "git", Version: "tag:v1.2.0", Constraint: "^1.2.0"},
+		}
+		if err := writeManifest(filepath.Join(project, ManifestFile), pins); err != nil {
+			t.Fatal(err)
+		}
+
+		l := new(testLogger)
+		got, err := updateManifest(context.Background(), c, project, "", getOptions{retry: backoff{}, logger: l})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0].Version != "tag:v1.3.0" || got[0].Constraint != "^1.2.0" {
+			t.Fatalf("expected foo to be updated to tag:v1.3.0 within its constraint, got %#v", got)
+		}
+		compareFiles(t, filepath.Join(project, "vendor", "example.com", "foo"), []file{
+			{"foo.go", "package foo"},
+			{"v1.3.0.go", "package foo"},
+		})
+		wantMsgs := []string{"example.com/foo: updated tag:v1.2.0 -> tag:v1.3.0"}
+		if msgs := l.messages("info"); !reflect.DeepEqual(msgs, wantMsgs) {
+			t.Errorf("expected messages %q, got %q", wantMsgs, msgs)
+		}
+
+		// No tag satisfies a constraint excluding every release.
+		pins[0].Constraint = "^3.0.0"
+		if err := writeManifest(filepath.Join(project, ManifestFile), pins); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := updateManifest(context.Background(), c, project, "", getOptions{retry: backoff{}}); err == nil || !strings.Contains(err.Error(), "no tag matches constraint ^3.0.0") {
+			t.Errorf("expected an unsatisfiable constraint to fail, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,323 @@
+package imports
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ericchiang/got/log"
+)
+
+// VendorOptions configures a vendor run.
+type VendorOptions struct {
+	// GOPATH, if non-empty, lists workspaces that are searched for
+	// existing checkouts of repos at their pinned revision, which are
+	// copied instead of cloning.
+	GOPATH string
+	// Preflight checks that the remotes of all repos that need to be
+	// vendored are reachable before any of them is fetched, reporting all
+	// unreachable ones together.
+	Preflight bool
+	// SkipExisting only compares the files of existing vendored copies to
+	// the ones recorded in the manifest, without hashing their contents.
+	// It speeds up runs over large vendor directories, but doesn't notice
+	// modified files.
+	SkipExisting bool
+	// Manifest, if non-empty, is a manifest in another format, such as
+	// "Godeps/Godeps.json", whose pins replace those of got.json before
+	// vendoring. See relock.
+	Manifest string
+	// Frozen vendors every repo at the revision recorded in the manifest
+	// when it was last vendored, from the cache only. Nothing is fetched,
+	// and the run fails if a repo was never vendored or its revision isn't
+	// cached.
+	Frozen bool
+	// Limits bound the clones of the run.
+	Limits CloneLimits
+}
+
+// Vendor copies every repo pinned by the manifest of the project in dir into
+// its vendor directory. Repos whose vendored files already match the files
+// and tree hash recorded in the manifest are left alone, so interrupted,
+// partially deleted or modified copies are vendored again without re-copying
+// everything.
+//
+// If GOPROXY is set, repos are downloaded from the module proxies it lists,
+// falling back to their VCS for versions the proxies don't have. Requests to
+// the proxies are made as configured by resolverOpts.
+//
+// Repos pinned to a branch with a "track:" prefix are fetched on every run,
+// and vendored again if the branch moved. The manifest keeps the branch and
+// records the revision it was vendored at.
+//
+// The manifest is updated as soon as each repo is vendored, so a run that's
+// interrupted or fails partway resumes where it left off.
+//
+// Repos whose clones exceed vendorOpts.Limits are skipped, left without
+// recorded files so the next run tries them again, and reported once every
+// other repo has been vendored. If the limits are strict, the run fails
+// instead.
+func Vendor(dir, cacheDir string, vendorOpts VendorOptions, resolverOpts ResolverOptions, logger log.Logger) ([]Pin, error) {
+	if vendorOpts.Frozen && vendorOpts.Preflight {
+		return nil, errors.New("frozen runs don't access remotes, so they can't be checked")
+	}
+	if vendorOpts.Frozen && vendorOpts.Manifest != "" {
+		return nil, errors.New("frozen runs only vendor the revisions recorded in got.json, not another manifest")
+	}
+	c, err := newCache(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	r, err := loggingResolver(resolverOpts, logger)
+	if err != nil {
+		return nil, err
+	}
+	opts := getOptions{
+		logger:       logger,
+		retry:        resolverOpts.retryPolicy(),
+		gopath:       vendorOpts.GOPATH,
+		preflight:    vendorOpts.Preflight,
+		skipExisting: vendorOpts.SkipExisting,
+		frozen:       vendorOpts.Frozen,
+		proxy:        proxyFromEnv(),
+		resolver:     r,
+		limits:       vendorOpts.Limits,
+	}
+	if vendorOpts.Manifest != "" {
+		deprecationNotices.warn(logger, vendorOpts.Manifest)
+		if err := relock(r, dir, vendorOpts.Manifest); err != nil {
+			return nil, err
+		}
+	}
+	return vendorManifest(context.Background(), c, dir, opts)
+}
+
+// relock replaces the pins of the manifest of the project in dir with those of
+// another manifest, which may be in any format parseManifest supports. Only
+// packages of repos that aren't pinned yet are resolved, those of pinned repos
+// reuse the remote of the pin. Repos pinned to the same version as before keep
+// their recorded files and revision, so only those whose version changed, or
+// that weren't pinned, are vendored again.
+func relock(r pkgResolver, dir, filename string) error {
+	lockfile := filepath.Join(dir, ManifestFile)
+	locked, err := readManifest(lockfile)
+	if err != nil {
+		return err
+	}
+	pins, err := resolveManifest(lockedResolver{locked, r}, filename, replaceTarget)
+	if err != nil {
+		return err
+	}
+	byRoot := map[string]Pin{}
+	for _, p := range locked {
+		byRoot[p.Root] = p
+	}
+	for i, p := range pins {
+		l, ok := byRoot[p.Root]
+		if ok && l.Remote == p.Remote && l.VCS == p.VCS && l.Subdir == p.Subdir && l.Version == p.Version {
+			l.Constraint = p.Constraint
+			pins[i] = l
+		}
+	}
+	return writeManifest(lockfile, pins)
+}
+
+// lockedResolver resolves packages of repos pinned by got.json to the pinned
+// repo without any lookups, deferring to next for other packages.
+type lockedResolver struct {
+	pins []Pin
+	next pkgResolver
+}
+
+func (r lockedResolver) resolve(ctx context.Context, pkg string) (*pkgMeta, error) {
+	var locked *Pin
+	for i, p := range r.pins {
+		if hasPathPrefix(pkg, p.Root) && (locked == nil || len(p.Root) > len(locked.Root)) {
+			locked = &r.pins[i]
+		}
+	}
+	if locked == nil {
+		return r.next.resolve(ctx, pkg)
+	}
+	return locked.meta(), nil
+}
+
+func vendorManifest(ctx context.Context, c *cache, dir string, opts getOptions) ([]Pin, error) {
+	filename := filepath.Join(dir, ManifestFile)
+	m, err := readManifestFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	pins := m.Packages
+	if pins == nil {
+		return nil, errors.Errorf("no manifest found at %s", filename)
+	}
+	m.configure(&opts)
+	if opts.limits.enabled() {
+		ctx = withCloneLimits(ctx, opts.limits)
+	}
+
+	vendor := filepath.Join(dir, "vendor")
+	roots := pinRoots(vendor, pins)
+
+	if opts.frozen {
+		var unlocked []string
+		for _, p := range pins {
+			if len(p.Files) == 0 {
+				unlocked = append(unlocked, p.Root)
+			}
+		}
+		if len(unlocked) > 0 {
+			sort.Strings(unlocked)
+			return nil, errors.Errorf("no vendored revision recorded for %s, vendor without freezing first", strings.Join(unlocked, ", "))
+		}
+	}
+
+	vendored := make([]Pin, len(pins))
+	copy(vendored, pins)
+
+	// Repos are vendored one at a time, parents before nested repos, since
+	// re-vendoring a parent removes the copies of repos nested below it.
+	sort.Slice(vendored, func(i, j int) bool { return vendored[i].Root < vendored[j].Root })
+	if opts.preflight {
+		// Repos nested below an incomplete repo are removed when it's
+		// re-vendored, so they're checked too.
+		var metas []*pkgMeta
+		var parents []string
+		for _, p := range vendored {
+			ok, err := isComplete(vendor, p, roots, !opts.skipExisting)
+			if err != nil {
+				return nil, errors.Wrapf(err, "checking vendored files of %s", p.Root)
+			}
+			nested := false
+			for _, parent := range parents {
+				nested = nested || hasPathPrefix(p.Root, parent)
+			}
+			// Tracked branches may have moved.
+			if refType, _ := parseVersion(p.Version); ok && !nested && refType != refTrack {
+				continue
+			}
+			parents = append(parents, p.Root)
+			metas = append(metas, p.meta())
+		}
+		if err := preflight(ctx, metas); err != nil {
+			return nil, err
+		}
+	}
+
+	var skipped []*limitError
+	for i := range vendored {
+		p := &vendored[i]
+		ok, err := isComplete(vendor, *p, roots, !opts.skipExisting)
+		if err != nil {
+			return nil, errors.Wrapf(err, "checking vendored files of %s", p.Root)
+		}
+		if refType, _ := parseVersion(p.Version); ok && refType == refTrack && !opts.frozen {
+			tip, err := tipRevision(ctx, c, p.meta(), p.Version, opts.retry)
+			if err != nil {
+				return nil, errors.Wrapf(err, "determining latest revision of %s", p.Root)
+			}
+			ok = tip == p.Revision
+		}
+		if ok {
+			if opts.logger != nil {
+				opts.logger.Debugf("%s: already vendored", p.Root)
+			}
+			continue
+		}
+		if opts.logger != nil {
+			opts.logger.Infof("%s: vendoring %s", p.Root, p.Version)
+		}
+		version := p.Version
+		if opts.frozen {
+			version = p.lockedVersion()
+		}
+		copied, err := revendor(ctx, c, dir, p.meta(), version, roots, opts)
+		if err != nil {
+			if e, ok := errors.Cause(err).(*limitError); ok && !opts.limits.Strict {
+				// The vendored copy is gone, so make sure the next run
+				// vendors it again.
+				p.Files = nil
+				p.Hash = ""
+				skipped = append(skipped, e)
+				continue
+			}
+			return nil, err
+		}
+		p.setVendored(p.Version, copied)
+		if err := writeManifest(filename, vendored); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeManifest(filename, vendored); err != nil {
+		return nil, err
+	}
+	if opts.logger != nil {
+		for _, e := range skipped {
+			opts.logger.Errorf("%s: skipped, %s", e.root, e.reason)
+		}
+	}
+	return vendored, nil
+}
+
+// pinRoots returns the vendor paths of the pinned repos. Repos can be nested,
+// e.g. "example.com/foo" and "example.com/foo/bar", so other repos are
+// skipped when listing a repo's vendored files, see otherRoots.
+func pinRoots(vendor string, pins []Pin) map[string]bool {
+	roots := map[string]bool{}
+	for _, p := range pins {
+		roots[vendorPath(vendor, &pkgMeta{Root: p.Root})] = true
+	}
+	return roots
+}
+
+// otherRoots returns the vendor paths in roots other than to, which are
+// skipped when listing the files vendored at to.
+func otherRoots(roots map[string]bool, to string) map[string]bool {
+	skip := map[string]bool{}
+	for root := range roots {
+		if root != to {
+			skip[root] = true
+		}
+	}
+	return skip
+}
+
+// isComplete reports whether the vendored copy of a repo holds exactly the
+// files recorded for its pin. A pin without recorded files is never complete.
+// If verify is true, the contents of the files must also match the tree hash
+// recorded for the pin, if any.
+func isComplete(vendor string, p Pin, roots map[string]bool, verify bool) (bool, error) {
+	if len(p.Files) == 0 {
+		return false, nil
+	}
+	to := vendorPath(vendor, &pkgMeta{Root: p.Root})
+	if _, err := os.Stat(to); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	files, err := listFiles(to, otherRoots(roots, to))
+	if err != nil {
+		return false, err
+	}
+	if !reflect.DeepEqual(files, p.Files) {
+		return false, nil
+	}
+	if !verify || p.Hash == "" {
+		return true, nil
+	}
+	hash, err := treeHash(to, files)
+	if err != nil {
+		return false, err
+	}
+	return hash == p.Hash, nil
+}
@@ -0,0 +1,725 @@
+package imports
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestVendorManifestIncomplete(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		files := []file{
+			{"foo.go", "package foo"},
+			{"bar.go", "package foo"},
+		}
+		remote := filepath.Join(dir, "remote")
+		rev := gitRepo(t, remote, files)
+
+		project := filepath.Join(dir, "project")
+		if err := os.Mkdir(project, 0755); err != nil {
+			t.Fatal(err)
+		}
+		pin := Pin{Root: "example.com/foo", Remote: "file://" + filepath.ToSlash(remote), VCS: "git", Version: rev}
+		if err := writeManifest(filepath.Join(project, ManifestFile), []Pin{pin}); err != nil {
+			t.Fatal(err)
+		}
+		opts := getOptions{retry: backoff{}}
+
+		// The first run has no record of the vendored files and always
+		// vendors the repo.
+		pins, err := vendorManifest(context.Background(), c, project, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"bar.go", "foo.go"}; len(pins) != 1 || !reflect.DeepEqual(pins[0].Files, want) {
+			t.Fatalf("expected files %q to be recorded, got %#v", want, pins)
+		}
+
+		tests := []struct {
+			name      string
+			remove    string
+			wantFetch bool
+		}{
+			{"complete", "", false},
+			{"missing file", "bar.go", true},
+			{"missing directory", ".", true},
+		}
+		to := filepath.Join(project, "vendor", "example.com", "foo")
+		for _, test := range tests {
+			if test.remove != "" {
+				if err := os.RemoveAll(filepath.Join(to, test.remove)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			l := new(testLogger)
+			opts.logger = l
+			if _, err := vendorManifest(context.Background(), c, project, opts); err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			if fetched := len(l.messages("info")) > 0; fetched != test.wantFetch {
+				t.Errorf("%s: expected re-vendor=%t, got %t", test.name, test.wantFetch, fetched)
+			}
+			compareFiles(t, to, files)
+		}
+	})
+}
+
+func TestVendorManifestSkipExisting(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		fooFiles := []file{{"foo.go", "package foo"}}
+		barFiles := []file{{"bar.go", "package bar"}}
+		fooRemote, barRemote := filepath.Join(dir, "foo"), filepath.Join(dir, "bar")
+		foo := gitRepo(t, fooRemote, fooFiles)
+		bar := gitRepo(t, barRemote, barFiles)
+
+		project := filepath.Join(dir, "project")
+		if err := os.Mkdir(project, 0755); err != nil {
+			t.Fatal(err)
+		}
+		pins := []Pin{
+			{Root: "example.com/bar", Remote: "file://" + filepath.ToSlash(barRemote), VCS: "git", Version: bar},
+			{Root: "example.com/foo", Remote: "file://" + filepath.ToSlash(fooRemote), VCS: "git", Version: foo},
+		}
+		if err := writeManifest(filepath.Join(project, ManifestFile), pins); err != nil {
+			t.Fatal(err)
+		}
+		if pins, err = vendorManifest(context.Background(), c, project, getOptions{retry: backoff{}}); err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range pins {
+			if want := vendoredHash(t, project, p.Root, p.Files); p.Hash != want {
+				t.Errorf("%s: expected hash %s to be recorded, got %q", p.Root, want, p.Hash)
+			}
+		}
+
+		vendor := filepath.Join(project, "vendor", "example.com")
+		modified := []file{{"foo.go", "package foo // modified"}}
+		tests := []struct {
+			name         string
+			skipExisting bool
+			wantVendored []string
+			wantFoo      []file
+		}{
+			// The modified copy is only vendored again if its contents
+			// are checked.
+			{"skip existing", true, []string{"example.com/bar: vendoring " + bar}, modified},
+			{"verify", false, []string{"example.com/bar: vendoring " + bar, "example.com/foo: vendoring " + foo}, fooFiles},
+		}
+		for _, test := range tests {
+			if err := os.RemoveAll(filepath.Join(vendor, "bar")); err != nil {
+				t.Fatal(err)
+			}
+			writeFiles(t, filepath.Join(vendor, "foo"), modified)
+
+			l := new(testLogger)
+			opts := getOptions{retry: backoff{}, logger: l, skipExisting: test.skipExisting}
+			if _, err := vendorManifest(context.Background(), c, project, opts); err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			if got := l.messages("info"); !reflect.DeepEqual(got, test.wantVendored) {
+				t.Errorf("%s: expected messages %q, got %q", test.name, test.wantVendored, got)
+			}
+			compareFiles(t, filepath.Join(vendor, "bar"), barFiles)
+			compareFiles(t, filepath.Join(vendor, "foo"), test.wantFoo)
+		}
+	})
+}
+
+func TestVendorManifestResume(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		project := filepath.Join(dir, "project")
+		if err := os.Mkdir(project, 0755); err != nil {
+			t.Fatal(err)
+		}
+		var pins []Pin
+		revs := map[string]string{}
+		for _, name := range []string{"a", "b", "c", "d"} {
+			remote := filepath.Join(dir, name)
+			// The third repo doesn't exist yet, interrupting the first run.
+			if name != "c" {
+				revs[name] = gitRepo(t, remote, []file{{name + ".go", "package " + name}})
+			}
+			pins = append(pins, Pin{
+				Root:    "example.com/" + name,
+				Remote:  "file://" + filepath.ToSlash(remote),
+				VCS:     "git",
+				Version: "branch:master",
+			})
+		}
+		filename := filepath.Join(project, ManifestFile)
+		if err := writeManifest(filename, pins); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := vendorManifest(context.Background(), c, project, getOptions{retry: backoff{}}); err == nil {
+			t.Fatal("expected vendoring a missing repo to fail")
+		}
+		// The manifest records the two repos vendored before the failure.
+		partial, err := readManifest(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, p := range partial {
+			vendored := i < 2
+			if got := len(p.Files) > 0 && p.Hash != ""; got != vendored {
+				t.Errorf("%s: expected vendored files to be recorded=%t, got %#v", p.Root, vendored, p)
+			}
+		}
+
+		revs["c"] = gitRepo(t, filepath.Join(dir, "c"), []file{{"c.go", "package c"}})
+		l := new(testLogger)
+		got, err := vendorManifest(context.Background(), c, project, getOptions{retry: backoff{}, logger: l})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"example.com/c: vendoring branch:master", "example.com/d: vendoring branch:master"}
+		if msgs := l.messages("info"); !reflect.DeepEqual(msgs, want) {
+			t.Errorf("expected only the remaining repos to be vendored %q, got %q", want, msgs)
+		}
+		for _, p := range got {
+			name := path.Base(p.Root)
+			if p.Revision != revs[name] {
+				t.Errorf("%s: expected revision %s, got %s", p.Root, revs[name], p.Revision)
+			}
+			compareFiles(t, filepath.Join(project, "vendor", "example.com", name), []file{{name + ".go", "package " + name}})
+		}
+	})
+}
+
+func TestVendorManifestFrozen(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		files := []file{{"foo.go", "package foo"}}
+		remote := filepath.Join(dir, "remote")
+		gitRepo(t, remote, files)
+
+		project := filepath.Join(dir, "project")
+		if err := os.Mkdir(project, 0755); err != nil {
+			t.Fatal(err)
+		}
+		pin := Pin{Root: "example.com/foo", Remote: "file://" + filepath.ToSlash(remote), VCS: "git", Version: "branch:master"}
+		filename := filepath.Join(project, ManifestFile)
+		if err := writeManifest(filename, []Pin{pin}); err != nil {
+			t.Fatal(err)
+		}
+		locked, err := vendorManifest(context.Background(), c, project, getOptions{retry: backoff{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Nothing may be fetched, from the remote or a module proxy.
+		if err := os.RemoveAll(remote); err != nil {
+			t.Fatal(err)
+		}
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Errorf("unexpected request to %s", r.URL)
+			http.NotFound(w, r)
+		}))
+		defer proxy.Close()
+		vendor := filepath.Join(project, "vendor")
+		if err := os.RemoveAll(vendor); err != nil {
+			t.Fatal(err)
+		}
+		opts := getOptions{retry: backoff{}, frozen: true, proxy: proxy.URL}
+		got, err := vendorManifest(context.Background(), c, project, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, locked) {
+			t.Errorf("expected pins %#v, got %#v", locked, got)
+		}
+		compareFiles(t, filepath.Join(vendor, "example.com", "foo"), files)
+
+		// A cold cache fails.
+		cold, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(cold)
+		if err := os.RemoveAll(vendor); err != nil {
+			t.Fatal(err)
+		}
+		_, err = vendorManifest(context.Background(), &cache{dirname: cold}, project, opts)
+		if err == nil || !strings.Contains(err.Error(), "isn't cached") {
+			t.Errorf("expected a frozen run with a cold cache to fail, got %v", err)
+		}
+
+		// So does a repo that was never vendored, before anything is
+		// vendored.
+		unlocked := Pin{Root: "example.com/bar", Remote: "https://example.com/bar", VCS: "git", Version: "v1.0.0"}
+		if err := writeManifest(filename, append(locked, unlocked)); err != nil {
+			t.Fatal(err)
+		}
+		_, err = vendorManifest(context.Background(), c, project, opts)
+		if err == nil || !strings.Contains(err.Error(), "example.com/bar") {
+			t.Errorf("expected an error naming the repo without a vendored revision, got %v", err)
+		}
+		if _, err := os.Stat(vendor); !os.IsNotExist(err) {
+			t.Errorf("expected nothing to be vendored, got %v", err)
+		}
+	})
+}
+
+func TestRelock(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		fooDir, barDir := filepath.Join(dir, "foo"), filepath.Join(dir, "bar")
+		oldFoo := gitRepo(t, fooDir, []file{{"foo.go", "package foo"}})
+		bar := gitRepo(t, barDir, []file{{"bar.go", "package bar"}})
+		writeFiles(t, fooDir, []file{{"new.go", "package foo"}})
+		for _, args := range [][]string{{"add", "-A"}, {"commit", "-q", "-m", "second commit"}} {
+			cmd := exec.Command("git", append([]string{"-c", "user.name=got", "-c", "user.email=got@example.com"}, args...)...)
+			cmd.Dir = fooDir
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("git %v: %v: %s", args, err, out)
+			}
+		}
+		out, err := exec.Command("git", "-C", fooDir, "rev-parse", "HEAD").Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		newFoo := strings.TrimSpace(string(out))
+
+		project := filepath.Join(dir, "project")
+		writeFiles(t, dir, []file{{"project", ""}, {"project/Godeps", ""}})
+		godeps := filepath.Join(project, "Godeps", "Godeps.json")
+		writeGodeps := func(foo string) {
+			writeFiles(t, project, []file{{"Godeps/Godeps.json", `{
+	"ImportPath": "example.com/project",
+	"Deps": [
+		{"ImportPath": "example.com/bar", "Rev": "` + bar + `"},
+		{"ImportPath": "example.com/foo/pkg", "Rev": "` + foo + `"}
+	]
+}`}})
+		}
+		remotes := map[string]string{"example.com/foo": fooDir, "example.com/bar": barDir}
+		var (
+			mu      sync.Mutex
+			lookups []string
+		)
+		r := resolverFunc(func(ctx context.Context, pkg string) (*pkgMeta, error) {
+			mu.Lock()
+			lookups = append(lookups, pkg)
+			mu.Unlock()
+			for root, remote := range remotes {
+				if hasPathPrefix(pkg, root) {
+					return &pkgMeta{Root: root, VCS: "git", Remote: "file://" + filepath.ToSlash(remote)}, nil
+				}
+			}
+			return nil, errors.Errorf("unknown package %s", pkg)
+		})
+
+		writeGodeps(oldFoo)
+		if err := relock(r, project, godeps); err != nil {
+			t.Fatal(err)
+		}
+		if len(lookups) != 2 {
+			t.Errorf("expected both repos to be resolved, got %q", lookups)
+		}
+		if _, err := vendorManifest(context.Background(), c, project, getOptions{retry: backoff{}}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Only changing a version doesn't resolve anything, and only
+		// vendors the changed repo again.
+		lookups = nil
+		writeGodeps(newFoo)
+		if err := relock(r, project, godeps); err != nil {
+			t.Fatal(err)
+		}
+		if len(lookups) != 0 {
+			t.Errorf("expected no lookups, got %q", lookups)
+		}
+		l := new(testLogger)
+		pins, err := vendorManifest(context.Background(), c, project, getOptions{retry: backoff{}, logger: l})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"example.com/foo: vendoring " + newFoo}; !reflect.DeepEqual(l.messages("info"), want) {
+			t.Errorf("expected messages %q, got %q", want, l.messages("info"))
+		}
+		if len(pins) != 2 || pins[1].Version != newFoo {
+			t.Errorf("expected foo to be pinned to %s, got %#v", newFoo, pins)
+		}
+		compareFiles(t, filepath.Join(project, "vendor", "example.com", "foo"), []file{
+			{"foo.go", "package foo"},
+			{"new.go", "package foo"},
+		})
+	})
+}
+
+func TestVendorManifestTrack(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		remote := filepath.Join(dir, "remote")
+		gitRepo(t, remote, []file{{"foo.go", "package foo"}})
+		git := func(args ...string) string {
+			cmd := exec.Command("git", append([]string{"-c", "user.name=got", "-c", "user.email=got@example.com"}, args...)...)
+			cmd.Dir = remote
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("git %v: %v: %s", args, err, out)
+			}
+			return strings.TrimSpace(string(out))
+		}
+		git("checkout", "-q", "-b", "dev")
+		oldDev := git("rev-parse", "HEAD")
+
+		project := filepath.Join(dir, "project")
+		if err := os.Mkdir(project, 0755); err != nil {
+			t.Fatal(err)
+		}
+		pin := Pin{Root: "example.com/foo", Remote: "file://" + filepath.ToSlash(remote), VCS: "git", Version: "track:dev"}
+		if err := writeManifest(filepath.Join(project, ManifestFile), []Pin{pin}); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name     string
+			commit   bool
+			wantMsgs int
+		}{
+			{"first run", false, 1},
+			{"branch unchanged", false, 0},
+			{"branch moved", true, 1},
+		}
+		revision := oldDev
+		for _, test := range tests {
+			if test.commit {
+				writeFiles(t, remote, []file{{"new.go", "package foo"}})
+				git("add", "-A")
+				git("commit", "-q", "-m", "dev commit")
+				revision = git("rev-parse", "HEAD")
+			}
+			l := new(testLogger)
+			pins, err := vendorManifest(context.Background(), c, project, getOptions{retry: backoff{}, logger: l})
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			if got := len(l.messages("info")); got != test.wantMsgs {
+				t.Errorf("%s: expected %d repos to be vendored, got %q", test.name, test.wantMsgs, l.messages("info"))
+			}
+			pinned, err := readManifest(filepath.Join(project, ManifestFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range [][]Pin{pins, pinned} {
+				if len(p) != 1 || p[0].Version != "track:dev" || p[0].Revision != revision {
+					t.Errorf("%s: expected track:dev to be recorded at %s, got %#v", test.name, revision, p)
+				}
+			}
+		}
+		compareFiles(t, filepath.Join(project, "vendor", "example.com", "foo"), []file{
+			{"foo.go", "package foo"},
+			{"new.go", "package foo"},
+		})
+	})
+}
+
+// vendoredHash returns the tree hash of the files vendored for the repo root
+// in project.
+func vendoredHash(t *testing.T, project, root string, files []string) string {
+	hash, err := treeHash(vendorPath(filepath.Join(project, "vendor"), &pkgMeta{Root: root}), files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestVendorManifestExclude(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		remote := filepath.Join(dir, "remote")
+		rev := gitRepo(t, remote, []file{
+			{"foo.go", "package foo"},
+			{"doc.go", "package foo"},
+			{"LICENSE", "license"},
+			{"examples", ""},
+			{"examples/main.go", "package main"},
+			{"sub", ""},
+			{"sub/sub.go", "package sub"},
+			{"sub/examples", ""},
+			{"sub/examples/main.go", "package main"},
+		})
+
+		project := filepath.Join(dir, "project")
+		if err := os.Mkdir(project, 0755); err != nil {
+			t.Fatal(err)
+		}
+		filename := filepath.Join(project, ManifestFile)
+		data := `{
+	"packages": [
+		{"root": "example.com/foo", "remote": "file://` + filepath.ToSlash(remote) + `", "vcs": "git", "version": "` + rev + `"}
+	],
+	"vendor_exclude_patterns": ["examples/", "doc.go"]
+}`
+		if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := vendorManifest(context.Background(), c, project, getOptions{retry: backoff{}}); err != nil {
+			t.Fatal(err)
+		}
+		compareFiles(t, filepath.Join(project, "vendor", "example.com", "foo"), []file{
+			{"foo.go", "package foo"},
+			{"LICENSE", "license"},
+			{"sub", ""},
+			{"sub/sub.go", "package sub"},
+		})
+
+		m, err := readManifestFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"examples/", "doc.go"}; !reflect.DeepEqual(m.VendorExclude, want) {
+			t.Errorf("expected exclude patterns %q to be kept, got %q", want, m.VendorExclude)
+		}
+	})
+}
+
+func TestVendorManifestPackageInfo(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		remote := filepath.Join(dir, "remote")
+		rev := gitRepo(t, remote, []file{
+			{"data", ""},
+			{"sub", ""},
+			{"foo.go", "package foo"},
+			{"data/LICENSE", "license"},
+			{"sub/sub.go", "package sub"},
+		})
+
+		project := filepath.Join(dir, "project")
+		if err := os.Mkdir(project, 0755); err != nil {
+			t.Fatal(err)
+		}
+		pin := Pin{Root: "example.com/foo", Remote: "file://" + filepath.ToSlash(remote), VCS: "git", Version: rev}
+		data, err := json.Marshal(manifest{Packages: []Pin{pin}, WritePackageInfo: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(project, ManifestFile), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := vendorManifest(context.Background(), c, project, getOptions{retry: backoff{}}); err != nil {
+			t.Fatal(err)
+		}
+		info, err := json.MarshalIndent(pin, "", "\t")
+		if err != nil {
+			t.Fatal(err)
+		}
+		compareFiles(t, filepath.Join(project, "vendor", "example.com", "foo"), []file{
+			{"data", ""},
+			{"sub", ""},
+			{"foo.go", "package foo"},
+			{pkgInfoFile, string(info) + "\n"},
+			{"data/LICENSE", "license"},
+			{"sub/sub.go", "package sub"},
+			{"sub/" + pkgInfoFile, string(info) + "\n"},
+		})
+	})
+}
+
+func TestVendorManifestRecordsRevision(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		remote := filepath.Join(dir, "remote")
+		rev := gitRepo(t, remote, []file{{"foo.go", "package foo"}})
+		cmd := exec.Command("git", "tag", "v1.0.0")
+		cmd.Dir = remote
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git tag: %v: %s", err, out)
+		}
+
+		project := filepath.Join(dir, "project")
+		if err := os.Mkdir(project, 0755); err != nil {
+			t.Fatal(err)
+		}
+		pins := []Pin{
+			{Root: "example.com/foo", Remote: "file://" + filepath.ToSlash(remote), VCS: "git", Version: "tag:v1.0.0"},
+			{Root: "example.com/bar", Remote: "file://" + filepath.ToSlash(remote), VCS: "git", Version: rev},
+		}
+		if err := writeManifest(filepath.Join(project, ManifestFile), pins); err != nil {
+			t.Fatal(err)
+		}
+		got, err := vendorManifest(context.Background(), c, project, getOptions{retry: backoff{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		revisions := map[string]string{}
+		for _, p := range got {
+			revisions[p.Root] = p.Revision
+		}
+		want := map[string]string{"example.com/foo": rev, "example.com/bar": ""}
+		if !reflect.DeepEqual(revisions, want) {
+			t.Errorf("expected recorded revisions %v, got %v", want, revisions)
+		}
+	})
+}
+
+func TestVendorManifestPreflight(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		remote := filepath.Join(dir, "remote")
+		rev := gitRepo(t, remote, []file{{"foo.go", "package foo"}})
+		missing := func(name string) string {
+			return "file://" + filepath.ToSlash(filepath.Join(dir, name))
+		}
+
+		project := filepath.Join(dir, "project")
+		if err := os.Mkdir(project, 0755); err != nil {
+			t.Fatal(err)
+		}
+		pins := []Pin{
+			{Root: "example.com/bar", Remote: missing("bar"), VCS: "git", Version: rev},
+			{Root: "example.com/baz", Remote: missing("baz"), VCS: "git", Version: rev},
+			{Root: "example.com/foo", Remote: "file://" + filepath.ToSlash(remote), VCS: "git", Version: rev},
+		}
+		if err := writeManifest(filepath.Join(project, ManifestFile), pins); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = vendorManifest(context.Background(), c, project, getOptions{retry: backoff{}, preflight: true})
+		perr, ok := errors.Cause(err).(*preflightError)
+		if !ok {
+			t.Fatalf("expected a preflight error, got %v", err)
+		}
+		var roots []string
+		for _, r := range perr.repos {
+			roots = append(roots, r.root)
+		}
+		if want := []string{"example.com/bar", "example.com/baz"}; !reflect.DeepEqual(roots, want) {
+			t.Errorf("expected unreachable repos %q, got %q", want, roots)
+		}
+		for _, want := range []string{missing("bar"), missing("baz")} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("expected report to name %s, got %v", want, err)
+			}
+		}
+
+		// Nothing is fetched when a remote is unreachable.
+		if _, err := os.Stat(filepath.Join(project, "vendor")); !os.IsNotExist(err) {
+			t.Errorf("expected nothing to be vendored, got %v", err)
+		}
+	})
+}
+
+func TestVendorResolvedManifest(t *testing.T) {
+	withCache(t, func(t *testing.T, c *cache) {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		files := []file{{"foo.go", "package foo"}, {"bar", ""}, {"bar/bar.go", "package bar"}}
+		remote := filepath.Join(dir, "remote")
+		rev := gitRepo(t, remote, files)
+
+		project := filepath.Join(dir, "project")
+		writeFiles(t, dir, []file{{"project", ""}, {"project/Godeps", ""}})
+		godeps := `{
+	"ImportPath": "example.com/project",
+	"Deps": [
+		{"ImportPath": "example.com/foo", "Rev": "` + rev + `"},
+		{"ImportPath": "example.com/foo/bar", "Rev": "` + rev + `"}
+	]
+}`
+		writeFiles(t, project, []file{{"Godeps/Godeps.json", godeps}})
+
+		// Packages are resolved concurrently.
+		var (
+			mu      sync.Mutex
+			lookups []string
+		)
+		r := resolverFunc(func(ctx context.Context, pkg string) (*pkgMeta, error) {
+			mu.Lock()
+			lookups = append(lookups, pkg)
+			mu.Unlock()
+			return &pkgMeta{Root: "example.com/foo", VCS: "git", Remote: "file://" + filepath.ToSlash(remote)}, nil
+		})
+		pins, err := resolveManifest(r, filepath.Join(project, "Godeps", "Godeps.json"), replaceTarget)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(lookups)
+		if want := []string{"example.com/foo", "example.com/foo/bar"}; !reflect.DeepEqual(lookups, want) {
+			t.Errorf("expected %q to be resolved with the fake resolver, got %q", want, lookups)
+		}
+		if err := writeManifest(filepath.Join(project, ManifestFile), pins); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := vendorManifest(context.Background(), c, project, getOptions{retry: backoff{}}); err != nil {
+			t.Fatal(err)
+		}
+		compareFiles(t, filepath.Join(project, "vendor", "example.com", "foo"), files)
+	})
+}
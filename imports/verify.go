@@ -0,0 +1,54 @@
+package imports
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Verify checks the vendored copy of every repo pinned by the manifest of the
+// project in dir against the files and tree hash recorded for it, without
+// fetching anything, and returns the roots of the repos that don't match,
+// sorted. Repos without recorded files were never vendored, so they don't
+// match either.
+func Verify(dir string) ([]string, error) {
+	return verifyVendor(dir, 0)
+}
+
+// verifyVendor checks up to workers vendored copies at once, see forEach. The
+// result doesn't depend on the number of workers.
+func verifyVendor(dir string, workers int) ([]string, error) {
+	filename := filepath.Join(dir, ManifestFile)
+	pins, err := readManifest(filename)
+	if err != nil {
+		return nil, err
+	}
+	if pins == nil {
+		return nil, errors.Errorf("no manifest found at %s", filename)
+	}
+
+	vendor := filepath.Join(dir, "vendor")
+	roots := pinRoots(vendor, pins)
+	ok := make([]bool, len(pins))
+	err = forEach(len(pins), workers, func(i int) error {
+		complete, err := isComplete(vendor, pins[i], roots, true)
+		if err != nil {
+			return errors.Wrapf(err, "checking vendored files of %s", pins[i].Root)
+		}
+		ok[i] = complete
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var mismatched []string
+	for i, p := range pins {
+		if !ok[i] {
+			mismatched = append(mismatched, p.Root)
+		}
+	}
+	sort.Strings(mismatched)
+	return mismatched, nil
+}
@@ -0,0 +1,119 @@
+package imports
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeSyntheticProject writes a project into dir vendoring repos repos with
+// pkgs packages each, and a manifest recording their files and tree hashes.
+// The project only imports every other package of every other repo.
+func writeSyntheticProject(t testing.TB, dir string, repos, pkgs int) {
+	files := []file{{"vendor", ""}, {"vendor/example.com", ""}}
+	var pins []Pin
+	var imports []string
+	for r := 0; r < repos; r++ {
+		root := fmt.Sprintf("example.com/repo%d", r)
+		files = append(files, file{"vendor/" + root, ""}, file{"vendor/" + root + "/LICENSE", "license"})
+		p := Pin{Root: root, Remote: "https://" + root, VCS: "git", Version: "v1", Files: []string{"LICENSE"}}
+		for k := 0; k < pkgs; k++ {
+			pkg := fmt.Sprintf("pkg%d", k)
+			files = append(files,
+				file{"vendor/" + root + "/" + pkg, ""},
+				file{"vendor/" + root + "/" + pkg + "/" + pkg + ".go", "package " + pkg},
+			)
+			p.Files = append(p.Files, pkg+"/"+pkg+".go")
+			if r%2 == 0 && k%2 == 0 {
+				imports = append(imports, fmt.Sprintf("\t_ %q\n", root+"/"+pkg))
+			}
+		}
+		sort.Strings(p.Files)
+		pins = append(pins, p)
+	}
+	files = append(files,
+		file{"go.mod", "module example.com/project\n"},
+		file{"main.go", "package main\n\nimport (\n" + strings.Join(imports, "") + ")\n"},
+	)
+	writeFiles(t, dir, files)
+
+	hashes, err := hashTrees(filepath.Join(dir, "vendor"), pins, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range pins {
+		pins[i].Hash = hashes[i]
+	}
+	if err := writeManifest(filepath.Join(dir, ManifestFile), pins); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyVendor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeSyntheticProject(t, dir, 8, 4)
+
+	for _, workers := range []int{1, 8} {
+		mismatched, err := verifyVendor(dir, workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(mismatched) != 0 {
+			t.Errorf("workers=%d: expected every repo to match, got %q", workers, mismatched)
+		}
+	}
+
+	vendor := filepath.Join(dir, "vendor", "example.com")
+	writeFiles(t, vendor, []file{{"repo1/pkg0/pkg0.go", "package modified"}})
+	if err := os.Remove(filepath.Join(vendor, "repo6", "LICENSE")); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, vendor, []file{{"repo3/extra.go", "package repo3"}})
+	pins, err := readManifest(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pins = append(pins, Pin{Root: "example.com/unvendored", Remote: "https://example.com/unvendored", VCS: "git", Version: "v1"})
+	if err := writeManifest(filepath.Join(dir, ManifestFile), pins); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"example.com/repo1", "example.com/repo3", "example.com/repo6", "example.com/unvendored"}
+	for _, workers := range []int{1, 8} {
+		mismatched, err := verifyVendor(dir, workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(mismatched, want) {
+			t.Errorf("workers=%d: expected mismatched repos %q, got %q", workers, want, mismatched)
+		}
+	}
+}
+
+func BenchmarkVerifyVendor(b *testing.B) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeSyntheticProject(b, dir, 32, 16)
+
+	for _, workers := range []int{1, 0} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := verifyVendor(dir, workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
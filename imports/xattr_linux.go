@@ -0,0 +1,80 @@
+package imports
+
+import (
+	"bytes"
+	"syscall"
+)
+
+// copyXattrs copies the extended attributes of one file to another. If the
+// filesystem of either file doesn't support extended attributes, it does
+// nothing. Attributes the process isn't allowed to read or set, such as those
+// in the security and trusted namespaces for unprivileged users, are skipped.
+func copyXattrs(to, from string) error {
+	names, err := listXattrs(from)
+	if err != nil {
+		if err == syscall.ENOTSUP {
+			return nil
+		}
+		return err
+	}
+
+	for _, name := range names {
+		value, err := getXattr(from, name)
+		if err != nil {
+			if xattrDenied(err) {
+				continue
+			}
+			return err
+		}
+		if err := syscall.Setxattr(to, name, value, 0); err != nil {
+			if err == syscall.ENOTSUP {
+				return nil
+			}
+			if xattrDenied(err) {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// xattrDenied reports whether err is the result of lacking permission to
+// read or set an extended attribute.
+func xattrDenied(err error) bool {
+	return err == syscall.EPERM || err == syscall.EACCES
+}
+
+func listXattrs(path string) ([]string, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	// Names are returned as a list of null terminated strings.
+	var names []string
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names, nil
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	size, err := syscall.Getxattr(path, name, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	size, err = syscall.Getxattr(path, name, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:size], nil
+}
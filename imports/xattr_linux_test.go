@@ -0,0 +1,68 @@
+package imports
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestCopyDirXattrs(t *testing.T) {
+	src, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	dest, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+
+	writeFiles(t, src, []file{{"foo.go", "package foo"}, {"bar.go", "package foo"}})
+
+	const name, value = "user.got.test", "hello"
+	for _, f := range []string{"foo.go", "bar.go"} {
+		if err := syscall.Setxattr(filepath.Join(src, f), name, []byte(value), 0); err != nil {
+			t.Skipf("filesystem doesn't support extended attributes: %v", err)
+		}
+	}
+	// Extended attributes of read-only files are copied too.
+	if err := os.Chmod(filepath.Join(src, "bar.go"), 0444); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := copyDir(dest, src, copyOptions{xattrs: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []string{"foo.go", "bar.go"} {
+		got, err := getXattr(filepath.Join(dest, f), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != value {
+			t.Errorf("%s: expected extended attribute %s=%q, got %q", f, name, value, got)
+		}
+	}
+	info, err := os.Stat(filepath.Join(dest, "bar.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0444 {
+		t.Errorf("expected read-only copy to keep mode 0444, got %#o", mode)
+	}
+}
+
+func TestXattrDenied(t *testing.T) {
+	for _, err := range []error{syscall.EPERM, syscall.EACCES} {
+		if !xattrDenied(err) {
+			t.Errorf("expected %v to be skipped", err)
+		}
+	}
+	if xattrDenied(syscall.EIO) {
+		t.Errorf("expected %v not to be skipped", syscall.EIO)
+	}
+}
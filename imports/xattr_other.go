@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package imports
+
+// copyXattrs is a no-op on platforms where extended attributes aren't
+// supported.
+func copyXattrs(to, from string) error { return nil }
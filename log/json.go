@@ -0,0 +1,85 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// NewJSON returns a logger which writes one JSON object per message to
+// stderr, for consumption by other programs such as CI systems.
+func NewJSON(level int) Logger {
+	return NewJSONWriter(level, os.Stderr)
+}
+
+// NewJSONWriter returns a logger which writes one JSON object per message to
+// w. Each object holds the message's "level", "time" and "msg", along with
+// the "fields" set by With, if any.
+func NewJSONWriter(level int, w io.Writer) Logger {
+	return &jsonLogger{level: level, w: w, now: time.Now, mu: new(sync.Mutex)}
+}
+
+type jsonLogger struct {
+	level int
+	now   func() time.Time
+	// fields are set by With.
+	fields map[string]interface{}
+
+	// mu serializes writes so concurrent messages aren't interleaved. It's
+	// shared with the loggers returned by With.
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+// jsonEntry is a single message written by a jsonLogger.
+type jsonEntry struct {
+	Level  string                 `json:"level"`
+	Time   time.Time              `json:"time"`
+	Msg    string                 `json:"msg"`
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+func (l *jsonLogger) Infof(format string, v ...interface{})  { l.print(Info, format, v...) }
+func (l *jsonLogger) Debugf(format string, v ...interface{}) { l.print(Debug, format, v...) }
+func (l *jsonLogger) Errorf(format string, v ...interface{}) { l.print(Error, format, v...) }
+
+func (l *jsonLogger) With(key string, value interface{}) Logger {
+	child := *l
+	child.fields = make(map[string]interface{}, len(l.fields)+1)
+	for k, v := range l.fields {
+		child.fields[k] = v
+	}
+	child.fields[key] = value
+	return &child
+}
+
+// levelNames are the names of levels in JSON messages.
+var levelNames = map[int]string{
+	Error: "error",
+	Info:  "info",
+	Debug: "debug",
+}
+
+func (l *jsonLogger) print(level int, format string, v ...interface{}) {
+	if l.level < level {
+		return
+	}
+	b, err := json.Marshal(jsonEntry{levelNames[level], l.now(), fmt.Sprintf(format, v...), l.fields})
+	if err != nil {
+		// A field can't be represented, fall back to formatting them.
+		fields := make(map[string]interface{}, len(l.fields))
+		for k, v := range l.fields {
+			fields[k] = fmt.Sprint(v)
+		}
+		b, err = json.Marshal(jsonEntry{levelNames[level], l.now(), fmt.Sprintf(format, v...), fields})
+		if err != nil {
+			return
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(append(b, '\n'))
+}
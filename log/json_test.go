@@ -0,0 +1,82 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJSONLogger(t *testing.T) {
+	now := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		level int
+		want  []map[string]string
+	}{
+		{Silent, nil},
+		{Error, []map[string]string{
+			{"level": "error", "time": "2018-01-02T03:04:05Z", "msg": "error 3"},
+		}},
+		{Info, []map[string]string{
+			{"level": "info", "time": "2018-01-02T03:04:05Z", "msg": "info 1"},
+			{"level": "error", "time": "2018-01-02T03:04:05Z", "msg": "error 3"},
+		}},
+		{Debug, []map[string]string{
+			{"level": "info", "time": "2018-01-02T03:04:05Z", "msg": "info 1"},
+			{"level": "debug", "time": "2018-01-02T03:04:05Z", "msg": "debug \"2\""},
+			{"level": "error", "time": "2018-01-02T03:04:05Z", "msg": "error 3"},
+		}},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		l := NewJSONWriter(test.level, &buf).(*jsonLogger)
+		l.now = func() time.Time { return now }
+		l.Infof("info %d", 1)
+		l.Debugf("debug %q", "2")
+		l.Errorf("error %d", 3)
+
+		var got []map[string]string
+		for _, line := range bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n")) {
+			if len(line) == 0 {
+				continue
+			}
+			var entry map[string]string
+			if err := json.Unmarshal(line, &entry); err != nil {
+				t.Fatalf("level %d: parsing %q: %v", test.level, line, err)
+			}
+			got = append(got, entry)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("level %d: expected %v, got %v", test.level, test.want, got)
+		}
+	}
+}
+
+func TestJSONLoggerWith(t *testing.T) {
+	var buf bytes.Buffer
+	parent := NewJSONWriter(Info, &buf)
+	child := parent.With("pkg", "go4.org/lock").With("attempt", 2)
+	child.Infof("fetching")
+	parent.Infof("done")
+
+	type entry struct {
+		Msg    string                 `json:"msg"`
+		Fields map[string]interface{} `json:"fields"`
+	}
+	var got []entry
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var e entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			t.Fatalf("parsing %q: %v", line, err)
+		}
+		got = append(got, e)
+	}
+	want := []entry{
+		{"fetching", map[string]interface{}{"pkg": "go4.org/lock", "attempt": 2.0}},
+		{"done", nil},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
@@ -1,6 +1,8 @@
 package log
 
 import (
+	"fmt"
+	"io"
 	"log"
 	"os"
 )
@@ -20,19 +22,30 @@ type Logger interface {
 	Infof(format string, v ...interface{})
 	Debugf(format string, v ...interface{})
 	Errorf(format string, v ...interface{})
+
+	// With returns a logger that prefixes all its messages with the
+	// key/value pair, on top of the fields of this logger, which is left
+	// unchanged.
+	With(key string, value interface{}) Logger
 }
 
+// New returns a logger which writes to stderr.
 func New(level int) Logger {
+	return NewWriter(level, os.Stderr)
+}
+
+// NewWriter returns a logger which writes to w, such as a RotatingFile.
+func NewWriter(level int, w io.Writer) Logger {
 	const flags = log.LstdFlags
 	l := &logger{}
 	if level >= Error {
-		l.error = log.New(os.Stderr, "[error] ", flags)
+		l.error = log.New(w, "[error] ", flags)
 	}
 	if level >= Info {
-		l.info = log.New(os.Stderr, "[info] ", flags)
+		l.info = log.New(w, "[info] ", flags)
 	}
 	if level >= Debug {
-		l.debug = log.New(os.Stderr, "[debug] ", flags)
+		l.debug = log.New(w, "[debug] ", flags)
 	}
 	return l
 }
@@ -41,14 +54,24 @@ type logger struct {
 	info  *log.Logger
 	debug *log.Logger
 	error *log.Logger
+
+	// fields are the "key=value" pairs set by With, each followed by a
+	// space.
+	fields string
 }
 
-func (l *logger) Infof(format string, v ...interface{})  { print(l.info, format, v...) }
-func (l *logger) Debugf(format string, v ...interface{}) { print(l.debug, format, v...) }
-func (l *logger) Errorf(format string, v ...interface{}) { print(l.error, format, v...) }
+func (l *logger) Infof(format string, v ...interface{})  { print(l.info, l.fields, format, v...) }
+func (l *logger) Debugf(format string, v ...interface{}) { print(l.debug, l.fields, format, v...) }
+func (l *logger) Errorf(format string, v ...interface{}) { print(l.error, l.fields, format, v...) }
+
+func (l *logger) With(key string, value interface{}) Logger {
+	child := *l
+	child.fields = l.fields + fmt.Sprintf("%s=%v ", key, value)
+	return &child
+}
 
-func print(l *log.Logger, format string, v ...interface{}) {
+func print(l *log.Logger, fields, format string, v ...interface{}) {
 	if l != nil {
-		l.Printf(format, v...)
+		l.Print(fields + fmt.Sprintf(format, v...))
 	}
 }
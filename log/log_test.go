@@ -1,6 +1,10 @@
 package log
 
-import "testing"
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
 
 func TestLevel(t *testing.T) {
 	l := New(Info).(*logger)
@@ -8,3 +12,24 @@ func TestLevel(t *testing.T) {
 		t.Errorf("expected log level 'Info' to disable debug logging")
 	}
 }
+
+func TestWith(t *testing.T) {
+	var buf bytes.Buffer
+	parent := NewWriter(Info, &buf)
+	child := parent.With("pkg", "go4.org/lock").With("attempt", 2)
+
+	child.Infof("fetching %s", "https://go4.org/lock")
+	parent.Infof("done")
+	child.Debugf("not logged")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", lines)
+	}
+	if want := "pkg=go4.org/lock attempt=2 fetching https://go4.org/lock"; !strings.HasSuffix(lines[0], want) {
+		t.Errorf("expected child message to end with %q, got %q", want, lines[0])
+	}
+	if !strings.HasSuffix(lines[1], " done") || strings.Contains(lines[1], "pkg=") {
+		t.Errorf("expected parent message without fields, got %q", lines[1])
+	}
+}
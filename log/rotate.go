@@ -0,0 +1,131 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// RotatingFile is an io.Writer that appends to a file, rotating it once it
+// grows past a configured size. Rotated files are named by appending a
+// numeric suffix to the filename, "got.log.1" being the most recent.
+type RotatingFile struct {
+	name    string
+	maxSize int64
+	keep    int
+
+	mu sync.Mutex
+	// f is nil if the file couldn't be reopened after rotating, in which
+	// case the next write tries again.
+	f    *os.File
+	size int64
+}
+
+// NewRotatingFile opens or creates the named file for appending. If maxSize
+// is greater than zero, the file is rotated before a write would cause it to
+// exceed maxSize bytes, and at most keep rotated files are retained.
+func NewRotatingFile(name string, maxSize int64, keep int) (*RotatingFile, error) {
+	r := &RotatingFile{name: name, maxSize: maxSize, keep: keep}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrap(err, "opening log file")
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.Wrap(err, "stat log file")
+	}
+	r.f = f
+	r.size = info.Size()
+	return nil
+}
+
+// Write writes p to the current log file, rotating first if needed. If
+// rotating fails, p is still appended to the current file, so no messages are
+// lost, and the rotation error is returned.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var rerr error
+	if r.f != nil && r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		rerr = r.rotate()
+	}
+	if r.f == nil {
+		if err := r.open(); err != nil {
+			if rerr != nil {
+				return 0, rerr
+			}
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	if err == nil {
+		err = rerr
+	}
+	return n, err
+}
+
+// rotate moves the current file aside and opens a new one. Whether or not
+// that succeeds, a file is reopened at the original name, leaving r.f nil only
+// if that fails too.
+func (r *RotatingFile) rotate() error {
+	err := r.f.Close()
+	r.f = nil
+	if err != nil {
+		err = errors.Wrap(err, "closing log file")
+	} else {
+		err = r.shift()
+	}
+	if oerr := r.open(); oerr != nil && err == nil {
+		err = oerr
+	}
+	return err
+}
+
+// shift renames the closed log file to the first rotated name, renaming
+// older files to make room.
+func (r *RotatingFile) shift() error {
+	if r.keep <= 0 {
+		if err := os.Remove(r.name); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "removing log file")
+		}
+		return nil
+	}
+
+	// Shift "name.N-1" to "name.N", dropping the oldest file.
+	for i := r.keep - 1; i > 0; i-- {
+		from, to := r.rotated(i), r.rotated(i+1)
+		if err := os.Rename(from, to); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "rotating log file")
+		}
+	}
+	if err := os.Rename(r.name, r.rotated(1)); err != nil {
+		return errors.Wrap(err, "rotating log file")
+	}
+	return nil
+}
+
+func (r *RotatingFile) rotated(n int) string {
+	return fmt.Sprintf("%s.%d", r.name, n)
+}
+
+// Close closes the current log file.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	return r.f.Close()
+}
@@ -0,0 +1,121 @@
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "got.log")
+	r, err := NewRotatingFile(name, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, msg := range []string{"aaaaaa\n", "bbbbbb\n", "cccccc\n", "dddddd\n"} {
+		if _, err := r.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]string{
+		"got.log":   "dddddd\n",
+		"got.log.1": "cccccc\n",
+		"got.log.2": "bbbbbb\n",
+	}
+	for file, data := range want {
+		got, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Errorf("reading %s: %v", file, err)
+			continue
+		}
+		if string(got) != data {
+			t.Errorf("expected %s to contain %q, got %q", file, data, got)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "got.log.3")); !os.IsNotExist(err) {
+		t.Errorf("expected only 2 rotated files to be kept")
+	}
+}
+
+func TestRotatingFileLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "got.log")
+	r, err := NewRotatingFile(name, 100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	l := NewWriter(Info, r)
+	for i := 0; i < 10; i++ {
+		l.Infof("message %d", i)
+	}
+
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "message 9") {
+		t.Errorf("expected newest log to contain latest message, got %q", data)
+	}
+	if _, err := os.Stat(name + ".1"); err != nil {
+		t.Errorf("expected log file to be rotated: %v", err)
+	}
+}
+
+func TestRotatingFileFailedRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A non-empty directory in the way of the rotated file makes renaming
+	// the log file fail.
+	name := filepath.Join(dir, "got.log")
+	if err := os.MkdirAll(filepath.Join(name+".1", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRotatingFile(name, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if _, err := r.Write([]byte("aaaaaa\n")); err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{"bbbbbb\n", "cccccc\n"} {
+		n, err := r.Write([]byte(msg))
+		if err == nil {
+			t.Errorf("expected rotating to fail")
+		}
+		if n != len(msg) {
+			t.Errorf("expected %q to be written despite the failed rotation, wrote %d bytes", msg, n)
+		}
+	}
+
+	got, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "aaaaaa\nbbbbbb\ncccccc\n"; string(got) != want {
+		t.Errorf("expected log file to contain %q, got %q", want, got)
+	}
+}